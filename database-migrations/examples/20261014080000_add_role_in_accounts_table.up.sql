@@ -0,0 +1,2 @@
+ALTER TABLE accounts
+ADD role VARCHAR(20) NOT NULL DEFAULT 'user';
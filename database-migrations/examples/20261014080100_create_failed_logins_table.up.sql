@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS failed_logins (
+  id SERIAL PRIMARY KEY,
+  identifier VARCHAR(150) NOT NULL,
+  ip_address VARCHAR(45),
+  reason VARCHAR(50) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS failed_logins_identifier_idx ON failed_logins (identifier);
+CREATE INDEX IF NOT EXISTS failed_logins_ip_address_idx ON failed_logins (ip_address);
+CREATE INDEX IF NOT EXISTS failed_logins_created_at_idx ON failed_logins (created_at);
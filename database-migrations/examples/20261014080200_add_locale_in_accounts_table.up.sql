@@ -0,0 +1,2 @@
+ALTER TABLE accounts
+ADD locale VARCHAR(10) NOT NULL DEFAULT 'en';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS accounts_display_name_idx;
+
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,4 @@
+ALTER TABLE accounts
+ADD display_name VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS accounts_display_name_idx ON accounts (LOWER(TRIM(display_name)));
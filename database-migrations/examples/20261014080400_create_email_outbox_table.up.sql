@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS email_outbox (
+  id SERIAL PRIMARY KEY,
+  recipient VARCHAR(150) NOT NULL,
+  locale VARCHAR(10) NOT NULL DEFAULT 'en',
+  template VARCHAR(50) NOT NULL,
+  data TEXT,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  attempts INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS email_outbox_status_idx ON email_outbox (status, id);
@@ -0,0 +1,3 @@
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS terms_version,
+DROP COLUMN IF EXISTS terms_accepted_at;
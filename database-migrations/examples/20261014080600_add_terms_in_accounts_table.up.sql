@@ -0,0 +1,3 @@
+ALTER TABLE accounts
+ADD terms_version VARCHAR(20),
+ADD terms_accepted_at TIMESTAMP;
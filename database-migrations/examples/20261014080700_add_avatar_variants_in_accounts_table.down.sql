@@ -0,0 +1,3 @@
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS avatar_variants,
+DROP COLUMN IF EXISTS avatar_processing;
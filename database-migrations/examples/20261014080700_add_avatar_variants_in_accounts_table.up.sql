@@ -0,0 +1,3 @@
+ALTER TABLE accounts
+ADD avatar_variants TEXT,
+ADD avatar_processing BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,4 @@
+ALTER TABLE accounts
+ADD password_changed_at TIMESTAMP;
+
+UPDATE accounts SET password_changed_at = created_at;
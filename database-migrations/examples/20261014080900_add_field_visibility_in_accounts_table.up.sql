@@ -0,0 +1,2 @@
+ALTER TABLE accounts
+ADD field_visibility TEXT;
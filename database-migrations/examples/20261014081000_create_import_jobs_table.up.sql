@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS import_jobs (
+  id SERIAL PRIMARY KEY,
+  created_by INT NOT NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  total INT NOT NULL DEFAULT 0,
+  processed INT NOT NULL DEFAULT 0,
+  succeeded INT NOT NULL DEFAULT 0,
+  failed INT NOT NULL DEFAULT 0,
+  errors TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  completed_at TIMESTAMP
+);
@@ -0,0 +1,2 @@
+ALTER TABLE accounts
+ADD permissions TEXT;
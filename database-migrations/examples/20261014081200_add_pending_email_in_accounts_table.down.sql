@@ -0,0 +1,6 @@
+ALTER TABLE verification_tokens
+DROP COLUMN IF EXISTS purpose;
+
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS pending_email,
+DROP COLUMN IF EXISTS pending_email_expires_at;
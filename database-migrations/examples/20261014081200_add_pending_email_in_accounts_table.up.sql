@@ -0,0 +1,6 @@
+ALTER TABLE accounts
+ADD pending_email VARCHAR(150),
+ADD pending_email_expires_at TIMESTAMP;
+
+ALTER TABLE verification_tokens
+ADD purpose VARCHAR(20) NOT NULL DEFAULT 'verification';
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_logs (
+  id SERIAL PRIMARY KEY,
+  actor_id INT NOT NULL,
+  action VARCHAR(50) NOT NULL,
+  target_id INT NOT NULL,
+  ip_address VARCHAR(45),
+  metadata TEXT,
+  prev_hash VARCHAR(64) NOT NULL DEFAULT '',
+  hash VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_logs_target_id_idx ON audit_logs (target_id, id);
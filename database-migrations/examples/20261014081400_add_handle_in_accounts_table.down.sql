@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS accounts_handle_idx;
+
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS handle;
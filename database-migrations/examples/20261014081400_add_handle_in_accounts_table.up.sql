@@ -0,0 +1,9 @@
+ALTER TABLE accounts
+ADD handle VARCHAR(60);
+
+UPDATE accounts SET handle = 'user-' || id WHERE handle IS NULL;
+
+ALTER TABLE accounts
+ALTER COLUMN handle SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_handle_idx ON accounts (handle);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS failed_registrations (
+  id SERIAL PRIMARY KEY,
+  fingerprint VARCHAR(64) NOT NULL,
+  reason VARCHAR(50) NOT NULL,
+  fields TEXT NOT NULL DEFAULT '[]',
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS failed_registrations_fingerprint_idx ON failed_registrations (fingerprint);
+CREATE INDEX IF NOT EXISTS failed_registrations_created_at_idx ON failed_registrations (created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE accounts
+ADD weak_password_rules TEXT;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS handle_redirects (
+  id SERIAL PRIMARY KEY,
+  handle VARCHAR(60) NOT NULL UNIQUE,
+  account_id INT NOT NULL REFERENCES accounts (id),
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS handle_redirects_account_id_idx ON handle_redirects (account_id);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+  id SERIAL PRIMARY KEY,
+  account_id INT NOT NULL REFERENCES accounts (id),
+  url VARCHAR(500) NOT NULL,
+  secret VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_account_id_idx ON webhooks (account_id);
@@ -0,0 +1,2 @@
+ALTER TABLE verification_tokens
+ADD seed VARCHAR(64) NOT NULL DEFAULT '';
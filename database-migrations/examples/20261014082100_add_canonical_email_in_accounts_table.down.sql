@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS accounts_canonical_email_idx;
+
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS canonical_email;
@@ -0,0 +1,13 @@
+ALTER TABLE accounts
+ADD canonical_email VARCHAR(150);
+
+-- backfill with the default EMAIL_CANONICAL_PROVIDERS, other domains are only lowercased
+UPDATE accounts
+SET canonical_email = CASE
+    WHEN lower(split_part(email, '@', 2)) IN ('gmail.com', 'googlemail.com')
+    THEN replace(split_part(lower(split_part(email, '@', 1)), '+', 1), '.', '') || '@gmail.com'
+    ELSE lower(email)
+END
+WHERE email IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS accounts_canonical_email_idx ON accounts (canonical_email);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS storage_usages (
+  id SERIAL PRIMARY KEY,
+  account_id INT NOT NULL REFERENCES accounts (id),
+  artifact VARCHAR(20) NOT NULL,
+  bytes BIGINT NOT NULL DEFAULT 0,
+  objects INT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  UNIQUE (account_id, artifact)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS sessions (
+  id SERIAL PRIMARY KEY,
+  account_id INT NOT NULL REFERENCES accounts (id),
+  ip_address VARCHAR(45) NOT NULL,
+  user_agent VARCHAR(300) NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_account_id_expires_at_idx ON sessions (account_id, expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE accounts
+ADD checksum VARCHAR(64) NOT NULL DEFAULT '';
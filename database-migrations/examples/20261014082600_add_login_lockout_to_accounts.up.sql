@@ -0,0 +1,3 @@
+ALTER TABLE accounts
+ADD failed_login_count INT NOT NULL DEFAULT 0,
+ADD locked_until TIMESTAMP;
@@ -0,0 +1,2 @@
+-- the original spelling of a normalized phone number is not kept, nothing to undo
+SELECT 1;
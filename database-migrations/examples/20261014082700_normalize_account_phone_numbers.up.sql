@@ -0,0 +1,17 @@
+-- rewrite stored 08.., 628.. and +628.. numbers to +628.., rows whose +62 form is already taken are left for review
+WITH normalized AS (
+  SELECT id, '+62' || substring(regexp_replace(phone_number, '[ .()-]', '', 'g') FROM '^(?:\+62|62|0)(8[0-9]{8,11})$') AS canonical
+  FROM accounts
+  WHERE phone_number IS NOT NULL
+), firsts AS (
+  SELECT DISTINCT ON (canonical) id, canonical
+  FROM normalized
+  WHERE canonical IS NOT NULL
+  ORDER BY canonical, id
+)
+UPDATE accounts
+SET phone_number = firsts.canonical
+FROM firsts
+WHERE accounts.id = firsts.id
+  AND accounts.phone_number <> firsts.canonical
+  AND NOT EXISTS (SELECT 1 FROM accounts other WHERE other.phone_number = firsts.canonical);
@@ -0,0 +1,4 @@
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS status,
+DROP COLUMN IF EXISTS suspension_reason,
+DROP COLUMN IF EXISTS suspended_at;
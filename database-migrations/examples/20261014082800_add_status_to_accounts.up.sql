@@ -0,0 +1,4 @@
+ALTER TABLE accounts
+ADD status VARCHAR(20) NOT NULL DEFAULT 'active',
+ADD suspension_reason VARCHAR(255),
+ADD suspended_at TIMESTAMP;
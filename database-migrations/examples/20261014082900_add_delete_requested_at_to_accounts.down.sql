@@ -0,0 +1,3 @@
+UPDATE accounts SET status = 'active' WHERE status = 'pending_deletion';
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS delete_requested_at;
@@ -0,0 +1,2 @@
+ALTER TABLE accounts
+ADD delete_requested_at TIMESTAMP;
@@ -0,0 +1,4 @@
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS totp_secret,
+DROP COLUMN IF EXISTS totp_enabled_at,
+DROP COLUMN IF EXISTS totp_last_step;
@@ -0,0 +1,4 @@
+ALTER TABLE accounts
+ADD totp_secret VARCHAR(255),
+ADD totp_enabled_at TIMESTAMP,
+ADD totp_last_step BIGINT NOT NULL DEFAULT 0;
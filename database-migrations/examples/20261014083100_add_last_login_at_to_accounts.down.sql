@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS accounts_last_activity_idx;
+
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS last_login_at;
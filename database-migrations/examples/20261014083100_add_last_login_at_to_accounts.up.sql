@@ -0,0 +1,4 @@
+ALTER TABLE accounts
+ADD last_login_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS accounts_last_activity_idx ON accounts ((COALESCE(last_login_at, created_at)));
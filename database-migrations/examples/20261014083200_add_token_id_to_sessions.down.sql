@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS sessions_token_id_idx;
+
+ALTER TABLE sessions
+DROP COLUMN IF EXISTS revoked_at,
+DROP COLUMN IF EXISTS token_id;
@@ -0,0 +1,5 @@
+ALTER TABLE sessions
+ADD token_id VARCHAR(64),
+ADD revoked_at TIMESTAMP;
+
+CREATE UNIQUE INDEX IF NOT EXISTS sessions_token_id_idx ON sessions (token_id) WHERE token_id IS NOT NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS accounts_lower_email_idx;
@@ -0,0 +1,2 @@
+-- emails are matched ignoring the case, a unique index needs the existing case duplicates merged first
+CREATE INDEX IF NOT EXISTS accounts_lower_email_idx ON accounts (LOWER(email));
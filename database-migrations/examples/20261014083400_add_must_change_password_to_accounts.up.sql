@@ -0,0 +1,3 @@
+-- set when an admin resets the password, cleared once the owner chooses a new one
+ALTER TABLE accounts
+ADD must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
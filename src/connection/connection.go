@@ -24,6 +24,18 @@ func DBMaster() *gorm.DB {
 	return db
 }
 
+// Close closes the database connection pool if it was opened, it is called once on shutdown
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 func dbConnection(hostType, dbName string) *gorm.DB {
 	port := os.Getenv("DB_POSTGRES_PORT")
 	postgresCon := fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s",
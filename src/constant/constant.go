@@ -3,6 +3,10 @@ package constant
 import (
 	"errors"
 	"os"
+	"time"
+
+	"go-rest-api/src/pkg/env"
+	"go-rest-api/src/pkg/passwordpolicy"
 
 	"github.com/joho/godotenv"
 )
@@ -17,33 +21,569 @@ const (
 	FilterByYear               = "year"
 	StatusCheckIn              = "check-in"
 	StatusCheckOut             = "check-out"
+	RoleAdmin                  = "admin"
+	RoleUser                   = "user"
+	// a suspended account keeps its data but cannot log in or use its tokens,
+	// a pending deletion is hidden from other accounts until the owner cancels it or it is purged
+	AccountStatusActive          = "active"
+	AccountStatusSuspended       = "suspended"
+	AccountStatusPendingDeletion = "pending_deletion"
+	// a date of birth more than DOBMaxAgeYears ago is rejected as implausible
+	DOBMaxAgeYears = 120
+	// two factor codes of the steps right before and after the current one are accepted for clock skew
+	TOTPSkewSteps = 1
+
+	// capabilities
+	FeatureTwoFactor         = "two_factor"
+	FeatureOAuth             = "oauth"
+	FeatureInviteOnly        = "invite_only"
+	FeatureProfileReplace    = "profile_replace"
+	FeatureUpdateRateLimit   = "update_rate_limit"
+	FeatureLocalizedNotices  = "localized_notifications"
+	FeatureUniqueDisplayName = "unique_display_name"
+
+	// export
+	ExportBatchSize = 500
+
+	// health checks
+	HealthCheckDatabase = "database"
+	HealthStatusUp      = "up"
+	HealthStatusDown    = "down"
+	HealthStatusTimeout = "timeout"
+
+	// gin context keys
+	AccountIDKey = "account_id"
+	RoleKey      = "role"
+	RequestIDKey = "request_id"
+
+	// account list
+	AccountListDefaultLimit = 20
+	AccountListMaxLimit     = 100
+	SortOrderAsc            = "asc"
+	SortOrderDesc           = "desc"
+
+	// me bundle sections
+	BundleSectionProfile     = "profile"
+	BundleSectionPreferences = "preferences"
+	BundleSectionPermissions = "permissions"
+	BundleSectionSessions    = "sessions"
+
+	// stored artifacts
+	StorageArtifactAvatar = "avatar"
+
+	// DefaultPhotoURL is the placeholder avatar of accounts that never uploaded one
+	DefaultPhotoURL = "https://thumbs.dreamstime.com/b/user-profile-avatar-solid-black-line-icon-simple-vector-filled-flat-pictogram-isolated-white-background-134042540.jpg"
+
+	// webhooks
+	WebhookAttempts            = 3
+	WebhookEventAccountUpdated = "account.updated"
+	WebhookEventAccountDeleted = "account.deleted"
+
+	// deletion webhook modes
+	DeletionWebhookFireAndForget = "fire_and_forget"
+	DeletionWebhookRequireAck    = "require_ack"
+
+	// bulk import
+	BulkImportMaxRows = 500
+	// sync imports hash every password within the request, so they take fewer rows
+	BulkCreateSyncMaxRows      = 100
+	ImportJobStatusPending     = "pending"
+	ImportJobStatusRunning     = "running"
+	ImportJobStatusCompleted   = "completed"
+	ImportJobStatusInterrupted = "interrupted"
+
+	// outbox
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusFailed  = "failed"
+	OutboxMaxAttempts   = 5
+	OutboxBatchSize     = 100
+
+	// failed login reasons
+	LoginFailureAccountNotRegistered = "account_not_registered"
+	LoginFailureInvalidPassword      = "invalid_password"
+	LoginFailureLocked               = "locked"
+	LoginFailureInvalidTOTPCode      = "invalid_totp_code"
+
+	// rejected token reasons of the auth_failures_total metric, logins use the failed login reasons
+	AuthFailureMissingToken      = "missing_token"
+	AuthFailureMalformedToken    = "malformed_token"
+	AuthFailureInvalidSignature  = "invalid_signature"
+	AuthFailureTokenExpired      = "token_expired"
+	AuthFailureTokenRevoked      = "token_revoked"
+	AuthFailureForeignAccountID  = "foreign_account_id"
+	AuthFailureInvalidToken      = "invalid_token"
+	AuthFailureAccountUnverified = "account_not_verified"
+	AuthFailureAccountSuspended  = "account_suspended"
+	AuthFailurePasswordChange    = "password_change_required"
+
+	// login diagnosis reasons, unverified, password_expired and password_change_required do not reject
+	// the login but are reported since they restrict what the session can do
+	LoginDiagnosisAccountNotFound  = "account_not_found"
+	LoginDiagnosisUnverified       = "unverified"
+	LoginDiagnosisLocked           = "locked"
+	LoginDiagnosisSuspended        = "suspended"
+	LoginDiagnosisPasswordExpired  = "password_expired"
+	LoginDiagnosisPasswordChange   = "password_change_required"
+	LoginDiagnosisTermsNotAccepted = "terms_not_accepted"
+
+	// failed registration reasons
+	RegistrationFailureInvalidFormat    = "invalid_format"
+	RegistrationFailureValidation       = "validation_failed"
+	RegistrationFailureTermsNotAccepted = "terms_not_accepted"
+	RegistrationFailureConflict         = "conflict"
+	RegistrationFailureHoneypot         = "honeypot"
+
+	// audit
+	AuditChainLockKey        = 7154201
+	AuditVerifyBatchSize     = 500
+	AuditActionRegister      = "account.register"
+	AuditActionUpdate        = "account.update"
+	AuditActionReplace       = "account.replace"
+	AuditActionDelete        = "account.delete"
+	AuditActionCancelDelete  = "account.cancel_delete"
+	AuditActionRestore       = "account.restore"
+	AuditActionBulkImport    = "account.bulk_import"
+	AuditActionMerge         = "account.merge"
+	AuditActionPassword      = "account.password_change"
+	AuditActionPasswordReset = "account.password_reset"
+	AuditActionRoleChange    = "account.role_change"
+	AuditActionSuspend       = "account.suspend"
+	AuditActionActivate      = "account.activate"
+	AuditActionTOTPEnable    = "account.totp_enable"
+	AuditActionForceReset    = "account.password_force_reset"
+
+	// account checksums
+	AccountIntegrityBatchSize = 500
+
+	// account merge strategies
+	MergeStrategyPreferTarget = "prefer_target"
+	MergeStrategyPreferSource = "prefer_source"
+	MergeStrategyPreferNewest = "prefer_newest"
+	MergeStrategyPerField     = "per_field"
+	MergeSideSource           = "source"
+	MergeSideTarget           = "target"
+
+	// handles
+	HandleMinLength = 3
+
+	// session user agents are cut to the column size
+	SessionUserAgentLimit = 300
+
+	// honeypot actions
+	HoneypotActionFakeSuccess = "fake_success"
+	HoneypotActionReject      = "reject"
+
+	// https enforcement modes
+	HTTPSEnforcementOff      = "off"
+	HTTPSEnforcementRedirect = "redirect"
+	HTTPSEnforcementReject   = "reject"
+
+	// device binding modes
+	DeviceBindingOff     = "off"
+	DeviceBindingWarn    = "warn"
+	DeviceBindingEnforce = "enforce"
+
+	// registration conflict codes
+	ConflictCodeUsername    = "username_taken"
+	ConflictCodeEmail       = "email_taken"
+	ConflictCodePhoneNumber = "phone_number_taken"
+	ConflictCodeReserved    = "username_reserved"
+
+	// existence probe policies for callers that are not admins
+	ExistenceProbeAmbiguous = "ambiguous"
+	ExistenceProbeAdminOnly = "admin_only"
+
+	// verification token purposes
+	TokenPurposeVerification  = "verification"
+	TokenPurposeEmailChange   = "email_change"
+	TokenPurposePasswordReset = "password_reset"
+
+	// profile card field visibility
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityPrivate   = "private"
 )
 
 var (
 	// db connection
 	_ = godotenv.Load()
 	ServiceName = os.Getenv("SERVICE_NAME")
+	// debug, info, warn or error
+	LogLevel = env.GetString("LOG_LEVEL", "info")
+	// how long a SIGINT or SIGTERM waits for active requests before the server exits anyway
+	ShutdownTimeout = env.GetDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	// how long /readyz waits for the dependency checks, a check still running is reported as timeout
+	ReadinessTimeout = env.GetDuration("READINESS_TIMEOUT", 2*time.Second)
+	// account reads and transactions failing with a transient database error run again up to DBRetryAttempts times
+	// in total, waiting from DBRetryBaseDelay doubling up to DBRetryMaxDelay. 1 turns retrying off
+	DBRetryAttempts  = env.GetInt("DB_RETRY_ATTEMPTS", 3)
+	DBRetryBaseDelay = env.GetDuration("DB_RETRY_BASE_DELAY", 50*time.Millisecond)
+	DBRetryMaxDelay  = env.GetDuration("DB_RETRY_MAX_DELAY", time.Second)
+	// an account read of a request gives up after AccountReadTimeout, a write after AccountWriteTimeout and
+	// a page of the account list after AccountListTimeout, the handler then answers 504.
+	// Exports, bulk operations, scans and purges have no timeout, they end with the request
+	AccountReadTimeout  = env.GetDuration("ACCOUNT_READ_TIMEOUT", 5*time.Second)
+	AccountWriteTimeout = env.GetDuration("ACCOUNT_WRITE_TIMEOUT", 10*time.Second)
+	AccountListTimeout  = env.GetDuration("ACCOUNT_LIST_TIMEOUT", 10*time.Second)
 
 	// jwt
 	SampleSecretKey = []byte(os.Getenv("SECRET_KEY"))
 
+	// public account ids are tagged with the environment e.g. stg or prd, ids of another environment are rejected
+	AccountIDPrefix = env.GetString("ACCOUNT_ID_PREFIX", "")
+
+	// public parameters
+	PasswordPolicyURL = os.Getenv("PASSWORD_POLICY_URL")
+	OAuthProviders    = env.GetList("OAUTH_PROVIDERS", nil)
+
+	// email verification
+	VerificationURL         = env.GetString("VERIFICATION_URL", "http://localhost:5000/v1/accounts/verify")
+	VerificationTokenTTL    = env.GetDuration("VERIFICATION_TOKEN_TTL", 24*time.Hour)
+	EmailChangeURL          = env.GetString("EMAIL_CHANGE_URL", "http://localhost:5000/v1/accounts/email/confirm")
+	EmailChangeTTL          = env.GetDuration("EMAIL_CHANGE_TTL", 24*time.Hour)
+	PasswordResetURL        = env.GetString("PASSWORD_RESET_URL", "http://localhost:5000/v1/accounts/password/reset")
+	PasswordResetTTL        = env.GetDuration("PASSWORD_RESET_TTL", time.Hour)
+	PasswordResetLimit      = env.GetInt("PASSWORD_RESET_LIMIT", 3)
+	PasswordResetWindow     = env.GetDuration("PASSWORD_RESET_WINDOW", time.Hour)
+	VerificationEmailLimit  = env.GetInt("VERIFICATION_EMAIL_LIMIT", 3)
+	VerificationEmailWindow = env.GetDuration("VERIFICATION_EMAIL_WINDOW", time.Hour)
+	VerificationReuseWindow = env.GetDuration("VERIFICATION_REUSE_WINDOW", 15*time.Minute)
+	OutboxDispatchInterval  = env.GetDuration("OUTBOX_DISPATCH_INTERVAL", 10*time.Second)
+	// login is rejected until the email is verified, turn off while accounts created before verification are migrated
+	RequireVerifiedLogin = env.GetBool("REQUIRE_VERIFIED_LOGIN", true)
+
+	// outbox emails are only logged or sent through the smtp server, an empty username skips authentication.
+	// There is no default, a deployment has to choose so it does not silently send nothing
+	EmailSender  = env.GetString("EMAIL_SENDER", "")
+	SMTPHost     = env.GetString("SMTP_HOST", "localhost")
+	SMTPPort     = env.GetInt("SMTP_PORT", 587)
+	SMTPUsername = env.GetString("SMTP_USERNAME", "")
+	SMTPPassword = env.GetString("SMTP_PASSWORD", "")
+	SMTPFrom     = env.GetString("SMTP_FROM", "no-reply@localhost")
+	SMTPTimeout  = env.GetDuration("SMTP_TIMEOUT", 10*time.Second)
+
+	// terms of service and privacy policy version users must accept
+	TermsVersion = env.GetString("TERMS_VERSION", "1")
+
+	// passwords older than this must be changed, zero disables the policy
+	PasswordMaxAge = env.GetDuration("PASSWORD_MAX_AGE", 0)
+
+	// access tokens and the sessions issuing them expire after TokenTTL,
+	// an expired token can still be refreshed within TokenRefreshGrace
+	TokenTTL          = time.Duration(env.GetInt("JWT_TTL_MINUTES", 30)) * time.Minute
+	TokenRefreshGrace = time.Duration(env.GetInt("JWT_REFRESH_GRACE_MINUTES", 10)) * time.Minute
+	// responses of a token expiring within TokenExpiryWarning tell the client to refresh, 0 disables the hint
+	TokenExpiryWarning = time.Duration(env.GetInt("JWT_EXPIRY_WARNING_MINUTES", 5)) * time.Minute
+	// tokens revoked by a logout are kept in memory on this instance or in redis shared by every instance
+	TokenBlacklistStore = env.GetString("TOKEN_BLACKLIST_STORE", "memory")
+
+	// authenticator secrets are stored encrypted under this base64 32 byte key, an empty key disables two factor login.
+	// A login of an account with it on answers a challenge token the code is sent with within TwoFactorChallengeTTL
+	TOTPEncryptionKey     = env.GetString("TOTP_ENCRYPTION_KEY", "")
+	TOTPIssuer            = env.GetString("TOTP_ISSUER", "go-rest-api")
+	TwoFactorChallengeTTL = env.GetDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute)
+
+	// the date of birth must match the one the ktp number (nik) encodes, checked when either is changed
+	DOBKTPCheck = env.GetBool("DOB_KTP_CHECK", false)
+
+	// an account is locked for the cooldown after threshold consecutive failed logins, 0 disables the lockout
+	LoginLockoutThreshold = env.GetInt("LOGIN_LOCKOUT_THRESHOLD", 5)
+	LoginLockoutCooldown  = env.GetDuration("LOGIN_LOCKOUT_COOLDOWN", 15*time.Minute)
+
+	// concurrent password verifies on login, in total, per ip and per username, 0 disables a cap
+	PasswordVerifyConcurrency   = env.GetInt("PASSWORD_VERIFY_CONCURRENCY", 16)
+	PasswordVerifyPerIP         = env.GetInt("PASSWORD_VERIFY_PER_IP", 4)
+	PasswordVerifyPerIdentifier = env.GetInt("PASSWORD_VERIFY_PER_IDENTIFIER", 2)
+
+	// new passwords below the policy are rejected listing the unmet rules, with enforcement off they are
+	// accepted and the account gets a warning instead. Passwords set before are only warned about
+	PasswordMinLength        = env.GetInt("PASSWORD_MIN_LENGTH", 8)
+	PasswordRequireUppercase = env.GetBool("PASSWORD_REQUIRE_UPPERCASE", true)
+	PasswordRequireLowercase = env.GetBool("PASSWORD_REQUIRE_LOWERCASE", true)
+	PasswordRequireDigit     = env.GetBool("PASSWORD_REQUIRE_DIGIT", true)
+	PasswordRequireSymbol    = env.GetBool("PASSWORD_REQUIRE_SYMBOL", true)
+	PasswordPolicyEnforce    = env.GetBool("PASSWORD_POLICY_ENFORCE", true)
+	PasswordPolicy           = passwordpolicy.Policy{
+		MinLength:        PasswordMinLength,
+		RequireUppercase: PasswordRequireUppercase,
+		RequireLowercase: PasswordRequireLowercase,
+		RequireDigit:     PasswordRequireDigit,
+		RequireSymbol:    PasswordRequireSymbol,
+	}
+	// an admin password reset without a password generates one of this length, at least PasswordMinLength
+	TemporaryPasswordLength = env.GetInt("TEMPORARY_PASSWORD_LENGTH", 16)
+
+	// new passwords are hashed with bcrypt or argon2id, older hashes are upgraded on login
+	PasswordHashAlgorithm = env.GetString("PASSWORD_HASH_ALGORITHM", "bcrypt")
+	// hashes of a lower cost are upgraded on login too
+	BcryptCost = env.GetInt("BCRYPT_COST", 12)
+	// lets accounts imported with plaintext passwords log in once so the password gets hashed, keep it off otherwise
+	PasswordLegacyPlaintext = env.GetBool("PASSWORD_LEGACY_PLAINTEXT", false)
+
+	// fields of downstream only responses like the export are encrypted under this base64 32 byte key
+	// shared with the consuming service, an empty key disables it
+	ResponseEncryptionKey   = env.GetString("RESPONSE_ENCRYPTION_KEY", "")
+	ResponseEncryptedFields = env.GetList("RESPONSE_ENCRYPTED_FIELDS", []string{"email", "phone_number", "address", "date_of_birth"})
+
+	// normalizations applied to registration and update fields before they are checked and stored,
+	// e.g. display_name=trim|strip_emoji, see transform.Builtin for the transformers
+	AccountFieldTransforms = env.GetList("ACCOUNT_FIELD_TRANSFORMS", nil)
+
+	// reject update payloads with fields the endpoint does not accept, like role or id
+	StrictRequestFields = env.GetBool("STRICT_REQUEST_FIELDS", false)
+
+	// registration honeypot, an empty field name disables it
+	HoneypotField  = env.GetString("HONEYPOT_FIELD", "")
+	HoneypotAction = env.GetString("HONEYPOT_ACTION", HoneypotActionFakeSuccess)
+
+	// read only maintenance mode, writes are still accepted with the bypass token
+	ReadOnlyMode           = env.GetBool("READ_ONLY_MODE", false)
+	MaintenanceBypassToken = env.GetString("MAINTENANCE_BYPASS_TOKEN", "")
+
+	// request bodies above the limit are rejected with 413 before parsing, the bulk import takes up to BulkImportMaxRows accounts
+	MaxRequestBodyBytes    = env.GetInt("MAX_REQUEST_BODY_BYTES", 1<<20)
+	BulkImportMaxBodyBytes = env.GetInt("BULK_IMPORT_MAX_BODY_BYTES", 10<<20)
+
+	// visibility of profile card fields for accounts that did not change it, keyed by json name
+	DefaultFieldVisibility = map[string]string{
+		"username":        VisibilityPublic,
+		"fullname":        VisibilityPublic,
+		"display_name":    VisibilityPublic,
+		"photo_url":       VisibilityPublic,
+		"job_position":    VisibilityPublic,
+		"employee_number": VisibilityPrivate,
+		"email":           VisibilityPrivate,
+		"phone_number":    VisibilityPrivate,
+	}
+
+	// avatar storage and processing, local or s3 for any S3 compatible bucket.
+	// Objects are served at STORAGE_BASE_URL, for s3 the public url of the bucket or a CDN in front of it.
+	// An avatar of more than AVATAR_MAX_PIXELS pixels is rejected from its header, it is never decoded
+	StorageDriver       = env.GetString("STORAGE_DRIVER", "local")
+	StorageLocalDir     = env.GetString("STORAGE_LOCAL_DIR", "uploads")
+	StorageBaseURL      = env.GetString("STORAGE_BASE_URL", "http://localhost:5000/uploads")
+	S3Endpoint          = env.GetString("S3_ENDPOINT", "")
+	S3Region            = env.GetString("S3_REGION", "us-east-1")
+	S3Bucket            = env.GetString("S3_BUCKET", "")
+	S3AccessKeyID       = env.GetString("S3_ACCESS_KEY_ID", "")
+	S3SecretAccessKey   = env.GetString("S3_SECRET_ACCESS_KEY", "")
+	S3Timeout           = env.GetDuration("S3_TIMEOUT", 30*time.Second)
+	AvatarMaxBytes      = env.GetInt("AVATAR_MAX_BYTES", 5<<20)
+	AvatarMaxPixels     = env.GetInt("AVATAR_MAX_PIXELS", 4096*4096)
+	AvatarVariantWidths = []int{64, 128, 256}
+	AvatarWorkers       = env.GetInt("AVATAR_WORKERS", 2)
+	AvatarQueueSize     = env.GetInt("AVATAR_QUEUE_SIZE", 100)
+
+	// deleted accounts can be restored by an admin within the window, PurgeDeleted removes them after it
+	AccountRestoreWindow = env.GetDuration("ACCOUNT_RESTORE_WINDOW", 30*24*time.Hour)
+	// a deletion requested by the owner can be cancelled within the grace, PurgeDeleted removes the account after it
+	AccountDeletionGrace = env.GetDuration("ACCOUNT_DELETION_GRACE", 14*24*time.Hour)
+
+	// account webhooks
+	WebhookMaxPerAccount = env.GetInt("WEBHOOK_MAX_PER_ACCOUNT", 5)
+	WebhookWorkers       = env.GetInt("WEBHOOK_WORKERS", 2)
+	WebhookQueueSize     = env.GetInt("WEBHOOK_QUEUE_SIZE", 100)
+	WebhookTimeout       = env.GetDuration("WEBHOOK_TIMEOUT", 5*time.Second)
+
+	// downstream systems told to clean up their copies of a deleted account, signed with DeletionWebhookSecret.
+	// With require_ack every endpoint must answer 2xx within the attempts before the account is deleted
+	DeletionWebhookURLs     = env.GetList("DELETION_WEBHOOK_URLS", nil)
+	DeletionWebhookSecret   = env.GetString("DELETION_WEBHOOK_SECRET", "")
+	DeletionWebhookMode     = env.GetString("DELETION_WEBHOOK_MODE", DeletionWebhookFireAndForget)
+	DeletionWebhookAttempts = env.GetInt("DELETION_WEBHOOK_ATTEMPTS", 3)
+	DeletionWebhookTimeout  = env.GetDuration("DELETION_WEBHOOK_TIMEOUT", 5*time.Second)
+
+	// failed registrations are kept for fraud scoring, a zero retention disables recording them
+	FailedRegistrationRetention     = env.GetDuration("FAILED_REGISTRATION_RETENTION", 30*24*time.Hour)
+	FailedRegistrationPurgeInterval = env.GetDuration("FAILED_REGISTRATION_PURGE_INTERVAL", time.Hour)
+	FingerprintSecret               = []byte(env.GetString("FINGERPRINT_SECRET", ""))
+
+	// account checksums are always written, verification on read logs and counts a mismatch.
+	// Without a secret a direct db edit can recompute the checksum, only corruption is caught
+	AccountChecksumVerify = env.GetBool("ACCOUNT_CHECKSUM_VERIFY", false)
+	AccountChecksumSecret = []byte(env.GetString("ACCOUNT_CHECKSUM_SECRET", ""))
+
+	// tokens are bound to the login device, a token used from another device is logged on warn and rejected on enforce
+	DeviceBinding = env.GetString("DEVICE_BINDING", DeviceBindingOff)
+
+	// addresses or cidrs of the proxies in front of the service, only their X-Forwarded-For and X-Real-IP
+	// headers are read for the client ip. None by default, the client ip is then the address of the peer
+	TrustedProxies = env.GetList("TRUSTED_PROXIES", nil)
+
+	// https enforcement behind a tls terminating proxy, off for local development. The forwarded protocol and
+	// tls version are read from TRUSTED_PROXIES only. MinTLSVersion is checked only when the proxy forwards it
+	HTTPSEnforcement = env.GetString("HTTPS_ENFORCEMENT", HTTPSEnforcementOff)
+	MinTLSVersion    = env.GetString("MIN_TLS_VERSION", "1.2")
+
+	// cross origin requests are only allowed from the listed origins, none by default.
+	// * allows any origin and cannot be combined with credentials, the server refuses to start with both
+	CORSAllowedOrigins   = env.GetList("CORS_ALLOWED_ORIGINS", nil)
+	CORSAllowedMethods   = env.GetList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE"})
+	CORSAllowedHeaders   = env.GetList("CORS_ALLOWED_HEADERS", []string{"Authorization", "Content-Type", "Accept-Language", "Idempotency-Key", "If-Match", "If-None-Match", "X-Request-ID"})
+	CORSExposedHeaders   = env.GetList("CORS_EXPOSED_HEADERS", []string{"ETag", "X-Request-ID", "Idempotent-Replayed"})
+	CORSAllowCredentials = env.GetBool("CORS_ALLOW_CREDENTIALS", false)
+	CORSMaxAge           = env.GetDuration("CORS_MAX_AGE", 10*time.Minute)
+
+	// handles are generated from the full name at registration
+	HandleMaxLength = env.GetInt("HANDLE_MAX_LENGTH", 30)
+	// a previous handle redirects to the account for this long, then it can be reclaimed
+	HandleRedirectTTL = env.GetDuration("HANDLE_REDIRECT_TTL", 30*24*time.Hour)
+
+	// display names are compared trimmed and case-folded when uniqueness is on
+	DisplayNameUnique = env.GetBool("DISPLAY_NAME_UNIQUE", false)
+
+	// email uniqueness is checked on the canonical email when on, see emailcanon.Known for the providers
+	EmailCanonicalization   = env.GetBool("EMAIL_CANONICALIZATION", false)
+	EmailCanonicalProviders = env.GetList("EMAIL_CANONICAL_PROVIDERS", []string{"gmail.com", "googlemail.com"})
+
+	// profile update rate limit per field group, a limit of 0 disables the group
+	ProfileUpdateLimit   = env.GetInt("PROFILE_UPDATE_LIMIT", 10)
+	ProfileUpdateWindow  = env.GetDuration("PROFILE_UPDATE_WINDOW", time.Hour)
+	EmailUpdateLimit     = env.GetInt("EMAIL_UPDATE_LIMIT", 3)
+	EmailUpdateWindow    = env.GetDuration("EMAIL_UPDATE_WINDOW", 24*time.Hour)
+	PasswordUpdateLimit  = env.GetInt("PASSWORD_UPDATE_LIMIT", 5)
+	PasswordUpdateWindow = env.GetDuration("PASSWORD_UPDATE_WINDOW", time.Hour)
+
+	// an identical update repeated within the window returns the first result without writing again, 0 disables it
+	UpdateCoalesceWindow = env.GetDuration("UPDATE_COALESCE_WINDOW", 2*time.Second)
+
+	// the account of Get is cached in redis (REDIS_HOST, REDIS_PORT, REDIS_PASSWORD) for the ttl, 0 disables it
+	AccountCacheTTL = env.GetDuration("ACCOUNT_CACHE_TTL", 5*time.Minute)
+	// after a failed cache call reads go straight to the database for this long
+	AccountCacheRetryAfter = env.GetDuration("ACCOUNT_CACHE_RETRY_AFTER", 30*time.Second)
+
+	// a register repeating an Idempotency-Key within the ttl gets the first response replayed, 0 disables it
+	IdempotencyTTL = env.GetDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+
+	// per ip request limits of the auth endpoints, login is also limited per username or email, a limit of 0 disables it
+	RegisterRateLimit         = env.GetInt("REGISTER_RATE_LIMIT", 10)
+	RegisterRateWindow        = env.GetDuration("REGISTER_RATE_WINDOW", time.Minute)
+	LoginRateLimit            = env.GetInt("LOGIN_RATE_LIMIT", 20)
+	LoginRateWindow           = env.GetDuration("LOGIN_RATE_WINDOW", time.Minute)
+	LoginIdentifierRateLimit  = env.GetInt("LOGIN_IDENTIFIER_RATE_LIMIT", 5)
+	LoginIdentifierRateWindow = env.GetDuration("LOGIN_IDENTIFIER_RATE_WINDOW", time.Minute)
+	PasswordResetRateLimit    = env.GetInt("PASSWORD_RESET_RATE_LIMIT", 5)
+	PasswordResetRateWindow   = env.GetDuration("PASSWORD_RESET_RATE_WINDOW", time.Minute)
+
+	// account existence probe, only admins ever learn whether an account exists
+	ExistenceProbePolicy = env.GetString("EXISTENCE_PROBE_POLICY", ExistenceProbeAmbiguous)
+	ExistenceProbeLimit  = env.GetInt("EXISTENCE_PROBE_LIMIT", 10)
+	ExistenceProbeWindow = env.GetDuration("EXISTENCE_PROBE_WINDOW", time.Minute)
+
+	// a reserved username is held for the registration presenting the reservation token
+	UsernameReservationTTL    = env.GetDuration("USERNAME_RESERVATION_TTL", 15*time.Minute)
+	UsernameReservationLimit  = env.GetInt("USERNAME_RESERVATION_LIMIT", 5)
+	UsernameReservationWindow = env.GetDuration("USERNAME_RESERVATION_WINDOW", time.Hour)
+
+	// login diagnosis rate limit per admin
+	LoginDiagnosisLimit  = env.GetInt("LOGIN_DIAGNOSIS_LIMIT", 20)
+	LoginDiagnosisWindow = env.GetDuration("LOGIN_DIAGNOSIS_WINDOW", time.Minute)
+
 	// error
 	ErrInvalidAddress           = errors.New("invalid address")
 	ErrInvalidID                = errors.New("invalid id")
+	ErrForeignAccountID         = errors.New("account id belongs to another environment")
 	ErrInvalidFormat            = errors.New("invalid format")
 	ErrInvalidDOBFormat         = errors.New("invalid dob format, example : '2006-01-02'")
+	ErrDOBOutOfRange            = errors.New("date of birth must not be in the future or more than 120 years ago")
+	ErrInvalidLocale            = errors.New("invalid locale")
 	ErrInvalidLocationName      = errors.New("invalid location")
 	ErrInvalidPassword          = errors.New("invalid password")
+	ErrInvalidCredentials       = errors.New("invalid username, email or password")
+	ErrAccountLocked            = errors.New("account is locked after too many failed logins, try again later")
+	ErrPasswordMismatch         = errors.New("old password does not match")
+	ErrPasswordUnchanged        = errors.New("new password must differ from the old password")
+	ErrVerifyBusy               = errors.New("too many login attempts in progress, try again later")
 	ErrInvalidStatusAttendance  = errors.New("invalid status attendance")
 	ErrAccountExist             = errors.New("account already exist")
 	ErrAccountNotRegistered     = errors.New("account not registered")
+	ErrAccountNotDeleted        = errors.New("account is not deleted")
+	ErrRestoreWindowExpired     = errors.New("account was deleted before the restore window")
+	ErrDeletionNotPending       = errors.New("account has no pending deletion")
+	ErrDeletionGraceExpired     = errors.New("the deletion can no longer be cancelled")
 	ErrEmailAlreadyExist        = errors.New("email already exist")
+	ErrDisplayNameAlreadyExist  = errors.New("display name already exist")
+	ErrDisplayNameCannotBeEmpty = errors.New("display name cannot be empty")
 	ErrLocationAlreadyExist     = errors.New("location already exist")
 	ErrLocationNameAlreadyExist = errors.New("location name already exist")
 	ErrLocationNotExist         = errors.New("location is not exist")
 	ErrKTPNumberAlreadyExist    = errors.New("ktp number already exist")
+	ErrDOBKTPMismatch           = errors.New("date of birth does not match the ktp number")
 	ErrPasswordCannotBeEmpty    = errors.New("password cannot be empty")
 	ErrUsernameCannotBeEmpty    = errors.New("username cannot be empty")
 	ErrPhoneNumberAlreadyExist  = errors.New("phone number already exist")
 	ErrUsernameAlreadyExist     = errors.New("username already exist")
+	ErrForbidden                = errors.New("forbidden")
+	ErrPreconditionFailed       = errors.New("account has been modified, fetch the latest version")
+	ErrUpdateRateExceeded       = errors.New("too many updates, try again later")
+	ErrInvalidTimeRange         = errors.New("invalid time range")
+	ErrInvalidDateFormat        = errors.New("invalid date format, example : '2006-01-02'")
+	ErrBulkImportTooLarge       = errors.New("too many rows in bulk import")
+	ErrBulkImportEmpty          = errors.New("bulk import cannot be empty")
+	ErrDuplicateInBatch         = errors.New("duplicated in this batch")
+	ErrTermsNotAccepted         = errors.New("current terms version must be accepted")
+	ErrAvatarQueueFull          = errors.New("avatar processing is busy, try again later")
+	ErrReadOnlyMode             = errors.New("service is in read only maintenance mode")
+	ErrInvalidVisibility        = errors.New("visibility must be public, followers or private")
+	ErrInvalidVisibilityField   = errors.New("field has no visibility setting")
+	ErrImportJobNotFound        = errors.New("import job not found")
+	ErrImportRowFailed          = errors.New("row could not be imported")
+	ErrEmailChangePending       = errors.New("an email change is already waiting for confirmation")
+	ErrInvalidToken             = errors.New("invalid or expired token")
+	ErrTokenExpired             = errors.New("token expired")
+	ErrMissingToken             = errors.New("authorization header is missing")
+	ErrMalformedToken           = errors.New("token is malformed")
+	ErrInvalidSignature         = errors.New("token signature is invalid")
+	ErrUnknownField             = errors.New("unknown field")
+	ErrProbeRateExceeded        = errors.New("too many requests, try again later")
+	ErrRateLimited              = errors.New("too many requests, try again later")
+	ErrDiagnosisRateExceeded    = errors.New("too many diagnoses, try again later")
+	ErrInvalidBundleSection     = errors.New("invalid bundle section")
+	ErrInvalidSortField         = errors.New("invalid sort field")
+	ErrInvalidSortOrder         = errors.New("invalid sort order, use asc or desc")
+	ErrUsernameReserved         = errors.New("username is reserved")
+	ErrReservationRateExceeded  = errors.New("too many reservations, try again later")
+	ErrInvalidHandle            = errors.New("handle may only contain lowercase letters, digits and single dashes")
+	ErrHandleAlreadyExist       = errors.New("handle already exist")
+	ErrHandleMoved              = errors.New("handle moved")
+	ErrAccountAlreadyVerified   = errors.New("account already verified")
+	ErrAccountNotVerified       = errors.New("account email is not verified")
+	ErrEmailNotSet              = errors.New("account has no email")
+	ErrVerificationRateExceeded = errors.New("too many verification emails, try again later")
+	ErrIDConflict               = errors.New("id in the body does not match the addressed record")
+	ErrWebhookNotFound          = errors.New("webhook not found")
+	ErrWebhookQuotaExceeded     = errors.New("webhook limit reached, delete a webhook first")
+	ErrDeletionNotAcknowledged  = errors.New("downstream cleanup was not acknowledged, try again later")
+	ErrHTTPSRequired            = errors.New("https is required")
+	ErrWeakTLS                  = errors.New("tls version is below the minimum")
+	ErrDeviceMismatch           = errors.New("token was issued to another device")
+	ErrMergeSameAccount         = errors.New("cannot merge an account into itself")
+	ErrInvalidMergeStrategy     = errors.New("strategy must be prefer_target, prefer_source, prefer_newest or per_field")
+	ErrInvalidMergeOverride     = errors.New("override must be source or target for a mergeable field")
+	ErrInvalidRole              = errors.New("role must be admin or user")
+	ErrUnauthorized             = errors.New("unauthorized")
+	ErrValidationFailed         = errors.New("validation failed")
+	ErrInternal                 = errors.New("internal server error")
+	ErrSelfRoleChange           = errors.New("cannot change your own role")
+	ErrInvalidIdempotencyKey    = errors.New("idempotency key must be at most 255 characters")
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used with a different payload")
+	ErrTokenRevoked             = errors.New("token was revoked by a logout")
+	ErrAccountSuspended         = errors.New("account is suspended")
+	ErrSelfSuspend              = errors.New("cannot suspend your own account")
+	ErrTwoFactorUnavailable     = errors.New("two factor authentication is not configured")
+	ErrTOTPAlreadyEnabled       = errors.New("two factor authentication is already enabled")
+	ErrTOTPNotEnrolled          = errors.New("start the two factor enrollment first")
+	ErrInvalidTOTPCode          = errors.New("invalid or expired two factor code")
+	ErrRequestBodyTooLarge      = errors.New("request body is too large")
+	ErrSessionNotFound          = errors.New("session not found")
+	ErrSessionNotRevocable      = errors.New("session was recorded before sessions could be revoked, it ends when its token expires")
+	ErrAvatarMissing            = errors.New("avatar file is missing")
+	ErrUnsupportedAvatarType    = errors.New("avatar must be a jpeg or png image")
+	ErrAvatarTooLarge           = errors.New("avatar file is too large")
+	ErrAvatarTooManyPixels      = errors.New("avatar dimensions are too large")
+	ErrRequestTimeout           = errors.New("request took too long")
+	ErrRequestCanceled          = errors.New("request was canceled by the client")
+	ErrPasswordChangeRequired   = errors.New("change the password before continuing")
+	ErrSelfPasswordReset        = errors.New("cannot reset your own password, change it instead")
 )
@@ -1,202 +1,2299 @@
 package account
 
 import (
-	"log"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"net/http"
 
 	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/apierror"
+	"go-rest-api/src/pkg/bind"
+	"go-rest-api/src/pkg/etag"
+	"go-rest-api/src/pkg/fieldcrypt"
+	"go-rest-api/src/pkg/fingerprint"
+	"go-rest-api/src/pkg/i18n"
 	"go-rest-api/src/pkg/jwt"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/metrics"
+	"go-rest-api/src/pkg/nulls"
+	"go-rest-api/src/pkg/permission"
+	"go-rest-api/src/pkg/publicid"
 	entity "go-rest-api/src/http"
 	"go-rest-api/src/service/v1/account"
+	"go-rest-api/src/service/v1/audit"
+	"go-rest-api/src/service/v1/importjob"
+	"go-rest-api/src/service/v1/security"
+	"go-rest-api/src/service/v1/webhook"
+	"github.com/forkyid/go-utils/v1/aes"
 	"github.com/forkyid/go-utils/v1/rest"
 	"github.com/forkyid/go-utils/v1/validation"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 )
 
+// endpoint labels of the validation failure metric
+const (
+	metricRegister = "register"
+	metricUpdate   = "update"
+)
+
 type Controller struct {
-	svc account.Servicer
+	svc       account.Servicer
+	importJob importjob.Servicer
+	audit     audit.Servicer
+	security  security.Servicer
+	webhook   webhook.Servicer
+	// fieldCipher encrypts the downstream only response fields, nil leaves them in plain text
+	fieldCipher *fieldcrypt.Cipher
+	logger      *logger.Logger
 }
 
 func NewController(
 	servicer account.Servicer,
+	importJobSvc importjob.Servicer,
+	auditSvc audit.Servicer,
+	securitySvc security.Servicer,
+	webhookSvc webhook.Servicer,
+	fieldCipher *fieldcrypt.Cipher,
+	appLogger *logger.Logger,
 ) *Controller {
 	return &Controller{
-		svc: servicer,
+		svc:         servicer,
+		importJob:   importJobSvc,
+		audit:       auditSvc,
+		security:    securitySvc,
+		webhook:     webhookSvc,
+		fieldCipher: fieldCipher,
+		logger:      appLogger,
 	}
 }
 
 // @Summary Get User Data
-// @Description Get User Data
+// @Description Get User Data, the response can be revalidated with If-None-Match
 // @Tags Accounts
 // @Produce application/json
 // @Param Authorization header string true "Bearer Token"
+// @Param If-None-Match header string false "ETag of a previous response"
+// @Param nulls query bool false "render empty optional fields as null instead of an empty string or omitting them"
 // @Success 200 {object} http.GetUser
-// @Failure 400 {string} string "Bad Request"
-// @Failure 401 {string} string "Unauthorized"
-// @Failure 500 {string} string "Internal Server Error"
+// @Success 304 {string} string "Not Modified"
+// @Header 200 {string} ETag "Account version, usable with If-Match"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Failure 504 {object} apierror.Envelope "Gateway Timeout"
 // @Router /v1/accounts [get]
 func (ctrl *Controller) Get(ctx *gin.Context) {
-	accountID, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	response, err := ctrl.svc.TakeAccountByID(ctx.Request.Context(), accountID)
+	if apierror.Interrupted(err) {
+		apierror.Response(ctx, err)
+		return
+	} else if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("get account by id failed", "error", err)
+		return
+	}
+
+	tag := ctrl.svc.AccountETag(response)
+	ctx.Header("ETag", tag)
+	ctx.Header("Cache-Control", "private, no-cache")
+	if etag.Match(ctx.GetHeader("If-None-Match"), tag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	if ctx.Query("nulls") == "true" {
+		rest.ResponseData(ctx, http.StatusOK, nulls.Explicit(response))
+		return
+	}
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// GetByID godoc
+// @Summary Get User Data By ID
+// @Description Get the data of any account by its public id, Admin Only
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param id path string true "Account ID"
+// @Param nulls query bool false "render empty optional fields as null instead of an empty string or omitting them"
+// @Success 200 {object} http.GetUser
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Failure 504 {object} apierror.Envelope "Gateway Timeout"
+// @Router /v1/accounts/{id} [get]
+func (ctrl *Controller) GetByID(ctx *gin.Context) {
+	if _, ok := ctrl.authorizeAdmin(ctx); !ok {
+		return
+	}
+
+	accountID, err := publicid.Decode(ctx.Param("id"))
 	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusUnauthorized)
+		apierror.Field(ctx, "id", err)
 		return
 	}
 
-	response, err := ctrl.svc.TakeAccountByID(accountID)
+	response, err := ctrl.svc.TakeAccountByID(ctx.Request.Context(), accountID)
 	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusInternalServerError)
-		log.Println("get account by id:", err)
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("get account by id failed", "error", err)
+		}
+		apierror.Response(ctx, err)
 		return
 	}
 
+	if ctx.Query("nulls") == "true" {
+		rest.ResponseData(ctx, http.StatusOK, nulls.Explicit(response))
+		return
+	}
 	rest.ResponseData(ctx, http.StatusOK, response)
 }
 
+// List godoc
+// @Summary List Accounts
+// @Description List every account for the admin dashboard, Admin Only
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param page query int false "page, default 1"
+// @Param limit query int false "limit, default 20 and at most 100"
+// @Param sort query string false "id, username, fullname, handle, created_at or updated_at, default id"
+// @Param order query string false "asc or desc, default asc"
+// @Success 200 {object} http.AccountList
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Failure 504 {object} apierror.Envelope "Gateway Timeout"
+// @Router /v1/accounts/list [get]
+func (ctrl *Controller) List(ctx *gin.Context) {
+	if _, ok := ctrl.authorizeAdmin(ctx); !ok {
+		return
+	}
+
+	params := entity.ListAccounts{
+		Page:  1,
+		Limit: constant.AccountListDefaultLimit,
+		Sort:  ctx.Query("sort"),
+		Order: strings.ToLower(ctx.Query("order")),
+	}
+	if page := ctx.Query("page"); page != "" {
+		value, err := strconv.Atoi(page)
+		if err != nil || value <= 0 {
+			apierror.Field(ctx, "page", constant.ErrInvalidFormat)
+			return
+		}
+		params.Page = value
+	}
+	if limit := ctx.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			apierror.Field(ctx, "limit", constant.ErrInvalidFormat)
+			return
+		}
+		params.Limit = value
+	}
+	if params.Limit > constant.AccountListMaxLimit {
+		params.Limit = constant.AccountListMaxLimit
+	}
+
+	accounts, total, err := ctrl.svc.ListAccounts(ctx.Request.Context(), params)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("list accounts failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, entity.AccountList{
+		Data:  accounts,
+		Page:  params.Page,
+		Limit: params.Limit,
+		Total: total,
+	})
+}
+
 // Register godoc
 // @Summary Register Account
-// @Description Register Account
+// @Description Register Account, a filled honeypot field answers like a registration without creating the account
 // @Tags Accounts
+// @Param Accept-Language header string false "Default locale when the payload has none"
+// @Param Idempotency-Key header string false "Replays the first response of a retried registration within IDEMPOTENCY_TTL"
 // @Param Payload body http.RegisterUser true "Payload"
 // @Success 201 {object} string "Created"
-// @Failure 400 {string} string "Bad Request"
-// @Failure 409 {string} string "Resource Conflict"
-// @Failure 500 {string} string "Internal Server Error"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 409 {object} apierror.Envelope "Resource Conflict, each conflicting field maps to its code e.g. username_taken"
+// @Failure 413 {object} apierror.Envelope "Request Entity Too Large"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason, or the idempotency key was reused with a different payload"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
 // @Router /v1/accounts/register [post]
 func (ctrl *Controller) Register(ctx *gin.Context) {
 	req := entity.RegisterUser{}
 	if err := rest.BindJSON(ctx, &req); err != nil {
-		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-			"body": constant.ErrInvalidFormat.Error()})
+		ctrl.recordFailedRegistration(ctx, constant.RegistrationFailureInvalidFormat, req)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	// the honeypot is not a RegisterUser field so it is never stored
+	if constant.HoneypotField != "" && bind.Filled(ctx, constant.HoneypotField) {
+		ctrl.recordFailedRegistration(ctx, constant.RegistrationFailureHoneypot, req)
+		if constant.HoneypotAction == constant.HoneypotActionReject {
+			apierror.Response(ctx, constant.ErrInvalidFormat)
+			return
+		}
+		rest.ResponseMessage(ctx, http.StatusCreated)
 		return
 	}
 
-	// required tapi tidak diisi akan return bad request
+	// required tapi tidak diisi akan return unprocessable entity
 	if err := validation.Validator.Struct(req); err != nil {
-		log.Println("validate struct:", err, "request:", req)
-		rest.ResponseError(ctx, http.StatusBadRequest, err)
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		metrics.ValidationErrors(metricRegister, err)
+		ctrl.recordFailedRegistration(ctx, constant.RegistrationFailureValidation, req)
+		apierror.Validation(ctx, err)
 		return
 	}
 
 	req.Username = strings.ToLower(req.Username)
-	err := ctrl.svc.Create(req)
-	if errors.Is(err, constant.ErrAccountExist) {
-		rest.ResponseError(ctx, http.StatusConflict, map[string]string{
-			"account": constant.ErrAccountExist.Error()})
+	if req.Locale == "" {
+		req.Locale = i18n.ParseAcceptLanguage(ctx.GetHeader("Accept-Language"))
+	}
+	accountID, err := ctrl.svc.Create(ctx.Request.Context(), req)
+	conflict := &account.ConflictError{}
+	if errors.As(err, &conflict) {
+		ctrl.recordFailedRegistration(ctx, constant.RegistrationFailureConflict, req)
+		apierror.Fields(ctx, err, conflict.Codes())
+	} else if errors.Is(err, constant.ErrTermsNotAccepted) {
+		metrics.ValidationFailed(metricRegister, "terms_version")
+		ctrl.recordFailedRegistration(ctx, constant.RegistrationFailureTermsNotAccepted, req)
+		apierror.Response(ctx, constant.ErrTermsNotAccepted)
 	} else if err != nil {
-		log.Println("register:", err.Error())
-		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("register account failed", "error", err)
+		apierror.Response(ctx, constant.ErrInternal)
 	} else {
+		ctrl.recordAudit(ctx, accountID, constant.AuditActionRegister, accountID, nil)
 		rest.ResponseMessage(ctx, http.StatusCreated)
 	}
 }
 
+// ReserveUsername godoc
+// @Summary Reserve Username
+// @Description Hold a free username for USERNAME_RESERVATION_TTL, the registration must present the returned token as reservation_token
+// @Tags Accounts
+// @Produce application/json
+// @Param Payload body http.ReserveUsername true "Payload"
+// @Success 201 {object} http.UsernameReservation
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 409 {object} apierror.Envelope "Resource Conflict"
+// @Failure 429 {object} apierror.Envelope "Too Many Requests"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/username/reserve [post]
+func (ctrl *Controller) ReserveUsername(ctx *gin.Context) {
+	request := entity.ReserveUsername{}
+	err := rest.BindJSON(ctx, &request)
+	if err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	request.Username = strings.ToLower(request.Username)
+	response, err := ctrl.svc.ReserveUsername(ctx.Request.Context(), request, ctx.ClientIP())
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("reserve username failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusCreated, response)
+}
+
+// recordFailedRegistration keeps the names of the filled in fields for fraud scoring,
+// the password is left out and no value is recorded
+func (ctrl *Controller) recordFailedRegistration(ctx *gin.Context, reason string, req entity.RegisterUser) {
+	fields := []string{}
+	if req.Username != "" {
+		fields = append(fields, "username")
+	}
+	if req.FullName != "" {
+		fields = append(fields, "fullname")
+	}
+	if req.Email != nil {
+		fields = append(fields, "email")
+	}
+	if req.PhoneNumber != nil {
+		fields = append(fields, "phone_number")
+	}
+	if req.Locale != "" {
+		fields = append(fields, "locale")
+	}
+	if req.TermsVersion != "" {
+		fields = append(fields, "terms_version")
+	}
+
+	err := ctrl.security.RecordFailedRegistration(fingerprint.FromRequest(ctx, constant.FingerprintSecret), reason, fields)
+	if err != nil {
+		ctrl.logger.For(ctx).Error("record failed registration failed", "error", err)
+	}
+}
+
 // Update godoc
 // @Summary Update Account
-// @Description Update Account
+// @Description Update Account, a new email is applied once confirmed from the link sent to it. An identical update repeated within seconds returns the first result
 // @Tags Accounts
 // @Param Authorization header string true "Bearer Token"
 // @Param Payload body http.UpdateUser true "Payload"
 // @Success 200 {string} string "Success"
-// @Failure 400 {string} string "Bad Request"
-// @Failure 500 {string} string "Internal Server Error"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 409 {object} apierror.Envelope "Email Change Pending"
+// @Failure 429 {object} apierror.Envelope "Too Many Requests"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
 // @Router /v1/accounts [patch]
 func (ctrl *Controller) Update(ctx *gin.Context) {
 	request := entity.UpdateUser{}
 	// int di isi dengan string maka akan return invalid format
-	err := rest.BindJSON(ctx, &request)
-	if err != nil {
-		log.Println("bind json:", err, "request:", request)
-		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-			"body": constant.ErrInvalidFormat.Error()})
+	err := bind.JSON(ctx, &request, constant.StrictRequestFields)
+	unknownField := &bind.UnknownFieldError{}
+	if errors.As(err, &unknownField) {
+		metrics.ValidationFailed(metricUpdate, unknownField.Field)
+		apierror.Field(ctx, unknownField.Field, constant.ErrUnknownField)
+		return
+	} else if err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
 		return
 	}
 
-	// required tapi tidak diisi akan return bad request
+	// required tapi tidak diisi akan return unprocessable entity
 	if err := validation.Validator.Struct(request); err != nil {
-		log.Println("validate struct:", err, "request:", request)
-		rest.ResponseError(ctx, http.StatusBadRequest, err)
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		metrics.ValidationErrors(metricUpdate, err)
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	if err := bind.CheckID(ctx, sameAccountID(accountID)); err != nil {
+		apierror.Response(ctx, constant.ErrIDConflict)
 		return
 	}
 
-	accountID, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
+	coalesced, err := ctrl.svc.Update(ctx.Request.Context(), accountID, request)
 	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusUnauthorized)
+		if _, definition := apierror.Lookup(err); definition.Status == http.StatusBadRequest && definition.Field != "" {
+			metrics.ValidationFailed(metricUpdate, definition.Field)
+		}
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("update account failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+	if coalesced {
+		ctrl.logger.For(ctx).Debug("update coalesced with an identical update")
+		rest.ResponseMessage(ctx, http.StatusOK)
+		return
+	}
+
+	ctrl.recordAudit(ctx, accountID, constant.AuditActionUpdate, accountID, nil)
+	ctrl.webhook.Publish(accountID, constant.WebhookEventAccountUpdated)
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// ChangePassword godoc
+// @Summary Change Password
+// @Description Change the password of the account, the current password is required
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.ChangePassword true "Payload"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 429 {object} apierror.Envelope "Too Many Requests"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/password [patch]
+func (ctrl *Controller) ChangePassword(ctx *gin.Context) {
+	request := entity.ChangePassword{}
+	// the request holds both passwords, it is never logged
+	if err := rest.BindJSON(ctx, &request); err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
 		return
 	}
 
-	err = ctrl.svc.Update(accountID, request)
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	err := ctrl.svc.ChangePassword(ctx.Request.Context(), accountID, request.OldPassword, request.NewPassword)
 	if err != nil {
 		if errors.Is(err, constant.ErrAccountNotRegistered) {
-			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-				"accounts": constant.ErrAccountNotRegistered.Error()})
-			return
-		} else if errors.Is(err, constant.ErrUsernameCannotBeEmpty) {
-			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-				"accounts": constant.ErrUsernameCannotBeEmpty.Error()})
-			return
-		} else if errors.Is(err, constant.ErrPasswordCannotBeEmpty) {
-			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-				"accounts": constant.ErrPasswordCannotBeEmpty.Error()})
-			return
-		} else if errors.Is(err, constant.ErrUsernameAlreadyExist) {
-			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-				"accounts": constant.ErrUsernameAlreadyExist.Error()})
-			return
-		} else if errors.Is(err, constant.ErrEmailAlreadyExist) {
-			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-				"accounts": constant.ErrEmailAlreadyExist.Error()})
-			return
-		} else if errors.Is(err, constant.ErrKTPNumberAlreadyExist) {
-			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-				"accounts": constant.ErrKTPNumberAlreadyExist.Error()})
-			return
-		} else if errors.Is(err, constant.ErrPhoneNumberAlreadyExist) {
-			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-				"accounts": constant.ErrPhoneNumberAlreadyExist.Error()})
-			return
-		} else if errors.Is(err, constant.ErrInvalidDOBFormat) {
-			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-				"accounts": constant.ErrInvalidDOBFormat.Error()})
+			apierror.Response(ctx, constant.ErrUnauthorized)
 			return
 		}
-		rest.ResponseMessage(ctx, http.StatusInternalServerError)
-		log.Println("update account: ", err.Error())
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("change password failed", "error", err)
+		}
+		apierror.Response(ctx, err)
 		return
 	}
 
+	// the new password lifts the limit an admin reset put on the tokens
+	if err = jwt.PasswordChanged(accountID); err != nil {
+		ctrl.logger.For(ctx).Error("lift password change limit failed", "error", err)
+	}
+	ctrl.recordAudit(ctx, accountID, constant.AuditActionPassword, accountID, nil)
 	rest.ResponseMessage(ctx, http.StatusOK)
 }
 
-// Delete godoc
-// @Summary Delete Account
-// @Description Delete Account By User Itself
+// RequestPasswordReset godoc
+// @Summary Request Password Reset
+// @Description Send a password reset link to the email, the response is the same whether or not an account has the email
+// @Tags Accounts
+// @Param Payload body http.RequestPasswordReset true "Payload"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Router /v1/accounts/password/reset-request [post]
+func (ctrl *Controller) RequestPasswordReset(ctx *gin.Context) {
+	request := entity.RequestPasswordReset{}
+	if err := rest.BindJSON(ctx, &request); err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	// a failure only happens for an existing account, so it is logged and never returned
+	if err := ctrl.svc.CreateResetToken(ctx.Request.Context(), request.Email); err != nil {
+		ctrl.logger.For(ctx).Error("create reset token failed", "error", err)
+	}
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// ResetPassword godoc
+// @Summary Reset Password
+// @Description Set a new password with the token of the reset link, a token works once and expires after PASSWORD_RESET_TTL
+// @Tags Accounts
+// @Param Payload body http.ResetPassword true "Payload"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/password/reset [post]
+func (ctrl *Controller) ResetPassword(ctx *gin.Context) {
+	request := entity.ResetPassword{}
+	// the request holds the new password, it is never logged
+	if err := rest.BindJSON(ctx, &request); err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	accountID, err := ctrl.svc.ResetPassword(ctx.Request.Context(), request.Token, request.NewPassword)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("reset password failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	if err = jwt.PasswordChanged(accountID); err != nil {
+		ctrl.logger.For(ctx).Error("lift password change limit failed", "error", err)
+	}
+	ctrl.recordAudit(ctx, accountID, constant.AuditActionPasswordReset, accountID, nil)
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// Replace godoc
+// @Summary Replace Account
+// @Description Replace every replaceable field of the account, omitted fields are reset to their defaults.
+// @Description Managed fields (id, username, password, ktp_number, photo_url, role, is_verified, created_at, updated_at) are not changed.
 // @Tags Accounts
 // @Param Authorization header string true "Bearer Token"
+// @Param If-Match header string false "ETag of the account version being replaced"
+// @Param Payload body http.ReplaceUser true "Payload"
 // @Success 200 {string} string "Success"
-// @Failure 400 {string} string "Bad Request"
-// @Failure 409 {string} string "Resource Conflict"
-// @Failure 500 {string} string "Internal Server Error"
-// @Router /v1/accounts [delete]
-func (ctrl *Controller) Delete(ctx *gin.Context) {
-	accountID, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 409 {object} apierror.Envelope "Email Change Pending"
+// @Failure 412 {object} apierror.Envelope "Precondition Failed"
+// @Failure 429 {object} apierror.Envelope "Too Many Requests"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/me [put]
+func (ctrl *Controller) Replace(ctx *gin.Context) {
+	request := entity.ReplaceUser{}
+	err := bind.JSON(ctx, &request, constant.StrictRequestFields)
+	unknownField := &bind.UnknownFieldError{}
+	if errors.As(err, &unknownField) {
+		apierror.Field(ctx, unknownField.Field, constant.ErrUnknownField)
+		return
+	} else if err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	if err := bind.CheckID(ctx, sameAccountID(accountID)); err != nil {
+		apierror.Response(ctx, constant.ErrIDConflict)
+		return
+	}
+
+	tag, err := ctrl.svc.Replace(ctx.Request.Context(), accountID, ctx.GetHeader("If-Match"), request)
 	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusUnauthorized)
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("replace account failed", "error", err)
+		}
+		apierror.Response(ctx, err)
 		return
 	}
 
-	err = ctrl.svc.Delete(accountID)
+	ctrl.recordAudit(ctx, accountID, constant.AuditActionReplace, accountID, nil)
+	ctrl.webhook.Publish(accountID, constant.WebhookEventAccountUpdated)
+	ctx.Header("ETag", tag)
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// ProbeExistence godoc
+// @Summary Probe Account Existence
+// @Description Check whether an account exists, only admins get the answer. Depending on EXISTENCE_PROBE_POLICY other callers get an ambiguous result or 403.
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string false "Bearer Token"
+// @Param Payload body http.ExistenceProbe true "Payload"
+// @Success 200 {object} http.ExistenceProbeResult
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 429 {object} apierror.Envelope "Too Many Requests"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/exists [post]
+func (ctrl *Controller) ProbeExistence(ctx *gin.Context) {
+	request := entity.ExistenceProbe{}
+	err := rest.BindJSON(ctx, &request)
 	if err != nil {
-		if errors.Is(err, constant.ErrAccountNotRegistered) {
-			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-				"accounts": constant.ErrAccountNotRegistered.Error()})
-			return
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	isAdmin := false
+	if accountID, err := jwt.ExtractID(ctx.GetHeader("Authorization")); err == nil {
+		isAdmin, _ = ctrl.svc.CheckAdminByID(ctx.Request.Context(), accountID)
+	}
+	if !isAdmin && constant.ExistenceProbePolicy == constant.ExistenceProbeAdminOnly {
+		apierror.Response(ctx, constant.ErrForbidden)
+		return
+	}
+
+	response, err := ctrl.svc.ProbeExistence(ctx.Request.Context(), request, ctx.ClientIP(), isAdmin)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("probe existence failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// DiagnoseLogin godoc
+// @Summary Diagnose Login
+// @Description Admin only, report why a login with the username would currently be rejected or restricted
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.DiagnoseLogin true "Payload"
+// @Success 200 {object} http.LoginDiagnosis
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 429 {object} apierror.Envelope "Too Many Requests"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/auth/diagnose [post]
+func (ctrl *Controller) DiagnoseLogin(ctx *gin.Context) {
+	adminID, ok := ctrl.authorizeAdmin(ctx)
+	if !ok {
+		return
+	}
+
+	request := entity.DiagnoseLogin{}
+	err := rest.BindJSON(ctx, &request)
+	if err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	response, err := ctrl.svc.DiagnoseLogin(ctx.Request.Context(), adminID, request)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("diagnose login failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// ConfirmEmailChange godoc
+// @Summary Confirm Email Change
+// @Description Apply a pending email change with the token of the link sent to the new address, until then login and notifications keep the old email
+// @Tags Accounts
+// @Param token query string true "email change token"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 409 {object} apierror.Envelope "Conflict"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/email/confirm [get]
+func (ctrl *Controller) ConfirmEmailChange(ctx *gin.Context) {
+	plainToken := ctx.Query("token")
+	if plainToken == "" {
+		apierror.Response(ctx, constant.ErrInvalidToken)
+		return
+	}
+
+	err := ctrl.svc.ConfirmEmailChange(ctx.Request.Context(), plainToken)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("confirm email change failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// VerifyEmail godoc
+// @Summary Verify Email
+// @Description Verify the account email with the token of the link sent after registration, a token works once and expires after VERIFICATION_TOKEN_TTL
+// @Tags Accounts
+// @Param token query string true "verification token"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/verify [get]
+func (ctrl *Controller) VerifyEmail(ctx *gin.Context) {
+	plainToken := ctx.Query("token")
+	if plainToken == "" {
+		apierror.Response(ctx, constant.ErrInvalidToken)
+		return
+	}
+
+	err := ctrl.svc.VerifyEmail(ctx.Request.Context(), plainToken)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("verify email failed", "error", err)
 		}
-		rest.ResponseMessage(ctx, http.StatusInternalServerError)
-		log.Println("delete account: ", err.Error())
+		apierror.Response(ctx, err)
 		return
 	}
-		
+
 	rest.ResponseMessage(ctx, http.StatusOK)
 }
+
+// AcceptTerms godoc
+// @Summary Accept Terms
+// @Description Record the acceptance of the current terms version
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.AcceptTerms true "Payload"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/terms [post]
+func (ctrl *Controller) AcceptTerms(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	request := entity.AcceptTerms{}
+	err := rest.BindJSON(ctx, &request)
+	if err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	err = ctrl.svc.AcceptTerms(ctx.Request.Context(), accountID, request)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("accept terms failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// GetPermissions godoc
+// @Summary Get Own Permissions
+// @Description Get the resolved permissions of the authenticated account, the response can be revalidated with If-None-Match
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param If-None-Match header string false "ETag of a previous response"
+// @Success 200 {object} http.GetPermissions
+// @Success 304 {string} string "Not Modified"
+// @Header 200 {string} ETag "Permission set version"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/me/permissions [get]
+func (ctrl *Controller) GetPermissions(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	response, err := ctrl.svc.TakePermissions(ctx.Request.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) {
+			apierror.Response(ctx, constant.ErrUnauthorized)
+			return
+		}
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("get permissions failed", "error", err)
+		return
+	}
+
+	content, _ := json.Marshal(response)
+	tag := etag.FromContent(content)
+	ctx.Header("ETag", tag)
+	ctx.Header("Cache-Control", "private, max-age=60")
+	if etag.Match(ctx.GetHeader("If-None-Match"), tag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// GetBundle godoc
+// @Summary Get Own Bundle
+// @Description Get the profile, preferences, permissions and session count of the authenticated account in one response
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param sections query string false "comma separated sections to include: profile, preferences, permissions, sessions, all by default"
+// @Success 200 {object} http.MeBundle
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/me/bundle [get]
+func (ctrl *Controller) GetBundle(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	sections, err := bundleSections(ctx.Query("sections"))
+	if err != nil {
+		apierror.Field(ctx, "sections", err)
+		return
+	}
+
+	response := entity.MeBundle{}
+	if sections[constant.BundleSectionProfile] || sections[constant.BundleSectionPreferences] {
+		profile, err := ctrl.svc.TakeAccountByID(ctx.Request.Context(), accountID)
+		if err != nil {
+			if errors.Is(err, constant.ErrAccountNotRegistered) {
+				apierror.Response(ctx, constant.ErrUnauthorized)
+				return
+			} else if apierror.Interrupted(err) {
+				apierror.Response(ctx, err)
+				return
+			}
+			apierror.Response(ctx, constant.ErrInternal)
+			ctrl.logger.For(ctx).Error("bundle profile failed", "error", err)
+			return
+		}
+		if sections[constant.BundleSectionProfile] {
+			response.Profile = &profile
+		}
+		if sections[constant.BundleSectionPreferences] {
+			visibility, err := ctrl.svc.TakeVisibility(ctx.Request.Context(), accountID)
+			if err != nil {
+				apierror.Response(ctx, constant.ErrInternal)
+				ctrl.logger.For(ctx).Error("bundle visibility failed", "error", err)
+				return
+			}
+			response.Preferences = &entity.Preferences{
+				Locale:     profile.Locale,
+				Visibility: visibility,
+			}
+		}
+	}
+	if sections[constant.BundleSectionPermissions] {
+		permissions, err := ctrl.svc.TakePermissions(ctx.Request.Context(), accountID)
+		if err != nil {
+			if errors.Is(err, constant.ErrAccountNotRegistered) {
+				apierror.Response(ctx, constant.ErrUnauthorized)
+				return
+			}
+			apierror.Response(ctx, constant.ErrInternal)
+			ctrl.logger.For(ctx).Error("bundle permissions failed", "error", err)
+			return
+		}
+		response.Permissions = &permissions
+	}
+	if sections[constant.BundleSectionSessions] {
+		sessions, err := ctrl.security.FindSessions(accountID, "")
+		if err != nil {
+			apierror.Response(ctx, constant.ErrInternal)
+			ctrl.logger.For(ctx).Error("bundle sessions failed", "error", err)
+			return
+		}
+		response.Sessions = &entity.SessionSummary{Active: len(sessions)}
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// bundleSections parses the comma separated selector, an empty selector selects every section
+func bundleSections(selector string) (sections map[string]bool, err error) {
+	known := []string{
+		constant.BundleSectionProfile,
+		constant.BundleSectionPreferences,
+		constant.BundleSectionPermissions,
+		constant.BundleSectionSessions,
+	}
+	sections = map[string]bool{}
+	if strings.TrimSpace(selector) == "" {
+		for _, section := range known {
+			sections[section] = true
+		}
+		return
+	}
+
+	for _, section := range strings.Split(selector, ",") {
+		section = strings.TrimSpace(section)
+		valid := false
+		for i := range known {
+			valid = valid || known[i] == section
+		}
+		if !valid {
+			err = errors.Wrap(constant.ErrInvalidBundleSection, section)
+			return
+		}
+		sections[section] = true
+	}
+	return
+}
+
+// GetStorageUsage godoc
+// @Summary Get Own Storage Usage
+// @Description Get the stored footprint of the authenticated account broken down by artifact type
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} http.StorageUsage
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/me/storage [get]
+func (ctrl *Controller) GetStorageUsage(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	response, err := ctrl.svc.StorageUsage(ctx.Request.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) {
+			apierror.Response(ctx, constant.ErrUnauthorized)
+			return
+		}
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("get storage usage failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// GetCard godoc
+// @Summary Get Own Profile Card
+// @Description Get the profile card of the authenticated account with every field
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} http.GetCard
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/card [get]
+func (ctrl *Controller) GetCard(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	response, err := ctrl.svc.TakeCard(ctx.Request.Context(), accountID, accountID)
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("get card failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// GetCardByID godoc
+// @Summary Get Profile Card
+// @Description Get the profile card of an account, fields the owner did not make public are omitted for other viewers
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string false "Bearer Token"
+// @Param id path string true "Account ID"
+// @Success 200 {object} http.GetCard
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/{id}/card [get]
+func (ctrl *Controller) GetCardByID(ctx *gin.Context) {
+	accountID, err := publicid.Decode(ctx.Param("id"))
+	if err != nil {
+		apierror.Field(ctx, "id", err)
+		return
+	}
+
+	// anonymous viewers are allowed
+	viewerID, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
+	if err != nil {
+		viewerID = 0
+	}
+
+	response, err := ctrl.svc.TakeCard(ctx.Request.Context(), accountID, viewerID)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("get card by id failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// GetCardByHandle godoc
+// @Summary Get Profile Card By Handle
+// @Description Get the profile card of an account by its handle, fields the owner did not make public are omitted for other viewers
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string false "Bearer Token"
+// @Param slug path string true "Handle"
+// @Success 200 {object} http.GetCard
+// @Success 301 {string} string "Moved Permanently, a previous handle redirects to the current one during its grace period"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/handle/{slug} [get]
+func (ctrl *Controller) GetCardByHandle(ctx *gin.Context) {
+	// anonymous viewers are allowed
+	viewerID, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
+	if err != nil {
+		viewerID = 0
+	}
+
+	response, err := ctrl.svc.TakeCardByHandle(ctx.Request.Context(), ctx.Param("slug"), viewerID)
+	if err != nil {
+		moved := &account.HandleMovedError{}
+		if errors.As(err, &moved) {
+			ctx.Redirect(http.StatusMovedPermanently, "/v1/accounts/handle/"+moved.Handle)
+			return
+		}
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("get card by handle failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// UpdateHandle godoc
+// @Summary Update Handle
+// @Description Change the handle of the account, it must be unique and already in slug form. The previous handle redirects to the new one for HANDLE_REDIRECT_TTL.
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.UpdateHandle true "Payload"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 409 {object} apierror.Envelope "Resource Conflict"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/handle [patch]
+func (ctrl *Controller) UpdateHandle(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	request := entity.UpdateHandle{}
+	err := rest.BindJSON(ctx, &request)
+	if err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	err = ctrl.svc.UpdateHandle(ctx.Request.Context(), accountID, request)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("update handle failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	ctrl.webhook.Publish(accountID, constant.WebhookEventAccountUpdated)
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// UploadAvatar godoc
+// @Summary Upload Avatar
+// @Description Upload a jpeg or png of at most AVATAR_MAX_BYTES and AVATAR_MAX_PIXELS as the photo of the account, the resized variants are generated in the background
+// @Tags Accounts
+// @Accept multipart/form-data
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param avatar formData file true "Avatar image"
+// @Success 200 {object} http.UploadedAvatar
+// @Failure 400 {object} apierror.Envelope "Bad Request, the file is missing or not a jpeg or png"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 413 {object} apierror.Envelope "Request Entity Too Large, the file or its dimensions are too large"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Failure 503 {object} apierror.Envelope "Service Unavailable, avatar processing is busy"
+// @Router /v1/accounts/avatar [post]
+func (ctrl *Controller) UploadAvatar(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	header, err := ctx.FormFile("avatar")
+	if err == http.ErrMissingFile {
+		apierror.Response(ctx, constant.ErrAvatarMissing)
+		return
+	} else if err != nil {
+		ctrl.logger.For(ctx).Warn("read multipart form failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+	if header.Size > int64(constant.AvatarMaxBytes) {
+		apierror.Response(ctx, constant.ErrAvatarTooLarge)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("open avatar failed", "error", err)
+		return
+	}
+	defer file.Close()
+	original, err := ioutil.ReadAll(io.LimitReader(file, int64(constant.AvatarMaxBytes)+1))
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("read avatar failed", "error", err)
+		return
+	}
+
+	photoURL, err := ctrl.svc.UploadAvatar(ctx.Request.Context(), accountID, original)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("upload avatar failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	ctrl.webhook.Publish(accountID, constant.WebhookEventAccountUpdated)
+	rest.ResponseData(ctx, http.StatusOK, entity.UploadedAvatar{PhotoURL: photoURL})
+}
+
+// GetVisibility godoc
+// @Summary Get Profile Card Visibility
+// @Description Get the visibility of every profile card field
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/visibility [get]
+func (ctrl *Controller) GetVisibility(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	response, err := ctrl.svc.TakeVisibility(ctx.Request.Context(), accountID)
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("get visibility failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// UpdateVisibility godoc
+// @Summary Update Profile Card Visibility
+// @Description Set fields to public, followers or private, fields not in the payload are kept
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.UpdateVisibility true "Payload"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/visibility [patch]
+func (ctrl *Controller) UpdateVisibility(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	request := entity.UpdateVisibility{}
+	err := rest.BindJSON(ctx, &request)
+	if err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	err = ctrl.svc.UpdateVisibility(ctx.Request.Context(), accountID, request)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("update visibility failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// Delete godoc
+// @Summary Delete Account
+// @Description Schedule the deletion of the account by the user itself, it is hidden from other accounts and can be cancelled by logging in and calling deletion/cancel within ACCOUNT_DELETION_GRACE, after which it is purged. Downstream systems are notified and with DELETION_WEBHOOK_MODE=require_ack must acknowledge first
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} http.DeletionScheduled
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 409 {object} apierror.Envelope "Resource Conflict"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Failure 503 {object} apierror.Envelope "Downstream Cleanup Not Acknowledged"
+// @Router /v1/accounts [delete]
+func (ctrl *Controller) Delete(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	// with require_ack the account is only deleted once every downstream system cleaned up
+	requireAck := constant.DeletionWebhookMode == constant.DeletionWebhookRequireAck
+	if requireAck {
+		exist, err := ctrl.svc.CheckAccountByID(ctx.Request.Context(), accountID)
+		if apierror.Interrupted(err) {
+			apierror.Response(ctx, err)
+			return
+		} else if err != nil {
+			apierror.Response(ctx, constant.ErrInternal)
+			ctrl.logger.For(ctx).Error("check account by id failed", "error", err)
+			return
+		}
+		if !exist {
+			apierror.Response(ctx, constant.ErrAccountNotRegistered)
+			return
+		}
+
+		err = ctrl.webhook.NotifyDeletion(accountID, true)
+		if err != nil {
+			if !apierror.Known(err) {
+				ctrl.logger.For(ctx).Error("notify deletion failed", "error", err)
+			}
+			apierror.Response(ctx, err)
+			return
+		}
+	}
+
+	scheduledAt, err := ctrl.svc.RequestDeletion(ctx.Request.Context(), accountID)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("request account deletion failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	if !requireAck {
+		if err := ctrl.webhook.NotifyDeletion(accountID, false); err != nil {
+			ctrl.logger.For(ctx).Error("notify deletion failed", "error", err)
+		}
+	}
+	ctrl.recordAudit(ctx, accountID, constant.AuditActionDelete, accountID, nil)
+	rest.ResponseData(ctx, http.StatusOK, entity.DeletionScheduled{
+		DeletionScheduledAt: scheduledAt,
+	})
+}
+
+// CancelDeletion godoc
+// @Summary Cancel Account Deletion
+// @Description Cancel the pending deletion of the account by the user itself, it is allowed until ACCOUNT_DELETION_GRACE after the deletion was requested
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {string} string "Success"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 409 {object} apierror.Envelope "No Pending Deletion"
+// @Failure 410 {object} apierror.Envelope "Deletion Grace Expired"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/deletion/cancel [post]
+func (ctrl *Controller) CancelDeletion(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	err := ctrl.svc.CancelDeletion(ctx.Request.Context(), accountID)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("cancel account deletion failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	ctrl.recordAudit(ctx, accountID, constant.AuditActionCancelDelete, accountID, nil)
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// EnableTOTP godoc
+// @Summary Enroll Two Factor
+// @Description Generate a TOTP secret for the authenticator app of the user, the otpauth uri is rendered as a QR code. Logins ask for a code once ConfirmTOTP accepted the first one, enrolling again before that replaces the secret
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} http.TOTPEnrollment
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 409 {object} apierror.Envelope "Two Factor Already Enabled"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Failure 503 {object} apierror.Envelope "Two Factor Not Configured"
+// @Router /v1/accounts/totp [post]
+func (ctrl *Controller) EnableTOTP(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	enrollment, err := ctrl.svc.EnableTOTP(ctx.Request.Context(), accountID)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("enable totp failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	// the secret is only shown once
+	ctx.Header("Cache-Control", "no-store")
+	rest.ResponseData(ctx, http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm Two Factor
+// @Description Turn two factor login on with the first code of the enrolled secret, codes of the previous and the next 30 seconds are accepted too
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.ConfirmTOTP true "Payload"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason, or invalid_totp_code"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 409 {object} apierror.Envelope "Not Enrolled or Already Enabled"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Failure 503 {object} apierror.Envelope "Two Factor Not Configured"
+// @Router /v1/accounts/totp/confirm [post]
+func (ctrl *Controller) ConfirmTOTP(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	request := entity.ConfirmTOTP{}
+	err := rest.BindJSON(ctx, &request)
+	if err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	err = ctrl.svc.ConfirmTOTP(ctx.Request.Context(), accountID, request.Code)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("confirm totp failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	ctrl.recordAudit(ctx, accountID, constant.AuditActionTOTPEnable, accountID, nil)
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// ResendVerification godoc
+// @Summary Resend Verification Email
+// @Description Send the verification email again, a link sent within VERIFICATION_REUSE_WINDOW is sent again and stays valid
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 409 {object} apierror.Envelope "Resource Conflict"
+// @Failure 429 {object} apierror.Envelope "Too Many Requests"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/verification/resend [post]
+func (ctrl *Controller) ResendVerification(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	err := ctrl.svc.ResendVerification(ctx.Request.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) {
+			apierror.Response(ctx, constant.ErrUnauthorized)
+			return
+		}
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("resend verification failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// SendVerificationBulk godoc
+// @Summary Send Verification Emails In Bulk
+// @Description Enqueue verification emails for unverified accounts matching the filter, Admin Only
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.SendVerificationBulk true "Payload"
+// @Success 200 {object} http.SendVerificationBulkResult
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/verification/bulk [post]
+func (ctrl *Controller) SendVerificationBulk(ctx *gin.Context) {
+	if _, ok := ctrl.authorizeAdmin(ctx); !ok {
+		return
+	}
+
+	request := entity.SendVerificationBulk{}
+	err := rest.BindJSON(ctx, &request)
+	if err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	count, err := ctrl.svc.SendVerificationBulk(ctx.Request.Context(), request)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("send verification bulk failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, entity.SendVerificationBulkResult{
+		Enqueued: count,
+	})
+}
+
+// Export godoc
+// @Summary Export Accounts
+// @Description Stream every account as newline delimited json in id order, Admin Only. Personal fields are only exported for admins with the accounts.pii.read permission. An interrupted export is resumed by passing the id of the last received line as from_id.
+// @Description With format=csv the accounts are streamed as a csv attachment sorted like the list, the email, phone, KTP and other personal columns are only added with include_pii=true, which needs accounts.pii.read.
+// @Tags Accounts
+// @Produce application/x-ndjson
+// @Produce text/csv
+// @Param Authorization header string true "Bearer Token"
+// @Param from_id query string false "export the accounts after this account id"
+// @Param format query string false "csv for a csv attachment, newline delimited json by default"
+// @Param sort query string false "csv only, id, username, fullname, handle, created_at or updated_at, default id"
+// @Param order query string false "csv only, asc or desc, default asc"
+// @Param include_pii query bool false "csv only, add the personal columns"
+// @Success 200 {object} http.ExportAccount
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Header 200 {string} X-Encrypted-Fields "Fields encrypted with the shared key, only set when RESPONSE_ENCRYPTION_KEY is"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/export [get]
+func (ctrl *Controller) Export(ctx *gin.Context) {
+	if ctx.Query("format") == "csv" {
+		ctrl.ExportCSV(ctx)
+		return
+	}
+
+	adminID, ok := ctrl.authorizeAdmin(ctx)
+	if !ok {
+		return
+	}
+
+	canExport, err := ctrl.svc.HasPermission(ctx.Request.Context(), adminID, permission.ExportAccounts)
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("check export permission failed", "error", err)
+		return
+	}
+	if !canExport {
+		apierror.Response(ctx, constant.ErrForbidden)
+		return
+	}
+	includePII, err := ctrl.svc.HasPermission(ctx.Request.Context(), adminID, permission.ReadAccountPII)
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("check pii permission failed", "error", err)
+		return
+	}
+
+	afterID := 0
+	if fromID := ctx.Query("from_id"); fromID != "" {
+		afterID, err = publicid.Decode(fromID)
+		if err != nil {
+			apierror.Field(ctx, "from_id", err)
+			return
+		}
+	}
+
+	// the status is sent with the first line, a failure after that can only end the stream
+	ctx.Header("Content-Type", "application/x-ndjson")
+	if ctrl.fieldCipher != nil {
+		ctx.Header("X-Encrypted-Fields", strings.Join(constant.ResponseEncryptedFields, ","))
+	}
+	ctx.Status(http.StatusOK)
+	encoder := json.NewEncoder(ctx.Writer)
+	lines := 0
+	err = ctrl.svc.Export(ctx.Request.Context(), afterID, includePII, func(line entity.ExportAccount) error {
+		var encoded interface{} = line
+		if ctrl.fieldCipher != nil {
+			encrypted, err := ctrl.fieldCipher.Fields(line, constant.ResponseEncryptedFields)
+			if err != nil {
+				return err
+			}
+			encoded = encrypted
+		}
+		err := encoder.Encode(encoded)
+		if err != nil {
+			return err
+		}
+		lines++
+		if lines%constant.ExportBatchSize == 0 {
+			ctx.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		ctrl.logger.For(ctx).Error("export accounts failed", "error", err)
+		return
+	}
+	ctx.Writer.Flush()
+}
+
+// exportCSVColumns are the columns of the csv export in order, the pii ones are only written with include_pii
+var exportCSVColumns = []struct {
+	name  string
+	pii   bool
+	value func(line entity.ExportAccount) string
+}{
+	{"id", false, func(line entity.ExportAccount) string { return line.ID }},
+	{"username", false, func(line entity.ExportAccount) string { return line.Username }},
+	{"handle", false, func(line entity.ExportAccount) string { return line.Handle }},
+	{"fullname", false, func(line entity.ExportAccount) string { return line.FullName }},
+	{"display_name", false, func(line entity.ExportAccount) string { return line.DisplayName }},
+	{"job_position", false, func(line entity.ExportAccount) string { return line.JobPosition }},
+	{"role", false, func(line entity.ExportAccount) string { return line.Role }},
+	{"locale", false, func(line entity.ExportAccount) string { return line.Locale }},
+	{"is_verified", false, func(line entity.ExportAccount) string { return strconv.FormatBool(line.IsVerified) }},
+	{"created_at", false, func(line entity.ExportAccount) string { return line.CreatedAt.UTC().Format(time.RFC3339) }},
+	{"updated_at", false, func(line entity.ExportAccount) string { return line.UpdatedAt.UTC().Format(time.RFC3339) }},
+	{"email", true, func(line entity.ExportAccount) string { return line.Email }},
+	{"phone_number", true, func(line entity.ExportAccount) string { return line.PhoneNumber }},
+	{"ktp_number", true, func(line entity.ExportAccount) string { return line.KTPNumber }},
+	{"employee_number", true, func(line entity.ExportAccount) string { return line.EmployeeNumber }},
+	{"address", true, func(line entity.ExportAccount) string { return line.Address }},
+	{"date_of_birth", true, func(line entity.ExportAccount) string { return line.DateOfBirth }},
+}
+
+// encryptedFields is constant.ResponseEncryptedFields as a set for the csv columns
+var encryptedFields = func() map[string]bool {
+	fields := map[string]bool{}
+	for _, field := range constant.ResponseEncryptedFields {
+		fields[field] = true
+	}
+	return fields
+}()
+
+// ExportCSV streams the accounts as a csv attachment for Export with format=csv, the rows are written
+// as they are read so the export is never held in memory. Columns listed in RESPONSE_ENCRYPTED_FIELDS
+// are encrypted like in the json export
+func (ctrl *Controller) ExportCSV(ctx *gin.Context) {
+	adminID, ok := ctrl.authorizeAdmin(ctx)
+	if !ok {
+		return
+	}
+
+	canExport, err := ctrl.svc.HasPermission(ctx.Request.Context(), adminID, permission.ExportAccounts)
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("check export permission failed", "error", err)
+		return
+	}
+	if !canExport {
+		apierror.Response(ctx, constant.ErrForbidden)
+		return
+	}
+	includePII := ctx.Query("include_pii") == "true"
+	if includePII {
+		canReadPII, err := ctrl.svc.HasPermission(ctx.Request.Context(), adminID, permission.ReadAccountPII)
+		if err != nil {
+			apierror.Response(ctx, constant.ErrInternal)
+			ctrl.logger.For(ctx).Error("check pii permission failed", "error", err)
+			return
+		}
+		if !canReadPII {
+			apierror.Response(ctx, constant.ErrForbidden)
+			return
+		}
+	}
+
+	sortBy, order := ctx.Query("sort"), strings.ToLower(ctx.Query("order"))
+	header := []string{}
+	for _, column := range exportCSVColumns {
+		if includePII || !column.pii {
+			header = append(header, column.name)
+		}
+	}
+
+	// the response starts with the first row so an invalid sort still gets its error response,
+	// a failure after that can only end the stream
+	writer := csv.NewWriter(ctx.Writer)
+	started := false
+	start := func() error {
+		started = true
+		fileName := fmt.Sprintf("accounts-%s.csv", time.Now().UTC().Format("20060102-150405"))
+		ctx.Header("Content-Type", "text/csv")
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+		ctx.Status(http.StatusOK)
+		return writer.Write(header)
+	}
+	rows := 0
+	err = ctrl.svc.ExportSorted(ctx.Request.Context(), sortBy, order, includePII, func(line entity.ExportAccount) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		record := make([]string, 0, len(header))
+		for _, column := range exportCSVColumns {
+			if !includePII && column.pii {
+				continue
+			}
+			value := column.value(line)
+			if ctrl.fieldCipher != nil && value != "" && encryptedFields[column.name] {
+				encrypted, err := ctrl.fieldCipher.Encrypt(column.name, value)
+				if err != nil {
+					return err
+				}
+				value = encrypted
+			} else {
+				value = csvSafe(value)
+			}
+			record = append(record, value)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		rows++
+		if rows%constant.ExportBatchSize == 0 {
+			writer.Flush()
+			ctx.Writer.Flush()
+		}
+		return writer.Error()
+	})
+	if err != nil && !started {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("export accounts csv failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	} else if err != nil {
+		ctrl.logger.For(ctx).Error("export accounts csv failed", "error", err)
+		return
+	}
+	if !started {
+		if err := start(); err != nil {
+			ctrl.logger.For(ctx).Error("export accounts csv failed", "error", err)
+			return
+		}
+	}
+	writer.Flush()
+	ctx.Writer.Flush()
+}
+
+// csvSafe prefixes a value a spreadsheet would run as a formula with a quote, compliance opens the export there
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ScanIntegrity godoc
+// @Summary Scan Account Integrity
+// @Description Verify the checksum of every account and list the ones that do not match, Admin Only
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} http.IntegrityScan
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/integrity [get]
+func (ctrl *Controller) ScanIntegrity(ctx *gin.Context) {
+	if _, ok := ctrl.authorizeAdmin(ctx); !ok {
+		return
+	}
+
+	response, err := ctrl.svc.ScanIntegrity(ctx.Request.Context())
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("scan account integrity failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// Restore godoc
+// @Summary Restore Account
+// @Description Restore a deleted account within ACCOUNT_RESTORE_WINDOW, Admin Only
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.RestoreAccount true "Payload"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 409 {object} apierror.Envelope "Account Not Deleted"
+// @Failure 410 {object} apierror.Envelope "Restore Window Expired"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/restore [post]
+func (ctrl *Controller) Restore(ctx *gin.Context) {
+	adminID, ok := ctrl.authorizeAdmin(ctx)
+	if !ok {
+		return
+	}
+
+	request := entity.RestoreAccount{}
+	if err := rest.BindJSON(ctx, &request); err != nil {
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	accountID, err := publicid.Decode(request.ID)
+	if err != nil {
+		apierror.Field(ctx, "id", err)
+		return
+	}
+
+	err = ctrl.svc.Restore(ctx.Request.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) || errors.Is(err, constant.ErrInvalidID) {
+			apierror.Response(ctx, constant.ErrAccountNotRegistered)
+			return
+		}
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("restore account failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	ctrl.recordAudit(ctx, adminID, constant.AuditActionRestore, accountID, nil)
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// UpdateRole godoc
+// @Summary Update Account Role
+// @Description Promote or demote an account, Admin Only. Admins cannot change their own role, the new role applies from the account's next login
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.UpdateRole true "Payload, role is admin or user"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/role [patch]
+func (ctrl *Controller) UpdateRole(ctx *gin.Context) {
+	adminID, ok := ctrl.authorizeAdmin(ctx)
+	if !ok {
+		return
+	}
+
+	request := entity.UpdateRole{}
+	if err := rest.BindJSON(ctx, &request); err != nil {
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	accountID, err := publicid.Decode(request.ID)
+	if err != nil {
+		apierror.Field(ctx, "id", err)
+		return
+	}
+
+	previous, err := ctrl.svc.UpdateRole(ctx.Request.Context(), adminID, accountID, request.Role)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) || errors.Is(err, constant.ErrInvalidID) {
+			apierror.Response(ctx, constant.ErrAccountNotRegistered)
+			return
+		}
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("update role failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	if previous != request.Role {
+		ctrl.recordAudit(ctx, adminID, constant.AuditActionRoleChange, accountID, map[string]string{
+			"from": previous, "to": request.Role})
+	}
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// Suspend godoc
+// @Summary Suspend Account
+// @Description Block the login and the issued tokens of an account without deleting it, Admin Only. Admins cannot suspend themselves, the reason shows in the account detail
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param id path string true "Account ID"
+// @Param Payload body http.SuspendAccount true "Payload"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/{id}/suspend [post]
+func (ctrl *Controller) Suspend(ctx *gin.Context) {
+	adminID, ok := ctrl.authorizeAdmin(ctx)
+	if !ok {
+		return
+	}
+
+	accountID, err := publicid.Decode(ctx.Param("id"))
+	if err != nil {
+		apierror.Field(ctx, "id", err)
+		return
+	}
+
+	request := entity.SuspendAccount{}
+	if err := rest.BindJSON(ctx, &request); err != nil {
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	if adminID == accountID {
+		apierror.Response(ctx, constant.ErrSelfSuspend)
+		return
+	}
+
+	err = ctrl.svc.Suspend(ctx.Request.Context(), accountID, request.Reason)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("suspend account failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	// the stored status already blocks the login, a retry blacklists the issued tokens again
+	err = jwt.SuspendAccount(accountID)
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("blacklist suspended account failed", "error", err)
+		return
+	}
+
+	ctrl.recordAudit(ctx, adminID, constant.AuditActionSuspend, accountID, map[string]string{
+		"reason": request.Reason})
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// AdminResetPassword godoc
+// @Summary Reset Password Of Account
+// @Description Set the password of an account for support staff and clear its lockout, Admin Only. Without a password a temporary one is generated and returned once. Until the owner changes it their tokens only reach GET /v1/accounts, PATCH /v1/accounts/password and logout
+// @Tags Accounts
+// @Accept application/json
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param id path string true "Account ID"
+// @Param Payload body http.AdminResetPassword true "Payload"
+// @Success 200 {object} http.AdminPasswordReset
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/{id}/reset-password [post]
+func (ctrl *Controller) AdminResetPassword(ctx *gin.Context) {
+	adminID, ok := ctrl.authorizeAdmin(ctx)
+	if !ok {
+		return
+	}
+
+	accountID, err := publicid.Decode(ctx.Param("id"))
+	if err != nil {
+		apierror.Field(ctx, "id", err)
+		return
+	}
+
+	request := entity.AdminResetPassword{}
+	// the request may hold the password, it is never logged
+	if err := rest.BindJSON(ctx, &request); err != nil {
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	temporary, err := ctrl.svc.AdminResetPassword(ctx.Request.Context(), adminID, accountID, request.Password)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("admin reset password failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	// the password is already replaced, failing now would lose the temporary one and lock the account out.
+	// The stored flag limits the next login, this limits the tokens issued before
+	err = jwt.RequirePasswordChange(accountID)
+	if err != nil {
+		ctrl.logger.For(ctx).Error("limit tokens to password change failed", "account_id", accountID, "error", err)
+	}
+
+	response := entity.AdminPasswordReset{
+		TemporaryPassword:  temporary,
+		MustChangePassword: true,
+	}
+	if request.RevokeSessions {
+		response.RevokedSessions, err = ctrl.security.RevokeSessions(accountID)
+		if err != nil {
+			ctrl.logger.For(ctx).Error("revoke sessions failed", "account_id", accountID, "error", err)
+		}
+	}
+
+	ctrl.recordAudit(ctx, adminID, constant.AuditActionForceReset, accountID, map[string]string{
+		"generated":        strconv.FormatBool(temporary != ""),
+		"revoked_sessions": strconv.Itoa(response.RevokedSessions)})
+	ctrl.logger.For(ctx).Info("password reset by admin", "admin_id", adminID, "account_id", accountID)
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// Activate godoc
+// @Summary Activate Account
+// @Description Lift the suspension of an account, Admin Only
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param id path string true "Account ID"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/{id}/activate [post]
+func (ctrl *Controller) Activate(ctx *gin.Context) {
+	adminID, ok := ctrl.authorizeAdmin(ctx)
+	if !ok {
+		return
+	}
+
+	accountID, err := publicid.Decode(ctx.Param("id"))
+	if err != nil {
+		apierror.Field(ctx, "id", err)
+		return
+	}
+
+	err = ctrl.svc.Activate(ctx.Request.Context(), accountID)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("activate account failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	err = jwt.ActivateAccount(accountID)
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("remove activated account from blacklist failed", "error", err)
+		return
+	}
+
+	ctrl.recordAudit(ctx, adminID, constant.AuditActionActivate, accountID, nil)
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+// MergeAccounts godoc
+// @Summary Merge Accounts
+// @Description Merge the source account into the target, Admin Only. Empty target fields are filled from the source and conflicting fields are resolved by the strategy, the source is deleted and its attendances move to the target.
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.MergeAccounts true "Payload, strategy is prefer_target, prefer_source, prefer_newest or per_field"
+// @Success 200 {object} http.MergeReport
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 422 {object} apierror.Envelope "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/merge [post]
+func (ctrl *Controller) MergeAccounts(ctx *gin.Context) {
+	adminID, ok := ctrl.authorizeAdmin(ctx)
+	if !ok {
+		return
+	}
+
+	request := entity.MergeAccounts{}
+	if err := rest.BindJSON(ctx, &request); err != nil {
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		apierror.Validation(ctx, err)
+		return
+	}
+
+	sourceID, err := publicid.Decode(request.SourceID)
+	if err != nil {
+		apierror.Field(ctx, "source_id", err)
+		return
+	}
+	targetID, err := publicid.Decode(request.TargetID)
+	if err != nil {
+		apierror.Field(ctx, "target_id", err)
+		return
+	}
+
+	report, err := ctrl.svc.MergeAccounts(ctx.Request.Context(), sourceID, targetID, request.Strategy, request.Overrides)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) || errors.Is(err, constant.ErrInvalidID) {
+			apierror.Response(ctx, constant.ErrAccountNotRegistered)
+			return
+		}
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("merge accounts failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	ctrl.recordAudit(ctx, adminID, constant.AuditActionMerge, targetID, map[string]string{
+		"source_id": request.SourceID,
+		"strategy":  request.Strategy,
+	})
+	rest.ResponseData(ctx, http.StatusOK, report)
+}
+
+// BulkCreate godoc
+// @Summary Bulk Account Import
+// @Description Import accounts in the background and return the job id, with validate_only=true every row is only validated and a per-row report is returned.
+// @Description With sync=true at most 100 rows are imported within the request and the result of every row is returned, 201 when all were created and 207 when some failed. Admin Only
+// @Tags Accounts
+// @Param Authorization header string true "Bearer Token"
+// @Param validate_only query bool false "only validate the rows, nothing is inserted"
+// @Param sync query bool false "import within the request and return the per-row results"
+// @Param Payload body []http.RegisterUser true "Payload"
+// @Success 200 {object} http.BulkValidationReport
+// @Success 201 {object} http.BulkCreateReport
+// @Success 202 {object} http.BulkImportJob
+// @Success 207 {object} http.BulkCreateReport
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 413 {object} apierror.Envelope "Request Entity Too Large, the body is limited to BULK_IMPORT_MAX_BODY_BYTES"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/bulk [post]
+func (ctrl *Controller) BulkCreate(ctx *gin.Context) {
+	accountID, ok := ctrl.authorizeAdmin(ctx)
+	if !ok {
+		return
+	}
+
+	requests := []entity.RegisterUser{}
+	if err := rest.BindJSON(ctx, &requests); err != nil {
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+	if len(requests) == 0 {
+		apierror.Response(ctx, constant.ErrBulkImportEmpty)
+		return
+	}
+	if len(requests) > constant.BulkImportMaxRows {
+		apierror.Response(ctx, constant.ErrBulkImportTooLarge)
+		return
+	}
+
+	if ctx.Query("validate_only") == "true" {
+		report, err := ctrl.svc.ValidateBulk(ctx.Request.Context(), requests)
+		if err != nil {
+			apierror.Response(ctx, constant.ErrInternal)
+			ctrl.logger.For(ctx).Error("validate bulk failed", "error", err)
+			return
+		}
+
+		rest.ResponseData(ctx, http.StatusOK, report)
+		return
+	}
+
+	if ctx.Query("sync") == "true" {
+		if len(requests) > constant.BulkCreateSyncMaxRows {
+			apierror.Response(ctx, constant.ErrBulkImportTooLarge)
+			return
+		}
+
+		report := ctrl.importJob.BulkCreate(ctx.Request.Context(), accountID, requests)
+		status := http.StatusCreated
+		if report.Failed > 0 {
+			status = http.StatusMultiStatus
+		}
+		rest.ResponseData(ctx, status, report)
+		return
+	}
+
+	jobID, err := ctrl.importJob.Start(accountID, requests)
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("start import job failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusAccepted, entity.BulkImportJob{
+		JobID: aes.Encrypt(jobID),
+	})
+}
+
+// GetImportJob godoc
+// @Summary Get Bulk Import Job
+// @Description Get the status and progress of a bulk import job, Admin Only
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param jobId path string true "Job ID"
+// @Success 200 {object} http.GetImportJob
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/bulk/{jobId} [get]
+func (ctrl *Controller) GetImportJob(ctx *gin.Context) {
+	if _, ok := ctrl.authorizeAdmin(ctx); !ok {
+		return
+	}
+
+	jobID := aes.Decrypt(ctx.Param("jobId"))
+	if jobID <= 0 {
+		apierror.Field(ctx, "job_id", constant.ErrInvalidID)
+		return
+	}
+
+	response, err := ctrl.importJob.TakeByID(jobID)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("get import job failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// GetImportJobErrors godoc
+// @Summary Download Bulk Import Error Report
+// @Description Download the failed rows of a bulk import job as csv, Admin Only
+// @Tags Accounts
+// @Produce text/csv
+// @Param Authorization header string true "Bearer Token"
+// @Param jobId path string true "Job ID"
+// @Success 200 {file} file "index,field,error"
+// @Failure 400 {object} apierror.Envelope "Bad Request"
+// @Failure 401 {object} apierror.Envelope "Unauthorized"
+// @Failure 403 {object} apierror.Envelope "Forbidden"
+// @Failure 404 {object} apierror.Envelope "Not Found"
+// @Failure 500 {object} apierror.Envelope "Internal Server Error"
+// @Router /v1/accounts/bulk/{jobId}/errors [get]
+func (ctrl *Controller) GetImportJobErrors(ctx *gin.Context) {
+	if _, ok := ctrl.authorizeAdmin(ctx); !ok {
+		return
+	}
+
+	jobID := aes.Decrypt(ctx.Param("jobId"))
+	if jobID <= 0 {
+		apierror.Field(ctx, "job_id", constant.ErrInvalidID)
+		return
+	}
+
+	rows, err := ctrl.importJob.TakeErrorReport(jobID)
+	if err != nil {
+		if !apierror.Known(err) {
+			ctrl.logger.For(ctx).Error("get import job errors failed", "error", err)
+		}
+		apierror.Response(ctx, err)
+		return
+	}
+
+	report := &bytes.Buffer{}
+	writer := csv.NewWriter(report)
+	writer.Write([]string{"index", "field", "error"})
+	for _, row := range rows {
+		fields := make([]string, 0, len(row.Errors))
+		for field := range row.Errors {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			writer.Write([]string{strconv.Itoa(row.Index), field, row.Errors[field]})
+		}
+	}
+	writer.Flush()
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=import-%s-errors.csv", ctx.Param("jobId")))
+	ctx.Data(http.StatusOK, "text/csv", report.Bytes())
+}
+
+// recordAudit never fails the action it records, a missing entry is logged loudly instead
+func (ctrl *Controller) recordAudit(ctx *gin.Context, actorID int, action string, targetID int, metadata map[string]string) {
+	err := ctrl.audit.Record(actorID, action, targetID, ctx.ClientIP(), metadata)
+	if err != nil {
+		ctrl.logger.For(ctx).Error("AUDIT WRITE FAILED", "action", action, "actor_id", actorID, "target_id", targetID, "error", err)
+	}
+}
+
+// sameAccountID matches a body id holding the encrypted id of the account
+func sameAccountID(accountID int) func(raw json.RawMessage) bool {
+	return func(raw json.RawMessage) bool {
+		id := ""
+		if json.Unmarshal(raw, &id) != nil {
+			return false
+		}
+		decoded, err := publicid.Decode(id)
+		return err == nil && decoded == accountID
+	}
+}
+
+// authorizeAdmin aborts with 401/403 unless the account set by the auth middleware is an admin
+func (ctrl *Controller) authorizeAdmin(ctx *gin.Context) (accountID int, ok bool) {
+	accountID = ctx.GetInt(constant.AccountIDKey)
+
+	isAdmin, err := ctrl.svc.CheckAdminByID(ctx.Request.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) {
+			apierror.Response(ctx, constant.ErrUnauthorized)
+			return
+		}
+		apierror.Response(ctx, constant.ErrInternal)
+		ctrl.logger.For(ctx).Error("check admin by id failed", "error", err)
+		return
+	}
+	if !isAdmin {
+		apierror.Response(ctx, constant.ErrForbidden)
+		return
+	}
+	return accountID, true
+}
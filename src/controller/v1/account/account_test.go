@@ -0,0 +1,267 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go-rest-api/src/constant"
+	entity "go-rest-api/src/http"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/passwordpolicy"
+	"go-rest-api/src/pkg/phone"
+	"go-rest-api/src/service/v1/account"
+	"go-rest-api/src/service/v1/audit"
+	"go-rest-api/src/service/v1/security"
+	"go-rest-api/src/service/v1/webhook"
+
+	"github.com/forkyid/go-utils/v1/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if err := phone.Register(validation.Validator); err != nil {
+		panic(err)
+	}
+	if err := passwordpolicy.Register(validation.Validator, constant.PasswordPolicy); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// createdAccounts keeps the registrations that reached the service
+type createdAccounts struct {
+	account.Servicer
+	created []entity.RegisterUser
+}
+
+func (svc *createdAccounts) Create(ctx context.Context, request entity.RegisterUser) (accountID int, err error) {
+	svc.created = append(svc.created, request)
+	return len(svc.created), nil
+}
+
+type auditStub struct {
+	audit.Servicer
+}
+
+func (auditStub) Record(actorID int, action string, targetID int, ipAddress string, metadata map[string]string) (err error) {
+	return
+}
+
+// failedRegistrations keeps the reasons of the recorded failed registrations
+type failedRegistrations struct {
+	security.Servicer
+	reasons []string
+}
+
+func (svc *failedRegistrations) RecordFailedRegistration(fingerprint, reason string, fields []string) (err error) {
+	svc.reasons = append(svc.reasons, reason)
+	return
+}
+
+func TestRegisterHoneypot(t *testing.T) {
+	defaultField, defaultAction := constant.HoneypotField, constant.HoneypotAction
+	constant.HoneypotField = "website"
+	defer func() { constant.HoneypotField, constant.HoneypotAction = defaultField, defaultAction }()
+
+	tests := []struct {
+		name        string
+		action      string
+		website     string
+		wantStatus  int
+		wantCreated bool
+	}{
+		{"filled answers like a registration", constant.HoneypotActionFakeSuccess, "https://spam.example.com", http.StatusCreated, false},
+		{"filled is rejected", constant.HoneypotActionReject, "https://spam.example.com", http.StatusBadRequest, false},
+		{"empty registers", constant.HoneypotActionFakeSuccess, "", http.StatusCreated, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constant.HoneypotAction = tt.action
+			accounts, failed := &createdAccounts{}, &failedRegistrations{}
+			ctrl := NewController(accounts, nil, auditStub{}, failed, nil, nil, logger.New(io.Discard, logger.LevelError))
+			router := gin.New()
+			router.POST("/v1/accounts/register", ctrl.Register)
+
+			body := `{"username":"budi","fullname":"Budi Santoso","password":"Str0ng!Passw0rd","website":"` + tt.website + `"}`
+			request := httptest.NewRequest(http.MethodPost, "/v1/accounts/register", strings.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if created := len(accounts.created) == 1; created != tt.wantCreated {
+				t.Errorf("account created %v, want %v", created, tt.wantCreated)
+			}
+			bot := len(failed.reasons) == 1 && failed.reasons[0] == constant.RegistrationFailureHoneypot
+			if bot == tt.wantCreated {
+				t.Errorf("recorded failed registrations %v, want the honeypot recorded only for a filled field", failed.reasons)
+			}
+		})
+	}
+}
+
+// bundleAccounts answers the sections of the bundle for an account in the locale id
+type bundleAccounts struct {
+	account.Servicer
+}
+
+func (bundleAccounts) TakeAccountByID(ctx context.Context, accountID int) (user entity.GetUser, err error) {
+	return entity.GetUser{Username: "budi", Locale: "id"}, nil
+}
+
+func (bundleAccounts) TakeVisibility(ctx context.Context, accountID int) (visibility map[string]string, err error) {
+	return map[string]string{"email": constant.VisibilityPrivate}, nil
+}
+
+func (bundleAccounts) TakePermissions(ctx context.Context, accountID int) (permissions entity.GetPermissions, err error) {
+	return entity.GetPermissions{Role: constant.RoleUser, Permissions: []string{}}, nil
+}
+
+type sessionsStub struct {
+	security.Servicer
+}
+
+func (sessionsStub) FindSessions(accountID int, currentTokenID string) (responses []entity.GetSession, err error) {
+	return []entity.GetSession{{ID: "first"}, {ID: "second"}}, nil
+}
+
+func TestGetBundleSections(t *testing.T) {
+	ctrl := NewController(bundleAccounts{}, nil, auditStub{}, sessionsStub{}, nil, nil, logger.New(io.Discard, logger.LevelError))
+	router := gin.New()
+	router.GET("/v1/accounts/me/bundle", func(ctx *gin.Context) {
+		ctx.Set(constant.AccountIDKey, 7)
+		ctrl.GetBundle(ctx)
+	})
+
+	tests := []struct {
+		name         string
+		selector     string
+		wantStatus   int
+		wantSections []string
+	}{
+		{"every section by default", "", http.StatusOK, []string{"permissions", "preferences", "profile", "sessions"}},
+		{"selected sections", "preferences, sessions", http.StatusOK, []string{"preferences", "sessions"}},
+		{"unknown section", "profile,friends", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/accounts/me/bundle?sections="+url.QueryEscape(tt.selector), nil))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			response := struct {
+				Result map[string]json.RawMessage `json:"result"`
+			}{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("body %q is not json: %v", recorder.Body.String(), err)
+			}
+			sections := []string{}
+			for section := range response.Result {
+				sections = append(sections, section)
+			}
+			sort.Strings(sections)
+			if !reflect.DeepEqual(sections, tt.wantSections) {
+				t.Errorf("sections = %v, want %v", sections, tt.wantSections)
+			}
+		})
+	}
+
+	// the sections carry what the services answered
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/accounts/me/bundle", nil))
+	response := struct {
+		Result entity.MeBundle `json:"result"`
+	}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("body %q is not json: %v", recorder.Body.String(), err)
+	}
+	bundle := response.Result
+	if bundle.Profile == nil || bundle.Preferences == nil || bundle.Permissions == nil || bundle.Sessions == nil {
+		t.Fatalf("bundle = %+v, want every section", bundle)
+	}
+	if bundle.Profile.Username != "budi" || bundle.Preferences.Locale != "id" ||
+		bundle.Preferences.Visibility["email"] != constant.VisibilityPrivate ||
+		bundle.Permissions.Role != constant.RoleUser || bundle.Sessions.Active != 2 {
+		t.Errorf("bundle = %+v, want the answers of the services", bundle)
+	}
+}
+
+// deletingAccounts counts the deletions requested of a registered account
+type deletingAccounts struct {
+	account.Servicer
+	requested int
+}
+
+func (svc *deletingAccounts) CheckAccountByID(ctx context.Context, accountID int) (exist bool, err error) {
+	return true, nil
+}
+
+func (svc *deletingAccounts) RequestDeletion(ctx context.Context, accountID int) (scheduledAt time.Time, err error) {
+	svc.requested++
+	return time.Now().Add(constant.AccountDeletionGrace), nil
+}
+
+// deletionWebhook answers every deletion with err
+type deletionWebhook struct {
+	webhook.Servicer
+	err error
+}
+
+func (hook deletionWebhook) NotifyDeletion(accountID int, waitForAck bool) (err error) {
+	return hook.err
+}
+
+func TestDeleteWaitsForTheDownstreamAck(t *testing.T) {
+	defaultMode := constant.DeletionWebhookMode
+	constant.DeletionWebhookMode = constant.DeletionWebhookRequireAck
+	defer func() { constant.DeletionWebhookMode = defaultMode }()
+
+	tests := []struct {
+		name          string
+		notifyErr     error
+		wantStatus    int
+		wantRequested int
+	}{
+		{"not acknowledged", constant.ErrDeletionNotAcknowledged, http.StatusServiceUnavailable, 0},
+		{"acknowledged", nil, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts := &deletingAccounts{}
+			ctrl := NewController(accounts, nil, auditStub{}, nil, deletionWebhook{err: tt.notifyErr}, nil,
+				logger.New(io.Discard, logger.LevelError))
+			router := gin.New()
+			router.DELETE("/v1/accounts", func(ctx *gin.Context) {
+				ctx.Set(constant.AccountIDKey, 7)
+				ctrl.Delete(ctx)
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/v1/accounts", nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if accounts.requested != tt.wantRequested {
+				t.Errorf("deletion requested %d times, want %d", accounts.requested, tt.wantRequested)
+			}
+		})
+	}
+}
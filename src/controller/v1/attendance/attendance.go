@@ -1,13 +1,14 @@
 package attendance
 
 import (
-	"log"
 	"net/http"
 	"strconv"
 
 	"go-rest-api/src/constant"
 	entity "go-rest-api/src/http"
-	"go-rest-api/src/pkg/jwt"
+	"go-rest-api/src/pkg/apierror"
+	"go-rest-api/src/pkg/enum"
+	"go-rest-api/src/pkg/logger"
 	"go-rest-api/src/pkg/pagination"
 	"go-rest-api/src/service/v1/attendance"
 
@@ -18,14 +19,17 @@ import (
 )
 
 type Controller struct {
-	svc attendance.Servicer
+	svc    attendance.Servicer
+	logger *logger.Logger
 }
 
 func NewController(
 	servicer attendance.Servicer,
+	appLogger *logger.Logger,
 ) *Controller {
 	return &Controller{
-		svc: servicer,
+		svc:    servicer,
+		logger: appLogger,
 	}
 }
 
@@ -43,16 +47,12 @@ func NewController(
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /v1/attendance/history [get]
 func (ctrl *Controller) Get(ctx *gin.Context) {
-	accountID, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
-	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusUnauthorized)
-		return
-	}
+	accountID := ctx.GetInt(constant.AccountIDKey)
 
 	limitString := ctx.Query("Limit")
 	limit, err := strconv.Atoi(limitString)
 	if err != nil {
-		log.Print(err)
+		ctrl.logger.For(ctx).Warn("parse pagination failed", "error", err)
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"limit": constant.ErrInvalidFormat.Error()})
 		return
@@ -61,7 +61,7 @@ func (ctrl *Controller) Get(ctx *gin.Context) {
 	pageString := ctx.Query("Page")
 	page, err := strconv.Atoi(pageString)
 	if err != nil {
-		log.Print(err)
+		ctrl.logger.For(ctx).Warn("parse pagination failed", "error", err)
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"page": constant.ErrInvalidFormat.Error()})
 		return
@@ -84,22 +84,26 @@ func (ctrl *Controller) Get(ctx *gin.Context) {
 	pgn.Paginate()
 
 	filter := ctx.Query("Filter")
-	log.Print(filter)
+	ctrl.logger.For(ctx).Debug("attendance filter", "filter", filter)
 	if filter != constant.FilterByDay && filter != constant.FilterByWeek && filter != constant.FilterByMonth && filter != constant.FilterByYear {
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"filter": constant.ErrInvalidFormat.Error()})
 		return
 	}
 
-	response, err := ctrl.svc.FindAttendanceHistory(accountID, pgn, filter)
+	response, err := ctrl.svc.FindAttendanceHistory(ctx.Request.Context(), accountID, pgn, filter)
 	if err != nil {
 		if errors.Is(err, constant.ErrAccountNotRegistered) {
 			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 				"account_id": constant.ErrAccountNotRegistered.Error()})
 			return
 		}
+		if apierror.Interrupted(err) {
+			rest.ResponseMessage(ctx, apierror.Status(err))
+			return
+		}
 		rest.ResponseMessage(ctx, http.StatusInternalServerError)
-		log.Println("get attendance by account id:", err)
+		ctrl.logger.For(ctx).Error("get attendance by account id failed", "error", err)
 		return
 	}
 
@@ -119,16 +123,12 @@ func (ctrl *Controller) Get(ctx *gin.Context) {
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /v1/attendance/locations [get]
 func (ctrl *Controller) GetByLocation(ctx *gin.Context) {
-	accountID, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
-	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusUnauthorized)
-		return
-	}
+	accountID := ctx.GetInt(constant.AccountIDKey)
 
 	limitString := ctx.Query("Limit")
 	limit, err := strconv.Atoi(limitString)
 	if err != nil {
-		log.Print(err)
+		ctrl.logger.For(ctx).Warn("parse pagination failed", "error", err)
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"limit": constant.ErrInvalidFormat.Error()})
 		return
@@ -137,7 +137,7 @@ func (ctrl *Controller) GetByLocation(ctx *gin.Context) {
 	pageString := ctx.Query("Page")
 	page, err := strconv.Atoi(pageString)
 	if err != nil {
-		log.Print(err)
+		ctrl.logger.For(ctx).Warn("parse pagination failed", "error", err)
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"page": constant.ErrInvalidFormat.Error()})
 		return
@@ -159,15 +159,19 @@ func (ctrl *Controller) GetByLocation(ctx *gin.Context) {
 	}
 	pgn.Paginate()
 
-	response, err := ctrl.svc.FindByLocation(accountID, pgn)
+	response, err := ctrl.svc.FindByLocation(ctx.Request.Context(), accountID, pgn)
 	if err != nil {
 		if errors.Is(err, constant.ErrAccountNotRegistered) {
 			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 				"account_id": constant.ErrAccountNotRegistered.Error()})
 			return
 		}
+		if apierror.Interrupted(err) {
+			rest.ResponseMessage(ctx, apierror.Status(err))
+			return
+		}
 		rest.ResponseMessage(ctx, http.StatusInternalServerError)
-		log.Println("get attendance by account id and by location:", err)
+		ctrl.logger.For(ctx).Error("get attendance by account id and by location failed", "error", err)
 		return
 	}
 
@@ -182,15 +186,12 @@ func (ctrl *Controller) GetByLocation(ctx *gin.Context) {
 // @Param Payload body http.AddAttendance true "Payload"
 // @Success 201 {object} string "Created"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 422 {string} string "Unprocessable Entity, each failed field maps to its reason"
 // @Failure 409 {string} string "Resource Conflict"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /v1/attendance [post]
 func (ctrl *Controller) Add(ctx *gin.Context) {
-	accountID, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
-	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusUnauthorized)
-		return
-	}
+	accountID := ctx.GetInt(constant.AccountIDKey)
 
 	req := entity.AddAttendance{}
 	if err := rest.BindJSON(ctx, &req); err != nil {
@@ -199,14 +200,14 @@ func (ctrl *Controller) Add(ctx *gin.Context) {
 		return
 	}
 
-	// required tapi tidak diisi akan return bad request
+	// required tapi tidak diisi akan return unprocessable entity
 	if err := validation.Validator.Struct(req); err != nil {
-		log.Println("validate struct:", err, "request:", req)
-		rest.ResponseError(ctx, http.StatusBadRequest, err)
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		enum.ResponseError(ctx, http.StatusUnprocessableEntity, apierror.Reasons(err))
 		return
 	}
 
-	err = ctrl.svc.Add(accountID, req)
+	err := ctrl.svc.Add(ctx.Request.Context(), accountID, req)
 	if errors.Is(err, constant.ErrAccountNotRegistered) {
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"account_id": constant.ErrAccountNotRegistered.Error()})
@@ -214,10 +215,12 @@ func (ctrl *Controller) Add(ctx *gin.Context) {
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"location": constant.ErrLocationNotExist.Error()})
 	} else if errors.Is(err, constant.ErrInvalidStatusAttendance) {
-		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+		enum.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"status": constant.ErrInvalidStatusAttendance.Error()})
+	} else if apierror.Interrupted(err) {
+		rest.ResponseMessage(ctx, apierror.Status(err))
 	} else if err != nil {
-		log.Println("attendance name:", err.Error())
+		ctrl.logger.For(ctx).Error("add attendance failed", "error", err)
 		rest.ResponseMessage(ctx, http.StatusInternalServerError)
 	} else {
 		rest.ResponseMessage(ctx, http.StatusCreated)
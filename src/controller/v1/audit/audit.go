@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-rest-api/src/constant"
+	entity "go-rest-api/src/http"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/pagination"
+	"go-rest-api/src/pkg/permission"
+	"go-rest-api/src/pkg/publicid"
+	"go-rest-api/src/service/v1/account"
+	"go-rest-api/src/service/v1/audit"
+
+	"github.com/forkyid/go-utils/v1/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type Controller struct {
+	svc     audit.Servicer
+	account account.Servicer
+	logger  *logger.Logger
+}
+
+func NewController(
+	servicer audit.Servicer,
+	accountSvc account.Servicer,
+	appLogger *logger.Logger,
+) *Controller {
+	return &Controller{
+		svc:     servicer,
+		account: accountSvc,
+		logger:  appLogger,
+	}
+}
+
+// @Summary Verify Audit Chain
+// @Description Recompute the audit log hash chain and report the first altered entry, Admin Only
+// @Tags Audit
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} http.AuditChainVerification
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/audit/verify [get]
+func (ctrl *Controller) VerifyChain(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	isAdmin, err := ctrl.account.CheckAdminByID(ctx.Request.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) {
+			rest.ResponseMessage(ctx, http.StatusUnauthorized)
+			return
+		}
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("check admin by id failed", "error", err)
+		return
+	}
+	if !isAdmin {
+		rest.ResponseError(ctx, http.StatusForbidden, map[string]string{
+			"accounts": constant.ErrForbidden.Error()})
+		return
+	}
+
+	response, err := ctrl.svc.VerifyAuditChain()
+	if err != nil {
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("verify audit chain failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// @Summary Get Account Audit Trail
+// @Description Get the audit entries of an account, its own actions and the ones taken on it by admins, newest first, Admin Only
+// @Tags Audit
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param id path string true "Account ID"
+// @Param Page query string true "page"
+// @Param Limit query string true "limit"
+// @Param action query string false "action, example: account.update"
+// @Param from query string false "RFC3339 time, example: 2006-01-02T15:04:05Z"
+// @Param to query string false "RFC3339 time, example: 2006-01-02T15:04:05Z"
+// @Success 200 {object} http.GetAuditEntry
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/accounts/{id}/audit [get]
+func (ctrl *Controller) GetAccountTrail(ctx *gin.Context) {
+	adminID := ctx.GetInt(constant.AccountIDKey)
+
+	isAdmin, err := ctrl.account.CheckAdminByID(ctx.Request.Context(), adminID)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) {
+			rest.ResponseMessage(ctx, http.StatusUnauthorized)
+			return
+		}
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("check admin by id failed", "error", err)
+		return
+	}
+	canRead := false
+	if isAdmin {
+		canRead, err = ctrl.account.HasPermission(ctx.Request.Context(), adminID, permission.ReadAuditTrail)
+		if err != nil {
+			rest.ResponseMessage(ctx, http.StatusInternalServerError)
+			ctrl.logger.For(ctx).Error("check audit permission failed", "error", err)
+			return
+		}
+	}
+	if !canRead {
+		rest.ResponseError(ctx, http.StatusForbidden, map[string]string{
+			"accounts": constant.ErrForbidden.Error()})
+		return
+	}
+
+	accountID, err := publicid.Decode(ctx.Param("id"))
+	if err != nil {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"id": err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.Query("Limit"))
+	if err != nil || limit <= 0 {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"limit": constant.ErrInvalidFormat.Error()})
+		return
+	}
+	page, err := strconv.Atoi(ctx.Query("Page"))
+	if err != nil || page <= 0 {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"page": constant.ErrInvalidFormat.Error()})
+		return
+	}
+	pgn := pagination.Pagination{
+		Limit: limit,
+		Page:  page,
+	}
+	pgn.Paginate()
+
+	filter := entity.AuditFilter{
+		Action: ctx.Query("action"),
+	}
+	if from := ctx.Query("from"); from != "" {
+		filter.From, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+				"from": constant.ErrInvalidFormat.Error()})
+			return
+		}
+	}
+	if to := ctx.Query("to"); to != "" {
+		filter.To, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+				"to": constant.ErrInvalidFormat.Error()})
+			return
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.From.After(filter.To) {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"from": constant.ErrInvalidTimeRange.Error()})
+		return
+	}
+
+	response, err := ctrl.svc.FindAccountTrail(accountID, filter, pgn)
+	if err != nil {
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("get account audit trail failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
@@ -2,15 +2,20 @@ package auth
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 
 	"go-rest-api/src/constant"
 	entity "go-rest-api/src/http"
-	"go-rest-api/src/pkg/bcrypt"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/apierror"
+	"go-rest-api/src/pkg/fingerprint"
+	"go-rest-api/src/pkg/semaphore"
 	"go-rest-api/src/service/v1/account"
+	"go-rest-api/src/service/v1/security"
 	"go-rest-api/src/pkg/jwt"
-	"github.com/forkyid/go-utils/v1/aes"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/metrics"
+	"go-rest-api/src/pkg/publicid"
 	"github.com/forkyid/go-utils/v1/rest"
 	"github.com/forkyid/go-utils/v1/validation"
 	"github.com/gin-gonic/gin"
@@ -18,109 +23,406 @@ import (
 )
 
 type Controller struct {
-	svc account.Servicer
+	svc      account.Servicer
+	security security.Servicer
+	// verifies caps the concurrent password verifies, hashing is deliberately expensive
+	verifies *semaphore.Keyed
+	logger   *logger.Logger
 }
 
 func NewController(
 	servicer account.Servicer,
+	securitySvc security.Servicer,
+	appLogger *logger.Logger,
 ) *Controller {
 	return &Controller{
-		svc: servicer,
+		svc:      servicer,
+		security: securitySvc,
+		verifies: semaphore.NewKeyed(),
+		logger:   appLogger,
 	}
 }
 
 // @Summary User Login
-// @Description User Login
+// @Description User Login with the username or the email, the token carries the encrypted account id. An account with two factor on gets a challenge token for /v1/auth/totp instead
 // @Tags Auth
 // @Produce application/json
-// @Param Payload body http.Auth true "Payload"
+// @Param Payload body http.LoginUser true "Payload"
 // @Success 200 {object} http.Token
+// @Success 202 {object} http.TwoFactorChallenge
 // @Failure 400 {string} string "Bad Request"
-// @Failure 401 {string} string "Unauthorized"
+// @Failure 422 {string} string "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {string} string "Wrong Password"
+// @Failure 403 {string} string "Email Not Verified or Account Suspended"
+// @Failure 404 {string} string "Account Not Registered"
+// @Failure 423 {string} string "Account Locked"
+// @Failure 429 {string} string "Too Many Requests"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /v1/auth [post]
 func (ctrl *Controller) Login(ctx *gin.Context) {
-	request := entity.Auth{}
+	request := entity.LoginUser{}
 	err := rest.BindJSON(ctx, &request)
 	if err != nil {
-		log.Println("bind json:", err, "request:", request)
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"body": constant.ErrInvalidFormat.Error()})
 		return
 	}
 
 	if err := validation.Validator.Struct(request); err != nil {
-		log.Println("validate struct:", err, "request:", request)
-		rest.ResponseError(ctx, http.StatusBadRequest, err)
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		rest.ResponseError(ctx, http.StatusUnprocessableEntity, apierror.Reasons(err))
+		return
+	}
+
+	identifier := request.Username
+	if identifier == "" {
+		identifier = request.Email
+	}
+	release, ok := ctrl.verifies.TryAcquire(
+		semaphore.Rule{Key: "verify", Limit: constant.PasswordVerifyConcurrency},
+		semaphore.Rule{Key: "verify:ip:" + ctx.ClientIP(), Limit: constant.PasswordVerifyPerIP},
+		semaphore.Rule{Key: "verify:identifier:" + identifier, Limit: constant.PasswordVerifyPerIdentifier},
+	)
+	if !ok {
+		rest.ResponseError(ctx, http.StatusTooManyRequests, map[string]string{
+			"accounts": constant.ErrVerifyBusy.Error()})
+		return
+	}
+	account, err := ctrl.svc.Authenticate(ctx.Request.Context(), request)
+	release()
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) {
+			ctrl.recordFailedLogin(ctx, identifier, constant.LoginFailureAccountNotRegistered)
+			rest.ResponseError(ctx, http.StatusNotFound, map[string]string{
+				"accounts": constant.ErrAccountNotRegistered.Error()})
+			return
+		} else if errors.Is(err, constant.ErrInvalidPassword) {
+			ctrl.recordFailedLogin(ctx, identifier, constant.LoginFailureInvalidPassword)
+			rest.ResponseError(ctx, http.StatusUnauthorized, map[string]string{
+				"accounts": constant.ErrInvalidCredentials.Error()})
+			return
+		} else if errors.Is(err, constant.ErrAccountLocked) {
+			ctrl.recordFailedLogin(ctx, identifier, constant.LoginFailureLocked)
+			rest.ResponseError(ctx, http.StatusLocked, map[string]string{
+				"accounts": constant.ErrAccountLocked.Error()})
+			return
+		} else if errors.Is(err, constant.ErrAccountNotVerified) {
+			metrics.AuthFailure(constant.AuthFailureAccountUnverified)
+			rest.ResponseError(ctx, http.StatusForbidden, map[string]string{
+				"accounts": constant.ErrAccountNotVerified.Error()})
+			return
+		} else if errors.Is(err, constant.ErrAccountSuspended) {
+			metrics.AuthFailure(constant.AuthFailureAccountSuspended)
+			rest.ResponseError(ctx, http.StatusForbidden, map[string]string{
+				"accounts": constant.ErrAccountSuspended.Error()})
+			return
+		}
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("authenticate failed", "error", err)
+		return
+	}
+
+	err = ctrl.svc.UpgradePasswordHash(ctx.Request.Context(), account, request.Password)
+	if err != nil {
+		ctrl.logger.For(ctx).Error("upgrade password hash failed", "error", err)
+	}
+
+	// a weak password only produces a warning
+	unmetRules, err := ctrl.svc.CheckPasswordStrength(ctx.Request.Context(), account, request.Password)
+	if err != nil {
+		ctrl.logger.For(ctx).Error("check password strength failed", "error", err)
+	}
+
+	if ctrl.svc.TOTPEnabled(account) {
+		challenge, expiresAt, err := jwt.GenerateChallenge(publicid.Encode(int(account.ID)))
+		if err != nil {
+			rest.ResponseMessage(ctx, http.StatusInternalServerError)
+			return
+		}
+		rest.ResponseData(ctx, http.StatusAccepted, entity.TwoFactorChallenge{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresAt:         expiresAt,
+		})
 		return
 	}
 
-	exist, _ := ctrl.svc.CheckAccountByUsername(request.Username)
-	if !exist {
+	ctrl.issueToken(ctx, account, unmetRules)
+}
+
+// @Summary Two Factor Login
+// @Description Finish a two factor login with the challenge token of the login and an authenticator code, codes of the previous and the next 30 seconds are accepted too
+// @Tags Auth
+// @Produce application/json
+// @Param Payload body http.LoginTOTP true "Payload"
+// @Success 200 {object} http.Token
+// @Failure 400 {string} string "Bad Request"
+// @Failure 422 {string} string "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {string} string "Invalid or Expired Challenge or Code"
+// @Failure 403 {string} string "Account Suspended"
+// @Failure 423 {string} string "Account Locked"
+// @Failure 429 {string} string "Too Many Requests"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 503 {string} string "Two Factor Not Configured"
+// @Router /v1/auth/totp [post]
+func (ctrl *Controller) LoginTOTP(ctx *gin.Context) {
+	request := entity.LoginTOTP{}
+	err := rest.BindJSON(ctx, &request)
+	if err != nil {
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-			"accounts": constant.ErrAccountNotRegistered.Error()})
+			"body": constant.ErrInvalidFormat.Error()})
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		rest.ResponseError(ctx, http.StatusUnprocessableEntity, apierror.Reasons(err))
+		return
+	}
+
+	accountID, err := jwt.ValidateChallenge(request.ChallengeToken)
+	if errors.Is(err, constant.ErrAccountSuspended) {
+		metrics.AuthFailure(constant.AuthFailureAccountSuspended)
+		rest.ResponseError(ctx, http.StatusForbidden, map[string]string{
+			"accounts": constant.ErrAccountSuspended.Error()})
+		return
+	} else if err != nil {
+		rest.ResponseError(ctx, http.StatusUnauthorized, map[string]string{
+			"challenge_token": constant.ErrInvalidToken.Error()})
 		return
 	}
 
-	account, err:= ctrl.svc.TakeAccountByUsername(request.Username)
+	account, err := ctrl.svc.VerifyTOTP(ctx.Request.Context(), accountID, request.Code)
 	if err != nil {
+		identifier := account.Username
+		if errors.Is(err, constant.ErrInvalidTOTPCode) {
+			ctrl.recordFailedLogin(ctx, identifier, constant.LoginFailureInvalidTOTPCode)
+			rest.ResponseError(ctx, http.StatusUnauthorized, map[string]string{
+				"code": constant.ErrInvalidTOTPCode.Error()})
+			return
+		} else if errors.Is(err, constant.ErrAccountLocked) {
+			ctrl.recordFailedLogin(ctx, identifier, constant.LoginFailureLocked)
+			rest.ResponseError(ctx, http.StatusLocked, map[string]string{
+				"accounts": constant.ErrAccountLocked.Error()})
+			return
+		} else if errors.Is(err, constant.ErrAccountSuspended) {
+			metrics.AuthFailure(constant.AuthFailureAccountSuspended)
+			rest.ResponseError(ctx, http.StatusForbidden, map[string]string{
+				"accounts": constant.ErrAccountSuspended.Error()})
+			return
+		} else if errors.Is(err, constant.ErrAccountNotRegistered) || errors.Is(err, constant.ErrTOTPNotEnrolled) {
+			rest.ResponseError(ctx, http.StatusUnauthorized, map[string]string{
+				"challenge_token": constant.ErrInvalidToken.Error()})
+			return
+		} else if errors.Is(err, constant.ErrTwoFactorUnavailable) {
+			rest.ResponseError(ctx, http.StatusServiceUnavailable, map[string]string{
+				"accounts": constant.ErrTwoFactorUnavailable.Error()})
+			return
+		}
 		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("verify totp failed", "error", err)
 		return
 	}
 
-	err = bcrypt.ComparePassword(account.Password, request.Password)
+	// the code itself can only be used once, a challenge left behind is harmless
+	err = jwt.ConsumeChallenge(request.ChallengeToken)
 	if err != nil {
-		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-			"accounts": constant.ErrInvalidPassword.Error()})
+		ctrl.logger.For(ctx).Error("consume challenge failed", "error", err)
+	}
+
+	ctrl.issueToken(ctx, account, ctrl.svc.PasswordUnmetRules(account))
+}
+
+// issueToken finishes a login, the token is bound to the device of the request unless device binding is off
+func (ctrl *Controller) issueToken(ctx *gin.Context, account model.Account, unmetRules []string) {
+	device := ""
+	if constant.DeviceBinding != constant.DeviceBindingOff {
+		device = fingerprint.DeviceFromRequest(ctx, constant.FingerprintSecret).String()
+	}
+	// the limit of an admin password reset may have expired before the owner logged in again
+	if account.MustChangePassword {
+		if err := jwt.RequirePasswordChange(int(account.ID)); err != nil {
+			rest.ResponseMessage(ctx, http.StatusInternalServerError)
+			ctrl.logger.For(ctx).Error("limit token to password change failed", "error", err)
+			return
+		}
+	}
+	token, err := jwt.GenerateJWT(publicid.Encode(int(account.ID)), device, account.Role)
+	if err != nil {
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
 		return
 	}
 
-	token, err := jwt.GenerateJWT(aes.Encrypt(int(account.ID)))
+	tokenID, _ := jwt.TokenID(token)
+	err = ctrl.security.RecordSession(int(account.ID), tokenID, ctx.ClientIP(), ctx.Request.UserAgent())
+	if err != nil {
+		ctrl.logger.For(ctx).Error("record session failed", "error", err)
+	}
+	ctrl.svc.RecordLogin(int(account.ID))
+
+	rest.ResponseData(ctx, http.StatusOK, entity.Token{
+		Token:               fmt.Sprintf("Bearer %v", token),
+		MustChangePassword:  ctrl.svc.MustChangePassword(account),
+		WeakPassword:        len(unmetRules) > 0,
+		PasswordUnmetRules:  unmetRules,
+		DeletionScheduledAt: ctrl.svc.DeletionScheduledAt(account),
+	})
+}
+
+// @Summary Refresh Token
+// @Description Issue a new token for a token that is valid or expired within JWT_REFRESH_GRACE_MINUTES, the device binding and the session are kept and the old token is revoked
+// @Tags Auth
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} http.Token
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Account Suspended"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/auth/refresh [post]
+func (ctrl *Controller) Refresh(ctx *gin.Context) {
+	authorization := ctx.GetHeader("Authorization")
+	token, err := jwt.Refresh(authorization, constant.TokenRefreshGrace)
 	if err != nil {
+		if errors.Is(err, constant.ErrTokenExpired) {
+			rest.ResponseError(ctx, http.StatusUnauthorized, map[string]string{
+				"authorization": constant.ErrTokenExpired.Error()})
+			return
+		} else if errors.Is(err, constant.ErrForeignAccountID) {
+			rest.ResponseError(ctx, http.StatusUnauthorized, map[string]string{
+				"authorization": constant.ErrForeignAccountID.Error()})
+			return
+		} else if errors.Is(err, constant.ErrTokenRevoked) {
+			rest.ResponseError(ctx, http.StatusUnauthorized, map[string]string{
+				"authorization": constant.ErrTokenRevoked.Error()})
+			return
+		} else if errors.Is(err, constant.ErrAccountSuspended) {
+			rest.ResponseError(ctx, http.StatusForbidden, map[string]string{
+				"accounts": constant.ErrAccountSuspended.Error()})
+			return
+		}
+		rest.ResponseMessage(ctx, http.StatusUnauthorized)
+		return
+	}
+
+	// the refresh token is verified, so the new one carries the same account. It is only handed out
+	// once the account may still use it
+	accountID, _ := jwt.ExtractID("Bearer " + token)
+	account, err := ctrl.svc.TakeRefreshableAccount(ctx.Request.Context(), accountID)
+	if apierror.Interrupted(err) {
+		rest.ResponseMessage(ctx, apierror.Status(err))
+		return
+	} else if errors.Is(err, constant.ErrAccountNotRegistered) {
+		rest.ResponseMessage(ctx, http.StatusUnauthorized)
+		return
+	} else if errors.Is(err, constant.ErrAccountSuspended) {
+		rest.ResponseError(ctx, http.StatusForbidden, map[string]string{
+			"accounts": constant.ErrAccountSuspended.Error()})
+		return
+	} else if err != nil {
 		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("take refreshable account failed", "error", err)
 		return
 	}
+	// the limit of an admin password reset ends with the tokens of its time, the new token outlives it
+	if account.MustChangePassword {
+		if err := jwt.RequirePasswordChange(accountID); err != nil {
+			rest.ResponseMessage(ctx, http.StatusInternalServerError)
+			ctrl.logger.For(ctx).Error("limit token to password change failed", "error", err)
+			return
+		}
+	}
+
+	oldTokenID, oldErr := jwt.TokenID(authorization)
+	newTokenID, newErr := jwt.TokenID(token)
+	if oldErr == nil && newErr == nil {
+		err = ctrl.security.RotateSession(oldTokenID, newTokenID)
+		if err != nil {
+			ctrl.logger.For(ctx).Error("rotate session failed", "error", err)
+		}
+	}
 
 	rest.ResponseData(ctx, http.StatusOK, entity.Token{
-		Token: fmt.Sprintf("Bearer %v", token),
+		Token:              fmt.Sprintf("Bearer %v", token),
+		MustChangePassword: ctrl.svc.MustChangePassword(account),
 	})
 }
 
+// @Summary Logout
+// @Description Revoke the token until it expires and its refresh grace ends and end its session, it can no longer be used or refreshed
+// @Tags Auth
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {string} string "Success"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/auth/logout [post]
+func (ctrl *Controller) Logout(ctx *gin.Context) {
+	tokenID, _ := jwt.TokenID(ctx.GetHeader("Authorization"))
+	err := jwt.Revoke(ctx.GetHeader("Authorization"))
+	if err != nil {
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("revoke token failed", "error", err)
+		return
+	}
+
+	err = ctrl.security.EndSession(tokenID)
+	if err != nil {
+		ctrl.logger.For(ctx).Error("end session failed", "error", err)
+	}
+
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
+
+func (ctrl *Controller) recordFailedLogin(ctx *gin.Context, identifier, reason string) {
+	metrics.AuthFailure(reason)
+	err := ctrl.security.RecordFailedLogin(identifier, ctx.ClientIP(), reason)
+	if err != nil {
+		ctrl.logger.For(ctx).Error("record failed login failed", "error", err)
+	}
+}
+
 // @Summary Update User Password
-// @Description Update User Password
+// @Description Deprecated, the ktp number alone is enough to take the account over. Use /v1/accounts/password/reset-request and /v1/accounts/password/reset, responses carry a Deprecation header until the route is removed
 // @Tags Auth
 // @Produce application/json
 // @Param Payload body http.ForgotPassword true "Payload"
 // @Success 200 {string} string "Success"
 // @Failure 400 {string} string "Bad Request"
-// @Failure 401 {string} string "Unauthorized"
+// @Failure 422 {string} string "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 404 {string} string "Account Not Registered"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /v1/auth/forgot [patch]
+// @Deprecated
 func (ctrl *Controller) ForgotPassword(ctx *gin.Context) {
+	ctx.Header("Deprecation", "true")
+	ctx.Header("Link", `</v1/accounts/password/reset-request>; rel="successor-version"`)
+
 	request := entity.ForgotPassword{}
 	err := rest.BindJSON(ctx, &request)
 	if err != nil {
-		log.Println("bind json:", err, "request:", request)
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"body": constant.ErrInvalidFormat.Error()})
 		return
 	}
 
 	if err := validation.Validator.Struct(request); err != nil {
-		log.Println("validate struct:", err, "request:", request)
-		rest.ResponseError(ctx, http.StatusBadRequest, err)
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		rest.ResponseError(ctx, http.StatusUnprocessableEntity, apierror.Reasons(err))
 		return
 	}
 
-	err = ctrl.svc.UpdatePassword(request)
+	err = ctrl.svc.UpdatePassword(ctx.Request.Context(), request)
 	if err != nil {
-		if errors.Is(err, constant.ErrPasswordCannotBeEmpty) {
-			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
-				"accounts": constant.ErrPasswordCannotBeEmpty.Error()})
+		if errors.Is(err, constant.ErrAccountNotRegistered) {
+			rest.ResponseError(ctx, http.StatusNotFound, map[string]string{
+				"accounts": constant.ErrAccountNotRegistered.Error()})
 			return
 		}
 		rest.ResponseMessage(ctx, http.StatusInternalServerError)
-		log.Println("update account password:", err)
+		ctrl.logger.For(ctx).Error("update account password failed", "error", err)
 		return
 	}
 
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-rest-api/src/constant"
+	entity "go-rest-api/src/http"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/nik"
+	"go-rest-api/src/pkg/passwordpolicy"
+	"go-rest-api/src/service/v1/account"
+	"go-rest-api/src/service/v1/security"
+
+	"github.com/forkyid/go-utils/v1/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// blockingAccounts holds every Authenticate until release is closed, like a slow password hash
+type blockingAccounts struct {
+	account.Servicer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (svc *blockingAccounts) Authenticate(ctx context.Context, request entity.LoginUser) (account model.Account, err error) {
+	svc.entered <- struct{}{}
+	<-svc.release
+	return account, constant.ErrInvalidPassword
+}
+
+type securityStub struct {
+	security.Servicer
+}
+
+func (securityStub) RecordFailedLogin(identifier, ipAddress, reason string) (err error) {
+	return
+}
+
+func login(router *gin.Engine, username string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/v1/auth",
+		strings.NewReader(`{"username":"`+username+`","password":"wrong password"}`))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestLoginThrottlesConcurrentVerifies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defaults := []int{constant.PasswordVerifyConcurrency, constant.PasswordVerifyPerIP, constant.PasswordVerifyPerIdentifier}
+	constant.PasswordVerifyConcurrency, constant.PasswordVerifyPerIP, constant.PasswordVerifyPerIdentifier = 100, 100, 2
+	defer func() {
+		constant.PasswordVerifyConcurrency, constant.PasswordVerifyPerIP, constant.PasswordVerifyPerIdentifier = defaults[0], defaults[1], defaults[2]
+	}()
+
+	accounts := &blockingAccounts{entered: make(chan struct{}), release: make(chan struct{})}
+	ctrl := NewController(accounts, securityStub{}, logger.New(io.Discard, logger.LevelError))
+	router := gin.New()
+	router.POST("/v1/auth", ctrl.Login)
+
+	// N verifies of the identifier are running
+	wg := sync.WaitGroup{}
+	statuses := make(chan int, 3)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- login(router, "budi").Code
+		}()
+		<-accounts.entered
+	}
+
+	// the (N+1)th is rejected without verifying, another identifier still gets through
+	if code := login(router, "budi").Code; code != http.StatusTooManyRequests {
+		t.Errorf("login past the limit of the identifier status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		statuses <- login(router, "siti").Code
+	}()
+	<-accounts.entered
+
+	close(accounts.release)
+	wg.Wait()
+	close(statuses)
+	for code := range statuses {
+		if code != http.StatusUnauthorized {
+			t.Errorf("verified login status = %d, want %d", code, http.StatusUnauthorized)
+		}
+	}
+
+	// the finished verifies gave their slots back
+	go func() { <-accounts.entered }()
+	if code := login(router, "budi").Code; code != http.StatusUnauthorized {
+		t.Errorf("login after the verifies finished status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+// unknownAccounts knows no account at all
+type unknownAccounts struct {
+	account.Servicer
+}
+
+func (unknownAccounts) Authenticate(ctx context.Context, request entity.LoginUser) (account model.Account, err error) {
+	return account, constant.ErrAccountNotRegistered
+}
+
+func TestLoginOfAnUnknownAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := NewController(unknownAccounts{}, securityStub{}, logger.New(io.Discard, logger.LevelError))
+	router := gin.New()
+	router.POST("/v1/auth", ctrl.Login)
+
+	recorder := login(router, "nobody")
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+	if !strings.Contains(recorder.Body.String(), constant.ErrAccountNotRegistered.Error()) {
+		t.Errorf("body = %q, want %v", recorder.Body.String(), constant.ErrAccountNotRegistered)
+	}
+}
+
+// ktpAccounts records the ktp number of the deprecated password reset
+type ktpAccounts struct {
+	account.Servicer
+	ktpNumber int
+}
+
+func (svc *ktpAccounts) UpdatePassword(ctx context.Context, request entity.ForgotPassword) (err error) {
+	svc.ktpNumber = request.KTPNumber
+	return
+}
+
+func TestForgotPasswordIsDeprecated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if err := nik.Register(validation.Validator); err != nil {
+		t.Fatal(err)
+	}
+	if err := passwordpolicy.Register(validation.Validator, constant.PasswordPolicy); err != nil {
+		t.Fatal(err)
+	}
+	accounts := &ktpAccounts{}
+	ctrl := NewController(accounts, securityStub{}, logger.New(io.Discard, logger.LevelError))
+	router := gin.New()
+	router.PATCH("/v1/auth/forgot", ctrl.ForgotPassword)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPatch, "/v1/auth/forgot",
+		strings.NewReader(`{"ktp_number":3171011505900001,"new_password":"Str0ng!Passw0rd"}`))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+	if accounts.ktpNumber != 3171011505900001 {
+		t.Errorf("reset the password of ktp number %d, want 3171011505900001", accounts.ktpNumber)
+	}
+	if recorder.Header().Get("Deprecation") != "true" || !strings.Contains(recorder.Header().Get("Link"), "/v1/accounts/password/reset-request") {
+		t.Errorf("headers = %v, want the deprecation and its successor", recorder.Header())
+	}
+}
@@ -0,0 +1,32 @@
+package capability
+
+import (
+	"net/http"
+
+	"go-rest-api/src/service/v1/capability"
+
+	"github.com/forkyid/go-utils/v1/rest"
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	svc capability.Servicer
+}
+
+func NewController(
+	servicer capability.Servicer,
+) *Controller {
+	return &Controller{
+		svc: servicer,
+	}
+}
+
+// @Summary Get Capabilities
+// @Description Get the optional features enabled in this deployment and their public parameters
+// @Tags Capabilities
+// @Produce application/json
+// @Success 200 {object} http.Capabilities
+// @Router /v1/capabilities [get]
+func (ctrl *Controller) Get(ctx *gin.Context) {
+	rest.ResponseData(ctx, http.StatusOK, ctrl.svc.Take())
+}
@@ -0,0 +1,59 @@
+package health
+
+import (
+	"net/http"
+
+	"go-rest-api/src/constant"
+	entity "go-rest-api/src/http"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/service/v1/health"
+
+	"github.com/forkyid/go-utils/v1/rest"
+	"github.com/gin-gonic/gin"
+)
+
+type Controller struct {
+	svc    health.Servicer
+	logger *logger.Logger
+}
+
+func NewController(
+	servicer health.Servicer,
+	appLogger *logger.Logger,
+) *Controller {
+	return &Controller{
+		svc:    servicer,
+		logger: appLogger,
+	}
+}
+
+// Health godoc
+// @Summary Liveness Probe
+// @Description Answers as long as the process serves requests, no dependency is checked
+// @Tags Health
+// @Produce application/json
+// @Success 200 {object} http.Liveness
+// @Router /healthz [get]
+func (ctrl *Controller) Health(ctx *gin.Context) {
+	rest.ResponseData(ctx, http.StatusOK, entity.Liveness{
+		Status: constant.HealthStatusUp,
+	})
+}
+
+// Readiness godoc
+// @Summary Readiness Probe
+// @Description Check every dependency within READINESS_TIMEOUT, 503 when any of them is down or timed out
+// @Tags Health
+// @Produce application/json
+// @Success 200 {object} http.Readiness
+// @Failure 503 {object} http.Readiness
+// @Router /readyz [get]
+func (ctrl *Controller) Readiness(ctx *gin.Context) {
+	ready, response := ctrl.svc.Ready()
+	if !ready {
+		ctrl.logger.For(ctx).Warn("readiness check failed", "checks", response.Checks)
+		rest.ResponseData(ctx, http.StatusServiceUnavailable, response)
+		return
+	}
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
@@ -1,15 +1,17 @@
 package location
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"strconv"
 
 	"go-rest-api/src/constant"
 	entity "go-rest-api/src/http"
-	"go-rest-api/src/pkg/jwt"
+	"go-rest-api/src/pkg/apierror"
+	"go-rest-api/src/pkg/bind"
+	"go-rest-api/src/pkg/logger"
 	"go-rest-api/src/service/v1/location"
 
 	"github.com/forkyid/go-utils/v1/rest"
@@ -19,14 +21,17 @@ import (
 )
 
 type Controller struct {
-	svc location.Servicer
+	svc    location.Servicer
+	logger *logger.Logger
 }
 
 func NewController(
 	servicer location.Servicer,
+	appLogger *logger.Logger,
 ) *Controller {
 	return &Controller{
-		svc: servicer,
+		svc:    servicer,
+		logger: appLogger,
 	}
 }
 
@@ -42,12 +47,6 @@ func NewController(
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /v1/locations [get]
 func (ctrl *Controller) Get(ctx *gin.Context) {
-	_, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
-	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusUnauthorized)
-		return
-	}
-
 	locationIDsStr := ctx.Query("location_ids")
 	if locationIDsStr == "" {
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
@@ -70,7 +69,7 @@ func (ctrl *Controller) Get(ctx *gin.Context) {
 	response, err := ctrl.svc.Find(locationIDs)
 	if err != nil {
 		rest.ResponseMessage(ctx, http.StatusInternalServerError)
-		log.Println("get location by id:", err)
+		ctrl.logger.For(ctx).Error("get location by id failed", "error", err)
 		return
 	}
 
@@ -85,16 +84,11 @@ func (ctrl *Controller) Get(ctx *gin.Context) {
 // @Param Payload body http.CreateLocation true "Payload"
 // @Success 201 {object} string "Created"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 422 {string} string "Unprocessable Entity, each failed field maps to its reason"
 // @Failure 409 {string} string "Resource Conflict"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /v1/locations [post]
 func (ctrl *Controller) Create(ctx *gin.Context) {
-	_, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
-	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusUnauthorized)
-		return
-	}
-
 	req := entity.CreateLocation{}
 	if err := rest.BindJSON(ctx, &req); err != nil {
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
@@ -102,14 +96,14 @@ func (ctrl *Controller) Create(ctx *gin.Context) {
 		return
 	}
 
-	// required tapi tidak diisi akan return bad request
+	// required tapi tidak diisi akan return unprocessable entity
 	if err := validation.Validator.Struct(req); err != nil {
-		log.Println("validate struct:", err, "request:", req)
-		rest.ResponseError(ctx, http.StatusBadRequest, err)
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		rest.ResponseError(ctx, http.StatusUnprocessableEntity, apierror.Reasons(err))
 		return
 	}
 
-	err = ctrl.svc.Create(req)
+	err := ctrl.svc.Create(req)
 	if errors.Is(err, constant.ErrInvalidLocationName) {
 		rest.ResponseError(ctx, http.StatusConflict, map[string]string{
 			"location": constant.ErrInvalidLocationName.Error()})
@@ -120,7 +114,7 @@ func (ctrl *Controller) Create(ctx *gin.Context) {
 		rest.ResponseError(ctx, http.StatusConflict, map[string]string{
 			"location": constant.ErrLocationAlreadyExist.Error()})
 	} else if err != nil {
-		log.Println("location:", err.Error())
+		ctrl.logger.For(ctx).Error("create location failed", "error", err)
 		rest.ResponseMessage(ctx, http.StatusInternalServerError)
 	} else {
 		rest.ResponseMessage(ctx, http.StatusCreated)
@@ -136,29 +130,24 @@ func (ctrl *Controller) Create(ctx *gin.Context) {
 // @Param Payload body http.UpdateLocation true "Payload"
 // @Success 200 {string} string "Success"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 422 {string} string "Unprocessable Entity, each failed field maps to its reason"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /v1/locations [patch]
 func (ctrl *Controller) Update(ctx *gin.Context) {
-	_, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
-	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusUnauthorized)
-		return
-	}
-
 	request := entity.UpdateLocation{}
 	// int di isi dengan string maka akan return invalid format
-	err = rest.BindJSON(ctx, &request)
+	err := rest.BindJSON(ctx, &request)
 	if err != nil {
-		log.Println("bind json:", err, "request:", request)
+		ctrl.logger.For(ctx).Warn("bind json failed", "error", err)
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
 			"body": constant.ErrInvalidFormat.Error()})
 		return
 	}
 
-	// required tapi tidak diisi akan return bad request
+	// required tapi tidak diisi akan return unprocessable entity
 	if err := validation.Validator.Struct(request); err != nil {
-		log.Println("validate struct:", err, "request:", request)
-		rest.ResponseError(ctx, http.StatusBadRequest, err)
+		ctrl.logger.For(ctx).Warn("validate struct failed", "error", err)
+		rest.ResponseError(ctx, http.StatusUnprocessableEntity, apierror.Reasons(err))
 		return
 	}
 
@@ -176,6 +165,16 @@ func (ctrl *Controller) Update(ctx *gin.Context) {
 		return
 	}
 
+	err = bind.CheckID(ctx, func(raw json.RawMessage) bool {
+		id := 0
+		return json.Unmarshal(raw, &id) == nil && id == locationID
+	})
+	if err != nil {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"id": constant.ErrIDConflict.Error()})
+		return
+	}
+
 	err = ctrl.svc.Update(locationID, request)
 	if err != nil {
 		if errors.Is(err, constant.ErrLocationNotExist) {
@@ -188,7 +187,7 @@ func (ctrl *Controller) Update(ctx *gin.Context) {
 			return
 		}
 		rest.ResponseMessage(ctx, http.StatusInternalServerError)
-		log.Println("update location: ", err.Error())
+		ctrl.logger.For(ctx).Error("update location failed", "error", err)
 		return
 	}
 
@@ -207,12 +206,6 @@ func (ctrl *Controller) Update(ctx *gin.Context) {
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /v1/locations [delete]
 func (ctrl *Controller) Delete(ctx *gin.Context) {
-	_, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
-	if err != nil {
-		rest.ResponseMessage(ctx, http.StatusUnauthorized)
-		return
-	}
-	
 	locationIDStr := ctx.Query("location_id")
 	if locationIDStr == "" {
 		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
@@ -235,7 +228,7 @@ func (ctrl *Controller) Delete(ctx *gin.Context) {
 			return
 		}
 		rest.ResponseMessage(ctx, http.StatusInternalServerError)
-		log.Println("delete location: ", err.Error())
+		ctrl.logger.For(ctx).Error("delete location failed", "error", err)
 		return
 	}
 		
@@ -0,0 +1,283 @@
+package security
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-rest-api/src/constant"
+	entity "go-rest-api/src/http"
+	"go-rest-api/src/pkg/jwt"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/pagination"
+	"go-rest-api/src/service/v1/account"
+	"go-rest-api/src/service/v1/security"
+
+	"github.com/forkyid/go-utils/v1/aes"
+	"github.com/forkyid/go-utils/v1/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type Controller struct {
+	svc     security.Servicer
+	account account.Servicer
+	logger  *logger.Logger
+}
+
+func NewController(
+	servicer security.Servicer,
+	accountSvc account.Servicer,
+	appLogger *logger.Logger,
+) *Controller {
+	return &Controller{
+		svc:     servicer,
+		account: accountSvc,
+		logger:  appLogger,
+	}
+}
+
+// @Summary Get Failed Login Attempts
+// @Description Get Failed Login Attempts, Admin Only
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param Page query string true "page"
+// @Param Limit query string true "limit"
+// @Param identifier query string false "username used on the attempt"
+// @Param ip_address query string false "ip address of the attempt"
+// @Param from query string false "RFC3339 time, example: 2006-01-02T15:04:05Z"
+// @Param to query string false "RFC3339 time, example: 2006-01-02T15:04:05Z"
+// @Success 200 {object} http.GetFailedLogin
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/accounts/security/failed-logins [get]
+func (ctrl *Controller) GetFailedLogins(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	isAdmin, err := ctrl.account.CheckAdminByID(ctx.Request.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) {
+			rest.ResponseMessage(ctx, http.StatusUnauthorized)
+			return
+		}
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("check admin by id failed", "error", err)
+		return
+	}
+	if !isAdmin {
+		rest.ResponseError(ctx, http.StatusForbidden, map[string]string{
+			"accounts": constant.ErrForbidden.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.Query("Limit"))
+	if err != nil || limit <= 0 {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"limit": constant.ErrInvalidFormat.Error()})
+		return
+	}
+	page, err := strconv.Atoi(ctx.Query("Page"))
+	if err != nil || page <= 0 {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"page": constant.ErrInvalidFormat.Error()})
+		return
+	}
+	pgn := pagination.Pagination{
+		Limit: limit,
+		Page:  page,
+	}
+	pgn.Paginate()
+
+	filter := entity.FailedLoginFilter{
+		Identifier: ctx.Query("identifier"),
+		IPAddress:  ctx.Query("ip_address"),
+	}
+	if from := ctx.Query("from"); from != "" {
+		filter.From, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+				"from": constant.ErrInvalidFormat.Error()})
+			return
+		}
+	}
+	if to := ctx.Query("to"); to != "" {
+		filter.To, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+				"to": constant.ErrInvalidFormat.Error()})
+			return
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.From.After(filter.To) {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"from": constant.ErrInvalidTimeRange.Error()})
+		return
+	}
+
+	response, err := ctrl.svc.FindFailedLogins(filter, pgn)
+	if err != nil {
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("get failed logins failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// @Summary Get Failed Registration Attempts
+// @Description Get Failed Registration Attempts kept for fraud scoring, only the names of the attempted fields are recorded, Admin Only
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param Page query string true "page"
+// @Param Limit query string true "limit"
+// @Param fingerprint query string false "client fingerprint of the attempt"
+// @Param reason query string false "invalid_format, validation_failed, terms_not_accepted or conflict"
+// @Param from query string false "RFC3339 time, example: 2006-01-02T15:04:05Z"
+// @Param to query string false "RFC3339 time, example: 2006-01-02T15:04:05Z"
+// @Success 200 {object} http.GetFailedRegistration
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/accounts/security/failed-registrations [get]
+func (ctrl *Controller) GetFailedRegistrations(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	isAdmin, err := ctrl.account.CheckAdminByID(ctx.Request.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, constant.ErrAccountNotRegistered) {
+			rest.ResponseMessage(ctx, http.StatusUnauthorized)
+			return
+		}
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("check admin by id failed", "error", err)
+		return
+	}
+	if !isAdmin {
+		rest.ResponseError(ctx, http.StatusForbidden, map[string]string{
+			"accounts": constant.ErrForbidden.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.Query("Limit"))
+	if err != nil || limit <= 0 {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"limit": constant.ErrInvalidFormat.Error()})
+		return
+	}
+	page, err := strconv.Atoi(ctx.Query("Page"))
+	if err != nil || page <= 0 {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"page": constant.ErrInvalidFormat.Error()})
+		return
+	}
+	pgn := pagination.Pagination{
+		Limit: limit,
+		Page:  page,
+	}
+	pgn.Paginate()
+
+	filter := entity.FailedRegistrationFilter{
+		Fingerprint: ctx.Query("fingerprint"),
+		Reason:      ctx.Query("reason"),
+	}
+	if from := ctx.Query("from"); from != "" {
+		filter.From, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+				"from": constant.ErrInvalidFormat.Error()})
+			return
+		}
+	}
+	if to := ctx.Query("to"); to != "" {
+		filter.To, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+				"to": constant.ErrInvalidFormat.Error()})
+			return
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.From.After(filter.To) {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"from": constant.ErrInvalidTimeRange.Error()})
+		return
+	}
+
+	response, err := ctrl.svc.FindFailedRegistrations(filter, pgn)
+	if err != nil {
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("get failed registrations failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// @Summary Get Own Sessions
+// @Description Get the active sessions of the authenticated account with the device type and approximate location of each login
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} http.GetSession
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/accounts/sessions [get]
+func (ctrl *Controller) GetSessions(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	currentTokenID, _ := jwt.TokenID(ctx.GetHeader("Authorization"))
+	response, err := ctrl.svc.FindSessions(accountID, currentTokenID)
+	if err != nil {
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("find sessions failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// @Summary Revoke Own Session
+// @Description Revoke an active session of the authenticated account, its token can no longer be used or refreshed. Revoking the current session is a logout
+// @Tags Accounts
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param id path string true "Session ID"
+// @Success 200 {string} string "Success"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not Found, also for a session of another account"
+// @Failure 409 {string} string "Session recorded before sessions could be revoked"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/accounts/sessions/{id} [delete]
+func (ctrl *Controller) DeleteSession(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	sessionID := aes.Decrypt(ctx.Param("id"))
+	if sessionID <= 0 {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"id": constant.ErrInvalidID.Error()})
+		return
+	}
+
+	err := ctrl.svc.RevokeSession(accountID, sessionID)
+	if err != nil {
+		if errors.Is(err, constant.ErrSessionNotFound) {
+			rest.ResponseError(ctx, http.StatusNotFound, map[string]string{
+				"id": constant.ErrSessionNotFound.Error()})
+			return
+		} else if errors.Is(err, constant.ErrSessionNotRevocable) {
+			rest.ResponseError(ctx, http.StatusConflict, map[string]string{
+				"id": constant.ErrSessionNotRevocable.Error()})
+			return
+		}
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("revoke session failed", "error", err)
+		return
+	}
+
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
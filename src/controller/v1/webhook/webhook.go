@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"net/http"
+
+	"go-rest-api/src/constant"
+	entity "go-rest-api/src/http"
+	"go-rest-api/src/pkg/apierror"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/webhook"
+	webhookService "go-rest-api/src/service/v1/webhook"
+
+	"github.com/forkyid/go-utils/v1/aes"
+	"github.com/forkyid/go-utils/v1/rest"
+	"github.com/forkyid/go-utils/v1/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type Controller struct {
+	svc    webhookService.Servicer
+	logger *logger.Logger
+}
+
+func NewController(
+	servicer webhookService.Servicer,
+	appLogger *logger.Logger,
+) *Controller {
+	return &Controller{
+		svc:    servicer,
+		logger: appLogger,
+	}
+}
+
+// @Summary Register Webhook
+// @Description Register a webhook receiving the events of the account, deliveries are signed with the returned secret in X-Webhook-Signature as sha256=hex(hmac(secret, timestamp + "." + body))
+// @Tags Webhooks
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Param Payload body http.CreateWebhook true "Payload, the url must be a public https url"
+// @Success 201 {object} http.CreatedWebhook
+// @Failure 400 {string} string "Bad Request"
+// @Failure 422 {string} string "Unprocessable Entity, each failed field maps to its reason"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 409 {string} string "Resource Conflict"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/accounts/webhooks [post]
+func (ctrl *Controller) Create(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	request := entity.CreateWebhook{}
+	err := rest.BindJSON(ctx, &request)
+	if err != nil {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"body": constant.ErrInvalidFormat.Error()})
+		return
+	}
+
+	if err := validation.Validator.Struct(request); err != nil {
+		rest.ResponseError(ctx, http.StatusUnprocessableEntity, apierror.Reasons(err))
+		return
+	}
+
+	response, err := ctrl.svc.Create(accountID, request)
+	if err != nil {
+		if errors.Is(err, webhook.ErrInvalidURL) || errors.Is(err, webhook.ErrInternalTarget) {
+			rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+				"url": err.Error()})
+			return
+		} else if errors.Is(err, constant.ErrWebhookQuotaExceeded) {
+			rest.ResponseError(ctx, http.StatusConflict, map[string]string{
+				"webhooks": constant.ErrWebhookQuotaExceeded.Error()})
+			return
+		}
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("create webhook failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusCreated, response)
+}
+
+// @Summary Get Webhooks
+// @Description Get the webhooks of the account
+// @Tags Webhooks
+// @Produce application/json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} []http.GetWebhook
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/accounts/webhooks [get]
+func (ctrl *Controller) Get(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	response, err := ctrl.svc.Find(accountID)
+	if err != nil {
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("get webhooks failed", "error", err)
+		return
+	}
+
+	rest.ResponseData(ctx, http.StatusOK, response)
+}
+
+// @Summary Delete Webhook
+// @Description Delete a webhook of the account
+// @Tags Webhooks
+// @Param Authorization header string true "Bearer Token"
+// @Param id path string true "Webhook ID"
+// @Success 200 {string} string "Success"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /v1/accounts/webhooks/{id} [delete]
+func (ctrl *Controller) Delete(ctx *gin.Context) {
+	accountID := ctx.GetInt(constant.AccountIDKey)
+
+	webhookID := aes.Decrypt(ctx.Param("id"))
+	if webhookID <= 0 {
+		rest.ResponseError(ctx, http.StatusBadRequest, map[string]string{
+			"id": constant.ErrInvalidID.Error()})
+		return
+	}
+
+	err := ctrl.svc.Delete(accountID, webhookID)
+	if err != nil {
+		if errors.Is(err, constant.ErrWebhookNotFound) {
+			rest.ResponseError(ctx, http.StatusNotFound, map[string]string{
+				"webhooks": constant.ErrWebhookNotFound.Error()})
+			return
+		}
+		rest.ResponseMessage(ctx, http.StatusInternalServerError)
+		ctrl.logger.For(ctx).Error("delete webhook failed", "error", err)
+		return
+	}
+
+	rest.ResponseMessage(ctx, http.StatusOK)
+}
@@ -1,32 +1,374 @@
 package http
 
+import "time"
+
+// GetUser renders the empty profile fields as "" and omits the other empty optional fields,
+// use nulls.Explicit to render both as null
 type GetUser struct {
 	ID             string `json:"id"`
 	Username       string `json:"username"`
+	Handle         string `json:"handle"`
 	FullName       string `json:"fullname"`
-	Email          string `json:"email"`
-	EmployeeNumber string `json:"employee_number"`
-	Address        string `json:"address"`
-	JobPosition    string `json:"job_position"`
+	DisplayName    string `json:"display_name" nulls:"empty"`
+	Email          string `json:"email" nulls:"empty"`
+	EmployeeNumber string `json:"employee_number" nulls:"empty"`
+	Address        string `json:"address" nulls:"empty"`
+	JobPosition    string `json:"job_position" nulls:"empty"`
 	PhotoURL       string `json:"photo_url"`
+	Locale         string `json:"locale"`
+	TermsVersion   string `json:"terms_version"`
+	// PendingEmail is the new email waiting for confirmation
+	PendingEmail string `json:"pending_email,omitempty"`
+	// PasswordChangedAt is when the password was last set, on registration or a change or reset
+	PasswordChangedAt  *time.Time `json:"password_changed_at,omitempty"`
+	MustChangePassword bool       `json:"must_change_password"`
+	// WeakPassword is a warning only, PasswordUnmetRules lists the policy rules the password does not meet
+	WeakPassword       bool     `json:"weak_password"`
+	PasswordUnmetRules []string `json:"password_unmet_rules,omitempty"`
+	// AvatarVariants maps a variant width to its url, it stays empty while AvatarProcessing is true
+	AvatarVariants   map[string]string `json:"avatar_variants,omitempty"`
+	AvatarProcessing bool              `json:"avatar_processing"`
+	// TermsAcceptanceRequired is true when the accepted terms are older than the current version
+	TermsAcceptanceRequired bool `json:"terms_acceptance_required"`
+	// Status is active, suspended or pending_deletion, a suspended account only shows through the admin GetByID
+	Status           string     `json:"status"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"`
+	// DeletionScheduledAt is when a pending deletion can no longer be cancelled
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	// TwoFactorEnabled is true once a TOTP enrollment was confirmed
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+	// LastLoginAt is the last successful login, it is written in the background and may lag the login by a moment
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// GetCard is the profile of an account as seen by the viewer, hidden fields are omitted
+type GetCard struct {
+	ID             string `json:"id"`
+	Username       string `json:"username,omitempty"`
+	Handle         string `json:"handle"`
+	FullName       string `json:"fullname,omitempty"`
+	DisplayName    string `json:"display_name,omitempty"`
+	PhotoURL       string `json:"photo_url,omitempty"`
+	JobPosition    string `json:"job_position,omitempty"`
+	EmployeeNumber string `json:"employee_number,omitempty"`
+	Email          string `json:"email,omitempty"`
+	PhoneNumber    string `json:"phone_number,omitempty"`
+}
+
+// UpdateVisibility sets the visibility of the given card fields, other fields are kept
+type UpdateVisibility struct {
+	Visibility map[string]string `json:"visibility" validate:"required"`
 }
 
 type RegisterUser struct {
 	Username  string `json:"username" validate:"required"`
 	FullName  string `json:"fullname" validate:"required"`
-	Password  string `json:"password" validate:"required"`
+	Password  string `json:"password" validate:"required,password"`
+	Locale    string `json:"locale"`
+	// TermsVersion must be the current terms version to accept it
+	TermsVersion string `json:"terms_version"`
+	// Email and PhoneNumber are optional, they must not belong to another account
+	Email       *string `json:"email" validate:"omitempty,email"`
+	PhoneNumber *string `json:"phone_number" validate:"omitempty,phone"`
+	// ReservationToken is required while the username is reserved, the reservation is consumed on registration
+	ReservationToken string `json:"reservation_token"`
 }
 
+type ReserveUsername struct {
+	Username string `json:"username" validate:"required"`
+}
+
+// UsernameReservation is returned once, only the hash of Token is stored
+type UsernameReservation struct {
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UpdateUser is a partial update, a field omitted or null is left as it is and a field present is written.
+// An empty username or password is rejected, other empty optional fields are cleared
 type UpdateUser struct {
 	Username       *string `json:"username"`
 	FullName       *string `json:"fullname"`
+	DisplayName    *string `json:"display_name"`
 	Email          *string `json:"email"`
-	Password       *string `json:"password"`
+	Password       *string `json:"password" validate:"omitempty,password"`
 	Address        *string `json:"address"`
 	EmployeeNumber *string `json:"employee_number"`
 	JobPosition    *string `json:"job_position"`
-	KTPNumber      *int    `json:"ktp_number"`
-	PhoneNumber    *string `json:"phone_number"`
+	KTPNumber      *int    `json:"ktp_number" validate:"omitempty,ktp"`
+	PhoneNumber    *string `json:"phone_number" validate:"omitempty,phone"`
 	Gender         *string `json:"gender"`
 	DOBString      *string `json:"date_of_birth" example:"yyyy-mm-dd"`
+	Locale         *string `json:"locale" example:"en"`
+}
+
+type RequestPasswordReset struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPassword struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,password"`
+}
+
+type ChangePassword struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,password"`
+}
+
+// ReplaceUser is the full-replace payload of PUT /v1/accounts/me.
+// Replaceable fields omitted from the payload are reset to their defaults.
+// Managed fields (id, username, password, ktp_number, photo_url, role,
+// is_verified, created_at, updated_at) are never changed by a replace.
+type ReplaceUser struct {
+	FullName       string  `json:"fullname" validate:"required"`
+	DisplayName    *string `json:"display_name"`
+	Email          *string `json:"email"`
+	Address        *string `json:"address"`
+	EmployeeNumber *string `json:"employee_number"`
+	JobPosition    *string `json:"job_position"`
+	PhoneNumber    *string `json:"phone_number" validate:"omitempty,phone"`
+	Gender         string  `json:"gender" validate:"omitempty,enum=gender"`
+	DOBString      *string `json:"date_of_birth" example:"yyyy-mm-dd"`
+	Locale         string  `json:"locale" example:"en"`
+}
+
+type SendVerificationBulk struct {
+	CreatedAfter  string `json:"created_after" example:"yyyy-mm-dd"`
+	CreatedBefore string `json:"created_before" example:"yyyy-mm-dd"`
+}
+
+type SendVerificationBulkResult struct {
+	Enqueued int `json:"enqueued"`
+}
+
+type BulkRowValidation struct {
+	Index  int               `json:"index"`
+	Valid  bool              `json:"valid"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type BulkValidationReport struct {
+	Valid bool                `json:"valid"`
+	Rows  []BulkRowValidation `json:"rows"`
+}
+
+// BulkRowResult is the outcome of one row of a sync import, ID is the public id of the created account
+type BulkRowResult struct {
+	Index   int               `json:"index"`
+	Created bool              `json:"created"`
+	ID      string            `json:"id,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// BulkCreateReport lists every row in request order, created rows stay created when others fail
+type BulkCreateReport struct {
+	Total     int             `json:"total"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Rows      []BulkRowResult `json:"rows"`
+}
+
+// GetPermissions is the resolved permission set of the role and the individual grants
+type GetPermissions struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+// MeBundle carries only the requested sections, the others are omitted
+type MeBundle struct {
+	Profile     *GetUser        `json:"profile,omitempty"`
+	Preferences *Preferences    `json:"preferences,omitempty"`
+	Permissions *GetPermissions `json:"permissions,omitempty"`
+	Sessions    *SessionSummary `json:"sessions,omitempty"`
+}
+
+type Preferences struct {
+	Locale     string            `json:"locale"`
+	Visibility map[string]string `json:"visibility"`
+}
+
+type SessionSummary struct {
+	Active int `json:"active"`
+}
+
+// StorageUsage is the stored footprint of the account broken down by artifact type
+type StorageUsage struct {
+	TotalBytes int64                  `json:"total_bytes"`
+	Artifacts  []StorageArtifactUsage `json:"artifacts"`
+}
+
+type StorageArtifactUsage struct {
+	Artifact  string    `json:"artifact"`
+	Bytes     int64     `json:"bytes"`
+	Objects   int       `json:"objects"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type BulkImportJob struct {
+	JobID string `json:"job_id"`
+}
+
+type GetImportJob struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	Succeeded   int        `json:"succeeded"`
+	Failed      int        `json:"failed"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+type UpdateHandle struct {
+	Handle string `json:"handle" validate:"required"`
+}
+
+// UploadedAvatar is the stored original, the resized avatar_variants follow once processed
+type UploadedAvatar struct {
+	PhotoURL string `json:"photo_url"`
+}
+
+type ExistenceProbe struct {
+	Username string `json:"username" validate:"required_without=Email"`
+	Email    string `json:"email" validate:"required_without=Username"`
+}
+
+// ExistenceProbeResult only carries Exists for admins, other callers get an ambiguous result
+type ExistenceProbeResult struct {
+	Exists    *bool `json:"exists"`
+	Ambiguous bool  `json:"ambiguous"`
+}
+
+type DiagnoseLogin struct {
+	Username string `json:"username" validate:"required"`
+}
+
+// LoginDiagnosis never carries the password or its hash, only the reasons login is rejected or restricted
+type LoginDiagnosis struct {
+	Username string   `json:"username"`
+	CanLogin bool     `json:"can_login"`
+	Reasons  []string `json:"reasons"`
+}
+
+type AcceptTerms struct {
+	TermsVersion string `json:"terms_version" validate:"required"`
+}
+
+// DeletionScheduled is when the requested deletion stops being cancellable and the account is purged
+type DeletionScheduled struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
+
+// TOTPEnrollment is the new authenticator secret, URI is the otpauth uri to render as a QR code.
+// It is only shown once, the stored secret is encrypted
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// ConfirmTOTP is the first code of the enrolled secret
+type ConfirmTOTP struct {
+	Code string `json:"code" validate:"required,len=6"`
+}
+
+// SuspendAccount is the reason kept with the suspension and shown to admins
+type SuspendAccount struct {
+	Reason string `json:"reason" validate:"required,max=255"`
+}
+
+// AdminResetPassword sets the password of an account for support staff, without a password one is generated.
+// RevokeSessions also logs the account out everywhere
+type AdminResetPassword struct {
+	Password       string `json:"password" validate:"omitempty,password"`
+	RevokeSessions bool   `json:"revoke_sessions"`
+}
+
+// AdminPasswordReset holds the generated password, it is shown only once and empty when the admin chose one
+type AdminPasswordReset struct {
+	TemporaryPassword  string `json:"temporary_password,omitempty"`
+	MustChangePassword bool   `json:"must_change_password"`
+	RevokedSessions    int    `json:"revoked_sessions"`
+}
+
+// UpdateRole sets the role of the account with the public id
+type UpdateRole struct {
+	ID   string `json:"id" validate:"required"`
+	Role string `json:"role" validate:"required,enum=role"`
+}
+
+// RestoreAccount names a deleted account by its public id
+type RestoreAccount struct {
+	ID string `json:"id" validate:"required"`
+}
+
+// MergeAccounts merges the source account into the target, Overrides picks source or target
+// per field and is used by the per_field strategy
+type MergeAccounts struct {
+	SourceID  string            `json:"source_id" validate:"required"`
+	TargetID  string            `json:"target_id" validate:"required"`
+	Strategy  string            `json:"strategy" validate:"required"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+// MergeResolution tells which side won a conflicting field and the rule that decided it
+type MergeResolution struct {
+	Field  string `json:"field"`
+	Winner string `json:"winner"`
+	Rule   string `json:"rule"`
+}
+
+// MergeReport lists the resolved conflicts, Filled are empty target fields taken from the source
+type MergeReport struct {
+	TargetID  string            `json:"target_id"`
+	Conflicts []MergeResolution `json:"conflicts"`
+	Filled    []string          `json:"filled"`
+}
+
+// ListAccounts sorts by a field of GetUser, see the account service for the sortable fields
+type ListAccounts struct {
+	Page  int
+	Limit int
+	Sort  string
+	Order string
+}
+
+type AccountList struct {
+	Data  []GetUser `json:"data"`
+	Page  int       `json:"page"`
+	Limit int       `json:"limit"`
+	Total int64     `json:"total"`
+}
+
+// IntegrityScan lists the encrypted ids of the accounts whose checksum does not match,
+// unsealed accounts were not written since checksums were added and are not verified
+type IntegrityScan struct {
+	Checked    int      `json:"checked"`
+	Unsealed   int      `json:"unsealed"`
+	Mismatched []string `json:"mismatched"`
+}
+
+// ExportAccount is one line of the account export, the personal fields are only set
+// for admins allowed to read them
+type ExportAccount struct {
+	ID             string    `json:"id"`
+	Username       string    `json:"username"`
+	Handle         string    `json:"handle"`
+	FullName       string    `json:"fullname"`
+	DisplayName    string    `json:"display_name,omitempty"`
+	JobPosition    string    `json:"job_position,omitempty"`
+	Role           string    `json:"role"`
+	Locale         string    `json:"locale"`
+	IsVerified     bool      `json:"is_verified"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Email          string    `json:"email,omitempty"`
+	PhoneNumber    string    `json:"phone_number,omitempty"`
+	EmployeeNumber string    `json:"employee_number,omitempty"`
+	Address        string    `json:"address,omitempty"`
+	DateOfBirth    string    `json:"date_of_birth,omitempty"`
+	// KTPNumber is only set by the csv export
+	KTPNumber string `json:"ktp_number,omitempty"`
 }
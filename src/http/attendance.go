@@ -17,5 +17,5 @@ type GetAttendanceByLocation struct {
 
 type AddAttendance struct {
 	LocationID int     `json:"location_id" validate:"required"`
-	Status     string  `json:"status" validate:"required"`
+	Status     string  `json:"status" validate:"required,enum=status"`
 }
@@ -0,0 +1,29 @@
+package http
+
+import (
+	"time"
+)
+
+type AuditChainVerification struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// BrokenAtID is the first entry whose hash or link to its predecessor does not match
+	BrokenAtID *int `json:"broken_at_id,omitempty"`
+}
+
+// GetAuditEntry ids are encrypted, the actor differs from the target for actions taken by an admin
+type GetAuditEntry struct {
+	ID        int               `json:"id"`
+	ActorID   string            `json:"actor_id"`
+	Action    string            `json:"action"`
+	TargetID  string            `json:"target_id"`
+	IPAddress string            `json:"ip_address"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt string            `json:"created_at"`
+}
+
+type AuditFilter struct {
+	Action string
+	From   time.Time
+	To     time.Time
+}
@@ -1,15 +1,41 @@
 package http
 
-type Auth struct {
-	Username  string `json:"username" validate:"required"`
-	Password  string `json:"password" validate:"required"`
+import "time"
+
+// LoginUser identifies the account by username or email, the username is used when both are given
+type LoginUser struct {
+	Username string `json:"username" validate:"required_without=Email"`
+	Email    string `json:"email" validate:"required_without=Username"`
+	Password string `json:"password" validate:"required"`
 }
 
 type Token struct {
 	Token string `json:"access_token"`
+	// MustChangePassword is true when the password is older than the max password age or an admin reset it,
+	// after a reset the token only reaches the password change until it is changed
+	MustChangePassword bool `json:"must_change_password"`
+	// WeakPassword is a warning only, PasswordUnmetRules lists the policy rules the password does not meet
+	WeakPassword       bool     `json:"weak_password"`
+	PasswordUnmetRules []string `json:"password_unmet_rules,omitempty"`
+	// DeletionScheduledAt is set while a deletion is pending, the client can offer to cancel it
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+// TwoFactorChallenge answers a login of an account with two factor on, the challenge token is sent
+// with the authenticator code to finish the login before ExpiresAt
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
 }
 
+type LoginTOTP struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required,len=6"`
+}
+
+
 type ForgotPassword struct {
-	KTPNumber int    `json:"ktp_number" validate:"required"`
-	Password  string `json:"new_password" validate:"required"`
+	KTPNumber int    `json:"ktp_number" validate:"required,ktp"`
+	Password  string `json:"new_password" validate:"required,password"`
 }
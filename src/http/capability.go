@@ -0,0 +1,16 @@
+package http
+
+type Capabilities struct {
+	Features   map[string]bool      `json:"features"`
+	Parameters CapabilityParameters `json:"parameters"`
+}
+
+type CapabilityParameters struct {
+	PasswordPolicyURL   string   `json:"password_policy_url,omitempty"`
+	OAuthProviders      []string `json:"oauth_providers"`
+	SupportedLocales    []string `json:"supported_locales"`
+	DefaultLocale       string   `json:"default_locale"`
+	TermsVersion        string   `json:"terms_version"`
+	ProfileUpdateLimit  int      `json:"profile_update_limit"`
+	ProfileUpdateWindow string   `json:"profile_update_window"`
+}
@@ -0,0 +1,11 @@
+package http
+
+// Readiness maps every dependency to up, down or timeout
+type Readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+type Liveness struct {
+	Status string `json:"status"`
+}
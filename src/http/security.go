@@ -0,0 +1,48 @@
+package http
+
+import (
+	"time"
+)
+
+type GetFailedLogin struct {
+	ID         int    `json:"id"`
+	Identifier string `json:"identifier"`
+	IPAddress  string `json:"ip_address"`
+	Reason     string `json:"reason"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type FailedLoginFilter struct {
+	Identifier string
+	IPAddress  string
+	From       time.Time
+	To         time.Time
+}
+
+type GetFailedRegistration struct {
+	ID          int      `json:"id"`
+	Fingerprint string   `json:"fingerprint"`
+	Reason      string   `json:"reason"`
+	Fields      []string `json:"fields"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+type FailedRegistrationFilter struct {
+	Fingerprint string
+	Reason      string
+	From        time.Time
+	To          time.Time
+}
+
+// GetSession carries the approximate location of the login ip, country and city are empty when unknown.
+// Current marks the session of the token making the request
+type GetSession struct {
+	ID         string `json:"id"`
+	IPAddress  string `json:"ip_address"`
+	DeviceType string `json:"device_type"`
+	Country    string `json:"country"`
+	City       string `json:"city"`
+	Current    bool   `json:"current"`
+	CreatedAt  string `json:"created_at"`
+	ExpiresAt  string `json:"expires_at"`
+}
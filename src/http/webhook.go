@@ -0,0 +1,25 @@
+package http
+
+type CreateWebhook struct {
+	URL string `json:"url" validate:"required"`
+}
+
+type GetWebhook struct {
+	ID        string `json:"id"`
+	URL       string `json:"url"`
+	CreatedAt string `json:"created_at"`
+}
+
+// CreatedWebhook carries the signing secret, it is only returned once on registration
+type CreatedWebhook struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// WebhookEvent is the body of a delivery, it only describes the account owning the webhook
+type WebhookEvent struct {
+	Event      string `json:"event"`
+	AccountID  string `json:"account_id"`
+	OccurredAt string `json:"occurred_at"`
+}
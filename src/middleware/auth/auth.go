@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/apierror"
+	"go-rest-api/src/pkg/jwt"
+	"go-rest-api/src/pkg/metrics"
+)
+
+const (
+	ExpiresSoonHeader = "X-Token-Expires-Soon"
+	ExpiresAtHeader   = "X-Token-Expires-At"
+)
+
+// tokenFailures maps the errors of jwt.ExtractID to the reason of the 401 body and the auth_failures_total metric,
+// any other error is an invalid_token
+var tokenFailures = map[error]string{
+	constant.ErrMissingToken:     constant.AuthFailureMissingToken,
+	constant.ErrMalformedToken:   constant.AuthFailureMalformedToken,
+	constant.ErrInvalidSignature: constant.AuthFailureInvalidSignature,
+	constant.ErrTokenExpired:     constant.AuthFailureTokenExpired,
+	constant.ErrTokenRevoked:     constant.AuthFailureTokenRevoked,
+	constant.ErrForeignAccountID: constant.AuthFailureForeignAccountID,
+}
+
+// passwordChangeRoutes are the routes a token limited by jwt.RequirePasswordChange still reaches
+var passwordChangeRoutes = struct {
+	sync.RWMutex
+	allowed map[string]bool
+}{allowed: map[string]bool{}}
+
+// AllowDuringPasswordChange lets a token limited by jwt.RequirePasswordChange reach the route,
+// the path is the registered route path e.g. /v1/accounts/password
+func AllowDuringPasswordChange(method, path string) {
+	passwordChangeRoutes.Lock()
+	defer passwordChangeRoutes.Unlock()
+	passwordChangeRoutes.allowed[method+" "+path] = true
+}
+
+func allowedDuringPasswordChange(ctx *gin.Context) bool {
+	passwordChangeRoutes.RLock()
+	defer passwordChangeRoutes.RUnlock()
+	return passwordChangeRoutes.allowed[ctx.Request.Method+" "+ctx.FullPath()]
+}
+
+// AuthRequired validates the token once and stores the account id under constant.AccountIDKey,
+// handlers read it with ctx.GetInt. The Bearer prefix is optional.
+// A rejected token gets 401 whose code is the reason e.g. missing_token, malformed_token, invalid_signature or token_expired.
+// A token of an account whose password was reset by an admin gets 403 password_change_required outside the
+// routes of AllowDuringPasswordChange.
+// A token expiring within constant.TokenExpiryWarning gets the expires soon headers so the client can refresh first.
+func AuthRequired() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		accountID, err := jwt.ExtractID(ctx.GetHeader("Authorization"))
+		if err == constant.ErrAccountSuspended {
+			metrics.AuthFailure(constant.AuthFailureAccountSuspended)
+			apierror.Field(ctx, "accounts", err)
+			ctx.Abort()
+			return
+		} else if err != nil {
+			reason, ok := tokenFailures[err]
+			if !ok {
+				reason, err = constant.AuthFailureInvalidToken, constant.ErrInvalidToken
+			}
+			metrics.AuthFailure(reason)
+			apierror.Authorization(ctx, http.StatusUnauthorized, err)
+			ctx.Abort()
+			return
+		}
+
+		if !allowedDuringPasswordChange(ctx) {
+			required, err := jwt.PasswordChangeRequired(accountID)
+			if err != nil || required {
+				reason, rejection := constant.AuthFailurePasswordChange, constant.ErrPasswordChangeRequired
+				status := http.StatusForbidden
+				if err != nil {
+					// the same as a blacklist that cannot be read when validating the token
+					reason, rejection = constant.AuthFailureInvalidToken, constant.ErrInvalidToken
+					status = http.StatusUnauthorized
+				}
+				metrics.AuthFailure(reason)
+				apierror.Authorization(ctx, status, rejection)
+				ctx.Abort()
+				return
+			}
+		}
+
+		ctx.Set(constant.AccountIDKey, accountID)
+		if constant.TokenExpiryWarning > 0 {
+			expiresAt, err := jwt.ExtractExpiry(ctx.GetHeader("Authorization"))
+			if err == nil && time.Until(expiresAt) <= constant.TokenExpiryWarning {
+				ctx.Header(ExpiresSoonHeader, "true")
+				ctx.Header(ExpiresAtHeader, expiresAt.UTC().Format(time.RFC3339))
+			}
+		}
+		ctx.Next()
+	}
+}
+
+// RequireRole rejects a token whose role claim is not role with 403, it must run after AuthRequired.
+// The claim is only as fresh as the token, handlers changing data still check the stored role
+func RequireRole(role string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claimed, err := jwt.ExtractRole(ctx.GetHeader("Authorization"))
+		if err != nil {
+			apierror.Response(ctx, constant.ErrUnauthorized)
+			ctx.Abort()
+			return
+		}
+		if claimed != role {
+			apierror.Field(ctx, "accounts", constant.ErrForbidden)
+			ctx.Abort()
+			return
+		}
+
+		ctx.Set(constant.RoleKey, claimed)
+		ctx.Next()
+	}
+}
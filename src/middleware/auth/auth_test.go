@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/apierror"
+	"go-rest-api/src/pkg/jwt"
+	"go-rest-api/src/pkg/publicid"
+)
+
+// issue returns a bearer token of the account that expires after ttl
+func issue(t *testing.T, ttl time.Duration) string {
+	t.Helper()
+	defaultTTL := constant.TokenTTL
+	constant.TokenTTL = ttl
+	defer func() { constant.TokenTTL = defaultTTL }()
+
+	token, err := jwt.GenerateJWT(publicid.Encode(7), "", constant.RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateJWT() error = %v", err)
+	}
+	return "Bearer " + token
+}
+
+func TestExpiresSoonHint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defaultSecret, defaultWarning := constant.SampleSecretKey, constant.TokenExpiryWarning
+	constant.SampleSecretKey = []byte("test secret")
+	defer func() { constant.SampleSecretKey, constant.TokenExpiryWarning = defaultSecret, defaultWarning }()
+
+	router := gin.New()
+	router.GET("/me", AuthRequired(), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		warning  time.Duration
+		wantHint bool
+	}{
+		{"near expiry", 2 * time.Minute, 5 * time.Minute, true},
+		{"fresh", time.Hour, 5 * time.Minute, false},
+		{"hint disabled", 2 * time.Minute, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constant.TokenExpiryWarning = tt.warning
+			token := issue(t, tt.ttl)
+			request := httptest.NewRequest(http.MethodGet, "/me", nil)
+			request.Header.Set("Authorization", token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+			}
+
+			hint, expiresAt := recorder.Header().Get(ExpiresSoonHeader), recorder.Header().Get(ExpiresAtHeader)
+			if !tt.wantHint {
+				if hint != "" || expiresAt != "" {
+					t.Errorf("headers = %q, %q, want no hint", hint, expiresAt)
+				}
+				return
+			}
+			if hint != "true" {
+				t.Errorf("%s = %q, want true", ExpiresSoonHeader, hint)
+			}
+			parsed, err := time.Parse(time.RFC3339, expiresAt)
+			if drift := parsed.Sub(time.Now().Add(tt.ttl)); err != nil || drift < -2*time.Second || drift > 2*time.Second {
+				t.Errorf("%s = %q, want about %s from now", ExpiresAtHeader, expiresAt, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestRejectedTokensUseTheErrorEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defaultSecret := constant.SampleSecretKey
+	constant.SampleSecretKey = []byte("test secret")
+	defer func() { constant.SampleSecretKey = defaultSecret }()
+
+	router := gin.New()
+	router.GET("/me", AuthRequired(), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	router.GET("/admin", AuthRequired(), RequireRole(constant.RoleAdmin), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		wantStatus    int
+		wantCode      string
+	}{
+		{"missing token", "/me", "", http.StatusUnauthorized, constant.AuthFailureMissingToken},
+		{"malformed token", "/me", "Bearer not-a-token", http.StatusUnauthorized, constant.AuthFailureMalformedToken},
+		{"expired token", "/me", issue(t, -time.Minute), http.StatusUnauthorized, constant.AuthFailureTokenExpired},
+		{"wrong role", "/admin", issue(t, time.Hour), http.StatusForbidden, "forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			response := apierror.Envelope{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("body %q is not json: %v", recorder.Body.String(), err)
+			}
+			if response.Error.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", response.Error.Code, tt.wantCode)
+			}
+		})
+	}
+}
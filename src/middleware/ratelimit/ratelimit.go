@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/apierror"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/slidingwindow"
+)
+
+// Store counts the requests of a key within a window, implementations shared by every instance
+// (e.g. redis) make the limits global instead of per instance
+type Store interface {
+	Allow(key string, limit int, window time.Duration) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// MemoryStore keeps the counters of this instance only
+type MemoryStore struct {
+	limiter *slidingwindow.Limiter
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		limiter: slidingwindow.NewLimiter(),
+	}
+}
+
+func (store *MemoryStore) Allow(key string, limit int, window time.Duration) (allowed bool, retryAfter time.Duration, err error) {
+	allowed, retryAfter = store.limiter.Reserve(slidingwindow.Rule{
+		Key:    key,
+		Limit:  limit,
+		Window: window,
+	})
+	return
+}
+
+// Rule limits the requests Key maps to the same value, a non positive limit or an empty key skips the rule
+type Rule struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    func(ctx *gin.Context) string
+}
+
+// Limit rejects a request exceeding any rule with 429 and a Retry-After in seconds.
+// A failing store lets the request through, the auth endpoints must stay usable without it
+func Limit(store Store, appLogger *logger.Logger, rules ...Rule) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		for _, rule := range rules {
+			if rule.Limit <= 0 {
+				continue
+			}
+			key := rule.Key(ctx)
+			if key == "" {
+				continue
+			}
+
+			allowed, retryAfter, err := store.Allow(rule.Name+":"+key, rule.Limit, rule.Window)
+			if err != nil {
+				appLogger.For(ctx).Error("rate limit store failed", "rule", rule.Name, "error", err)
+				continue
+			}
+			if !allowed {
+				ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				apierror.Field(ctx, "requests", constant.ErrRateLimited)
+				ctx.Abort()
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
+
+// ClientIP keys a rule by the client ip
+func ClientIP(ctx *gin.Context) string {
+	return ctx.ClientIP()
+}
+
+// LoginIdentifier keys a rule by the lowercase username or email of a login body, the body is left readable
+func LoginIdentifier(ctx *gin.Context) string {
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return ""
+	}
+	ctx.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	login := struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}{}
+	if json.Unmarshal(body, &login) != nil {
+		return ""
+	}
+	if login.Username != "" {
+		return strings.ToLower(login.Username)
+	}
+	return strings.ToLower(login.Email)
+}
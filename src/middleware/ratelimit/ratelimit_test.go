@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/pkg/logger"
+)
+
+func TestClientIPBehindATrustedProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := router.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("SetTrustedProxies() error = %v", err)
+	}
+	router.POST("/login", Limit(NewMemoryStore(), logger.New(io.Discard, logger.LevelError),
+		Rule{Name: "login", Limit: 1, Window: time.Minute, Key: ClientIP}),
+		func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         int
+	}{
+		{"first client through the proxy", "10.0.0.1:5000", "203.0.113.10", http.StatusOK},
+		{"second client through the proxy has its own limit", "10.0.0.1:5000", "203.0.113.11", http.StatusOK},
+		{"first client again", "10.0.0.1:5000", "203.0.113.10", http.StatusTooManyRequests},
+		{"direct client", "198.51.100.7:6000", "203.0.113.20", http.StatusOK},
+		// a client outside the proxies cannot pick another ip to escape its limit
+		{"direct client claiming another ip", "198.51.100.7:6000", "203.0.113.21", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/login", nil)
+			request.RemoteAddr = tt.remoteAddr
+			request.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.want)
+			}
+		})
+	}
+}
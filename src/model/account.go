@@ -7,21 +7,90 @@ import (
 
 type Account struct {
 	gorm.Model
-	Username          string    `gorm:"column:username;type:varchar(50)"`
-	FullName          string    `gorm:"column:full_name;type:varchar(150)"`
-	Email             *string   `gorm:"column:email;type:varchar(150)"`
-	Password          string    `gorm:"column:password;type:varchar(64)"`
-	Address           *string   `gorm:"column:address;type:varchar(50)"`
-	EmployeeNumber    *string   `gorm:"column:employee_number;type:varchar(50)"`
-	JobPosition       *string   `gorm:"column:job_position;type:varchar(50)"`
-	KTPNumber         *string   `gorm:"column:ktp_number;type:varchar(50)"`
-	PhoneNumber       *string   `gorm:"column:phone_number;type:varchar(20)"`
-	PhotoURL          string    `gorm:"column:photo_url;type:varchar(200)"`
-	Gender            string    `gorm:"column:gender"`
-	DateOfBirth       time.Time `gorm:"column:date_of_birth;type:date"`
-	IsVerified        bool      `gorm:"column:is_verified;type:bool"`
+	Username        string     `gorm:"column:username;type:varchar(50)"`
+	FullName        string     `gorm:"column:full_name;type:varchar(150)"`
+	DisplayName     *string    `gorm:"column:display_name;type:varchar(100)"`
+	Email           *string    `gorm:"column:email;type:varchar(150)"`
+	Password        string     `gorm:"column:password;type:varchar(255)"`
+	Address         *string    `gorm:"column:address;type:varchar(50)"`
+	EmployeeNumber  *string    `gorm:"column:employee_number;type:varchar(50)"`
+	JobPosition     *string    `gorm:"column:job_position;type:varchar(50)"`
+	KTPNumber       *string    `gorm:"column:ktp_number;type:varchar(50)"`
+	PhoneNumber     *string    `gorm:"column:phone_number;type:varchar(20)"`
+	PhotoURL        string     `gorm:"column:photo_url;type:varchar(200)"`
+	Gender          string     `gorm:"column:gender"`
+	DateOfBirth     time.Time  `gorm:"column:date_of_birth;type:date"`
+	IsVerified      bool       `gorm:"column:is_verified;type:bool"`
+	Role            string     `gorm:"column:role;type:varchar(20)"`
+	Locale          string     `gorm:"column:locale;type:varchar(10)"`
+	TermsVersion    string     `gorm:"column:terms_version;type:varchar(20)"`
+	TermsAcceptedAt *time.Time `gorm:"column:terms_accepted_at"`
+	// PasswordChangedAt is set on registration and every password change or reset
+	PasswordChangedAt *time.Time `gorm:"column:password_changed_at"`
+	// MustChangePassword is set by an admin reset, the owner's tokens only reach the password change until it is cleared
+	MustChangePassword bool `gorm:"column:must_change_password;type:bool"`
+	// Permissions is a json array of permissions granted on top of the role
+	Permissions string `gorm:"column:permissions;type:text"`
+	// FieldVisibility is a json object of card field to visibility, missing fields use the default
+	FieldVisibility string `gorm:"column:field_visibility;type:text"`
+	// AvatarVariants is a json object of variant width to url
+	AvatarVariants   string `gorm:"column:avatar_variants;type:text"`
+	AvatarProcessing bool   `gorm:"column:avatar_processing;type:bool"`
+	Handle           string `gorm:"column:handle;type:varchar(60)"`
+	// PendingEmail replaces Email once confirmed, further email changes are locked until it expires
+	PendingEmail          *string    `gorm:"column:pending_email;type:varchar(150)"`
+	PendingEmailExpiresAt *time.Time `gorm:"column:pending_email_expires_at"`
+	// WeakPasswordRules is a json array of the password policy rules the password did not meet when last checked
+	WeakPasswordRules string `gorm:"column:weak_password_rules;type:text"`
+	// CanonicalEmail is Email canonicalized for the uniqueness check, Email is kept as given for sending
+	CanonicalEmail *string `gorm:"column:canonical_email;type:varchar(150)"`
+	// Checksum covers the critical fields and is resealed on every write, empty until the first write after it was added
+	Checksum string `gorm:"column:checksum;type:varchar(64)"`
+	// FailedLoginCount counts the failed logins since the last successful one, reaching the threshold sets LockedUntil
+	FailedLoginCount int        `gorm:"column:failed_login_count"`
+	LockedUntil      *time.Time `gorm:"column:locked_until"`
+	// Status is active, suspended or pending_deletion, SuspensionReason and SuspendedAt are kept from the last suspension
+	Status           string     `gorm:"column:status;type:varchar(20);default:active"`
+	SuspensionReason *string    `gorm:"column:suspension_reason;type:varchar(255)"`
+	SuspendedAt      *time.Time `gorm:"column:suspended_at"`
+	// DeleteRequestedAt is set while the owner's deletion is pending
+	DeleteRequestedAt *time.Time `gorm:"column:delete_requested_at"`
+	// TOTPSecret is the encrypted authenticator secret, logins ask for a code once TOTPEnabledAt is set.
+	// TOTPLastStep is the time step of the last accepted code, a code is accepted only once
+	TOTPSecret    *string    `gorm:"column:totp_secret;type:varchar(255)"`
+	TOTPEnabledAt *time.Time `gorm:"column:totp_enabled_at"`
+	TOTPLastStep  int64      `gorm:"column:totp_last_step"`
+	// LastLoginAt is set in the background on every successful login, nil for an account that never logged in
+	LastLoginAt *time.Time `gorm:"column:last_login_at"`
 }
 
 func (Account) TableName() string {
 	return "accounts"
 }
+
+// HandleRedirect keeps a previous handle pointing to the account until it expires,
+// after that the handle can be taken by another account
+type HandleRedirect struct {
+	ID        uint      `gorm:"column:id;primaryKey"`
+	Handle    string    `gorm:"column:handle;type:varchar(60)"`
+	AccountID int       `gorm:"column:account_id"`
+	ExpiresAt time.Time `gorm:"column:expires_at"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+func (HandleRedirect) TableName() string {
+	return "handle_redirects"
+}
+
+// UsernameReservation holds a username for the registration presenting the token until it expires
+type UsernameReservation struct {
+	ID        uint      `gorm:"column:id;primaryKey"`
+	Username  string    `gorm:"column:username;type:varchar(50)"`
+	TokenHash string    `gorm:"column:token_hash;type:varchar(64)"`
+	ExpiresAt time.Time `gorm:"column:expires_at"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+func (UsernameReservation) TableName() string {
+	return "username_reservations"
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// AuditLog entries are hash chained, Hash covers the entry fields and PrevHash
+type AuditLog struct {
+	ID        uint      `gorm:"column:id;primaryKey"`
+	ActorID   int       `gorm:"column:actor_id"`
+	Action    string    `gorm:"column:action;type:varchar(50)"`
+	TargetID  int       `gorm:"column:target_id"`
+	IPAddress string    `gorm:"column:ip_address;type:varchar(45)"`
+	Metadata  string    `gorm:"column:metadata;type:text"`
+	PrevHash  string    `gorm:"column:prev_hash;type:varchar(64)"`
+	Hash      string    `gorm:"column:hash;type:varchar(64)"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+type ImportJob struct {
+	ID        uint   `gorm:"column:id;primaryKey"`
+	CreatedBy int    `gorm:"column:created_by"`
+	Status    string `gorm:"column:status;type:varchar(20)"`
+	Total     int    `gorm:"column:total"`
+	Processed int    `gorm:"column:processed"`
+	Succeeded int    `gorm:"column:succeeded"`
+	Failed    int    `gorm:"column:failed"`
+	// Errors is a json array of the failed rows
+	Errors      string     `gorm:"column:errors;type:text"`
+	CreatedAt   time.Time  `gorm:"column:created_at"`
+	CompletedAt *time.Time `gorm:"column:completed_at"`
+}
+
+func (ImportJob) TableName() string {
+	return "import_jobs"
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+type Outbox struct {
+	ID        uint       `gorm:"column:id;primaryKey"`
+	Recipient string     `gorm:"column:recipient;type:varchar(150)"`
+	Locale    string     `gorm:"column:locale;type:varchar(10)"`
+	Template  string     `gorm:"column:template;type:varchar(50)"`
+	Data      string     `gorm:"column:data;type:text"`
+	Status    string     `gorm:"column:status;type:varchar(20)"`
+	Attempts  int        `gorm:"column:attempts"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+	SentAt    *time.Time `gorm:"column:sent_at"`
+}
+
+func (Outbox) TableName() string {
+	return "email_outbox"
+}
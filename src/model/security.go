@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+)
+
+type FailedLogin struct {
+	ID         uint      `gorm:"column:id;primaryKey"`
+	Identifier string    `gorm:"column:identifier;type:varchar(150)"`
+	IPAddress  string    `gorm:"column:ip_address;type:varchar(45)"`
+	Reason     string    `gorm:"column:reason;type:varchar(50)"`
+	CreatedAt  time.Time `gorm:"column:created_at"`
+}
+
+func (FailedLogin) TableName() string {
+	return "failed_logins"
+}
+
+// FailedRegistration keeps no field values, Fields is a json array of the field names the attempt filled in
+type FailedRegistration struct {
+	ID          uint      `gorm:"column:id;primaryKey"`
+	Fingerprint string    `gorm:"column:fingerprint;type:varchar(64)"`
+	Reason      string    `gorm:"column:reason;type:varchar(50)"`
+	Fields      string    `gorm:"column:fields;type:text"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+}
+
+func (FailedRegistration) TableName() string {
+	return "failed_registrations"
+}
+
+// Session is recorded on every login and stays active until the token it issued expires or it is revoked.
+// TokenID is the jti of the current token of the session, a refresh moves the session to the new token
+type Session struct {
+	ID        uint       `gorm:"column:id;primaryKey"`
+	AccountID int        `gorm:"column:account_id"`
+	TokenID   *string    `gorm:"column:token_id;type:varchar(64)"`
+	IPAddress string     `gorm:"column:ip_address;type:varchar(45)"`
+	UserAgent string     `gorm:"column:user_agent;type:varchar(300)"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+	ExpiresAt time.Time  `gorm:"column:expires_at"`
+	RevokedAt *time.Time `gorm:"column:revoked_at"`
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+)
+
+// StorageUsage is the stored footprint of one artifact type of an account,
+// kept up to date on every write so usage never needs a storage scan
+type StorageUsage struct {
+	ID        uint      `gorm:"column:id;primaryKey"`
+	AccountID int       `gorm:"column:account_id"`
+	Artifact  string    `gorm:"column:artifact;type:varchar(20)"`
+	Bytes     int64     `gorm:"column:bytes"`
+	Objects   int       `gorm:"column:objects"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+func (StorageUsage) TableName() string {
+	return "storage_usages"
+}
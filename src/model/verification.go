@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+type VerificationToken struct {
+	ID        uint       `gorm:"column:id;primaryKey"`
+	AccountID int        `gorm:"column:account_id"`
+	Purpose   string     `gorm:"column:purpose;type:varchar(20)"`
+	TokenHash string     `gorm:"column:token_hash;type:varchar(64)"`
+	ExpiresAt time.Time  `gorm:"column:expires_at"`
+	UsedAt    *time.Time `gorm:"column:used_at"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+	// Seed derives the token with the server secret, tokens without one cannot be sent again
+	Seed string `gorm:"column:seed;type:varchar(64)"`
+}
+
+func (VerificationToken) TableName() string {
+	return "verification_tokens"
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+// Webhook receives the events of its own account, deliveries are signed with Secret
+type Webhook struct {
+	ID        uint      `gorm:"column:id;primaryKey"`
+	AccountID int       `gorm:"column:account_id"`
+	URL       string    `gorm:"column:url;type:varchar(500)"`
+	Secret    string    `gorm:"column:secret;type:varchar(64)"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
@@ -0,0 +1,379 @@
+package apierror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/forkyid/go-utils/v1/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/enum"
+	"go-rest-api/src/pkg/metrics"
+	"go-rest-api/src/pkg/nik"
+	"go-rest-api/src/pkg/passwordpolicy"
+	"go-rest-api/src/pkg/phone"
+)
+
+// Envelope is the body of every error response
+type Envelope struct {
+	Error Body `json:"error"`
+}
+
+// Body describes the error, Fields maps each request field it concerns to a code,
+// Reasons explains each failed field of a validation error in words, Errors lists the same failures
+// in order with their rule, and Allowed lists the accepted values of the failed enum fields.
+// RequestID is the X-Request-ID of the request so a client can quote it
+type Body struct {
+	Code      string              `json:"code"`
+	Message   string              `json:"message"`
+	Fields    map[string]string   `json:"fields,omitempty"`
+	Reasons   map[string]string   `json:"reasons,omitempty"`
+	Errors    []FieldError        `json:"errors,omitempty"`
+	Allowed   map[string][]string `json:"allowed,omitempty"`
+	RequestID string              `json:"request_id,omitempty"`
+}
+
+// FieldError is one failed rule of a validation error, Rule is the validate tag e.g. required or password
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Definition is the stable code and status of an error, Field is the request field it concerns by default
+type Definition struct {
+	Code   string
+	Status int
+	Field  string
+}
+
+// Definitions maps every constant.Err* value to its response, codes are part of the api and never renamed
+var Definitions = map[error]Definition{
+	constant.ErrUnauthorized:             {"unauthorized", http.StatusUnauthorized, ""},
+	constant.ErrValidationFailed:         {"validation_failed", http.StatusUnprocessableEntity, ""},
+	constant.ErrInternal:                 {"internal_error", http.StatusInternalServerError, ""},
+	constant.ErrInvalidAddress:           {"invalid_address", http.StatusBadRequest, "address"},
+	constant.ErrInvalidID:                {"invalid_id", http.StatusBadRequest, "id"},
+	constant.ErrForeignAccountID:         {"foreign_account_id", http.StatusBadRequest, "id"},
+	constant.ErrInvalidFormat:            {"invalid_format", http.StatusBadRequest, "body"},
+	constant.ErrInvalidDOBFormat:         {"invalid_date_of_birth", http.StatusBadRequest, "date_of_birth"},
+	constant.ErrDOBOutOfRange:            {"date_of_birth_out_of_range", http.StatusBadRequest, "date_of_birth"},
+	constant.ErrInvalidLocale:            {"invalid_locale", http.StatusBadRequest, "locale"},
+	constant.ErrInvalidLocationName:      {"invalid_location_name", http.StatusBadRequest, "name"},
+	constant.ErrInvalidPassword:          {"invalid_password", http.StatusBadRequest, "password"},
+	constant.ErrInvalidCredentials:       {"invalid_credentials", http.StatusUnauthorized, ""},
+	constant.ErrAccountLocked:            {"account_locked", http.StatusLocked, ""},
+	constant.ErrPasswordMismatch:         {"password_mismatch", http.StatusBadRequest, "old_password"},
+	constant.ErrPasswordUnchanged:        {"password_unchanged", http.StatusBadRequest, "new_password"},
+	constant.ErrVerifyBusy:               {"verify_busy", http.StatusTooManyRequests, ""},
+	constant.ErrInvalidStatusAttendance:  {"invalid_status", http.StatusBadRequest, "status"},
+	constant.ErrAccountExist:             {"account_exist", http.StatusConflict, ""},
+	constant.ErrAccountNotRegistered:     {"account_not_registered", http.StatusNotFound, ""},
+	constant.ErrAccountNotDeleted:        {"account_not_deleted", http.StatusConflict, ""},
+	constant.ErrRestoreWindowExpired:     {"restore_window_expired", http.StatusGone, ""},
+	constant.ErrDeletionNotPending:       {"deletion_not_pending", http.StatusConflict, ""},
+	constant.ErrDeletionGraceExpired:     {"deletion_grace_expired", http.StatusGone, ""},
+	constant.ErrEmailAlreadyExist:        {constant.ConflictCodeEmail, http.StatusConflict, "email"},
+	constant.ErrDisplayNameAlreadyExist:  {"display_name_taken", http.StatusConflict, "display_name"},
+	constant.ErrDisplayNameCannotBeEmpty: {"display_name_empty", http.StatusBadRequest, "display_name"},
+	constant.ErrLocationAlreadyExist:     {"location_exist", http.StatusConflict, ""},
+	constant.ErrLocationNameAlreadyExist: {"location_name_taken", http.StatusConflict, "name"},
+	constant.ErrLocationNotExist:         {"location_not_exist", http.StatusNotFound, ""},
+	constant.ErrKTPNumberAlreadyExist:    {"ktp_number_taken", http.StatusConflict, "ktp_number"},
+	constant.ErrDOBKTPMismatch:           {"date_of_birth_ktp_mismatch", http.StatusBadRequest, "date_of_birth"},
+	constant.ErrPasswordCannotBeEmpty:    {"password_empty", http.StatusBadRequest, "password"},
+	constant.ErrUsernameCannotBeEmpty:    {"username_empty", http.StatusBadRequest, "username"},
+	constant.ErrPhoneNumberAlreadyExist:  {constant.ConflictCodePhoneNumber, http.StatusConflict, "phone_number"},
+	constant.ErrUsernameAlreadyExist:     {constant.ConflictCodeUsername, http.StatusConflict, "username"},
+	constant.ErrForbidden:                {"forbidden", http.StatusForbidden, ""},
+	constant.ErrPreconditionFailed:       {"precondition_failed", http.StatusPreconditionFailed, ""},
+	constant.ErrUpdateRateExceeded:       {"update_rate_exceeded", http.StatusTooManyRequests, ""},
+	constant.ErrInvalidTimeRange:         {"invalid_time_range", http.StatusBadRequest, ""},
+	constant.ErrInvalidDateFormat:        {"invalid_date_format", http.StatusBadRequest, ""},
+	constant.ErrBulkImportTooLarge:       {"bulk_import_too_large", http.StatusBadRequest, "body"},
+	constant.ErrBulkImportEmpty:          {"bulk_import_empty", http.StatusBadRequest, "body"},
+	constant.ErrDuplicateInBatch:         {"duplicate_in_batch", http.StatusBadRequest, ""},
+	constant.ErrTermsNotAccepted:         {"terms_not_accepted", http.StatusBadRequest, "terms_version"},
+	constant.ErrAvatarQueueFull:          {"avatar_queue_full", http.StatusServiceUnavailable, ""},
+	constant.ErrReadOnlyMode:             {"read_only_mode", http.StatusServiceUnavailable, ""},
+	constant.ErrInvalidVisibility:        {"invalid_visibility", http.StatusBadRequest, "visibility"},
+	constant.ErrInvalidVisibilityField:   {"invalid_visibility_field", http.StatusBadRequest, "visibility"},
+	constant.ErrImportJobNotFound:        {"import_job_not_found", http.StatusNotFound, "job_id"},
+	constant.ErrImportRowFailed:          {"import_row_failed", http.StatusBadRequest, ""},
+	constant.ErrEmailChangePending:       {"email_change_pending", http.StatusConflict, "email"},
+	constant.ErrInvalidToken:             {"invalid_token", http.StatusBadRequest, "token"},
+	constant.ErrTokenExpired:             {"token_expired", http.StatusUnauthorized, ""},
+	constant.ErrTokenRevoked:             {"token_revoked", http.StatusUnauthorized, ""},
+	constant.ErrMissingToken:             {"missing_token", http.StatusUnauthorized, "authorization"},
+	constant.ErrMalformedToken:           {"malformed_token", http.StatusUnauthorized, "authorization"},
+	constant.ErrInvalidSignature:         {"invalid_signature", http.StatusUnauthorized, "authorization"},
+	constant.ErrUnknownField:             {"unknown_field", http.StatusBadRequest, ""},
+	constant.ErrProbeRateExceeded:        {"probe_rate_exceeded", http.StatusTooManyRequests, ""},
+	constant.ErrRateLimited:              {"rate_limited", http.StatusTooManyRequests, ""},
+	constant.ErrDiagnosisRateExceeded:    {"diagnosis_rate_exceeded", http.StatusTooManyRequests, ""},
+	constant.ErrInvalidBundleSection:     {"invalid_bundle_section", http.StatusBadRequest, "sections"},
+	constant.ErrInvalidSortField:         {"invalid_sort_field", http.StatusBadRequest, "sort"},
+	constant.ErrInvalidSortOrder:         {"invalid_sort_order", http.StatusBadRequest, "order"},
+	constant.ErrUsernameReserved:         {constant.ConflictCodeReserved, http.StatusConflict, "username"},
+	constant.ErrReservationRateExceeded:  {"reservation_rate_exceeded", http.StatusTooManyRequests, ""},
+	constant.ErrInvalidHandle:            {"invalid_handle", http.StatusBadRequest, "handle"},
+	constant.ErrHandleAlreadyExist:       {"handle_taken", http.StatusConflict, "handle"},
+	constant.ErrHandleMoved:              {"handle_moved", http.StatusMovedPermanently, ""},
+	constant.ErrAccountAlreadyVerified:   {"account_already_verified", http.StatusConflict, ""},
+	constant.ErrAccountNotVerified:       {"account_not_verified", http.StatusForbidden, ""},
+	constant.ErrEmailNotSet:              {"email_not_set", http.StatusBadRequest, "email"},
+	constant.ErrVerificationRateExceeded: {"verification_rate_exceeded", http.StatusTooManyRequests, "email"},
+	constant.ErrIDConflict:               {"id_conflict", http.StatusBadRequest, "id"},
+	constant.ErrWebhookNotFound:          {"webhook_not_found", http.StatusNotFound, ""},
+	constant.ErrWebhookQuotaExceeded:     {"webhook_quota_exceeded", http.StatusConflict, ""},
+	constant.ErrDeletionNotAcknowledged:  {"deletion_not_acknowledged", http.StatusServiceUnavailable, ""},
+	constant.ErrHTTPSRequired:            {"https_required", http.StatusBadRequest, ""},
+	constant.ErrWeakTLS:                  {"weak_tls", http.StatusBadRequest, ""},
+	constant.ErrDeviceMismatch:           {"device_mismatch", http.StatusUnauthorized, ""},
+	constant.ErrMergeSameAccount:         {"merge_same_account", http.StatusBadRequest, "source_id"},
+	constant.ErrInvalidMergeStrategy:     {"invalid_merge_strategy", http.StatusBadRequest, "strategy"},
+	constant.ErrInvalidMergeOverride:     {"invalid_merge_override", http.StatusBadRequest, "overrides"},
+	constant.ErrInvalidRole:              {"invalid_role", http.StatusBadRequest, "role"},
+	constant.ErrSelfRoleChange:           {"self_role_change", http.StatusForbidden, "role"},
+	constant.ErrInvalidIdempotencyKey:    {"invalid_idempotency_key", http.StatusBadRequest, ""},
+	constant.ErrIdempotencyKeyReused:     {"idempotency_key_reused", http.StatusUnprocessableEntity, ""},
+	constant.ErrAccountSuspended:         {"account_suspended", http.StatusForbidden, ""},
+	constant.ErrSelfSuspend:              {"self_suspend", http.StatusForbidden, ""},
+	constant.ErrTwoFactorUnavailable:     {"two_factor_unavailable", http.StatusServiceUnavailable, ""},
+	constant.ErrTOTPAlreadyEnabled:       {"totp_already_enabled", http.StatusConflict, ""},
+	constant.ErrTOTPNotEnrolled:          {"totp_not_enrolled", http.StatusConflict, ""},
+	constant.ErrInvalidTOTPCode:          {"invalid_totp_code", http.StatusUnprocessableEntity, "code"},
+	constant.ErrRequestBodyTooLarge:      {"request_body_too_large", http.StatusRequestEntityTooLarge, "body"},
+	constant.ErrAvatarMissing:            {"avatar_missing", http.StatusBadRequest, "avatar"},
+	constant.ErrUnsupportedAvatarType:    {"unsupported_avatar_type", http.StatusBadRequest, "avatar"},
+	constant.ErrAvatarTooLarge:           {"avatar_too_large", http.StatusRequestEntityTooLarge, "avatar"},
+	constant.ErrAvatarTooManyPixels:      {"avatar_too_many_pixels", http.StatusRequestEntityTooLarge, "avatar"},
+	constant.ErrRequestTimeout:           {"request_timeout", http.StatusGatewayTimeout, ""},
+	constant.ErrRequestCanceled:          {"request_canceled", StatusClientClosedRequest, ""},
+	constant.ErrPasswordChangeRequired:   {"password_change_required", http.StatusForbidden, ""},
+	constant.ErrSelfPasswordReset:        {"self_password_reset", http.StatusForbidden, ""},
+}
+
+// StatusClientClosedRequest is the nginx status of a request the client gave up on, net/http has none
+const StatusClientClosedRequest = 499
+
+// Lookup returns the sentinel and definition of the first error in the chain that has one.
+// A chain ending in a timed out or canceled context is constant.ErrRequestTimeout or ErrRequestCanceled.
+// An unknown error is constant.ErrInternal, its message is never sent to the client
+func Lookup(err error) (sentinel error, definition Definition) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return constant.ErrRequestTimeout, Definitions[constant.ErrRequestTimeout]
+	} else if errors.Is(err, context.Canceled) {
+		return constant.ErrRequestCanceled, Definitions[constant.ErrRequestCanceled]
+	}
+	for cause := err; cause != nil; cause = errors.Unwrap(cause) {
+		if definition, ok := Definitions[cause]; ok {
+			return cause, definition
+		}
+	}
+	return constant.ErrInternal, Definitions[constant.ErrInternal]
+}
+
+// Interrupted reports whether the error ends in a timed out or canceled context, handlers answering every
+// other failure with internal_error respond with such an error as is
+func Interrupted(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// Status is the status of the error, for handlers answering with rest.ResponseMessage
+func Status(err error) int {
+	_, definition := Lookup(err)
+	return definition.Status
+}
+
+// Known reports whether the error has a definition, handlers log the unknown ones before responding
+func Known(err error) bool {
+	sentinel, _ := Lookup(err)
+	return sentinel != constant.ErrInternal
+}
+
+// Response writes the envelope of the error, the fields hold its default field if it has one
+func Response(ctx *gin.Context, err error) {
+	_, definition := Lookup(err)
+	fields := map[string]string{}
+	if definition.Field != "" {
+		fields[definition.Field] = definition.Code
+	}
+	Fields(ctx, err, fields)
+}
+
+// Field writes the envelope of the error for the named request field instead of its default one
+func Field(ctx *gin.Context, field string, err error) {
+	_, definition := Lookup(err)
+	Fields(ctx, err, map[string]string{field: definition.Code})
+}
+
+// Fields writes the envelope of the error with fields mapping request fields to codes
+func Fields(ctx *gin.Context, err error, fields map[string]string) {
+	sentinel, definition := Lookup(err)
+	if definition.Status == http.StatusConflict {
+		metrics.AccountConflict(definition.Code)
+	}
+	write(ctx, definition.Status, Body{
+		Code:    definition.Code,
+		Message: sentinel.Error(),
+		Fields:  fields,
+		Allowed: enum.Allowed(fields),
+	})
+}
+
+// Authorization writes the envelope of a token the auth middleware rejects with status, the authorization
+// field carries the code. An error answered with another status elsewhere, like invalid_token of a reset link,
+// keeps its code
+func Authorization(ctx *gin.Context, status int, err error) {
+	sentinel, definition := Lookup(err)
+	write(ctx, status, Body{
+		Code:    definition.Code,
+		Message: sentinel.Error(),
+		Fields:  map[string]string{"authorization": definition.Code},
+	})
+}
+
+// Validation writes validation_failed with 422 and every failed field mapped to its tag and its reason,
+// a failed password maps to the unmet password rules. Other errors are invalid_format, a body that does
+// not parse stays a 400
+func Validation(ctx *gin.Context, err error) {
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		Response(ctx, constant.ErrInvalidFormat)
+		return
+	}
+
+	fields, _ := constant.PasswordPolicy.Detail(validationErrors).(map[string]string)
+	definition := Definitions[constant.ErrValidationFailed]
+	write(ctx, definition.Status, Body{
+		Code:    definition.Code,
+		Message: constant.ErrValidationFailed.Error(),
+		Fields:  fields,
+		Reasons: Reasons(validationErrors),
+		Errors:  FieldErrors(validationErrors),
+		Allowed: enum.Allowed(validationErrors),
+	})
+}
+
+// FieldErrors lists every failed field of a validator.Struct error in the order of the struct fields
+func FieldErrors(validationErrors validator.ValidationErrors) []FieldError {
+	unmet, _ := constant.PasswordPolicy.Detail(validationErrors).(map[string]string)
+	fieldErrors := []FieldError{}
+	for _, fieldErr := range validationErrors {
+		field := strings.ToLower(fieldErr.Field())
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Rule:    fieldErr.Tag(),
+			Message: reason(fieldErr, unmet[field]),
+		})
+	}
+	return fieldErrors
+}
+
+// messages are the registered overrides of the built in reasons, keyed by rule and by field and rule
+var messages = struct {
+	mu     sync.RWMutex
+	rules  map[string]string
+	fields map[string]string
+}{rules: map[string]string{}, fields: map[string]string{}}
+
+// SetRuleMessage replaces the reason of a rule for every field, {param} is replaced with the tag parameter
+// e.g. SetRuleMessage("max", "is longer than {param} characters")
+func SetRuleMessage(rule, message string) {
+	messages.mu.Lock()
+	defer messages.mu.Unlock()
+	messages.rules[rule] = message
+}
+
+// SetFieldMessage replaces the reason of a rule for one field only, the field is the lowercase name
+// the errors report e.g. SetFieldMessage("password", "password", "needs 8 characters with a digit")
+func SetFieldMessage(field, rule, message string) {
+	messages.mu.Lock()
+	defer messages.mu.Unlock()
+	messages.fields[field+" "+rule] = message
+}
+
+func registeredMessage(fieldErr validator.FieldError) (message string, ok bool) {
+	messages.mu.RLock()
+	defer messages.mu.RUnlock()
+	message, ok = messages.fields[strings.ToLower(fieldErr.Field())+" "+fieldErr.Tag()]
+	if !ok {
+		message, ok = messages.rules[fieldErr.Tag()]
+	}
+	return strings.ReplaceAll(message, "{param}", fieldErr.Param()), ok
+}
+
+// Reasons maps every failed field of a validator.Struct error to a sentence, handlers still answering
+// with rest.ResponseError send it as the detail of their 422. Other errors map the body to invalid_format
+func Reasons(err error) map[string]string {
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return map[string]string{"body": constant.ErrInvalidFormat.Error()}
+	}
+
+	unmet, _ := constant.PasswordPolicy.Detail(validationErrors).(map[string]string)
+	reasons := map[string]string{}
+	for _, fieldErr := range validationErrors {
+		field := strings.ToLower(fieldErr.Field())
+		reasons[field] = reason(fieldErr, unmet[field])
+	}
+	return reasons
+}
+
+// reason phrases the failed tag, unmetRules are the password policy rules a password field did not meet.
+// A message registered for the field or the rule wins over the built in one
+func reason(fieldErr validator.FieldError, unmetRules string) string {
+	if message, ok := registeredMessage(fieldErr); ok {
+		return message
+	}
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return fmt.Sprintf("is required when %s is empty", strings.ToLower(fieldErr.Param()))
+	case "email":
+		return "must be a valid email address"
+	case "max":
+		return fmt.Sprintf("must be at most %s characters", fieldErr.Param())
+	case "min":
+		return fmt.Sprintf("must be at least %s characters", fieldErr.Param())
+	case "len":
+		return fmt.Sprintf("must be exactly %s characters", fieldErr.Param())
+	case enum.Tag:
+		return fmt.Sprintf("must be one of %s", strings.Join(enum.Values[fieldErr.Param()], ", "))
+	case nik.Tag:
+		return "must be a valid 16 digit KTP number"
+	case phone.Tag:
+		return "must be an Indonesian mobile number such as 08123456789 or +628123456789"
+	case passwordpolicy.Tag:
+		if unmetRules != "" && unmetRules != passwordpolicy.Tag {
+			return fmt.Sprintf("does not meet the password policy: %s", strings.ReplaceAll(unmetRules, ",", ", "))
+		}
+		return "does not meet the password policy"
+	}
+	return fmt.Sprintf("failed the %s check", fieldErr.Tag())
+}
+
+func write(ctx *gin.Context, status int, body Body) {
+	if len(body.Fields) == 0 {
+		body.Fields = nil
+	}
+	if len(body.Reasons) == 0 {
+		body.Reasons = nil
+	}
+	if len(body.Errors) == 0 {
+		body.Errors = nil
+	}
+	if len(body.Allowed) == 0 {
+		body.Allowed = nil
+	}
+	body.RequestID = ctx.GetString(constant.RequestIDKey)
+	rest.PublishLog(ctx.Copy(), status, body.Fields, body.Message)
+	ctx.JSON(status, Envelope{Error: body})
+}
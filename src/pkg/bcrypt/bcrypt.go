@@ -4,8 +4,8 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (hashedPassword string, err error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+func HashPassword(password string, cost int) (hashedPassword string, err error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
 		return "", err
 	}
@@ -14,4 +14,14 @@ func HashPassword(password string) (hashedPassword string, err error) {
 }
 func ComparePassword(hashedPassword string, password string) (err error) {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-}
\ No newline at end of file
+}
+
+// ValidCost reports whether bcrypt accepts the cost
+func ValidCost(cost int) bool {
+	return cost >= bcrypt.MinCost && cost <= bcrypt.MaxCost
+}
+
+// Cost returns the cost a hash was made with
+func Cost(hashedPassword string) (cost int, err error) {
+	return bcrypt.Cost([]byte(hashedPassword))
+}
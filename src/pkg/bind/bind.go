@@ -0,0 +1,88 @@
+package bind
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+)
+
+const unknownFieldPrefix = "json: unknown field "
+
+// UnknownFieldError names the first payload field the target struct does not declare
+type UnknownFieldError struct {
+	Field string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("%s: %s", constant.ErrUnknownField.Error(), e.Field)
+}
+
+func (e *UnknownFieldError) Unwrap() error {
+	return constant.ErrUnknownField
+}
+
+// JSON binds the body like rest.BindJSON, in strict mode a field the target does not declare
+// is rejected with an UnknownFieldError instead of being ignored
+func JSON(ctx *gin.Context, v interface{}, strict bool) (err error) {
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return
+	}
+	ctx.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	if !strict {
+		err = json.Unmarshal(body, v)
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(v)
+	if err != nil && strings.HasPrefix(err.Error(), unknownFieldPrefix) {
+		field := strings.Trim(strings.TrimPrefix(err.Error(), unknownFieldPrefix), "\"")
+		err = &UnknownFieldError{Field: field}
+	}
+	return
+}
+
+// CheckID rejects a body whose "id" does not address the record the route addresses with constant.ErrIDConflict,
+// a body without an id passes. same reports whether the raw json id is the route's id.
+func CheckID(ctx *gin.Context, same func(raw json.RawMessage) bool) (err error) {
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return
+	}
+	ctx.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(body, &fields) != nil {
+		// not an object, binding reports the format error
+		return nil
+	}
+	if raw, ok := fields["id"]; ok && !same(raw) {
+		return constant.ErrIDConflict
+	}
+	return nil
+}
+
+// Filled reports whether the body has the field set to anything but null or an empty string
+func Filled(ctx *gin.Context, field string) bool {
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return false
+	}
+	ctx.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(body, &fields) != nil {
+		return false
+	}
+	raw, ok := fields[field]
+	value := strings.TrimSpace(string(raw))
+	return ok && value != "null" && value != `""`
+}
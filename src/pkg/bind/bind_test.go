@@ -0,0 +1,87 @@
+package bind
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+)
+
+type updateRequest struct {
+	FullName *string `json:"fullname"`
+}
+
+func jsonContext(body string) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPatch, "/v1/accounts", strings.NewReader(body))
+	return ctx
+}
+
+func TestJSONWithAnUnexpectedRoleField(t *testing.T) {
+	const body = `{"fullname":"Budi","role":"admin"}`
+
+	request := updateRequest{}
+	err := JSON(jsonContext(body), &request, true)
+	unknownField := &UnknownFieldError{}
+	if !errors.As(err, &unknownField) || unknownField.Field != "role" {
+		t.Fatalf("strict JSON() error = %v, want the unknown field role", err)
+	}
+	if !errors.Is(err, constant.ErrUnknownField) {
+		t.Errorf("strict JSON() error = %v, want it to unwrap to %v", err, constant.ErrUnknownField)
+	}
+
+	// without strict mode the role is dropped, it has no field to bind to
+	request = updateRequest{}
+	if err = JSON(jsonContext(body), &request, false); err != nil {
+		t.Fatalf("lenient JSON() error = %v", err)
+	}
+	if request.FullName == nil || *request.FullName != "Budi" {
+		t.Errorf("lenient JSON() fullname = %v, want Budi", request.FullName)
+	}
+}
+
+func TestJSONKeepsTheBody(t *testing.T) {
+	ctx := jsonContext(`{"fullname":"Budi"}`)
+	if err := JSON(ctx, &updateRequest{}, true); err != nil {
+		t.Fatalf("JSON() error = %v", err)
+	}
+	if !Filled(ctx, "fullname") {
+		t.Error("the body cannot be read again after JSON()")
+	}
+}
+
+func TestCheckID(t *testing.T) {
+	// the route addresses the record 7
+	same := func(raw json.RawMessage) bool {
+		id := 0
+		return json.Unmarshal(raw, &id) == nil && id == 7
+	}
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{"different id", `{"id":8,"fullname":"Budi"}`, constant.ErrIDConflict},
+		{"id of another type", `{"id":"7","fullname":"Budi"}`, constant.ErrIDConflict},
+		{"same id", `{"id":7,"fullname":"Budi"}`, nil},
+		{"without id", `{"fullname":"Budi"}`, nil},
+		{"not an object", `[7]`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := jsonContext(tt.body)
+			if err := CheckID(ctx, same); err != tt.wantErr {
+				t.Fatalf("CheckID() error = %v, want %v", err, tt.wantErr)
+			}
+			if body, _ := io.ReadAll(ctx.Request.Body); string(body) != tt.body {
+				t.Errorf("body after CheckID() = %q, want it kept for binding", body)
+			}
+		})
+	}
+}
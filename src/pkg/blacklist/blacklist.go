@@ -0,0 +1,106 @@
+package blacklist
+
+import (
+	"sync"
+	"time"
+
+	"github.com/forkyid/go-utils/v1/cache"
+	"go-rest-api/src/constant"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+// sweepInterval bounds how often MemoryStore drops the expired ids
+const sweepInterval = time.Minute
+
+// Store keeps revoked token ids until the token would have expired anyway
+type Store interface {
+	Add(id string, ttl time.Duration) (err error)
+	Contains(id string) (revoked bool, err error)
+	Remove(id string) (err error)
+}
+
+// New returns the store named by constant.TokenBlacklistStore, ok is false for an unknown name
+func New(name string) (store Store, ok bool) {
+	switch name {
+	case StoreMemory:
+		return NewMemoryStore(), true
+	case StoreRedis:
+		return RedisStore{}, true
+	}
+	return nil, false
+}
+
+// MemoryStore keeps the ids of this instance only, a token revoked here is still accepted by other instances
+type MemoryStore struct {
+	mu        sync.Mutex
+	expiresAt map[string]time.Time
+	sweptAt   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		expiresAt: map[string]time.Time{},
+		sweptAt:   time.Now(),
+	}
+}
+
+// Add drops the expired ids at most once per sweepInterval so the map only holds live tokens
+func (store *MemoryStore) Add(id string, ttl time.Duration) (err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(store.sweptAt) >= sweepInterval {
+		for key, expiresAt := range store.expiresAt {
+			if !expiresAt.After(now) {
+				delete(store.expiresAt, key)
+			}
+		}
+		store.sweptAt = now
+	}
+	store.expiresAt[id] = now.Add(ttl)
+	return
+}
+
+func (store *MemoryStore) Contains(id string) (revoked bool, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	expiresAt, ok := store.expiresAt[id]
+	return ok && expiresAt.After(time.Now()), nil
+}
+
+func (store *MemoryStore) Remove(id string) (err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.expiresAt, id)
+	return
+}
+
+// RedisStore shares the ids between instances, redis expires them with the token
+type RedisStore struct{}
+
+func (RedisStore) Add(id string, ttl time.Duration) (err error) {
+	seconds := int(ttl.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	return cache.SetJSON(key(id), true, seconds)
+}
+
+func (RedisStore) Contains(id string) (revoked bool, err error) {
+	return cache.IsCacheExists(key(id))
+}
+
+func (RedisStore) Remove(id string) (err error) {
+	return cache.Delete(key(id))
+}
+
+func key(id string) string {
+	return constant.ServiceName + ":revoked_token:" + id
+}
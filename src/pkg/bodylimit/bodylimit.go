@@ -0,0 +1,74 @@
+package bodylimit
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/apierror"
+)
+
+// Limit rejects request bodies above the default limit with 413 before a handler parses them.
+// Routes that take larger payloads, like the bulk import, get their own limit with SetRoute.
+type Limit struct {
+	mu          sync.RWMutex
+	defaultSize int64
+	routeSizes  map[string]int64
+}
+
+func NewLimit(defaultSize int64) *Limit {
+	return &Limit{
+		defaultSize: defaultSize,
+		routeSizes:  map[string]int64{},
+	}
+}
+
+// SetRoute overrides the limit of a route, the path is the registered route path e.g. /v1/accounts/bulk
+func (limit *Limit) SetRoute(method, path string, size int64) {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	limit.routeSizes[method+" "+path] = size
+}
+
+// Middleware buffers at most the limit plus one byte so an oversized body is never read in full,
+// a declared Content-Length above the limit is rejected without reading at all
+func (limit *Limit) Middleware(ctx *gin.Context) {
+	size := limit.size(ctx)
+	if ctx.Request.ContentLength > size {
+		tooLarge(ctx)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(ctx.Request.Body, size+1))
+	if err != nil {
+		apierror.Response(ctx, constant.ErrInvalidFormat)
+		ctx.Abort()
+		return
+	}
+	if int64(len(body)) > size {
+		tooLarge(ctx)
+		return
+	}
+	ctx.Request.Body.Close()
+	ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	ctx.Next()
+}
+
+func (limit *Limit) size(ctx *gin.Context) int64 {
+	limit.mu.RLock()
+	defer limit.mu.RUnlock()
+	if size, ok := limit.routeSizes[ctx.Request.Method+" "+ctx.FullPath()]; ok {
+		return size
+	}
+	return limit.defaultSize
+}
+
+// tooLarge closes the connection after the response, the rest of the body is never read
+func tooLarge(ctx *gin.Context) {
+	ctx.Header("Connection", "close")
+	apierror.Response(ctx, constant.ErrRequestBodyTooLarge)
+	ctx.Abort()
+}
@@ -0,0 +1,21 @@
+package checksum
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Sum is the hex hmac-sha256 of the json encoded values, their order is part of the sum
+func Sum(secret []byte, values ...interface{}) string {
+	content, _ := json.Marshal(values)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Equal compares two sums in constant time
+func Equal(sum, expected string) bool {
+	return hmac.Equal([]byte(sum), []byte(expected))
+}
@@ -0,0 +1,72 @@
+package coalesce
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPanicked is returned to the writes waiting on a write whose fn panicked
+var ErrPanicked = errors.New("coalesced write panicked")
+
+// Group folds a write repeated with the same payload hash into the first one. Only the latest
+// write is kept per key, so a different payload in between makes the next repeat run again.
+type Group struct {
+	mu     sync.Mutex
+	window time.Duration
+	calls  map[string]*call
+}
+
+type call struct {
+	hash string
+	done chan struct{}
+	err  error
+}
+
+// NewGroup keeps a successful write for the window after it finished, a zero window disables coalescing
+func NewGroup(window time.Duration) *Group {
+	return &Group{
+		window: window,
+		calls:  map[string]*call{},
+	}
+}
+
+// Do runs fn unless a write with the same hash is running or succeeded within the window for the key,
+// then it waits for that write and returns its result with coalesced set. Failed writes are dropped
+// once finished so a retry runs again, so is a panic of fn, which still reaches the caller.
+func (g *Group) Do(key, hash string, fn func() error) (coalesced bool, err error) {
+	if g.window <= 0 {
+		return false, fn()
+	}
+
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok && c.hash == hash {
+		g.mu.Unlock()
+		<-c.done
+		return true, c.err
+	}
+	c := &call{hash: hash, done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.err = ErrPanicked
+	defer func() {
+		close(c.done)
+		if c.err != nil {
+			g.forget(key, c)
+		} else {
+			time.AfterFunc(g.window, func() { g.forget(key, c) })
+		}
+	}()
+	c.err = fn()
+	return false, c.err
+}
+
+// forget drops the call unless a newer write already replaced it
+func (g *Group) forget(key string, c *call) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
@@ -0,0 +1,119 @@
+package coalesce
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoCoalescesIdenticalWrites(t *testing.T) {
+	group := NewGroup(time.Minute)
+	runs := int32(0)
+	release := make(chan struct{})
+	write := func() error {
+		atomic.AddInt32(&runs, 1)
+		<-release
+		return nil
+	}
+
+	// the second submit arrives while the first is still writing and waits for its result
+	first := make(chan bool)
+	go func() {
+		coalesced, _ := group.Do("7", "hash-a", write)
+		first <- coalesced
+	}()
+	for atomic.LoadInt32(&runs) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan bool)
+	go func() {
+		coalesced, _ := group.Do("7", "hash-a", write)
+		second <- coalesced
+	}()
+	close(release)
+	if <-first || !<-second {
+		t.Fatal("Do() of the second identical write was not coalesced into the first")
+	}
+
+	// within the window a finished write still absorbs a repeat, other payloads and keys run
+	tests := []struct {
+		key, hash     string
+		wantCoalesced bool
+	}{
+		{"7", "hash-a", true},
+		{"8", "hash-a", false},
+		{"7", "hash-b", false},
+		{"7", "hash-a", false},
+	}
+	for _, tt := range tests {
+		coalesced, err := group.Do(tt.key, tt.hash, write)
+		if err != nil || coalesced != tt.wantCoalesced {
+			t.Errorf("Do(%s, %s) = %v, %v, want coalesced %v", tt.key, tt.hash, coalesced, err, tt.wantCoalesced)
+		}
+	}
+	if got := atomic.LoadInt32(&runs); got != 4 {
+		t.Errorf("the write ran %d times, want 4", got)
+	}
+}
+
+func TestDoRunsAgainAfterAFailure(t *testing.T) {
+	group := NewGroup(time.Minute)
+	failure := errors.New("deadlock detected")
+	if _, err := group.Do("7", "hash-a", func() error { return failure }); err != failure {
+		t.Fatalf("Do() error = %v, want %v", err, failure)
+	}
+	coalesced, err := group.Do("7", "hash-a", func() error { return nil })
+	if coalesced || err != nil {
+		t.Errorf("retry of a failed write = %v, %v, want it to run", coalesced, err)
+	}
+}
+
+func TestDoWithoutWindow(t *testing.T) {
+	group := NewGroup(0)
+	runs := 0
+	for i := 0; i < 2; i++ {
+		if coalesced, _ := group.Do("7", "hash-a", func() error { runs++; return nil }); coalesced {
+			t.Error("Do() without a window coalesced")
+		}
+	}
+	if runs != 2 {
+		t.Errorf("the write ran %d times, want 2", runs)
+	}
+}
+
+func TestDoForgetsAPanickingWrite(t *testing.T) {
+	group := NewGroup(time.Minute)
+	started, release := make(chan struct{}), make(chan struct{})
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		group.Do("7", "hash-a", func() error {
+			close(started)
+			<-release
+			panic("update failed")
+		})
+	}()
+	<-started
+
+	// a repeat waiting on the panicking write is released with an error instead of hanging
+	waited := make(chan error)
+	go func() {
+		_, err := group.Do("7", "hash-a", func() error { return nil })
+		waited <- err
+	}()
+	// give the repeat time to start waiting
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if recovered := <-panicked; recovered == nil {
+		t.Error("the panic of the write did not reach the caller")
+	}
+	if err := <-waited; err != ErrPanicked {
+		t.Errorf("Do() waiting on a panicked write error = %v, want %v", err, ErrPanicked)
+	}
+
+	coalesced, err := group.Do("7", "hash-a", func() error { return nil })
+	if coalesced || err != nil {
+		t.Errorf("retry after the panic = %v, %v, want it to run", coalesced, err)
+	}
+}
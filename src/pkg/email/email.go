@@ -0,0 +1,176 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SenderLog  = "log"
+	SenderSMTP = "smtp"
+)
+
+// EmailSender delivers one plain text message, the notifier renders the subject and body before
+type EmailSender interface {
+	Send(to, subject, body string) (err error)
+}
+
+// SendError is a failed send, Retriable is false when sending the same message again cannot succeed
+// e.g. the server rejected the recipient with a 5xx reply
+type SendError struct {
+	Err       error
+	Retriable bool
+}
+
+func (e *SendError) Error() string {
+	return "send email: " + e.Err.Error()
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// Retriable reports whether sending again may succeed, errors of senders not returning SendError are retried
+func Retriable(err error) bool {
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		return sendErr.Retriable
+	}
+	return err != nil
+}
+
+// New returns the sender named by constant.EmailSender, ok is false for an unknown name
+func New(name string, config SMTPConfig) (sender EmailSender, ok bool) {
+	switch name {
+	case SenderLog:
+		return LogSender{}, true
+	case SenderSMTP:
+		return SMTPSender{config: config}, true
+	}
+	return nil, false
+}
+
+// LogSender only prints the recipient and subject, for local development. The body is never printed,
+// it carries the reset, verification and email change tokens
+type LogSender struct{}
+
+func (LogSender) Send(to, subject, body string) (err error) {
+	log.Printf("send to: %s, subject: %s", to, subject)
+	return
+}
+
+// SMTPConfig is read from the SMTP_* env, an empty username sends without authentication
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+// SMTPSender sends through the configured server, upgrading to TLS when the server offers STARTTLS
+type SMTPSender struct {
+	config SMTPConfig
+}
+
+// Send fails with a SendError, only a 5xx reply of the server and a malformed message are not retriable
+func (s SMTPSender) Send(to, subject, body string) (err error) {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return &SendError{Err: errors.New("line break in the recipient or subject")}
+	}
+
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	conn, err := net.DialTimeout("tcp", addr, s.config.Timeout)
+	if err != nil {
+		return failed(err)
+	}
+	// the deadline covers the whole conversation so a stalled server cannot hold the dispatcher
+	conn.SetDeadline(time.Now().Add(s.config.Timeout))
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return failed(err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: s.config.Host}); err != nil {
+			return failed(err)
+		}
+	}
+	if s.config.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return failed(err)
+		}
+	}
+	if err = client.Mail(s.config.From); err != nil {
+		return failed(err)
+	}
+	if err = client.Rcpt(to); err != nil {
+		return failed(err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return failed(err)
+	}
+	message, err := compose(s.config.From, to, subject, body)
+	if err != nil {
+		writer.Close()
+		return &SendError{Err: err}
+	}
+	if _, err = writer.Write(message); err != nil {
+		writer.Close()
+		return failed(err)
+	}
+	if err = writer.Close(); err != nil {
+		return failed(err)
+	}
+	if err = client.Quit(); err != nil {
+		return failed(err)
+	}
+	return
+}
+
+// failed keeps the message for a retry unless the server answered with a permanent 5xx reply
+func failed(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return &SendError{Err: err}
+	}
+	return &SendError{Err: err, Retriable: true}
+}
+
+// compose writes the headers and the quoted printable utf-8 body
+func compose(from, to, subject, body string) (message []byte, err error) {
+	buffer := bytes.Buffer{}
+	fmt.Fprintf(&buffer, "From: %s\r\n", from)
+	fmt.Fprintf(&buffer, "To: %s\r\n", to)
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buffer.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	encoder := quotedprintable.NewWriter(&buffer)
+	if _, err = encoder.Write([]byte(body)); err != nil {
+		return
+	}
+	if err = encoder.Close(); err != nil {
+		return
+	}
+	return buffer.Bytes(), nil
+}
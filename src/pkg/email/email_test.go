@@ -0,0 +1,34 @@
+package email
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNewRequiresASender(t *testing.T) {
+	for _, name := range []string{"", "sendmail"} {
+		if _, ok := New(name, SMTPConfig{}); ok {
+			t.Errorf("New(%q) ok = true, want an unset or unknown sender rejected", name)
+		}
+	}
+}
+
+func TestLogSenderKeepsTheBodyOutOfTheLog(t *testing.T) {
+	output := bytes.Buffer{}
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	err := LogSender{}.Send("budi@example.com", "Reset your password", "https://example.com/reset?token=secret-token")
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.Contains(output.String(), "budi@example.com") || !strings.Contains(output.String(), "Reset your password") {
+		t.Errorf("log = %q, want the recipient and subject", output.String())
+	}
+	if strings.Contains(output.String(), "secret-token") {
+		t.Errorf("log = %q, want the body left out", output.String())
+	}
+}
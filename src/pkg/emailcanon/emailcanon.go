@@ -0,0 +1,70 @@
+package emailcanon
+
+import "strings"
+
+// Rule is how a provider delivers different spellings of a local part to the same mailbox
+type Rule struct {
+	// Domain the provider's aliases canonicalize to
+	Domain string
+	// IgnoreDots drops every dot of the local part
+	IgnoreDots bool
+	// PlusTags drops everything from the first plus of the local part
+	PlusTags bool
+}
+
+// Known are the providers a canonicalization can be enabled for
+var Known = map[string]Rule{
+	"gmail.com":      {Domain: "gmail.com", IgnoreDots: true, PlusTags: true},
+	"googlemail.com": {Domain: "gmail.com", IgnoreDots: true, PlusTags: true},
+	"outlook.com":    {Domain: "outlook.com", PlusTags: true},
+	"hotmail.com":    {Domain: "hotmail.com", PlusTags: true},
+	"live.com":       {Domain: "live.com", PlusTags: true},
+	"icloud.com":     {Domain: "icloud.com", PlusTags: true},
+	"protonmail.com": {Domain: "protonmail.com", PlusTags: true},
+	"fastmail.com":   {Domain: "fastmail.com", PlusTags: true},
+}
+
+// Canonicalize lowercases the email and applies the rule of its domain when the domain is one of providers,
+// emails of other domains are only lowercased
+func Canonicalize(email string, providers []string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+
+	rule, ok := Known[domain]
+	if !ok || !enabled(domain, providers) {
+		return email
+	}
+	if rule.PlusTags {
+		if plus := strings.Index(local, "+"); plus >= 0 {
+			local = local[:plus]
+		}
+	}
+	if rule.IgnoreDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + rule.Domain
+}
+
+func enabled(domain string, providers []string) bool {
+	for _, provider := range providers {
+		if strings.EqualFold(strings.TrimSpace(provider), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize trims the email and lowercases its domain, the local part is kept as typed since it is what
+// the owner sees. Matching compares the lowercased address, see Canonicalize for the provider rules
+func Normalize(email string) string {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	return email[:at] + strings.ToLower(email[at:])
+}
@@ -0,0 +1,36 @@
+package emailcanon
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	providers := []string{"gmail.com", "googlemail.com", "outlook.com"}
+	tests := []struct {
+		name  string
+		email string
+		want  string
+	}{
+		{"gmail dots and plus tag", "a.b+x@gmail.com", "ab@gmail.com"},
+		{"gmail alias domain", "A.B@GoogleMail.com", "ab@gmail.com"},
+		{"plus tag only provider keeps dots", "a.b+x@outlook.com", "a.b@outlook.com"},
+		{"known provider not enabled", "a.b+x@hotmail.com", "a.b+x@hotmail.com"},
+		{"unknown domain is only lowercased", " A.B+x@Example.com ", "a.b+x@example.com"},
+		{"not an email", "budi", "budi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Canonicalize(tt.email, providers); got != tt.want {
+				t.Errorf("Canonicalize(%q) = %q, want %q", tt.email, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeCollision(t *testing.T) {
+	providers := []string{"gmail.com"}
+	if Canonicalize("a.b+x@gmail.com", providers) != Canonicalize("ab@gmail.com", providers) {
+		t.Error("a.b+x@gmail.com and ab@gmail.com do not collide")
+	}
+	if Canonicalize("a.b+x@gmail.com", nil) == Canonicalize("ab@gmail.com", nil) {
+		t.Error("a.b+x@gmail.com and ab@gmail.com collide without the provider enabled")
+	}
+}
@@ -0,0 +1,102 @@
+package enum
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/forkyid/go-utils/v1/rest"
+	"github.com/forkyid/go-utils/v1/uuid"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/i18n"
+)
+
+// Tag is the validate tag checking a field against a set in Values e.g. validate:"required,enum=status"
+const Tag = "enum"
+
+const (
+	Status = "status"
+	Gender = "gender"
+	Locale = "locale"
+	Role   = "role"
+)
+
+// Values holds every fixed set of accepted values, it is the single source for validation and the allowed hints
+var Values = map[string][]string{
+	Status: {constant.StatusCheckIn, constant.StatusCheckOut},
+	Gender: {"male", "female", "none"},
+	Locale: i18n.SupportedLocales,
+	Role:   {constant.RoleAdmin, constant.RoleUser},
+}
+
+// Valid reports whether value is in the named set, an unknown set accepts nothing
+func Valid(name, value string) bool {
+	for _, allowed := range Values[name] {
+		if value == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Register adds the enum tag to the validator, it must run before any struct using the tag is validated
+func Register(validate *validator.Validate) error {
+	return validate.RegisterValidation(Tag, func(fl validator.FieldLevel) bool {
+		return Valid(fl.Param(), fl.Field().String())
+	})
+}
+
+type response struct {
+	Error   string              `json:"error,omitempty"`
+	Message string              `json:"message,omitempty"`
+	Detail  map[string]string   `json:"detail,omitempty"`
+	Allowed map[string][]string `json:"allowed,omitempty"`
+}
+
+// Allowed returns the allowed values of every failed enum field, keyed by field.
+// Validation errors get hints for fields failing the enum tag, detail maps for keys naming a set in Values
+func Allowed(detail interface{}) map[string][]string {
+	allowed := map[string][]string{}
+	switch det := detail.(type) {
+	case validator.ValidationErrors:
+		for _, fieldErr := range det {
+			if values, ok := Values[fieldErr.Param()]; ok && fieldErr.Tag() == Tag {
+				allowed[strings.ToLower(fieldErr.Field())] = values
+			}
+		}
+	case map[string]string:
+		for field := range det {
+			if values, ok := Values[field]; ok {
+				allowed[field] = values
+			}
+		}
+	}
+	return allowed
+}
+
+// ResponseError is rest.ResponseError extended with the allowed values of every failed enum field
+func ResponseError(ctx *gin.Context, status int, detail interface{}) {
+	allowed := Allowed(detail)
+	if len(allowed) == 0 {
+		rest.ResponseError(ctx, status, detail)
+		return
+	}
+
+	resp := response{
+		Error:   uuid.GetUUID(),
+		Message: http.StatusText(status),
+		Allowed: allowed,
+	}
+	if det, ok := detail.(validator.ValidationErrors); ok {
+		resp.Detail = map[string]string{}
+		for _, fieldErr := range det {
+			resp.Detail[strings.ToLower(fieldErr.Field())] = fieldErr.Tag()
+		}
+	} else {
+		resp.Detail = detail.(map[string]string)
+	}
+
+	rest.PublishLog(ctx.Copy(), status, resp.Detail, resp.Message)
+	ctx.JSON(status, resp)
+}
@@ -0,0 +1,60 @@
+package enum
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/forkyid/go-utils/v1/validation"
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+)
+
+func TestMain(m *testing.M) {
+	if err := Register(validation.Validator); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type attendance struct {
+	Status string `json:"status" validate:"required,enum=status"`
+	Note   string `json:"note" validate:"required"`
+}
+
+func TestAllowedListsTheStatusSet(t *testing.T) {
+	err := validation.Validator.Struct(attendance{Status: "sleeping"})
+	if err == nil {
+		t.Fatal("Struct() of an invalid status passed")
+	}
+	// the missing note has no fixed set and gets no hint
+	want := map[string][]string{"status": {constant.StatusCheckIn, constant.StatusCheckOut}}
+	if allowed := Allowed(err); !reflect.DeepEqual(allowed, want) {
+		t.Errorf("Allowed() = %v, want %v", allowed, want)
+	}
+
+	if err = validation.Validator.Struct(attendance{Status: constant.StatusCheckOut, Note: "home"}); err != nil {
+		t.Errorf("Struct() of an allowed status error = %v", err)
+	}
+}
+
+func TestResponseErrorCarriesTheAllowedSet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/attendances", nil)
+
+	ResponseError(ctx, http.StatusBadRequest, map[string]string{"status": constant.ErrInvalidStatusAttendance.Error()})
+
+	body := response{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not json: %v", recorder.Body.String(), err)
+	}
+	if recorder.Code != http.StatusBadRequest || !reflect.DeepEqual(body.Allowed[Status], Values[Status]) ||
+		body.Detail["status"] != constant.ErrInvalidStatusAttendance.Error() {
+		t.Errorf("ResponseError() wrote %d %+v, want the status detail with its allowed values", recorder.Code, body)
+	}
+}
@@ -0,0 +1,57 @@
+package env
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetString returns the env value or the fallback when it is unset
+func GetString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// GetInt returns the env value as int or the fallback when it is unset or invalid
+func GetInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetBool returns the env value as bool or the fallback when it is unset or invalid
+func GetBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetDuration parses values like "30s", "15m" or "1h", returning the fallback when it is unset or invalid
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetList splits a comma separated env value, returning the fallback when it is unset
+func GetList(key string, fallback []string) (values []string) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package etag
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Generate returns a quoted strong etag for a resource version
+func Generate(id uint, updatedAt time.Time) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d-%d", id, updatedAt.UnixNano())))
+	return fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:]))
+}
+
+// Match reports whether an If-Match / If-None-Match header value matches the etag
+func Match(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == tag || candidate == "W/"+tag {
+			return true
+		}
+	}
+	return false
+}
+
+// FromContent returns a quoted strong etag for a response body
+func FromContent(content []byte) string {
+	sum := sha1.Sum(content)
+	return fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:]))
+}
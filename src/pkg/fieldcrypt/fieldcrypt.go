@@ -0,0 +1,109 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Prefix marks an encrypted value, the version changes with the algorithm
+const Prefix = "enc:v1:"
+
+var (
+	ErrInvalidKey        = errors.New("field encryption key must be 32 bytes")
+	ErrInvalidCiphertext = errors.New("invalid encrypted field")
+)
+
+// Cipher encrypts response fields with AES-256-GCM under a key shared with the downstream service.
+// The field name is authenticated with the value, so a value cannot be moved to another field.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+func New(key []byte) (*Cipher, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// ParseKey decodes a standard base64 key
+func ParseKey(encoded string) (key []byte, err error) {
+	key, err = base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+	return
+}
+
+// Encrypt returns Prefix followed by the url safe base64 of the nonce and the sealed value
+func (c *Cipher) Encrypt(field, plaintext string) (value string, err error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), []byte(field))
+	value = Prefix + base64.RawURLEncoding.EncodeToString(sealed)
+	return
+}
+
+func (c *Cipher) Decrypt(field, value string) (plaintext string, err error) {
+	if !strings.HasPrefix(value, Prefix) {
+		err = ErrInvalidCiphertext
+		return
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		err = ErrInvalidCiphertext
+		return
+	}
+	nonceSize := c.aead.NonceSize()
+	opened, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(field))
+	if err != nil {
+		err = ErrInvalidCiphertext
+		return
+	}
+	plaintext = string(opened)
+	return
+}
+
+// Fields returns the json object of v with the named non empty string fields encrypted,
+// other fields and values are kept as they are
+func (c *Cipher) Fields(v interface{}, fields []string) (object map[string]interface{}, err error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	object = map[string]interface{}{}
+	if err = decoder.Decode(&object); err != nil {
+		return
+	}
+
+	for _, field := range fields {
+		plaintext, ok := object[field].(string)
+		if !ok || plaintext == "" {
+			continue
+		}
+		object[field], err = c.Encrypt(field, plaintext)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
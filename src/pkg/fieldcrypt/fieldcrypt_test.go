@@ -0,0 +1,89 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func newCipher(t *testing.T) *Cipher {
+	t.Helper()
+	c, err := New(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c
+}
+
+func TestFieldsRoundTrip(t *testing.T) {
+	type account struct {
+		Username  string `json:"username"`
+		KTPNumber string `json:"ktp_number"`
+		Email     string `json:"email"`
+	}
+	sender, receiver := newCipher(t), newCipher(t)
+
+	object, err := sender.Fields(account{Username: "budi", KTPNumber: "3171234567890001"}, []string{"ktp_number", "email"})
+	if err != nil {
+		t.Fatalf("Fields() error = %v", err)
+	}
+	encrypted, _ := object["ktp_number"].(string)
+	if !strings.HasPrefix(encrypted, Prefix) || strings.Contains(encrypted, "3171234567890001") {
+		t.Fatalf("ktp_number = %q, want it encrypted", encrypted)
+	}
+	// the other fields and the empty one are left as they are
+	if object["username"] != "budi" || object["email"] != "" {
+		t.Errorf("username %v and email %v, want them in plain text", object["username"], object["email"])
+	}
+
+	// the downstream service decrypts with the shared key
+	plaintext, err := receiver.Decrypt("ktp_number", encrypted)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if plaintext != "3171234567890001" {
+		t.Errorf("Decrypt() = %q, want the ktp number", plaintext)
+	}
+}
+
+func TestDecryptRejectsAMovedOrTamperedValue(t *testing.T) {
+	c := newCipher(t)
+	encrypted, err := c.Encrypt("ktp_number", "3171234567890001")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	other, _ := New(bytes.Repeat([]byte{8}, 32))
+	// a character inside the sealed value, the last one may only carry padding bits
+	tampered := []byte(encrypted)
+	i := len(Prefix) + 20
+	if tampered[i] == 'A' {
+		tampered[i] = 'B'
+	} else {
+		tampered[i] = 'A'
+	}
+
+	tests := []struct {
+		name   string
+		cipher *Cipher
+		field  string
+		value  string
+	}{
+		{"moved to another field", c, "email", encrypted},
+		{"tampered", c, "ktp_number", string(tampered)},
+		{"another key", other, "ktp_number", encrypted},
+		{"plain text", c, "ktp_number", "3171234567890001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.cipher.Decrypt(tt.field, tt.value); err != ErrInvalidCiphertext {
+				t.Errorf("Decrypt() error = %v, want %v", err, ErrInvalidCiphertext)
+			}
+		})
+	}
+}
+
+func TestNewRejectsAShortKey(t *testing.T) {
+	if _, err := New([]byte("short")); err != ErrInvalidKey {
+		t.Errorf("New() error = %v, want %v", err, ErrInvalidKey)
+	}
+}
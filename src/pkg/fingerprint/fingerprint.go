@@ -0,0 +1,96 @@
+package fingerprint
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FromRequest keys the client ip and the headers describing the client software with the secret,
+// requests from the same client share a fingerprint without the ip being recoverable from it
+func FromRequest(ctx *gin.Context, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	for _, part := range []string{ctx.ClientIP(), ctx.GetHeader("User-Agent"), ctx.GetHeader("Accept-Language")} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Device is a device fingerprint kept as separately keyed parts, so a single changed part
+// such as a new network can be told apart from a different device
+type Device struct {
+	UserAgent string
+	Language  string
+	Network   string
+}
+
+// DeviceFromRequest ignores version numbers in the user agent and the host part of the ip,
+// browser updates and a new address on the same network keep the fingerprint
+func DeviceFromRequest(ctx *gin.Context, secret []byte) Device {
+	userAgent := strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '.' || r == '_' {
+			return -1
+		}
+		return r
+	}, ctx.GetHeader("User-Agent"))
+	language := strings.TrimSpace(strings.Split(ctx.GetHeader("Accept-Language"), ",")[0])
+
+	return Device{
+		UserAgent: keyed(secret, "user-agent", userAgent),
+		Language:  keyed(secret, "language", strings.ToLower(language)),
+		Network:   keyed(secret, "network", network(ctx.ClientIP())),
+	}
+}
+
+// ParseDevice reads a device written by String
+func ParseDevice(value string) (device Device, ok bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return
+	}
+	return Device{UserAgent: parts[0], Language: parts[1], Network: parts[2]}, true
+}
+
+func (device Device) String() string {
+	return device.UserAgent + "." + device.Language + "." + device.Network
+}
+
+// Matches allows one of the parts to differ, a device changing more than that is treated as another device
+func (device Device) Matches(other Device) bool {
+	differences := 0
+	if device.UserAgent != other.UserAgent {
+		differences++
+	}
+	if device.Language != other.Language {
+		differences++
+	}
+	if device.Network != other.Network {
+		differences++
+	}
+	return differences <= 1
+}
+
+func keyed(secret []byte, name, value string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// network is the /24 of an ipv4 address or the /48 of an ipv6 address
+func network(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		return ipv4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
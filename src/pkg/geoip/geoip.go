@@ -0,0 +1,52 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+)
+
+var ErrNotFound = errors.New("location not found")
+
+// Location is approximate, either part may be empty when the provider does not know it
+type Location struct {
+	Country string
+	City    string
+}
+
+// Provider resolves the approximate location of an ip address
+type Provider interface {
+	Lookup(ip string) (location Location, err error)
+}
+
+// Noop resolves nothing, it is used when no provider is configured
+type Noop struct{}
+
+func (Noop) Lookup(ip string) (location Location, err error) {
+	err = ErrNotFound
+	return
+}
+
+// Static resolves from a fixed table of ip to location, meant for tests and local development
+type Static map[string]Location
+
+func (static Static) Lookup(ip string) (location Location, err error) {
+	location, ok := static[ip]
+	if !ok {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Resolve never fails, loopback and unparseable addresses and provider errors resolve to an empty location
+func Resolve(provider Provider, ip string) Location {
+	parsed := net.ParseIP(ip)
+	if provider == nil || parsed == nil || parsed.IsLoopback() {
+		return Location{}
+	}
+
+	location, err := provider.Lookup(ip)
+	if err != nil {
+		return Location{}
+	}
+	return location
+}
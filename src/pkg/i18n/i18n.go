@@ -0,0 +1,81 @@
+package i18n
+
+import (
+	"strings"
+)
+
+const (
+	LocaleEnglish    = "en"
+	LocaleIndonesian = "id"
+	DefaultLocale    = LocaleEnglish
+
+	TemplateVerification  = "verification"
+	TemplatePasswordReset = "password_reset"
+	TemplateEmailChange   = "email_change"
+)
+
+type Message struct {
+	Subject string
+	Body    string
+}
+
+var SupportedLocales = []string{LocaleEnglish, LocaleIndonesian}
+
+var messages = map[string]map[string]Message{
+	LocaleEnglish: {
+		TemplateVerification: {
+			Subject: "Verify your email",
+			Body:    "Hi {{.name}}, please verify your email by opening this link: {{.link}}",
+		},
+		TemplatePasswordReset: {
+			Subject: "Reset your password",
+			Body:    "Hi {{.name}}, use this link to reset your password: {{.link}}. Ignore this email if you did not request it.",
+		},
+		TemplateEmailChange: {
+			Subject: "Confirm your new email",
+			Body:    "Hi {{.name}}, open this link to use this address for your account: {{.link}}. Ignore this email if you did not request it.",
+		},
+	},
+	LocaleIndonesian: {
+		TemplateVerification: {
+			Subject: "Verifikasi email anda",
+			Body:    "Hai {{.name}}, silakan verifikasi email anda dengan membuka tautan berikut: {{.link}}",
+		},
+		TemplatePasswordReset: {
+			Subject: "Atur ulang kata sandi anda",
+			Body:    "Hai {{.name}}, gunakan tautan berikut untuk mengatur ulang kata sandi anda: {{.link}}. Abaikan email ini jika anda tidak memintanya.",
+		},
+		TemplateEmailChange: {
+			Subject: "Konfirmasi email baru anda",
+			Body:    "Hai {{.name}}, buka tautan berikut untuk menggunakan alamat ini pada akun anda: {{.link}}. Abaikan email ini jika anda tidak memintanya.",
+		},
+	},
+}
+
+// IsSupported reports whether the locale has its own set of messages
+func IsSupported(locale string) bool {
+	_, ok := messages[locale]
+	return ok
+}
+
+// ParseAcceptLanguage returns the first supported locale of an Accept-Language header,
+// falling back to the default locale
+func ParseAcceptLanguage(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		locale := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if IsSupported(locale) {
+			return locale
+		}
+	}
+	return DefaultLocale
+}
+
+// Lookup returns the message template for the locale, falling back to the default locale
+func Lookup(locale, template string) (message Message, ok bool) {
+	if message, ok = messages[locale][template]; ok {
+		return
+	}
+	message, ok = messages[DefaultLocale][template]
+	return
+}
@@ -0,0 +1,162 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/apierror"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+	MaxKeyLength   = 255
+)
+
+// Response is the recorded outcome of the first request of a key
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Store keeps the response of every key for the ttl on this instance only, a zero ttl disables it
+type Store struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*entry
+}
+
+type entry struct {
+	hash     string
+	done     chan struct{}
+	response Response
+	// panicked is set when fn did not return, the waiters answer with constant.ErrInternal
+	panicked bool
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		ttl:     ttl,
+		entries: map[string]*entry{},
+	}
+}
+
+// Do runs fn for the first request of the key and keeps its response for the ttl. A repeat with the same
+// payload hash waits for the first one and gets its response with replayed set, a different hash gets
+// constant.ErrIdempotencyKeyReused. Server errors are dropped once finished so a retry runs again,
+// so is a panic of fn, which still reaches the caller. A repeat stops waiting when ctx is done.
+func (s *Store) Do(ctx context.Context, key, hash string, fn func() Response) (response Response, replayed bool, err error) {
+	s.mu.Lock()
+	if e, ok := s.entries[key]; ok {
+		s.mu.Unlock()
+		if e.hash != hash {
+			return Response{}, false, constant.ErrIdempotencyKeyReused
+		}
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return Response{}, false, ctx.Err()
+		}
+		if e.panicked {
+			return Response{}, false, constant.ErrInternal
+		}
+		return e.response, true, nil
+	}
+	e := &entry{hash: hash, done: make(chan struct{})}
+	s.entries[key] = e
+	s.mu.Unlock()
+
+	e.panicked = true
+	defer func() {
+		close(e.done)
+		if e.panicked || e.response.Status >= 500 {
+			s.forget(key, e)
+		} else {
+			time.AfterFunc(s.ttl, func() { s.forget(key, e) })
+		}
+	}()
+	e.response = fn()
+	e.panicked = false
+	return e.response, false, nil
+}
+
+// forget drops the entry unless a newer request already replaced it
+func (s *Store) forget(key string, e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[key] == e {
+		delete(s.entries, key)
+	}
+}
+
+// Middleware replays the stored status and body to a request repeating the Idempotency-Key of an earlier one,
+// keys are scoped to endpoint so the same key sent to another operation does not collide.
+// Requests without the header run as usual
+func Middleware(store *Store, endpoint string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(Header)
+		if key == "" || store.ttl <= 0 {
+			ctx.Next()
+			return
+		}
+		if len(key) > MaxKeyLength {
+			apierror.Response(ctx, constant.ErrInvalidIdempotencyKey)
+			ctx.Abort()
+			return
+		}
+
+		body, err := ioutil.ReadAll(ctx.Request.Body)
+		if err != nil {
+			apierror.Response(ctx, constant.ErrInvalidFormat)
+			ctx.Abort()
+			return
+		}
+		ctx.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+		sum := sha256.Sum256(body)
+
+		response, replayed, err := store.Do(ctx.Request.Context(), endpoint+":"+key, hex.EncodeToString(sum[:]), func() Response {
+			writer := &recorder{ResponseWriter: ctx.Writer}
+			ctx.Writer = writer
+			ctx.Next()
+			return Response{
+				Status:      writer.Status(),
+				ContentType: writer.Header().Get("Content-Type"),
+				Body:        writer.body.Bytes(),
+			}
+		})
+		if err != nil {
+			apierror.Response(ctx, err)
+			ctx.Abort()
+			return
+		}
+		if replayed {
+			ctx.Header(ReplayedHeader, "true")
+			ctx.Data(response.Status, response.ContentType, response.Body)
+			ctx.Abort()
+		}
+	}
+}
+
+// recorder copies the body written by the handler so it can be replayed
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *recorder) WriteString(data string) (int, error) {
+	r.body.WriteString(data)
+	return r.ResponseWriter.WriteString(data)
+}
@@ -0,0 +1,71 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-rest-api/src/constant"
+)
+
+// doPanicking runs a first request whose handler panics, like Recovery would see it
+func doPanicking(store *Store, started chan<- struct{}, release <-chan struct{}) (recovered interface{}) {
+	defer func() { recovered = recover() }()
+	store.Do(context.Background(), "register:key", "hash", func() Response {
+		close(started)
+		<-release
+		panic("handler failed")
+	})
+	return
+}
+
+func TestDoForgetsAPanickingRequest(t *testing.T) {
+	store := NewStore(time.Minute)
+	started, release := make(chan struct{}), make(chan struct{})
+	panicked := make(chan interface{})
+	go func() { panicked <- doPanicking(store, started, release) }()
+	<-started
+
+	// a repeat waiting on the first request is released with an error instead of hanging
+	waited := make(chan error)
+	go func() {
+		_, _, err := store.Do(context.Background(), "register:key", "hash", func() Response { return Response{} })
+		waited <- err
+	}()
+	// give the repeat time to start waiting
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if recovered := <-panicked; recovered == nil {
+		t.Error("the panic of the handler did not reach the caller")
+	}
+	if err := <-waited; err != constant.ErrInternal {
+		t.Errorf("Do() waiting on a panicked request error = %v, want %v", err, constant.ErrInternal)
+	}
+
+	// the key is free again, a retry runs
+	response, replayed, err := store.Do(context.Background(), "register:key", "hash", func() Response {
+		return Response{Status: http.StatusCreated}
+	})
+	if err != nil || replayed || response.Status != http.StatusCreated {
+		t.Errorf("retry after the panic = %+v, %v, %v, want it to run", response, replayed, err)
+	}
+}
+
+func TestDoStopsWaitingWhenTheRequestIsCanceled(t *testing.T) {
+	store := NewStore(time.Minute)
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	go store.Do(context.Background(), "register:key", "hash", func() Response {
+		close(started)
+		<-release
+		return Response{Status: http.StatusCreated}
+	})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := store.Do(ctx, "register:key", "hash", func() Response { return Response{} }); err != context.Canceled {
+		t.Errorf("Do() of a canceled repeat error = %v, want %v", err, context.Canceled)
+	}
+}
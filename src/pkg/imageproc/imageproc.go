@@ -0,0 +1,122 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"go-rest-api/src/pkg/logger"
+)
+
+// contentTypes are the formats Resize decodes
+var contentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+}
+
+// ContentType detects the type from the content rather than a client supplied header,
+// ok is false for anything Resize cannot decode
+func ContentType(data []byte) (contentType string, ok bool) {
+	contentType = http.DetectContentType(data)
+	return contentType, contentTypes[contentType]
+}
+
+// ErrTooManyPixels is returned for an image declaring more pixels than allowed, it is never decoded
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+// CheckPixels reads only the header of the image, decoding allocates width times height pixels
+// so an image above maxPixels is rejected before it is decoded
+func CheckPixels(data []byte, maxPixels int) (err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxPixels/config.Height {
+		return ErrTooManyPixels
+	}
+	return
+}
+
+// Resize scales an image down to the given width keeping its ratio, images
+// narrower than width are returned re-encoded at their original size.
+// Images above maxPixels fail with ErrTooManyPixels without being decoded
+func Resize(data []byte, width, maxPixels int) (resized []byte, contentType string, err error) {
+	err = CheckPixels(data, maxPixels)
+	if err != nil {
+		return
+	}
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	bounds := src.Bounds()
+	if bounds.Dx() > width {
+		height := bounds.Dy() * width / bounds.Dx()
+		if height < 1 {
+			height = 1
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				dst.Set(x, y, src.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height))
+			}
+		}
+		src = dst
+	}
+
+	buffer := bytes.Buffer{}
+	if format == "png" {
+		contentType = "image/png"
+		err = png.Encode(&buffer, src)
+	} else {
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&buffer, src, &jpeg.Options{Quality: 85})
+	}
+	resized = buffer.Bytes()
+	return
+}
+
+// Pool runs jobs on a fixed number of workers so CPU heavy processing stays bounded
+type Pool struct {
+	jobs   chan func()
+	logger *logger.Logger
+}
+
+func NewPool(workers, queueSize int, appLogger *logger.Logger) *Pool {
+	pool := &Pool{
+		jobs:   make(chan func(), queueSize),
+		logger: appLogger,
+	}
+	for i := 0; i < workers; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+// Submit queues a job, it returns false when the queue is full
+func (p *Pool) Submit(job func()) bool {
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Pool) work() {
+	for job := range p.jobs {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					p.logger.Error("image processing job panic", "panic", fmt.Sprint(r))
+				}
+			}()
+			job()
+		}()
+	}
+}
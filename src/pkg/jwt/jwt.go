@@ -1,71 +1,338 @@
 package jwt
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
-	"github.com/forkyid/go-utils/v1/aes"
+	"github.com/forkyid/go-utils/v1/uuid"
 	"github.com/golang-jwt/jwt"
 	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/blacklist"
+	"go-rest-api/src/pkg/publicid"
 )
 
-func GenerateJWT(accountID string) (string, error) {
+// bearerPrefix is optional and matched in any case, clients are inconsistent
+const bearerPrefix = "Bearer "
+
+// challengePurpose marks the token of a login waiting for its two factor code, only ValidateChallenge accepts it
+const challengePurpose = "two_factor"
+
+// Blacklist holds the ids of revoked tokens, routes replaces it with the configured store at startup
+var Blacklist blacklist.Store = blacklist.NewMemoryStore()
+
+// GenerateJWT binds the token to the device fingerprint, an empty device leaves the token unbound.
+// The role claim is what RequireRole checks, a role change applies from the next login
+func GenerateJWT(accountID, device, role string) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
 	claims["authorized"] = true
 	claims["accountID"] = accountID
-	claims["exp"] = time.Now().Add(time.Minute * 30).Unix()
+	if device != "" {
+		claims["device"] = device
+	}
+	claims["role"] = role
+	claims["jti"] = uuid.GetUUID()
+	claims["exp"] = time.Now().Add(constant.TokenTTL).Unix()
 
 	tokenString, err := token.SignedString(constant.SampleSecretKey)
 	if err != nil {
-		fmt.Errorf("Something Went Wrong: %s", err.Error())
-		return "", err
+		return "", fmt.Errorf("something went wrong: %s", err.Error())
 	}
 	return tokenString, nil
 }
 
+// ValidateToken rejects an expired token with constant.ErrTokenExpired
 func ValidateToken(bearerToken string) (claims jwt.MapClaims, err error) {
-	tokenStr := strings.Replace(bearerToken, "Bearer ", "", -1)
+	claims, expiresAt, err := parse(bearerToken, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Before(time.Now()) {
+		return nil, constant.ErrTokenExpired
+	}
+	return claims, err
+}
+
+// ValidateRefresh accepts a token that is valid or expired for less than grace,
+// the signature is always verified so a tampered token is never refreshed
+func ValidateRefresh(bearerToken string, grace time.Duration) (claims jwt.MapClaims, err error) {
+	claims, expiresAt, err := parse(bearerToken, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Add(grace).Before(time.Now()) {
+		return nil, constant.ErrTokenExpired
+	}
+	return claims, err
+}
+
+// parse verifies the signature and the purpose claim, access tokens have none. It rejects a revoked token
+// with constant.ErrTokenRevoked and a token of a suspended account with constant.ErrAccountSuspended,
+// the expiry is left to the caller. A blacklist that cannot be read rejects the token
+func parse(bearerToken, purpose string) (claims jwt.MapClaims, expiresAt time.Time, err error) {
+	claims, expiresAt, err = verify(bearerToken)
+	if err != nil {
+		return
+	}
+	if claimed, _ := claims["purpose"].(string); claimed != purpose {
+		return nil, time.Time{}, constant.ErrInvalidToken
+	}
+
+	revoked, err := Blacklist.Contains(tokenID(bearerToken, claims))
+	if err != nil {
+		err = fmt.Errorf("check token blacklist: %s", err.Error())
+		return nil, time.Time{}, err
+	}
+	if revoked {
+		return nil, time.Time{}, constant.ErrTokenRevoked
+	}
 
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+	publicID, _ := claims["accountID"].(string)
+	if accountID, decodeErr := publicid.Decode(publicID); decodeErr == nil {
+		suspended, err := Blacklist.Contains(accountKey(accountID))
+		if err != nil {
+			err = fmt.Errorf("check account blacklist: %s", err.Error())
+			return nil, time.Time{}, err
+		}
+		if suspended {
+			return nil, time.Time{}, constant.ErrAccountSuspended
+		}
+	}
+	return
+}
+
+// verify checks the signature and reads the expiry, it fails with constant.ErrMissingToken for an empty header,
+// constant.ErrMalformedToken for a token that does not parse and constant.ErrInvalidSignature for a token
+// not signed with the secret or with another algorithm
+func verify(bearerToken string) (claims jwt.MapClaims, expiresAt time.Time, err error) {
+	tokenStr := trimBearer(bearerToken)
+	if tokenStr == "" {
+		err = constant.ErrMissingToken
+		return
+	}
+
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("there was an error in parsing")
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return constant.SampleSecretKey, nil
 	})
-	if err != nil {
-		return nil, err
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorMalformed != 0 {
+		return nil, time.Time{}, constant.ErrMalformedToken
+	} else if err != nil || token == nil || !token.Valid {
+		return nil, time.Time{}, constant.ErrInvalidSignature
 	}
 
-	if token == nil {
-		err = errors.New("token error")
-		return nil, err
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, time.Time{}, constant.ErrMalformedToken
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
+	exp, ok := claims["exp"].(float64)
 	if !ok {
-		err = errors.New("invalid JWT Token")
-		return nil, err
+		return nil, time.Time{}, constant.ErrMalformedToken
 	}
+	expiresAt = time.Unix(int64(exp), 0)
+	return
+}
+
+// tokenID is the jti claim, tokens issued before it was added are identified by the hash of the token
+func tokenID(bearerToken string, claims jwt.MapClaims) string {
+	if id, _ := claims["jti"].(string); id != "" {
+		return id
+	}
+	sum := sha256.Sum256([]byte(trimBearer(bearerToken)))
+	return hex.EncodeToString(sum[:])
+}
+
+// trimBearer returns an empty token for a header carrying the prefix only
+func trimBearer(bearerToken string) string {
+	tokenStr := strings.TrimSpace(bearerToken)
+	if strings.EqualFold(tokenStr, strings.TrimSpace(bearerPrefix)) {
+		return ""
+	}
+	if len(tokenStr) > len(bearerPrefix) && strings.EqualFold(tokenStr[:len(bearerPrefix)], bearerPrefix) {
+		tokenStr = strings.TrimSpace(tokenStr[len(bearerPrefix):])
+	}
+	return tokenStr
+}
 
-	exp := claims["exp"].(float64)
-	if int64(exp) < time.Now().Local().Unix() {
-		err = errors.New("token expired")
+// Revoke blacklists a valid token for the rest of its lifetime and the refresh grace after it,
+// later requests and refreshes with it fail with constant.ErrTokenRevoked
+func Revoke(bearerToken string) (err error) {
+	claims, err := ValidateToken(bearerToken)
+	if err != nil {
 		return
 	}
-	return claims, err
+	exp, _ := claims["exp"].(float64)
+	return RevokeID(tokenID(bearerToken, claims), time.Unix(int64(exp), 0))
 }
 
+// RevokeID blacklists the token with the id until it expires at expiresAt and its refresh grace ended,
+// for revoking a token that is not at hand like the one of another session
+func RevokeID(id string, expiresAt time.Time) (err error) {
+	return Blacklist.Add(id, time.Until(expiresAt)+constant.TokenRefreshGrace)
+}
+
+// TokenID returns the jti of a token that is not revoked, an expired token still has its id
+// so a refresh can hand its session over to the new token
+func TokenID(bearerToken string) (id string, err error) {
+	claims, _, err := parse(bearerToken, "")
+	if err != nil {
+		return "", err
+	}
+	return tokenID(bearerToken, claims), nil
+}
+
+// SuspendAccount rejects every token of the account until the longest lived of them has expired
+// and its refresh grace ended, new tokens are not issued since login checks the stored status
+func SuspendAccount(accountID int) (err error) {
+	return Blacklist.Add(accountKey(accountID), constant.TokenTTL+constant.TokenRefreshGrace)
+}
+
+// ActivateAccount accepts the unexpired tokens of the account again
+func ActivateAccount(accountID int) (err error) {
+	return Blacklist.Remove(accountKey(accountID))
+}
+
+// accountKey keeps the account entries apart from the token ids
+func accountKey(accountID int) string {
+	return fmt.Sprintf("account:%d", accountID)
+}
+
+// RequirePasswordChange limits every token of the account to the password change for as long as SuspendAccount
+// would reject them, a login of an account still flagged with must_change_password marks it again
+func RequirePasswordChange(accountID int) (err error) {
+	return Blacklist.Add(passwordChangeKey(accountID), constant.TokenTTL+constant.TokenRefreshGrace)
+}
+
+// PasswordChanged lifts RequirePasswordChange once the owner chose a new password
+func PasswordChanged(accountID int) (err error) {
+	return Blacklist.Remove(passwordChangeKey(accountID))
+}
+
+// PasswordChangeRequired reports whether the tokens of the account are limited to the password change
+func PasswordChangeRequired(accountID int) (required bool, err error) {
+	return Blacklist.Contains(passwordChangeKey(accountID))
+}
+
+func passwordChangeKey(accountID int) string {
+	return fmt.Sprintf("password_change:%d", accountID)
+}
+
+// GenerateChallenge issues the token a two factor login sends with its code, it expires after TwoFactorChallengeTTL
+func GenerateChallenge(accountID string) (challenge string, expiresAt time.Time, err error) {
+	expiresAt = time.Now().Add(constant.TwoFactorChallengeTTL)
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["accountID"] = accountID
+	claims["purpose"] = challengePurpose
+	claims["jti"] = uuid.GetUUID()
+	claims["exp"] = expiresAt.Unix()
+
+	challenge, err = token.SignedString(constant.SampleSecretKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("something went wrong: %s", err.Error())
+	}
+	return
+}
+
+// ValidateChallenge returns the account of an unexpired challenge, it fails with constant.ErrInvalidToken
+// for anything else including an access token and a challenge already used by ConsumeChallenge
+func ValidateChallenge(challenge string) (accountID int, err error) {
+	claims, expiresAt, err := parse(challenge, challengePurpose)
+	if err == constant.ErrAccountSuspended {
+		return -1, err
+	} else if err != nil || expiresAt.Before(time.Now()) {
+		return -1, constant.ErrInvalidToken
+	}
+	publicID, _ := claims["accountID"].(string)
+	accountID, err = publicid.Decode(publicID)
+	if err != nil {
+		return -1, constant.ErrInvalidToken
+	}
+	return
+}
+
+// ConsumeChallenge blacklists a challenge until it expires so a finished login cannot be repeated with it
+func ConsumeChallenge(challenge string) (err error) {
+	claims, expiresAt, err := parse(challenge, challengePurpose)
+	if err != nil {
+		return
+	}
+	return Blacklist.Add(tokenID(challenge, claims), time.Until(expiresAt))
+}
+
+// ExtractID fails with one of the errors of verify, constant.ErrTokenExpired for an expired token,
+// constant.ErrTokenRevoked for a revoked one, constant.ErrAccountSuspended for a token of a suspended account
+// constant.ErrForeignAccountID for an account id of another environment and constant.ErrInvalidToken for a token
+// issued for another purpose like a login challenge. Other errors mean the blacklist could not be read
 func ExtractID(bearerToken string) (int, error) {
 	claimsMap, err := ValidateToken(bearerToken)
 	if err != nil {
-		return -1, fmt.Errorf("failed on claiming token")
+		return -1, err
 	}
-	id := aes.Decrypt(claimsMap["accountID"].(string))
-	if id == -1 {
-		return -1, fmt.Errorf("invalid ID")
+	accountID, _ := claimsMap["accountID"].(string)
+	id, err := publicid.Decode(accountID)
+	if err == constant.ErrForeignAccountID {
+		return -1, err
+	} else if err != nil {
+		return -1, constant.ErrMalformedToken
 	}
 	return id, nil
-}
\ No newline at end of file
+}
+
+// ExtractExpiry returns when a valid token expires
+func ExtractExpiry(bearerToken string) (time.Time, error) {
+	_, expiresAt, err := verify(bearerToken)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed on claiming token")
+	}
+	return expiresAt, nil
+}
+
+// ExtractDevice returns the device fingerprint the token is bound to, empty for an unbound token
+func ExtractDevice(bearerToken string) (string, error) {
+	claimsMap, err := ValidateToken(bearerToken)
+	if err != nil {
+		return "", fmt.Errorf("failed on claiming token")
+	}
+	device, _ := claimsMap["device"].(string)
+	return device, nil
+}
+
+// ExtractRole returns the role claim of a valid token, empty for a token issued without one
+func ExtractRole(bearerToken string) (string, error) {
+	claimsMap, err := ValidateToken(bearerToken)
+	if err != nil {
+		return "", fmt.Errorf("failed on claiming token")
+	}
+	role, _ := claimsMap["role"].(string)
+	return role, nil
+}
+
+// Refresh issues a new token for the account, device and role of a token ValidateRefresh accepts,
+// it fails with the same errors as ExtractID
+func Refresh(bearerToken string, grace time.Duration) (string, error) {
+	claimsMap, err := ValidateRefresh(bearerToken, grace)
+	if err != nil {
+		return "", err
+	}
+	accountID, _ := claimsMap["accountID"].(string)
+	if _, err := publicid.Decode(accountID); err == constant.ErrForeignAccountID {
+		return "", err
+	} else if err != nil {
+		return "", constant.ErrMalformedToken
+	}
+	device, _ := claimsMap["device"].(string)
+	role, _ := claimsMap["role"].(string)
+	return GenerateJWT(accountID, device, role)
+}
@@ -0,0 +1,118 @@
+package jwt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/blacklist"
+	"go-rest-api/src/pkg/publicid"
+)
+
+// issue returns a bearer token of the account that expires after ttl, a negative ttl expired already
+func issue(t *testing.T, accountID int, ttl time.Duration) string {
+	t.Helper()
+	defaultTTL := constant.TokenTTL
+	constant.TokenTTL = ttl
+	defer func() { constant.TokenTTL = defaultTTL }()
+
+	token, err := GenerateJWT(publicid.Encode(accountID), "", constant.RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateJWT() error = %v", err)
+	}
+	return bearerPrefix + token
+}
+
+func useSecret(t *testing.T, secret string) {
+	t.Helper()
+	defaultSecret := constant.SampleSecretKey
+	constant.SampleSecretKey = []byte(secret)
+	t.Cleanup(func() { constant.SampleSecretKey = defaultSecret })
+}
+
+func TestExtractID(t *testing.T) {
+	useSecret(t, "test secret")
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		wantErr error
+	}{
+		{"valid", time.Minute, nil},
+		{"expired", -time.Minute, constant.ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accountID, err := ExtractID(issue(t, 7, tt.ttl))
+			if err != tt.wantErr {
+				t.Fatalf("ExtractID() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && accountID != 7 {
+				t.Errorf("ExtractID() = %d, want 7", accountID)
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	useSecret(t, "test secret")
+	grace := 10 * time.Minute
+
+	valid := issue(t, 7, time.Minute)
+	parts := strings.Split(valid, ".")
+	otherParts := strings.Split(issue(t, 8, time.Minute), ".")
+	// the payload of another account under the signature of this one
+	alteredClaims := strings.Join([]string{parts[0], otherParts[1], parts[2]}, ".")
+
+	useSecret(t, "forged secret")
+	forged := issue(t, 7, time.Minute)
+	useSecret(t, "test secret")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"valid", valid, nil},
+		{"expired within grace", issue(t, 7, -5*time.Minute), nil},
+		{"expired past grace", issue(t, 7, -grace-time.Minute), constant.ErrTokenExpired},
+		{"altered claims", alteredClaims, constant.ErrInvalidSignature},
+		{"signed with another secret", forged, constant.ErrInvalidSignature},
+		{"missing", "", constant.ErrMissingToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refreshed, err := Refresh(tt.token, grace)
+			if err != tt.wantErr {
+				t.Fatalf("Refresh() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			accountID, err := ExtractID(bearerPrefix + refreshed)
+			if err != nil {
+				t.Fatalf("ExtractID() of the refreshed token error = %v", err)
+			}
+			if accountID != 7 {
+				t.Errorf("refreshed token carries account %d, want 7", accountID)
+			}
+		})
+	}
+}
+
+func TestRefreshRevoked(t *testing.T) {
+	useSecret(t, "test secret")
+	defaultBlacklist := Blacklist
+	Blacklist = blacklist.NewMemoryStore()
+	defer func() { Blacklist = defaultBlacklist }()
+
+	token := issue(t, 7, time.Minute)
+	if err := Revoke(token); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if _, err := Refresh(token, time.Minute); err != constant.ErrTokenRevoked {
+		t.Errorf("Refresh() of a revoked token error = %v, want %v", err, constant.ErrTokenRevoked)
+	}
+}
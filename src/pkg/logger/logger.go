@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKey holds the request scoped logger set by the logging middleware
+const ContextKey = "logger"
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// ParseLevel accepts debug, info, warn or error in any case
+func ParseLevel(name string) (level Level, ok bool) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, true
+		}
+	}
+	return LevelInfo, false
+}
+
+// Logger writes one json object per entry with time, level, msg and the key value fields.
+// Loggers derived with With share the writer of their parent.
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  Level
+	fields []interface{}
+}
+
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{
+		mu:    &sync.Mutex{},
+		out:   out,
+		level: level,
+	}
+}
+
+// With returns a logger adding the key value pairs to every entry
+func (logger *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(logger.fields)+len(keyvals))
+	fields = append(fields, logger.fields...)
+	fields = append(fields, keyvals...)
+	return &Logger{
+		mu:     logger.mu,
+		out:    logger.out,
+		level:  logger.level,
+		fields: fields,
+	}
+}
+
+// For returns the request scoped logger of the context, or the logger itself outside a request
+func (logger *Logger) For(ctx *gin.Context) *Logger {
+	if scoped, ok := ctx.Value(ContextKey).(*Logger); ok {
+		return scoped
+	}
+	return logger
+}
+
+func (logger *Logger) Debug(msg string, keyvals ...interface{}) {
+	logger.write(LevelDebug, msg, keyvals)
+}
+
+func (logger *Logger) Info(msg string, keyvals ...interface{}) {
+	logger.write(LevelInfo, msg, keyvals)
+}
+
+func (logger *Logger) Warn(msg string, keyvals ...interface{}) {
+	logger.write(LevelWarn, msg, keyvals)
+}
+
+func (logger *Logger) Error(msg string, keyvals ...interface{}) {
+	logger.write(LevelError, msg, keyvals)
+}
+
+func (logger *Logger) write(level Level, msg string, keyvals []interface{}) {
+	if level < logger.level {
+		return
+	}
+
+	entry := map[string]interface{}{}
+	addFields(entry, logger.fields)
+	addFields(entry, keyvals)
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = levelNames[level]
+	entry["msg"] = msg
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]interface{}{
+			"time":  entry["time"],
+			"level": entry["level"],
+			"msg":   msg,
+			"error": "unencodable log fields: " + err.Error(),
+		})
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.out.Write(append(line, '\n'))
+}
+
+// addFields sets the key value pairs, errors are logged by their message and a key without value is kept empty
+func addFields(entry map[string]interface{}, keyvals []interface{}) {
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{}
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[key] = value
+	}
+}
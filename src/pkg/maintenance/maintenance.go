@@ -0,0 +1,76 @@
+package maintenance
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/apierror"
+)
+
+const BypassHeader = "X-Maintenance-Bypass"
+
+// Mode rejects mutating requests with 503 while read only is on.
+// Safe methods always pass, other routes can be marked as reads with AllowRoute.
+type Mode struct {
+	mu          sync.RWMutex
+	readOnly    bool
+	bypassToken string
+	readRoutes  map[string]bool
+}
+
+func NewMode(readOnly bool, bypassToken string) *Mode {
+	return &Mode{
+		readOnly:    readOnly,
+		bypassToken: bypassToken,
+		readRoutes:  map[string]bool{},
+	}
+}
+
+func (mode *Mode) SetReadOnly(readOnly bool) {
+	mode.mu.Lock()
+	defer mode.mu.Unlock()
+	mode.readOnly = readOnly
+}
+
+func (mode *Mode) ReadOnly() bool {
+	mode.mu.RLock()
+	defer mode.mu.RUnlock()
+	return mode.readOnly
+}
+
+// AllowRoute marks a non GET route as a read, the path is the registered route path e.g. /v1/auth
+func (mode *Mode) AllowRoute(method, path string) {
+	mode.mu.Lock()
+	defer mode.mu.Unlock()
+	mode.readRoutes[method+" "+path] = true
+}
+
+func (mode *Mode) Middleware(ctx *gin.Context) {
+	if !mode.ReadOnly() || mode.isRead(ctx) || mode.bypassed(ctx) {
+		ctx.Next()
+		return
+	}
+
+	apierror.Field(ctx, "server", constant.ErrReadOnlyMode)
+	ctx.Abort()
+}
+
+func (mode *Mode) isRead(ctx *gin.Context) bool {
+	switch ctx.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	mode.mu.RLock()
+	defer mode.mu.RUnlock()
+	return mode.readRoutes[ctx.Request.Method+" "+ctx.FullPath()]
+}
+
+func (mode *Mode) bypassed(ctx *gin.Context) bool {
+	token := ctx.GetHeader(BypassHeader)
+	return mode.bypassToken != "" && token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(mode.bypassToken)) == 1
+}
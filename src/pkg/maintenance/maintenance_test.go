@@ -0,0 +1,59 @@
+package maintenance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadOnlyModeRejectsWrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mode := NewMode(true, "bypass-secret")
+	mode.AllowRoute(http.MethodPost, "/v1/auth")
+	router := gin.New()
+	router.Use(mode.Middleware)
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+	router.GET("/v1/accounts/:id", ok)
+	router.POST("/v1/accounts", ok)
+	router.PATCH("/v1/accounts/:id", ok)
+	router.DELETE("/v1/accounts/:id", ok)
+	router.POST("/v1/auth", ok)
+
+	tests := []struct {
+		name         string
+		method, path string
+		bypass       string
+		want         int
+	}{
+		{"get passes", http.MethodGet, "/v1/accounts/1", "", http.StatusOK},
+		{"register is rejected", http.MethodPost, "/v1/accounts", "", http.StatusServiceUnavailable},
+		{"update is rejected", http.MethodPatch, "/v1/accounts/1", "", http.StatusServiceUnavailable},
+		{"delete is rejected", http.MethodDelete, "/v1/accounts/1", "", http.StatusServiceUnavailable},
+		{"post marked as a read passes", http.MethodPost, "/v1/auth", "", http.StatusOK},
+		{"write with the bypass token passes", http.MethodPatch, "/v1/accounts/1", "bypass-secret", http.StatusOK},
+		{"write with a wrong bypass token is rejected", http.MethodPatch, "/v1/accounts/1", "guess", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.bypass != "" {
+				request.Header.Set(BypassHeader, tt.bypass)
+			}
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, recorder.Code, tt.want)
+			}
+		})
+	}
+
+	// turning read only off lets writes through again
+	mode.SetReadOnly(false)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/v1/accounts/1", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("write after leaving read only status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+}
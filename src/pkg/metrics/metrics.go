@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	otherField = "other"
+	// unmatchedRoute labels requests no route matched so scanned paths cannot grow the series
+	unmatchedRoute = "unmatched"
+)
+
+// validatedFields bounds the field label to the json names of the account payloads
+var validatedFields = map[string]bool{
+	"username":        true,
+	"fullname":        true,
+	"display_name":    true,
+	"email":           true,
+	"password":        true,
+	"address":         true,
+	"employee_number": true,
+	"job_position":    true,
+	"ktp_number":      true,
+	"phone_number":    true,
+	"gender":          true,
+	"date_of_birth":   true,
+	"locale":          true,
+	"terms_version":   true,
+}
+
+var validationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "account_validation_failures_total",
+	Help: "Account payload validation failures by endpoint and field.",
+}, []string{"endpoint", "field"})
+
+var checksumMismatches = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "account_checksum_mismatches_total",
+	Help: "Account rows whose stored checksum does not match their critical fields.",
+})
+
+var requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_requests_total",
+	Help: "Handled requests by method, route template and response status.",
+}, []string{"method", "route", "status"})
+
+var requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_request_duration_seconds",
+	Help:    "Request latency by method and route template.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "route"})
+
+var authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "auth_failures_total",
+	Help: "Rejected logins and tokens by reason.",
+}, []string{"reason"})
+
+var accountConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "account_conflicts_total",
+	Help: "Account requests answered with 409 by error code.",
+}, []string{"code"})
+
+var dbRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "db_retries_total",
+	Help: "Database operations run again after a transient error by operation.",
+}, []string{"operation"})
+
+var auditWriteFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "audit_write_failures_total",
+	Help: "Audit entries that could not be written by action, each one is missing from the trail.",
+}, []string{"action"})
+
+func init() {
+	prometheus.MustRegister(validationFailures, checksumMismatches, requests, requestDuration, authFailures, accountConflicts, dbRetries,
+		auditWriteFailures)
+}
+
+// Request counts a handled request, route is the gin route template so ids in the path stay out of the labels
+func Request(method, route string, status int, elapsed time.Duration) {
+	if route == "" {
+		route = unmatchedRoute
+	}
+	requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	requestDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// AuthFailure counts a rejected login or token, reason is a constant.LoginFailure* or constant.AuthFailure* value
+func AuthFailure(reason string) {
+	authFailures.WithLabelValues(reason).Inc()
+}
+
+// DBRetry counts a retry of a database operation, operation is a fixed name like take_account_by_id
+func DBRetry(operation string) {
+	dbRetries.WithLabelValues(operation).Inc()
+}
+
+// AuditWriteFailure counts an audit entry that was not written, action is a constant.AuditAction* value
+func AuditWriteFailure(action string) {
+	auditWriteFailures.WithLabelValues(action).Inc()
+}
+
+// AccountConflict counts a 409 answer, code is the apierror code
+func AccountConflict(code string) {
+	accountConflicts.WithLabelValues(code).Inc()
+}
+
+// ValidationFailed counts a failed field, fields outside the known payload fields are counted as other
+func ValidationFailed(endpoint, field string) {
+	if !validatedFields[field] {
+		field = otherField
+	}
+	validationFailures.WithLabelValues(endpoint, field).Inc()
+}
+
+// ValidationErrors counts every failed field of a validator error
+func ValidationErrors(endpoint string, err error) {
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return
+	}
+	for _, fieldErr := range validationErrors {
+		ValidationFailed(endpoint, fieldErr.Field())
+	}
+}
+
+func ChecksumMismatch() {
+	checksumMismatches.Inc()
+}
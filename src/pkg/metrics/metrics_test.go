@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/forkyid/go-utils/v1/validation"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestValidationErrorsCountsTheFailingField(t *testing.T) {
+	request := struct {
+		Username string `json:"username" validate:"required"`
+		Email    string `json:"email" validate:"omitempty,email"`
+	}{Username: "budi", Email: "not an email"}
+	err := validation.Validator.Struct(request)
+	if err == nil {
+		t.Fatal("Struct() of an invalid email passed")
+	}
+
+	email := validationFailures.WithLabelValues("register", "email")
+	username := validationFailures.WithLabelValues("register", "username")
+	emailBefore, usernameBefore := testutil.ToFloat64(email), testutil.ToFloat64(username)
+	ValidationErrors("register", err)
+	if got := testutil.ToFloat64(email) - emailBefore; got != 1 {
+		t.Errorf("email failures grew by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(username) - usernameBefore; got != 0 {
+		t.Errorf("username failures grew by %v, the username was valid", got)
+	}
+}
+
+func TestValidationFailedBoundsTheFieldLabel(t *testing.T) {
+	other := validationFailures.WithLabelValues("update", otherField)
+	before := testutil.ToFloat64(other)
+	ValidationFailed("update", "role")
+	ValidationFailed("update", "x-attacker-chosen-field")
+	if got := testutil.ToFloat64(other) - before; got != 2 {
+		t.Errorf("other failures grew by %v, want 2 for the unknown fields", got)
+	}
+}
@@ -0,0 +1,302 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forkyid/go-utils/v1/uuid"
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/apierror"
+	"go-rest-api/src/pkg/fingerprint"
+	"go-rest-api/src/pkg/jwt"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/metrics"
+)
+
+const (
+	RequestIDHeader      = "X-Request-ID"
+	ForwardedProtoHeader = "X-Forwarded-Proto"
+	// ForwardedTLSHeader carries the negotiated version e.g. TLSv1.2, the proxy must be configured to set it
+	ForwardedTLSHeader = "X-Forwarded-TLS-Version"
+)
+
+// RequestID keeps the caller's X-Request-ID or generates one, and echoes it in the response
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = uuid.GetUUID()
+		}
+		ctx.Set(constant.RequestIDKey, requestID)
+		ctx.Header(RequestIDHeader, requestID)
+		ctx.Next()
+	}
+}
+
+// AccessLog is gin.Logger with the request id of RequestID appended to every line
+func AccessLog() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		requestID, _ := param.Keys[constant.RequestIDKey].(string)
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v request_id=%s\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency.Truncate(time.Microsecond),
+			param.ClientIP,
+			param.Method,
+			param.Path,
+			requestID,
+			param.ErrorMessage,
+		)
+	})
+}
+
+// Logging stores a request scoped logger carrying the request id, the route and the account id of a valid token,
+// handlers get it with Logger.For. It must run after RequestID
+func Logging(base *logger.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scoped := base.With("request_id", ctx.GetString(constant.RequestIDKey), "method", ctx.Request.Method, "path", ctx.FullPath())
+		if authorization := ctx.GetHeader("Authorization"); authorization != "" {
+			if accountID, err := jwt.ExtractID(authorization); err == nil {
+				scoped = scoped.With("account_id", accountID)
+			}
+		}
+		ctx.Set(logger.ContextKey, scoped)
+		ctx.Next()
+	}
+}
+
+// Metrics records the count, latency and status of every request by route template, it must run
+// before Recovery so a recovered panic is counted as the 500 it becomes
+func Metrics() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+		metrics.Request(ctx.Request.Method, ctx.FullPath(), ctx.Writer.Status(), time.Since(start))
+	}
+}
+
+// Recovery turns a handler panic into the standard 500 response.
+// The panic value and stack trace are logged with the request id, never returned to the client.
+func Recovery(base *logger.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// the client went away, let net/http handle it as usual
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			base.For(ctx).Error("panic recovered", "request_id", ctx.GetString(constant.RequestIDKey), "method", ctx.Request.Method,
+				"path", ctx.Request.URL.Path, "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+			if ctx.Writer.Written() {
+				ctx.Abort()
+				return
+			}
+			apierror.Response(ctx, constant.ErrInternal)
+			ctx.Abort()
+		}()
+		ctx.Next()
+	}
+}
+
+// DeviceBinding compares the device a token is bound to with the device using it.
+// Invalid and unbound tokens pass, they are left to the handlers and to expire.
+func DeviceBinding(mode string, secret []byte, base *logger.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authorization := ctx.GetHeader("Authorization")
+		if mode == constant.DeviceBindingOff || authorization == "" {
+			ctx.Next()
+			return
+		}
+
+		claim, err := jwt.ExtractDevice(authorization)
+		if err != nil || claim == "" {
+			ctx.Next()
+			return
+		}
+		bound, ok := fingerprint.ParseDevice(claim)
+		if ok && bound.Matches(fingerprint.DeviceFromRequest(ctx, secret)) {
+			ctx.Next()
+			return
+		}
+
+		if mode != constant.DeviceBindingEnforce {
+			base.For(ctx).Warn("device mismatch", "request_id", ctx.GetString(constant.RequestIDKey), "method", ctx.Request.Method,
+				"path", ctx.Request.URL.Path)
+			ctx.Next()
+			return
+		}
+		apierror.Field(ctx, "authorization", constant.ErrDeviceMismatch)
+		ctx.Abort()
+	}
+}
+
+// HTTPS rejects requests the proxy did not receive over https, in redirect mode GET and HEAD
+// are redirected to https, other methods are rejected since their body and token were already sent.
+// The forwarded headers are only read from the trusted proxies of the router, a client reaching
+// the service directly cannot claim https
+func HTTPS(mode, minTLSVersion string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if mode == constant.HTTPSEnforcementOff {
+			ctx.Next()
+			return
+		}
+
+		_, fromProxy := ctx.RemoteIP()
+		secure := ctx.Request.TLS != nil || (fromProxy &&
+			strings.EqualFold(strings.TrimSpace(strings.Split(ctx.GetHeader(ForwardedProtoHeader), ",")[0]), "https"))
+		if !secure {
+			if mode == constant.HTTPSEnforcementRedirect &&
+				(ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead) {
+				ctx.Redirect(http.StatusMovedPermanently, "https://"+ctx.Request.Host+ctx.Request.URL.RequestURI())
+				ctx.Abort()
+				return
+			}
+			apierror.Field(ctx, "protocol", constant.ErrHTTPSRequired)
+			ctx.Abort()
+			return
+		}
+
+		version := ""
+		if fromProxy {
+			version = ctx.GetHeader(ForwardedTLSHeader)
+		}
+		if version != "" && tlsVersionBelow(version, minTLSVersion) {
+			apierror.Field(ctx, "protocol", constant.ErrWeakTLS)
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// tlsVersionBelow compares versions like TLSv1.2, TLS 1.3 or 1.1, an unparseable version is treated as below
+func tlsVersionBelow(version, minimum string) bool {
+	major, minor, ok := parseTLSVersion(version)
+	minMajor, minMinor, minOK := parseTLSVersion(minimum)
+	if !minOK {
+		return false
+	}
+	if !ok {
+		return true
+	}
+	return major < minMajor || (major == minMajor && minor < minMinor)
+}
+
+func parseTLSVersion(version string) (major, minor int, ok bool) {
+	version = strings.TrimLeft(strings.ToLower(version), "tlsv ")
+	parts := strings.SplitN(version, ".", 2)
+	if len(parts) != 2 {
+		return
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return
+	}
+	return major, minor, true
+}
+
+// CORSConfig lists what cross origin requests may do, an origin of * allows any origin but not with credentials
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// Validate rejects a wildcard origin with credentials and origins that are not scheme://host[:port]
+func (config CORSConfig) Validate() (err error) {
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			if config.AllowCredentials {
+				return fmt.Errorf("origin * cannot be combined with credentials")
+			}
+			continue
+		}
+		parsed, parseErr := url.Parse(origin)
+		if parseErr != nil || parsed.Scheme == "" || parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") {
+			return fmt.Errorf("origin must be scheme://host[:port]: %s", origin)
+		}
+	}
+	return
+}
+
+// CORS answers the preflight of an allowed origin with 204 before any handler runs, a preflight of another
+// origin or for a method that is not allowed gets 403. Other requests of an allowed origin get the
+// allow and expose headers, requests without an Origin header pass untouched
+func CORS(config CORSConfig) gin.HandlerFunc {
+	origins := map[string]bool{}
+	for _, origin := range config.AllowedOrigins {
+		origins[strings.TrimSuffix(origin, "/")] = true
+	}
+	methods := map[string]bool{}
+	for _, method := range config.AllowedMethods {
+		methods[strings.ToUpper(method)] = true
+	}
+	allowedMethods := strings.Join(config.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(config.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+		ctx.Writer.Header().Add("Vary", "Origin")
+		preflight := ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != ""
+
+		allowed := origins[origin] || origins["*"]
+		if !allowed || (preflight && !methods[strings.ToUpper(ctx.GetHeader("Access-Control-Request-Method"))]) {
+			if preflight {
+				ctx.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			ctx.Next()
+			return
+		}
+
+		if origins[origin] {
+			ctx.Header("Access-Control-Allow-Origin", origin)
+		} else {
+			ctx.Header("Access-Control-Allow-Origin", "*")
+		}
+		if config.AllowCredentials {
+			ctx.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if exposedHeaders != "" {
+				ctx.Header("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			ctx.Next()
+			return
+		}
+
+		ctx.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		ctx.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		ctx.Header("Access-Control-Allow-Methods", allowedMethods)
+		if allowedHeaders != "" {
+			ctx.Header("Access-Control-Allow-Headers", allowedHeaders)
+		}
+		if config.MaxAge > 0 {
+			ctx.Header("Access-Control-Max-Age", maxAge)
+		}
+		ctx.AbortWithStatus(http.StatusNoContent)
+	}
+}
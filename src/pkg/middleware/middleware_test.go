@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/apierror"
+	"go-rest-api/src/pkg/fingerprint"
+	"go-rest-api/src/pkg/jwt"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/publicid"
+)
+
+func TestRecoveryRespondsWithTheStandardError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logs := bytes.Buffer{}
+
+	router := gin.New()
+	router.Use(RequestID(), Recovery(logger.New(&logs, logger.LevelError)))
+	router.GET("/panic", func(ctx *gin.Context) {
+		panic("secret connection string")
+	})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	request.Header.Set(RequestIDHeader, "req-123")
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+	response := apierror.Envelope{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("body %q is not json: %v", recorder.Body.String(), err)
+	}
+	if response.Error.Code != "internal_error" || response.Error.RequestID != "req-123" {
+		t.Errorf("body = %+v, want the internal_error envelope of the request", response)
+	}
+	if strings.Contains(recorder.Body.String(), "secret") {
+		t.Errorf("body %q leaks the panic value", recorder.Body.String())
+	}
+
+	logged := logs.String()
+	if !strings.Contains(logged, `"request_id":"req-123"`) || !strings.Contains(logged, "secret connection string") ||
+		!strings.Contains(logged, "goroutine") {
+		t.Errorf("log = %q, want the request id, the panic value and the stack trace", logged)
+	}
+}
+
+func TestRecoveryRepanicsAnAbortedHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Recovery(logger.New(io.Discard, logger.LevelError)))
+	router.GET("/abort", func(ctx *gin.Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler to reach net/http", recovered)
+		}
+	}()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+}
+
+// deviceRequest is a request of the browser described by userAgent, language and remoteAddr
+func deviceRequest(userAgent, language, remoteAddr string) *http.Request {
+	request := httptest.NewRequest(http.MethodGet, "/me", nil)
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set("Accept-Language", language)
+	request.RemoteAddr = remoteAddr
+	return request
+}
+
+func TestDeviceBinding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defaultSecret := constant.SampleSecretKey
+	constant.SampleSecretKey = []byte("test secret")
+	defer func() { constant.SampleSecretKey = defaultSecret }()
+	secret := []byte("fingerprint secret")
+
+	// the token is bound to the device it logged in from
+	login, _ := gin.CreateTestContext(httptest.NewRecorder())
+	login.Request = deviceRequest("Mozilla/5.0 Firefox/118.0", "id-ID,id;q=0.9", "203.0.113.10:5000")
+	token, err := jwt.GenerateJWT(publicid.Encode(7), fingerprint.DeviceFromRequest(login, secret).String(), constant.RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateJWT() error = %v", err)
+	}
+
+	same := deviceRequest("Mozilla/5.0 Firefox/118.0", "id-ID,id;q=0.9", "203.0.113.10:5000")
+	// a browser update on another network is drift of one part
+	drifted := deviceRequest("Mozilla/5.0 Firefox/119.0", "id-ID,id;q=0.9", "198.51.100.7:6000")
+	other := deviceRequest("curl/8.0", "en-US", "203.0.113.10:5000")
+
+	tests := []struct {
+		name       string
+		mode       string
+		request    *http.Request
+		wantStatus int
+		wantLog    bool
+	}{
+		{"enforce matching", constant.DeviceBindingEnforce, same, http.StatusOK, false},
+		{"enforce drifted", constant.DeviceBindingEnforce, drifted, http.StatusOK, false},
+		{"enforce mismatching", constant.DeviceBindingEnforce, other, http.StatusUnauthorized, false},
+		{"warn mismatching", constant.DeviceBindingWarn, other, http.StatusOK, true},
+		{"off mismatching", constant.DeviceBindingOff, other, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := bytes.Buffer{}
+
+			router := gin.New()
+			router.Use(DeviceBinding(tt.mode, secret, logger.New(&logs, logger.LevelDebug)))
+			router.GET("/me", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+			tt.request.Header.Set("Authorization", "Bearer "+token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, tt.request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && !strings.Contains(recorder.Body.String(), constant.ErrDeviceMismatch.Error()) {
+				t.Errorf("body = %q, want %v", recorder.Body.String(), constant.ErrDeviceMismatch)
+			}
+			if logged := strings.Contains(logs.String(), "device mismatch"); logged != tt.wantLog {
+				t.Errorf("logged the mismatch %v, want %v", logged, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestHTTPS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const (
+		proxy  = "10.0.0.1:5000"
+		direct = "198.51.100.7:6000"
+	)
+	tests := []struct {
+		name         string
+		mode         string
+		method       string
+		remoteAddr   string
+		proto        string
+		tlsVersion   string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"redirects an http GET", constant.HTTPSEnforcementRedirect, http.MethodGet, proxy, "http", "", http.StatusMovedPermanently,
+			"https://api.example.com/v1/accounts?page=2"},
+		{"rejects an http POST in redirect mode", constant.HTTPSEnforcementRedirect, http.MethodPost, proxy, "http", "", http.StatusBadRequest, ""},
+		{"rejects an http GET", constant.HTTPSEnforcementReject, http.MethodGet, proxy, "http", "", http.StatusBadRequest, ""},
+		{"rejects a request without the header", constant.HTTPSEnforcementReject, http.MethodGet, proxy, "", "", http.StatusBadRequest, ""},
+		{"rejects a weak tls version", constant.HTTPSEnforcementReject, http.MethodGet, proxy, "https", "TLSv1.0", http.StatusBadRequest, ""},
+		{"passes https", constant.HTTPSEnforcementReject, http.MethodGet, proxy, "https", "TLSv1.3", http.StatusOK, ""},
+		{"rejects https claimed by a direct client", constant.HTTPSEnforcementReject, http.MethodGet, direct, "https", "TLSv1.3", http.StatusBadRequest, ""},
+		{"passes http when off", constant.HTTPSEnforcementOff, http.MethodGet, direct, "http", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			if err := router.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+				t.Fatalf("SetTrustedProxies() error = %v", err)
+			}
+			router.Use(HTTPS(tt.mode, "1.2"))
+			router.Handle(tt.method, "/v1/accounts", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			request := httptest.NewRequest(tt.method, "http://api.example.com/v1/accounts?page=2", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				request.Header.Set(ForwardedProtoHeader, tt.proto)
+			}
+			if tt.tlsVersion != "" {
+				request.Header.Set(ForwardedTLSHeader, tt.tlsVersion)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if location := recorder.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package nik
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Tag is the validate tag failing a KTP number that is not a plausible NIK, it accepts string and integer fields
+const Tag = "ktp"
+
+// Length of an Indonesian NIK: 6 digit region, DDMMYY birth date, 4 digit serial
+const Length = 16
+
+// femaleDayOffset is added to the birth day of women
+const femaleDayOffset = 40
+
+// provinces are the codes of the first two digits, the regency and district digits are not checked against a list
+var provinces = map[string]bool{
+	"11": true, "12": true, "13": true, "14": true, "15": true, "16": true, "17": true, "18": true, "19": true,
+	"21": true,
+	"31": true, "32": true, "33": true, "34": true, "35": true, "36": true,
+	"51": true, "52": true, "53": true,
+	"61": true, "62": true, "63": true, "64": true, "65": true,
+	"71": true, "72": true, "73": true, "74": true, "75": true, "76": true,
+	"81": true, "82": true,
+	"91": true, "92": true, "93": true, "94": true, "95": true, "96": true,
+}
+
+// daysInMonth allows 29 february since the century of the year is not encoded
+var daysInMonth = [13]int{0, 31, 29, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+// BirthDate decodes the day, month and two digit year of birth, ok is false when the NIK cannot encode a date
+func BirthDate(nik string) (day, month, year int, female, ok bool) {
+	if len(nik) != Length {
+		return
+	}
+	for _, r := range nik {
+		if r < '0' || r > '9' {
+			return
+		}
+	}
+
+	day, _ = strconv.Atoi(nik[6:8])
+	month, _ = strconv.Atoi(nik[8:10])
+	year, _ = strconv.Atoi(nik[10:12])
+	if day > femaleDayOffset {
+		day -= femaleDayOffset
+		female = true
+	}
+	if day < 1 || day > 31 || month < 1 || month > 12 {
+		return
+	}
+	return day, month, year, female, true
+}
+
+// Valid reports whether the NIK is 16 digits with a known province, non zero regency, district and serial
+// and a birth date that exists
+func Valid(nik string) bool {
+	day, month, _, _, ok := BirthDate(nik)
+	if !ok || day > daysInMonth[month] {
+		return false
+	}
+	return provinces[nik[0:2]] && nik[2:4] != "00" && nik[4:6] != "00" && nik[12:16] != "0000"
+}
+
+// Register adds the ktp tag to the validator, it must run before any struct using the tag is validated
+func Register(validate *validator.Validate) error {
+	return validate.RegisterValidation(Tag, func(fl validator.FieldLevel) bool {
+		switch fl.Field().Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			return Valid(strconv.FormatInt(fl.Field().Int(), 10))
+		case reflect.String:
+			return Valid(fl.Field().String())
+		}
+		return false
+	})
+}
+
+// MatchesDOB reports whether the NIK encodes the date of birth, the century is not encoded so only
+// the last two digits of the year are compared
+func MatchesDOB(nik string, dob time.Time) bool {
+	day, month, year, _, ok := BirthDate(nik)
+	return ok && day == dob.Day() && month == int(dob.Month()) && year == dob.Year()%100
+}
@@ -0,0 +1,89 @@
+package nik
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBirthDate(t *testing.T) {
+	tests := []struct {
+		name             string
+		nik              string
+		day, month, year int
+		female, ok       bool
+	}{
+		{"male", "3171011708900001", 17, 8, 90, false, true},
+		{"female", "3171015708900002", 17, 8, 90, true, true},
+		{"female first of month", "3273144101050003", 1, 1, 5, true, true},
+		{"day zero", "3171010008900001", 0, 0, 0, false, false},
+		{"month thirteen", "3171011713900001", 0, 0, 0, false, false},
+		{"female day past 31", "3171017208900001", 0, 0, 0, false, false},
+		{"too short", "317101170890001", 0, 0, 0, false, false},
+		{"not digits", "31710117089000a1", 0, 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			day, month, year, female, ok := BirthDate(tt.nik)
+			if ok != tt.ok {
+				t.Fatalf("BirthDate(%q) ok = %v, want %v", tt.nik, ok, tt.ok)
+			}
+			if ok && (day != tt.day || month != tt.month || year != tt.year || female != tt.female) {
+				t.Errorf("BirthDate(%q) = %d-%d-%d female %v, want %d-%d-%d female %v",
+					tt.nik, day, month, year, female, tt.day, tt.month, tt.year, tt.female)
+			}
+		})
+	}
+}
+
+func TestMatchesDOB(t *testing.T) {
+	date := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name string
+		nik  string
+		dob  time.Time
+		want bool
+	}{
+		{"male match", "3171011708900001", date("1990-08-17"), true},
+		{"female match with 40 added to the day", "3171015708900002", date("1990-08-17"), true},
+		{"century is not encoded", "3273144101050003", date("2005-01-01"), true},
+		{"day mismatch", "3171011708900001", date("1990-08-18"), false},
+		{"month mismatch", "3171011708900001", date("1990-09-17"), false},
+		{"year mismatch", "3171011708900001", date("1991-08-17"), false},
+		{"female day mismatch", "3171015708900002", date("1990-08-16"), false},
+		{"undecodable nik", "3171010008900001", date("1990-08-17"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchesDOB(tt.nik, tt.dob); got != tt.want {
+				t.Errorf("MatchesDOB(%q, %s) = %v, want %v", tt.nik, tt.dob.Format("2006-01-02"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		nik  string
+		want bool
+	}{
+		{"3171011708900001", true},
+		{"3171015708900002", true},
+		{"9971011708900001", false},
+		{"3100011708900001", false},
+		{"3171011708900000", false},
+		{"3171013002900001", false},
+		{"3171012902000001", true},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.nik); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.nik, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package notifier
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"go-rest-api/src/pkg/email"
+	"go-rest-api/src/pkg/i18n"
+)
+
+type Notifier interface {
+	Notify(to, locale, templateName string, data map[string]string) (err error)
+}
+
+type TemplateNotifier struct {
+	sender email.EmailSender
+}
+
+func NewNotifier(
+	sender email.EmailSender,
+) *TemplateNotifier {
+	return &TemplateNotifier{
+		sender: sender,
+	}
+}
+
+// Notify renders the templated message in the recipient locale and sends it
+func (n *TemplateNotifier) Notify(to, locale, templateName string, data map[string]string) (err error) {
+	message, ok := i18n.Lookup(locale, templateName)
+	if !ok {
+		return fmt.Errorf("unknown template: %s", templateName)
+	}
+
+	tmpl, err := template.New(templateName).Parse(message.Body)
+	if err != nil {
+		return
+	}
+	body := bytes.Buffer{}
+	err = tmpl.Execute(&body, data)
+	if err != nil {
+		return
+	}
+
+	return n.sender.Send(to, message.Subject, body.String())
+}
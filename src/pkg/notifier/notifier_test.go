@@ -0,0 +1,58 @@
+package notifier
+
+import (
+	"strings"
+	"testing"
+
+	"go-rest-api/src/pkg/i18n"
+)
+
+// outbox keeps the last message instead of sending it
+type outbox struct {
+	to, subject, body string
+}
+
+func (o *outbox) Send(to, subject, body string) (err error) {
+	o.to, o.subject, o.body = to, subject, body
+	return
+}
+
+func TestNotifyUsesTheAccountLocale(t *testing.T) {
+	tests := []struct {
+		name        string
+		locale      string
+		wantSubject string
+		wantBody    string
+	}{
+		{"indonesian", i18n.LocaleIndonesian, "Verifikasi email anda", "Hai Budi, silakan verifikasi email anda"},
+		{"english", i18n.LocaleEnglish, "Verify your email", "Hi Budi, please verify your email"},
+		{"unsupported falls back to english", "fr", "Verify your email", "Hi Budi, please verify your email"},
+		{"empty falls back to english", "", "Verify your email", "Hi Budi, please verify your email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := &outbox{}
+			err := NewNotifier(sent).Notify("budi@example.com", tt.locale, i18n.TemplateVerification,
+				map[string]string{"name": "Budi", "link": "https://example.com/verify?token=abc"})
+			if err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if sent.to != "budi@example.com" || sent.subject != tt.wantSubject {
+				t.Errorf("Notify() sent %q to %q, want %q", sent.subject, sent.to, tt.wantSubject)
+			}
+			if !strings.HasPrefix(sent.body, tt.wantBody) || !strings.Contains(sent.body, "https://example.com/verify?token=abc") {
+				t.Errorf("Notify() body = %q, want it to start with %q and carry the link", sent.body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNotifyUnknownTemplate(t *testing.T) {
+	sent := &outbox{}
+	if err := NewNotifier(sent).Notify("budi@example.com", i18n.LocaleIndonesian, "unknown", nil); err == nil {
+		t.Error("Notify() of an unknown template did not fail")
+	}
+	if sent.to != "" {
+		t.Error("Notify() of an unknown template sent a message")
+	}
+}
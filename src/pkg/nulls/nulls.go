@@ -0,0 +1,67 @@
+package nulls
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Explicit converts a struct into a map keyed by json name where every empty
+// `omitempty` field is kept as an explicit null instead of being omitted, and every
+// empty field tagged `nulls:"empty"` is null instead of its zero value.
+// Slices are converted element by element, other values are returned as is.
+func Explicit(v interface{}) interface{} {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			items[i] = Explicit(value.Index(i).Interface())
+		}
+		return items
+	case reflect.Struct:
+		return explicitStruct(value)
+	}
+	return v
+}
+
+func explicitStruct(value reflect.Value) map[string]interface{} {
+	result := map[string]interface{}{}
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		omitEmpty := false
+		for _, option := range tag[1:] {
+			if option == "omitempty" {
+				omitEmpty = true
+			}
+		}
+
+		fieldValue := value.Field(i)
+		if (omitEmpty || field.Tag.Get("nulls") == "empty") && fieldValue.IsZero() {
+			result[name] = nil
+			continue
+		}
+		result[name] = fieldValue.Interface()
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package nulls
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go-rest-api/src/http"
+)
+
+func TestExplicitAgainstOmitted(t *testing.T) {
+	account := http.GetUser{ID: "usr_1", Username: "budi", FullName: "Budi Santoso", Email: "budi@example.com"}
+
+	decode := func(v interface{}) map[string]interface{} {
+		content, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		fields := map[string]interface{}{}
+		if err = json.Unmarshal(content, &fields); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		return fields
+	}
+	omitted, explicit := decode(account), decode(Explicit(account))
+
+	// the profile fields keep their empty string without nulls
+	for _, name := range []string{"display_name", "address", "employee_number", "job_position"} {
+		if value, ok := omitted[name]; !ok || value != "" {
+			t.Errorf("empty %s = %v, present %v without nulls, want an empty string", name, value, ok)
+		}
+		if value, ok := explicit[name]; !ok || value != nil {
+			t.Errorf("empty %s = %v, present %v, want an explicit null", name, value, ok)
+		}
+	}
+	for _, name := range []string{"password_changed_at", "avatar_variants"} {
+		if _, ok := omitted[name]; ok {
+			t.Errorf("empty %s is present without nulls", name)
+		}
+		if value, ok := explicit[name]; !ok || value != nil {
+			t.Errorf("empty %s = %v, present %v, want an explicit null", name, value, ok)
+		}
+	}
+	for _, name := range []string{"email", "username", "must_change_password"} {
+		if omitted[name] != explicit[name] {
+			t.Errorf("%s = %v with nulls, want %v as without", name, explicit[name], omitted[name])
+		}
+	}
+	if len(explicit) <= len(omitted) {
+		t.Errorf("nulls rendered %d fields, want more than the %d without", len(explicit), len(omitted))
+	}
+}
+
+func TestExplicitSlice(t *testing.T) {
+	items, ok := Explicit([]http.GetUser{{Username: "budi"}, {Username: "siti"}}).([]interface{})
+	if !ok || len(items) != 2 {
+		t.Fatalf("Explicit() of a slice = %#v, want two items", items)
+	}
+	if item := items[1].(map[string]interface{}); item["username"] != "siti" || item["email"] != nil {
+		t.Errorf("Explicit() item = %v, want siti with a null email", item)
+	}
+}
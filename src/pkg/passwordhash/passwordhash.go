@@ -0,0 +1,175 @@
+package passwordhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/bcrypt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMismatch         = errors.New("password does not match")
+)
+
+// Hasher is a password hashing algorithm, its hashes carry an identifier the hasher recognizes
+// so a stored hash is always verified with the algorithm that produced it.
+// Outdated reports a hash of the algorithm made with weaker parameters than the current ones
+type Hasher interface {
+	Hash(password string) (hash string, err error)
+	Compare(hash, password string) (err error)
+	Identifies(hash string) bool
+	Outdated(hash string) bool
+}
+
+var hashers = map[string]Hasher{
+	AlgorithmBcrypt: Bcrypt{Cost: constant.BcryptCost},
+	AlgorithmArgon2id: Argon2id{
+		Time:       3,
+		Memory:     64 * 1024,
+		Threads:    2,
+		SaltLength: 16,
+		KeyLength:  32,
+	},
+}
+
+func Supported(algorithm string) bool {
+	_, ok := hashers[algorithm]
+	return ok
+}
+
+// Hash hashes the password with the given algorithm
+func Hash(algorithm, password string) (hash string, err error) {
+	hasher, ok := hashers[algorithm]
+	if !ok {
+		return "", ErrUnknownAlgorithm
+	}
+	return hasher.Hash(password)
+}
+
+// Compare verifies the password with the algorithm identified by the hash. A value no algorithm identifies
+// is a legacy plaintext password, it only verifies while constant.PasswordLegacyPlaintext is set
+func Compare(hash, password string) (err error) {
+	for _, hasher := range hashers {
+		if hasher.Identifies(hash) {
+			return hasher.Compare(hash, password)
+		}
+	}
+	if constant.PasswordLegacyPlaintext && hash != "" {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(password)) != 1 {
+			return ErrMismatch
+		}
+		return nil
+	}
+	return ErrUnknownAlgorithm
+}
+
+// NeedsUpgrade reports whether the hash was produced by another algorithm than the given one,
+// by weaker parameters of it or is not a hash at all
+func NeedsUpgrade(algorithm, hash string) bool {
+	hasher, ok := hashers[algorithm]
+	return ok && (!hasher.Identifies(hash) || hasher.Outdated(hash))
+}
+
+// Bcrypt hashes with Cost, hashes of a lower cost keep verifying and are upgraded on login
+type Bcrypt struct {
+	Cost int
+}
+
+func (h Bcrypt) Hash(password string) (string, error) {
+	return bcrypt.HashPassword(password, h.Cost)
+}
+
+func (Bcrypt) Compare(hash, password string) error {
+	return bcrypt.ComparePassword(hash, password)
+}
+
+func (Bcrypt) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2")
+}
+
+func (h Bcrypt) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err == nil && cost < h.Cost
+}
+
+// Argon2id hashes are written in the PHC string format, $argon2id$v=19$m=65536,t=3,p=2$salt$key
+type Argon2id struct {
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+func (h Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Compare uses the parameters stored in the hash, hashes made with older parameters keep verifying
+func (h Argon2id) Compare(hash, password string) error {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return ErrUnknownAlgorithm
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return ErrUnknownAlgorithm
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return ErrUnknownAlgorithm
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return ErrUnknownAlgorithm
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return ErrUnknownAlgorithm
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+func (Argon2id) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h Argon2id) Outdated(hash string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	return memory < h.Memory || time < h.Time || threads < h.Threads
+}
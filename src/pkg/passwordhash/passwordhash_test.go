@@ -0,0 +1,48 @@
+package passwordhash
+
+import "testing"
+
+func TestCompareVerifiesWithTheAlgorithmOfTheHash(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmBcrypt, AlgorithmArgon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			hash, err := Hash(algorithm, "Str0ng!Passw0rd")
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+			if err = Compare(hash, "Str0ng!Passw0rd"); err != nil {
+				t.Errorf("Compare() of the password error = %v", err)
+			}
+			if err = Compare(hash, "wr0ng!Passw0rd"); err == nil {
+				t.Error("Compare() of another password did not fail")
+			}
+
+			// only a hash of another algorithm needs an upgrade
+			for _, preferred := range []string{AlgorithmBcrypt, AlgorithmArgon2id} {
+				if got := NeedsUpgrade(preferred, hash); got != (preferred != algorithm) {
+					t.Errorf("NeedsUpgrade(%s) of a %s hash = %v", preferred, algorithm, got)
+				}
+			}
+		})
+	}
+}
+
+func TestArgon2idOutdatedParameters(t *testing.T) {
+	weak := Argon2id{Time: 1, Memory: 8 * 1024, Threads: 1, SaltLength: 16, KeyLength: 32}
+	hash, err := weak.Hash("Str0ng!Passw0rd")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	// a hash of weaker parameters keeps verifying until it is upgraded
+	if err = Compare(hash, "Str0ng!Passw0rd"); err != nil {
+		t.Errorf("Compare() of a weaker hash error = %v", err)
+	}
+	if !NeedsUpgrade(AlgorithmArgon2id, hash) {
+		t.Error("NeedsUpgrade() of a weaker argon2id hash = false")
+	}
+}
+
+func TestHashUnknownAlgorithm(t *testing.T) {
+	if _, err := Hash("md5", "Str0ng!Passw0rd"); err != ErrUnknownAlgorithm {
+		t.Errorf("Hash() error = %v, want %v", err, ErrUnknownAlgorithm)
+	}
+}
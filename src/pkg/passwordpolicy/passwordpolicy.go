@@ -0,0 +1,168 @@
+package passwordpolicy
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// rule codes reported for a password that does not meet the policy
+const (
+	RuleMinLength = "min_length"
+	RuleUppercase = "uppercase"
+	RuleLowercase = "lowercase"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+)
+
+type Policy struct {
+	MinLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+}
+
+// Unmet returns the codes of the rules the password does not meet, in the order they are declared
+func (policy Policy) Unmet(password string) (rules []string) {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	rules = []string{}
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		rules = append(rules, RuleMinLength)
+	}
+	if policy.RequireUppercase && !upper {
+		rules = append(rules, RuleUppercase)
+	}
+	if policy.RequireLowercase && !lower {
+		rules = append(rules, RuleLowercase)
+	}
+	if policy.RequireDigit && !digit {
+		rules = append(rules, RuleDigit)
+	}
+	if policy.RequireSymbol && !symbol {
+		rules = append(rules, RuleSymbol)
+	}
+	return
+}
+
+// generated passwords leave out characters that are easily mistaken for each other like 0 and O or l and 1
+const (
+	upperChars  = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	lowerChars  = "abcdefghijkmnopqrstuvwxyz"
+	digitChars  = "23456789"
+	symbolChars = "!#$%&*+-=?@^_"
+)
+
+// Generate returns a random password of length, at least MinLength, with one character of every required class
+func (policy Policy) Generate(length int) (password string, err error) {
+	if length < policy.MinLength {
+		length = policy.MinLength
+	}
+	all := upperChars + lowerChars + digitChars + symbolChars
+	classes := []string{}
+	for _, class := range []struct {
+		required bool
+		chars    string
+	}{
+		{policy.RequireUppercase, upperChars},
+		{policy.RequireLowercase, lowerChars},
+		{policy.RequireDigit, digitChars},
+		{policy.RequireSymbol, symbolChars},
+	} {
+		if class.required {
+			classes = append(classes, class.chars)
+		}
+	}
+	if length < len(classes) {
+		length = len(classes)
+	}
+
+	chars := make([]byte, length)
+	for i := range chars {
+		set := all
+		if i < len(classes) {
+			set = classes[i]
+		}
+		if chars[i], err = randomChar(set); err != nil {
+			return
+		}
+	}
+	// the required characters would otherwise always lead
+	for i := len(chars) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return "", err
+		}
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	return string(chars), nil
+}
+
+func randomChar(set string) (char byte, err error) {
+	i, err := randomInt(len(set))
+	if err != nil {
+		return
+	}
+	return set[i], nil
+}
+
+func randomInt(n int) (int, error) {
+	value, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(value.Int64()), nil
+}
+
+// Tag is the validate tag failing a password that does not meet every rule of the registered policy
+const Tag = "password"
+
+// Register adds the password tag to the validator, a zero policy accepts every password
+func Register(validate *validator.Validate, policy Policy) error {
+	return validate.RegisterValidation(Tag, func(fl validator.FieldLevel) bool {
+		return len(policy.Unmet(fl.Field().String())) == 0
+	})
+}
+
+// Detail maps validation errors to field and tag like rest.ResponseError, a field failing the password tag
+// gets the codes of its unmet rules joined with commas instead. Other errors are returned as they are
+func (policy Policy) Detail(err error) interface{} {
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	detail := map[string]string{}
+	for _, fieldErr := range validationErrors {
+		field := strings.ToLower(fieldErr.Field())
+		detail[field] = fieldErr.Tag()
+		if fieldErr.Tag() != Tag {
+			continue
+		}
+		password, _ := fieldErr.Value().(string)
+		if pointer, ok := fieldErr.Value().(*string); ok && pointer != nil {
+			password = *pointer
+		}
+		if unmet := policy.Unmet(password); len(unmet) > 0 {
+			detail[field] = strings.Join(unmet, ",")
+		}
+	}
+	return detail
+}
@@ -0,0 +1,75 @@
+package permission
+
+import (
+	"sort"
+
+	"go-rest-api/src/constant"
+)
+
+const (
+	ReadAccount      = "accounts.read"
+	UpdateAccount    = "accounts.update"
+	DeleteAccount    = "accounts.delete"
+	ImportAccounts   = "accounts.import"
+	ExportAccounts   = "accounts.export"
+	ReadAccountPII   = "accounts.pii.read"
+	VerifyAccounts   = "accounts.verification.send"
+	ReadFailedLogins = "security.failed_logins.read"
+	ReadAuditTrail   = "audit.read"
+	ReadAttendance   = "attendance.read"
+	CreateAttendance = "attendance.create"
+	ReadLocations    = "locations.read"
+	ManageLocations  = "locations.manage"
+)
+
+// parents makes a role inherit every permission of its parent role
+var parents = map[string]string{
+	constant.RoleAdmin: constant.RoleUser,
+}
+
+var rolePermissions = map[string][]string{
+	constant.RoleUser: {
+		ReadAccount,
+		UpdateAccount,
+		DeleteAccount,
+		ReadAttendance,
+		CreateAttendance,
+		ReadLocations,
+	},
+	// ReadAccountPII is only granted individually
+	constant.RoleAdmin: {
+		ImportAccounts,
+		ExportAccounts,
+		VerifyAccounts,
+		ReadFailedLogins,
+		ReadAuditTrail,
+		ManageLocations,
+	},
+}
+
+// Resolve returns the sorted permissions of the role, its parent roles and the individual grants
+func Resolve(role string, individual []string) (permissions []string) {
+	resolved := map[string]bool{}
+	for current, seen := role, map[string]bool{}; current != "" && !seen[current]; current = parents[current] {
+		seen[current] = true
+		for _, permission := range rolePermissions[current] {
+			resolved[permission] = true
+		}
+	}
+	for _, permission := range individual {
+		resolved[permission] = true
+	}
+
+	permissions = make([]string, 0, len(resolved))
+	for permission := range resolved {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return
+}
+
+// Has reports whether the permission is in the sorted permissions returned by Resolve
+func Has(permissions []string, permission string) bool {
+	i := sort.SearchStrings(permissions, permission)
+	return i < len(permissions) && permissions[i] == permission
+}
@@ -0,0 +1,59 @@
+package phone
+
+import (
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Tag is the validate tag failing a phone number Normalize cannot read
+const Tag = "phone"
+
+const (
+	countryCode = "+62"
+	// subscriber numbers after the country code are a mobile prefix 8 and 8 to 11 more digits
+	minSubscriberLength = 9
+	maxSubscriberLength = 12
+)
+
+// Normalize returns the +62 form of an Indonesian mobile number written as 08.., 628.. or +628..,
+// spaces, dashes, dots and parentheses are ignored. ok is false for anything else
+func Normalize(number string) (canonical string, ok bool) {
+	number = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, number)
+
+	var subscriber string
+	switch {
+	case strings.HasPrefix(number, "+62"):
+		subscriber = number[3:]
+	case strings.HasPrefix(number, "62"):
+		subscriber = number[2:]
+	case strings.HasPrefix(number, "0"):
+		subscriber = number[1:]
+	default:
+		return "", false
+	}
+
+	if len(subscriber) < minSubscriberLength || len(subscriber) > maxSubscriberLength || subscriber[0] != '8' {
+		return "", false
+	}
+	for _, r := range subscriber {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	return countryCode + subscriber, true
+}
+
+// Register adds the phone tag to the validator, it must run before any struct using the tag is validated
+func Register(validate *validator.Validate) error {
+	return validate.RegisterValidation(Tag, func(fl validator.FieldLevel) bool {
+		_, ok := Normalize(fl.Field().String())
+		return ok
+	})
+}
@@ -0,0 +1,47 @@
+package publicid
+
+import (
+	"strings"
+
+	"github.com/forkyid/go-utils/v1/aes"
+	"go-rest-api/src/constant"
+)
+
+// separator never occurs in an encrypted id, the hashids alphabet is alphanumeric
+const separator = "_"
+
+// Encode encrypts the account id and prefixes it with the AccountIDPrefix environment tag, if any
+func Encode(accountID int) string {
+	if constant.AccountIDPrefix == "" {
+		return aes.Encrypt(accountID)
+	}
+	return constant.AccountIDPrefix + separator + aes.Encrypt(accountID)
+}
+
+// Decode fails with constant.ErrForeignAccountID for an id carrying another environment tag,
+// or no tag while AccountIDPrefix is set, and with constant.ErrInvalidID for an id that does not decrypt
+func Decode(publicID string) (accountID int, err error) {
+	prefix, encrypted := "", publicID
+	if i := strings.Index(publicID, separator); i >= 0 {
+		prefix, encrypted = publicID[:i], publicID[i+len(separator):]
+	}
+	if prefix != constant.AccountIDPrefix {
+		return -1, constant.ErrForeignAccountID
+	}
+
+	accountID = aes.Decrypt(encrypted)
+	if accountID <= 0 {
+		return -1, constant.ErrInvalidID
+	}
+	return accountID, nil
+}
+
+// ValidPrefix accepts an empty prefix or letters and digits, a separator in the prefix would break Decode
+func ValidPrefix(prefix string) bool {
+	for _, r := range prefix {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package publicid
+
+import (
+	"strings"
+	"testing"
+
+	"go-rest-api/src/constant"
+)
+
+// usePrefix configures the environment tag for the test
+func usePrefix(t *testing.T, prefix string) {
+	t.Helper()
+	defaultPrefix := constant.AccountIDPrefix
+	constant.AccountIDPrefix = prefix
+	t.Cleanup(func() { constant.AccountIDPrefix = defaultPrefix })
+}
+
+func TestDecodeRejectsAnotherEnvironment(t *testing.T) {
+	usePrefix(t, "stg")
+	staging := Encode(7)
+	if !strings.HasPrefix(staging, "stg_") {
+		t.Fatalf("Encode() in staging = %q, want the stg_ prefix", staging)
+	}
+
+	usePrefix(t, "prd")
+	production := Encode(7)
+	unprefixed := strings.TrimPrefix(production, "prd_")
+	tests := []struct {
+		name     string
+		publicID string
+		want     int
+		wantErr  error
+	}{
+		{"production id", production, 7, nil},
+		{"staging id", staging, -1, constant.ErrForeignAccountID},
+		{"id without a prefix", unprefixed, -1, constant.ErrForeignAccountID},
+		{"prefixed garbage", "prd_not-an-id", -1, constant.ErrInvalidID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accountID, err := Decode(tt.publicID)
+			if accountID != tt.want || err != tt.wantErr {
+				t.Errorf("Decode(%q) = %d, %v, want %d, %v", tt.publicID, accountID, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidPrefix(t *testing.T) {
+	for prefix, want := range map[string]bool{"": true, "prd": true, "stg2": true, "stg_": false, "st-g": false} {
+		if got := ValidPrefix(prefix); got != want {
+			t.Errorf("ValidPrefix(%q) = %v, want %v", prefix, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package retry
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/metrics"
+)
+
+// postgres error codes of a statement that was rolled back and can run again as is
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+	cannotConnectNow     = "57P03"
+)
+
+// Policy retries an operation failing with a retriable error, the delay doubles from BaseDelay up to MaxDelay.
+// MaxAttempts counts the first run, 1 or less runs the operation once. Retries are logged with Logger
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Logger      *logger.Logger
+}
+
+// Do runs fn until it succeeds, fails with an error retriable rejects, ran MaxAttempts times or ctx is done.
+// Every retry is logged and counted under operation, the error of the last run is returned
+func (policy Policy) Do(ctx context.Context, operation string, retriable func(err error) bool, fn func() error) (err error) {
+	delay := policy.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= policy.MaxAttempts || !retriable(err) || ctx.Err() != nil {
+			return
+		}
+
+		metrics.DBRetry(operation)
+		policy.Logger.Warn("retry", "operation", operation, "attempt", attempt, "error", err)
+		// half of the delay is random so instances failing together do not retry together
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if delay *= 2; delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
+
+// Transient reports whether a read may succeed when run again: a deadlock, a serialization failure,
+// a server shutting down or not accepting connections yet, and a connection that broke or was refused.
+// Logical errors like a unique violation or gorm.ErrRecordNotFound and context errors are not transient
+func Transient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if RolledBack(err) {
+		return true
+	}
+
+	pgErr := &pgconn.PgError{}
+	if errors.As(err, &pgErr) {
+		// class 08 is connection exception, 57P01 and 57P02 are the server shutting down
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01" || pgErr.Code == "57P02"
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// RolledBack reports whether a write failed without taking effect so running it again cannot apply it twice,
+// a connection that broke while a commit was under way is left to the caller
+func RolledBack(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	pgErr := &pgconn.PgError{}
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected || pgErr.Code == cannotConnectNow
+	}
+	// database/sql and pgconn only report these when nothing was sent to the server
+	return errors.Is(err, driver.ErrBadConn) || pgconn.SafeToRetry(err)
+}
@@ -0,0 +1,58 @@
+package semaphore
+
+import (
+	"sync"
+)
+
+// Rule caps the concurrent holders of Key, a non positive limit is ignored
+type Rule struct {
+	Key   string
+	Limit int
+}
+
+// Keyed is an in-memory counting semaphore per key, keys are dropped once nothing holds them
+type Keyed struct {
+	mu   sync.Mutex
+	held map[string]int
+}
+
+func NewKeyed() *Keyed {
+	return &Keyed{
+		held: map[string]int{},
+	}
+}
+
+// TryAcquire takes a slot of every rule only when none of them is full, it never waits.
+// release gives the slots back and must be called exactly once when ok.
+func (k *Keyed) TryAcquire(rules ...Rule) (release func(), ok bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, rule := range rules {
+		if rule.Limit > 0 && k.held[rule.Key] >= rule.Limit {
+			return nil, false
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.Limit > 0 {
+			k.held[rule.Key]++
+		}
+	}
+	return func() { k.release(rules) }, true
+}
+
+func (k *Keyed) release(rules []Rule) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, rule := range rules {
+		if rule.Limit <= 0 {
+			continue
+		}
+		k.held[rule.Key]--
+		if k.held[rule.Key] <= 0 {
+			delete(k.held, rule.Key)
+		}
+	}
+}
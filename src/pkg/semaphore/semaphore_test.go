@@ -0,0 +1,58 @@
+package semaphore
+
+import "testing"
+
+func TestTryAcquire(t *testing.T) {
+	keyed := NewKeyed()
+	rules := []Rule{{Key: "verify", Limit: 3}}
+
+	releases := []func(){}
+	for i := 0; i < 3; i++ {
+		release, ok := keyed.TryAcquire(rules...)
+		if !ok {
+			t.Fatalf("TryAcquire() %d of 3 was throttled", i+1)
+		}
+		releases = append(releases, release)
+	}
+	if _, ok := keyed.TryAcquire(rules...); ok {
+		t.Fatal("TryAcquire() past the limit was not throttled")
+	}
+
+	releases[0]()
+	release, ok := keyed.TryAcquire(rules...)
+	if !ok {
+		t.Fatal("TryAcquire() after a release was throttled")
+	}
+	release()
+	for _, release := range releases[1:] {
+		release()
+	}
+	if len(keyed.held) != 0 {
+		t.Errorf("held = %v after every release, want no keys", keyed.held)
+	}
+}
+
+func TestTryAcquireTakesEveryRuleOrNone(t *testing.T) {
+	keyed := NewKeyed()
+	release, ok := keyed.TryAcquire(Rule{Key: "verify:ip:10.0.0.1", Limit: 1})
+	if !ok {
+		t.Fatal("TryAcquire() of a free key was throttled")
+	}
+	defer release()
+
+	// the full ip rejects the request, the identifier slot must not stay taken
+	_, ok = keyed.TryAcquire(Rule{Key: "verify:identifier:budi", Limit: 1}, Rule{Key: "verify:ip:10.0.0.1", Limit: 1})
+	if ok {
+		t.Fatal("TryAcquire() with a full rule was not throttled")
+	}
+	if keyed.held["verify:identifier:budi"] != 0 {
+		t.Error("TryAcquire() kept the slot of a rule while rejecting the request")
+	}
+
+	// another ip and a rule without a limit are not affected
+	other, ok := keyed.TryAcquire(Rule{Key: "verify:ip:10.0.0.2", Limit: 1}, Rule{Key: "verify", Limit: 0})
+	if !ok {
+		t.Fatal("TryAcquire() of another key was throttled")
+	}
+	other()
+}
@@ -0,0 +1,81 @@
+package slidingwindow
+
+import (
+	"sync"
+	"time"
+)
+
+type Rule struct {
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+// Limiter is an in-memory sliding window log, keys are dropped once their window is empty
+type Limiter struct {
+	mu   sync.Mutex
+	hits map[string][]time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		hits: map[string][]time.Time{},
+	}
+}
+
+// Allow records a hit for every rule only when none of them is exhausted.
+// Rules with a non positive limit are ignored.
+func (l *Limiter) Allow(rules ...Rule) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, rule := range rules {
+		if rule.Limit <= 0 {
+			continue
+		}
+		if len(l.prune(rule.Key, rule.Window, now)) >= rule.Limit {
+			return false
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.Limit <= 0 {
+			continue
+		}
+		l.hits[rule.Key] = append(l.hits[rule.Key], now)
+	}
+	return true
+}
+
+// Reserve is Allow for a single rule, an exhausted rule also reports when its oldest hit leaves the window
+func (l *Limiter) Reserve(rule Rule) (allowed bool, retryAfter time.Duration) {
+	if rule.Limit <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	hits := l.prune(rule.Key, rule.Window, now)
+	if len(hits) >= rule.Limit {
+		return false, rule.Window - now.Sub(hits[len(hits)-rule.Limit])
+	}
+	l.hits[rule.Key] = append(l.hits[rule.Key], now)
+	return true, 0
+}
+
+func (l *Limiter) prune(key string, window time.Duration, now time.Time) []time.Time {
+	hits := l.hits[key]
+	i := 0
+	for i < len(hits) && now.Sub(hits[i]) >= window {
+		i++
+	}
+	hits = hits[i:]
+	if len(hits) == 0 {
+		delete(l.hits, key)
+		return nil
+	}
+	l.hits[key] = hits
+	return hits
+}
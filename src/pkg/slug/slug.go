@@ -0,0 +1,83 @@
+package slug
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fallback is used when nothing of the source survives slugging, e.g. a name in a non latin script
+const Fallback = "user"
+
+// letters without a unicode decomposition to ascii
+var replacements = map[rune]string{
+	'ß': "ss",
+	'æ': "ae",
+	'ø': "o",
+	'œ': "oe",
+	'đ': "d",
+	'ł': "l",
+	'þ': "th",
+	'ð': "d",
+	'ı': "i",
+}
+
+// Make lowercases the source, strips diacritics and joins the remaining ascii letters and digits
+// with single dashes, the result is at most maxLength bytes
+func Make(source string, maxLength int) string {
+	builder := strings.Builder{}
+	dash := false
+	for _, r := range norm.NFKD.String(strings.ToLower(source)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if replacement, ok := replacements[r]; ok {
+			builder.WriteString(replacement)
+			dash = false
+			continue
+		}
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && builder.Len() > 0 {
+			builder.WriteByte('-')
+			dash = true
+		}
+	}
+
+	slug := strings.Trim(builder.String(), "-")
+	if len(slug) > maxLength {
+		slug = strings.TrimRight(slug[:maxLength], "-")
+	}
+	if slug == "" {
+		slug = Fallback
+	}
+	return slug
+}
+
+// Unique returns base when it is free, otherwise base-2, base-3 and so on, the first free suffix wins.
+// The suffixed slug is shortened so it still fits maxLength.
+func Unique(base string, maxLength int, taken map[string]bool) string {
+	if !taken[base] {
+		return base
+	}
+	for n := 2; ; n++ {
+		suffix := fmt.Sprintf("-%d", n)
+		prefix := base
+		if len(prefix)+len(suffix) > maxLength {
+			prefix = strings.TrimRight(prefix[:maxLength-len(suffix)], "-")
+		}
+		if !taken[prefix+suffix] {
+			return prefix + suffix
+		}
+	}
+}
+
+// Valid reports whether the slug is already in the form Make produces
+func Valid(slug string, minLength, maxLength int) bool {
+	return len(slug) >= minLength && len(slug) <= maxLength && Make(slug, maxLength) == slug
+}
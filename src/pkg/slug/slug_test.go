@@ -0,0 +1,74 @@
+package slug
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"John Doe", "john-doe"},
+		{"  John   Doe!! ", "john-doe"},
+		{"José Müller", "jose-muller"},
+		{"Ærøskøbing Straße", "aeroskobing-strasse"},
+		{"Łukasz Żółć", "lukasz-zolc"},
+		{"Nguyễn Văn Đức", "nguyen-van-duc"},
+		{"ｆｕｌｌ ｗｉｄｔｈ 123", "full-width-123"},
+		{"山田太郎", Fallback},
+		{"", Fallback},
+	}
+	for _, tt := range tests {
+		if got := Make(tt.source, 30); got != tt.want {
+			t.Errorf("Make(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+
+	// the cut never leaves a trailing dash
+	if got := Make("a very long display name", 12); got != "a-very-long" {
+		t.Errorf("Make() past the max length = %q, want %q", got, "a-very-long")
+	}
+}
+
+func TestUnique(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  string
+		taken []string
+		want  string
+	}{
+		{"free", "john-doe", nil, "john-doe"},
+		{"taken", "john-doe", []string{"john-doe"}, "john-doe-2"},
+		{"first free suffix", "john-doe", []string{"john-doe", "john-doe-2", "john-doe-4"}, "john-doe-3"},
+		{"suffix fits the max length", "johnathan-do", []string{"johnathan-do"}, "johnathan-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taken := map[string]bool{}
+			for _, slug := range tt.taken {
+				taken[slug] = true
+			}
+			if got := Unique(tt.base, 12, taken); got != tt.want {
+				t.Errorf("Unique(%q) = %q, want %q", tt.base, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		slug string
+		want bool
+	}{
+		{"john-doe", true},
+		{"John-Doe", false},
+		{"john--doe", false},
+		{"-john", false},
+		{"jo", false},
+		{"john-doe-the-third", false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.slug, 3, 12); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.slug, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+type Storage interface {
+	Put(key, contentType string, data []byte) (url string, err error)
+}
+
+// New returns the storage named by constant.StorageDriver, ok is false for an unknown name.
+// Objects are served at baseURL, the directory of the local storage or the public url of the bucket
+func New(name, localDir, baseURL string, config S3Config) (storage Storage, ok bool) {
+	switch name {
+	case DriverLocal:
+		return NewLocalStorage(localDir, baseURL), true
+	case DriverS3:
+		return NewS3Storage(config, baseURL), true
+	}
+	return nil, false
+}
+
+// LocalStorage writes objects under a directory served at baseURL, meant for local development
+type LocalStorage struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocalStorage(dir, baseURL string) *LocalStorage {
+	return &LocalStorage{
+		dir:     dir,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+func (s *LocalStorage) Put(key, contentType string, data []byte) (url string, err error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return
+	}
+
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return
+	}
+
+	url = fmt.Sprintf("%s/%s", s.baseURL, key)
+	return
+}
+
+// S3Config is read from the S3_* env, Endpoint is the scheme and host of any S3 compatible service
+// e.g. https://s3.ap-southeast-1.amazonaws.com or http://localhost:9000 for minio
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Timeout         time.Duration
+}
+
+// S3Storage puts objects with a signature v4 request to the path style url of the bucket,
+// reading them is left to baseURL e.g. a CDN in front of the bucket
+type S3Storage struct {
+	config  S3Config
+	baseURL string
+	client  *http.Client
+}
+
+func NewS3Storage(config S3Config, baseURL string) *S3Storage {
+	return &S3Storage{
+		config:  config,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: config.Timeout},
+	}
+}
+
+func (s *S3Storage) Put(key, contentType string, data []byte) (objectURL string, err error) {
+	endpoint, err := url.Parse(strings.TrimRight(s.config.Endpoint, "/"))
+	if err != nil {
+		return
+	}
+	endpoint.Path = "/" + s.config.Bucket + "/" + key
+
+	request, err := http.NewRequest(http.MethodPut, endpoint.String(), bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", contentType)
+	s.sign(request, data, time.Now().UTC())
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		return "", fmt.Errorf("put object: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	objectURL = fmt.Sprintf("%s/%s", s.baseURL, key)
+	return
+}
+
+// sign adds the AWS signature version 4 headers, the payload is hashed so S3 verifies the upload
+func (s *S3Storage) sign(request *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		"content-type:" + request.Header.Get("Content-Type"),
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,36 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Generate returns a random url-safe token and the hash that should be stored instead of it
+func Generate() (plain, hashed string, err error) {
+	bytes := make([]byte, 32)
+	_, err = rand.Read(bytes)
+	if err != nil {
+		return
+	}
+	plain = hex.EncodeToString(bytes)
+	hashed = Hash(plain)
+	return
+}
+
+// Hash returns the hex encoded sha256 of a token
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// Derive returns the token the secret derives from the seed and its hash, storing the seed
+// allows sending the same token again without storing the token itself
+func Derive(secret []byte, seed string) (plain, hashed string) {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(seed))
+	plain = hex.EncodeToString(mac.Sum(nil))
+	hashed = Hash(plain)
+	return
+}
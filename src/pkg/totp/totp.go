@@ -0,0 +1,85 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// codes are the RFC 6238 defaults every authenticator app supports
+const (
+	Digits     = 6
+	Period     = 30 * time.Second
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random 160 bit secret in the unpadded base32 authenticator apps expect
+func GenerateSecret() (secret string, err error) {
+	raw := make([]byte, secretSize)
+	if _, err = rand.Read(raw); err != nil {
+		return
+	}
+	return encoding.EncodeToString(raw), nil
+}
+
+// URI is the otpauth uri apps import from a QR code, the label is issuer:account
+func URI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Step is the time step at now, codes of the same step are equal
+func Step(now time.Time) int64 {
+	return now.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code of the step, ok is false for a secret that is not base32
+func Code(secret string, step int64) (code string, ok bool) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", false
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000), true
+}
+
+// Verify returns the step the code belongs to, the steps within skew before and after now are accepted
+// so a clock a little off still logs in. ok is false for a wrong code
+func Verify(secret, code string, now time.Time, skew int64) (step int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(now)
+	for step = current - skew; step <= current+skew; step++ {
+		expected, valid := Code(secret, step)
+		if !valid {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,90 @@
+package transform
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Func normalizes a single field value
+type Func func(value string) string
+
+// Builtin are the transformers a pipeline can name
+var Builtin = map[string]Func{
+	"trim":            strings.TrimSpace,
+	"lowercase":       strings.ToLower,
+	"uppercase":       strings.ToUpper,
+	"collapse_spaces": func(value string) string { return strings.Join(strings.Fields(value), " ") },
+	"strip_emoji":     stripEmoji,
+}
+
+// Pipelines holds the ordered transformers of every configured field, keyed by json field name
+type Pipelines map[string][]Func
+
+// Parse reads specs like display_name=trim|strip_emoji, the transformers run in the given order
+func Parse(specs []string) (pipelines Pipelines, err error) {
+	pipelines = Pipelines{}
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid pipeline %q, use field=transformer|transformer", spec)
+		}
+		field := strings.TrimSpace(parts[0])
+		for _, name := range strings.Split(parts[1], "|") {
+			fn, ok := Builtin[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown transformer %q for %s", name, field)
+			}
+			pipelines[field] = append(pipelines[field], fn)
+		}
+	}
+	return
+}
+
+// Apply runs the pipelines on the string and *string fields of the struct request points to,
+// nil pointers are left alone and set pointers are replaced rather than written through
+func (pipelines Pipelines) Apply(request interface{}) {
+	if len(pipelines) == 0 {
+		return
+	}
+	value := reflect.ValueOf(request)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return
+	}
+	value = value.Elem()
+
+	for i := 0; i < value.NumField(); i++ {
+		name := strings.SplitN(value.Type().Field(i).Tag.Get("json"), ",", 2)[0]
+		fns, ok := pipelines[name]
+		if !ok {
+			continue
+		}
+
+		field := value.Field(i)
+		switch {
+		case field.Kind() == reflect.String:
+			field.SetString(run(fns, field.String()))
+		case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.String && !field.IsNil():
+			transformed := run(fns, field.Elem().String())
+			field.Set(reflect.ValueOf(&transformed))
+		}
+	}
+}
+
+func run(fns []Func, value string) string {
+	for _, fn := range fns {
+		value = fn(value)
+	}
+	return value
+}
+
+// stripEmoji drops pictographs and the joiners, variation selectors and skin tones composing them
+func stripEmoji(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.So, r) || r == '\u200d' || r == '\ufe0f' || (r >= 0x1f3fb && r <= 0x1f3ff) {
+			return -1
+		}
+		return r
+	}, value)
+}
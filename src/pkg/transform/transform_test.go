@@ -0,0 +1,66 @@
+package transform
+
+import "testing"
+
+type profile struct {
+	Username    string  `json:"username"`
+	Email       *string `json:"email,omitempty"`
+	PhoneNumber *string `json:"phone_number"`
+	FullName    string  `json:"fullname"`
+}
+
+func TestTrimThenLowercase(t *testing.T) {
+	pipelines, err := Parse([]string{"username=trim|lowercase", "email=trim|lowercase"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	email := "  Budi@Example.COM "
+	request := profile{Username: "  BudiSantoso\t", Email: &email, FullName: "  Budi Santoso "}
+	pipelines.Apply(&request)
+
+	if request.Username != "budisantoso" {
+		t.Errorf("username = %q, want %q", request.Username, "budisantoso")
+	}
+	if request.Email == nil || *request.Email != "budi@example.com" {
+		t.Errorf("email = %v, want %q", request.Email, "budi@example.com")
+	}
+	// the pointer is replaced, the value the caller passed in is untouched
+	if email != "  Budi@Example.COM " {
+		t.Errorf("the caller's email was written through to %q", email)
+	}
+	if request.PhoneNumber != nil || request.FullName != "  Budi Santoso " {
+		t.Errorf("fields without a pipeline changed to %+v", request)
+	}
+}
+
+func TestPipelineOrder(t *testing.T) {
+	// stripping the emoji after trimming leaves the space it was separated by
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"fullname=trim|strip_emoji", "Budi "},
+		{"fullname=strip_emoji|trim", "Budi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			pipelines, err := Parse([]string{tt.spec})
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			request := profile{FullName: " Budi 🎉"}
+			pipelines.Apply(&request)
+			if request.FullName != tt.want {
+				t.Errorf("fullname = %q, want %q", request.FullName, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"username", "=trim", "username=trim|shout"} {
+		if _, err := Parse([]string{spec}); err == nil {
+			t.Errorf("Parse(%q) did not fail", spec)
+		}
+	}
+}
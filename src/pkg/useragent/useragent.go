@@ -0,0 +1,47 @@
+package useragent
+
+import "strings"
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// tablets are checked before mobiles, android tablets lack the "mobile" token
+var (
+	botTokens     = []string{"bot", "crawler", "spider", "curl", "wget", "python-requests", "go-http-client"}
+	tabletTokens  = []string{"ipad", "tablet", "kindle", "silk", "playbook"}
+	mobileTokens  = []string{"mobi", "iphone", "ipod", "windows phone", "blackberry", "opera mini"}
+	desktopTokens = []string{"windows nt", "macintosh", "mac os x", "x11", "linux", "cros"}
+)
+
+// DeviceType guesses the kind of device from the user agent
+func DeviceType(userAgent string) string {
+	userAgent = strings.ToLower(userAgent)
+	switch {
+	case userAgent == "":
+		return DeviceUnknown
+	case containsAny(userAgent, botTokens):
+		return DeviceBot
+	case containsAny(userAgent, tabletTokens),
+		strings.Contains(userAgent, "android") && !strings.Contains(userAgent, "mobile"):
+		return DeviceTablet
+	case containsAny(userAgent, mobileTokens), strings.Contains(userAgent, "android"):
+		return DeviceMobile
+	case containsAny(userAgent, desktopTokens):
+		return DeviceDesktop
+	}
+	return DeviceUnknown
+}
+
+func containsAny(value string, tokens []string) bool {
+	for _, token := range tokens {
+		if strings.Contains(value, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go-rest-api/src/pkg/logger"
+)
+
+const (
+	EventHeader     = "X-Webhook-Event"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+var (
+	ErrInvalidURL     = errors.New("webhook url must be an absolute https url")
+	ErrInternalTarget = errors.New("webhook url must not point to a private or internal address")
+)
+
+// Sign returns the signature receivers recompute to authenticate a delivery,
+// it covers the timestamp so a captured delivery cannot be replayed later with a new one
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateURL rejects urls that are not https or whose host resolves to a non public address.
+// Delivery checks the address again when connecting, so a host re-resolving to an internal address is refused too.
+func ValidateURL(raw string) (err error) {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" || parsed.User != nil {
+		return ErrInvalidURL
+	}
+
+	ips, err := net.LookupIP(parsed.Hostname())
+	if err != nil || len(ips) == 0 {
+		return ErrInvalidURL
+	}
+	for _, ip := range ips {
+		if !public(ip) {
+			return ErrInternalTarget
+		}
+	}
+	return nil
+}
+
+// privateBlocks are the private, shared and reserved ranges net.IP has no helper for
+var privateBlocks = parseCIDRs("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+func parseCIDRs(cidrs ...string) (blocks []*net.IPNet) {
+	for _, cidr := range cidrs {
+		_, block, _ := net.ParseCIDR(cidr)
+		blocks = append(blocks, block)
+	}
+	return
+}
+
+func public(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, block := range privateBlocks {
+		if block.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Delivery is one signed POST of an event to an endpoint
+type Delivery struct {
+	URL    string
+	Secret string
+	Event  string
+	Body   []byte
+}
+
+// Dispatcher queues deliveries for the background or delivers them in the caller's goroutine
+type Dispatcher interface {
+	Enqueue(delivery Delivery) bool
+	Deliver(delivery Delivery) (err error)
+}
+
+// Sender delivers in the background on a fixed number of workers, only to public addresses
+type Sender struct {
+	deliveries chan Delivery
+	client     *http.Client
+	attempts   int
+	logger     *logger.Logger
+}
+
+func NewSender(workers, queueSize, attempts int, timeout time.Duration, appLogger *logger.Logger) *Sender {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return ErrInternalTarget
+			}
+			return nil
+		},
+	}
+	sender := &Sender{
+		deliveries: make(chan Delivery, queueSize),
+		logger:     appLogger,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return dialer.DialContext(ctx, network, address)
+				},
+			},
+			// a redirect could lead to an internal address the url check never saw
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		attempts: attempts,
+	}
+	for i := 0; i < workers; i++ {
+		go sender.work()
+	}
+	return sender
+}
+
+// Enqueue queues a delivery, it returns false when the queue is full
+func (sender *Sender) Enqueue(delivery Delivery) bool {
+	select {
+	case sender.deliveries <- delivery:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sender *Sender) work() {
+	for delivery := range sender.deliveries {
+		err := sender.Deliver(delivery)
+		if err != nil {
+			sender.logger.Error("deliver webhook failed", "event", delivery.Event, "error", err)
+		}
+	}
+}
+
+// Deliver sends the delivery in the caller's goroutine, retrying up to the sender's attempts.
+// A nil error means the endpoint acknowledged it with a 2xx.
+func (sender *Sender) Deliver(delivery Delivery) (err error) {
+	for attempt := 1; attempt <= sender.attempts; attempt++ {
+		err = sender.send(delivery)
+		if err == nil {
+			return
+		}
+		if attempt < sender.attempts {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+	return
+}
+
+func (sender *Sender) send(delivery Delivery) (err error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Body))
+
+	response, err := sender.client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		err = fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	return
+}
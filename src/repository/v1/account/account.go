@@ -1,9 +1,20 @@
 package account
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
 	"go-rest-api/src/connection"
 	"go-rest-api/src/constant"
 	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/checksum"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/metrics"
+	"go-rest-api/src/pkg/pagination"
+	"go-rest-api/src/pkg/retry"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -14,39 +25,190 @@ type DB struct {
 
 type Repository struct {
 	dbMaster *gorm.DB
+	// inTransaction is set on the repository Transaction hands to fn, its writes join that transaction
+	inTransaction bool
+	// ctx is set by WithContext, it ends the statements and the retries of the repository
+	ctx    context.Context
+	logger *logger.Logger
 }
 
 func NewRepository(
 	db connection.DB,
+	appLogger *logger.Logger,
 ) *Repository {
 	return &Repository{
 		dbMaster: db.Master,
+		logger:   appLogger,
 	}
 }
 
 type Repositorier interface {
+	WithContext(ctx context.Context) Repositorier
+	Transaction(fn func(repo Repositorier) error) (err error)
 	TakeAccountByID(accountID int) (account model.Account, err error)
 	TakeAccountByEmail(email string) (account model.Account, err error)
+	TakeAccountByCanonicalEmail(canonicalEmail string) (account model.Account, err error)
 	TakeAccountByKTPNumber(ktpNumber string) (account model.Account, err error)
 	TakeAccountByPhoneNumber(phoneNumber string) (account model.Account, err error)
 	TakeAccountByUsername(username string) (account model.Account, err error)
+	TakeAccountByDisplayName(displayName string) (account model.Account, err error)
+	TakeAccountByHandle(handle string) (account model.Account, err error)
+	FindHandlesWithPrefix(prefix string) (handles []string, err error)
+	TakeHandleRedirect(handle string, now time.Time) (redirect model.HandleRedirect, err error)
+	FindRedirectHandlesWithPrefix(prefix string, now time.Time) (handles []string, err error)
+	UpdateHandle(accountID int, oldHandle, newHandle string, redirectExpiresAt time.Time) (err error)
 	Find(accountIDs []int) (accounts []model.Account, err error)
-	Create(account model.Account) (err error)
+	FindUnverified(createdAfter, createdBefore time.Time, afterID, limit int) (accounts []model.Account, err error)
+	FindAfterID(afterID, limit int) (accounts []model.Account, err error)
+	FindInactive(since time.Time, afterID, limit int) (accounts []model.Account, err error)
+	FindPage(sortColumn string, desc bool, pgn pagination.Pagination) (accounts []model.Account, total int64, err error)
+	EachSorted(sortColumn string, desc bool, fn func(account model.Account) error) (err error)
+	Create(account model.Account) (accountID int, err error)
 	Update(accountID int, request model.Account) (err error)
+	UpdateFields(accountID int, fields map[string]interface{}) (err error)
+	UpdateLoginState(accountID int, failedLoginCount int, lockedUntil *time.Time) (err error)
+	UpdateTOTPStep(accountID int, step int64) (accepted bool, err error)
+	UpdateLastLogin(accountID int, loggedInAt time.Time) (err error)
+	Replace(accountID int, updatedAt time.Time, fields map[string]interface{}) (err error)
 	Delete(accountID int) (err error)
+	TakeDeletedAccountByID(accountID int) (account model.Account, err error)
+	Restore(accountID int) (err error)
+	PurgeDeleted(before, requestedBefore time.Time) (purged int64, err error)
+	Merge(sourceID, targetID int, fields map[string]interface{}) (err error)
+	SetStorageUsage(usage model.StorageUsage) (err error)
+	ReserveUsername(reservation model.UsernameReservation) (reserved bool, err error)
+	TakeUsernameReservation(username string, now time.Time) (reservation model.UsernameReservation, err error)
+	DeleteUsernameReservation(username string) (err error)
+	FindStorageUsage(accountID int) (usages []model.StorageUsage, err error)
+}
+
+// TakeAccountByID verifies the checksum with AccountChecksumVerify, a mismatch is logged and counted,
+// the account is still returned
+// uniqueViolation is the postgres error code of a unique constraint violation
+const uniqueViolation = "23505"
+
+// uniqueColumns maps the unique constraints of accounts to the column they cover
+var uniqueColumns = map[string]string{
+	"accounts_username_key":     "username",
+	"accounts_email_key":        "email",
+	"accounts_ktp_number_key":   "ktp_number",
+	"accounts_phone_number_key": "phone_number",
+	"accounts_handle_idx":       "handle",
+}
+
+// ConflictColumn returns the column whose unique constraint err violated, ok is false for any other error
+func ConflictColumn(err error) (column string, ok bool) {
+	pgErr := &pgconn.PgError{}
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return
+	}
+	column, ok = uniqueColumns[pgErr.ConstraintName]
+	return
+}
+
+// Transaction runs fn with a repository whose reads and writes share one transaction, it is committed
+// when fn returns nil and rolled back otherwise. Inside a transaction fn joins the outer one.
+// A transaction rolled back by a deadlock or serialization failure runs again with fn, see retry.RolledBack
+func (repo *Repository) Transaction(fn func(repo Repositorier) error) (err error) {
+	if repo.inTransaction {
+		return fn(repo)
+	}
+	return repo.retryPolicy().Do(repo.requestContext(), "account_transaction", retry.RolledBack, func() error {
+		return repo.dbMaster.Transaction(func(tx *gorm.DB) error {
+			return fn(&Repository{dbMaster: tx, inTransaction: true, ctx: repo.ctx, logger: repo.logger})
+		})
+	})
+}
+
+// WithContext returns the repository with its statements bound to ctx, a canceled or timed out ctx
+// ends the running query and the retries, the error then wraps ctx.Err()
+func (repo *Repository) WithContext(ctx context.Context) Repositorier {
+	return &Repository{
+		dbMaster:      repo.dbMaster.WithContext(ctx),
+		inTransaction: repo.inTransaction,
+		ctx:           ctx,
+		logger:        repo.logger,
+	}
+}
+
+// requestContext is the ctx of WithContext, a repository without one never gives up on a retry early
+func (repo *Repository) requestContext() context.Context {
+	if repo.ctx == nil {
+		return context.Background()
+	}
+	return repo.ctx
+}
+
+// read runs a read again on a transient error, see retry.Transient. Inside Transaction a failed statement
+// aborts the transaction, so the read runs once and the transaction is retried as a whole
+func (repo *Repository) read(operation string, fn func() error) error {
+	if repo.inTransaction {
+		return fn()
+	}
+	return repo.retryPolicy().Do(repo.requestContext(), operation, retry.Transient, fn)
+}
+
+func (repo *Repository) retryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts: constant.DBRetryAttempts,
+		BaseDelay:   constant.DBRetryBaseDelay,
+		MaxDelay:    constant.DBRetryMaxDelay,
+		Logger:      repo.logger,
+	}
+}
+
+// begin starts the transaction of a write, a write inside Transaction runs in the outer one
+func (repo *Repository) begin() *gorm.DB {
+	if repo.inTransaction {
+		return repo.dbMaster
+	}
+	return repo.dbMaster.Begin()
+}
+
+// commit is left to Transaction for a write inside it
+func (repo *Repository) commit(query *gorm.DB) (err error) {
+	if repo.inTransaction {
+		return
+	}
+	return query.Commit().Error
+}
+
+// rollback is left to Transaction for a write inside it, the write returns its error to fn
+func (repo *Repository) rollback(query *gorm.DB) {
+	if repo.inTransaction {
+		return
+	}
+	query.Rollback()
 }
 
 func (repo *Repository) TakeAccountByID(accountID int) (account model.Account, err error) {
-	query := repo.dbMaster.Model(&model.Account{}).
-		Where("id", accountID).
-		Take(&account)
-	err = query.Error
+	err = repo.read("take_account_by_id", func() error {
+		account = model.Account{}
+		return repo.dbMaster.Model(&model.Account{}).
+			Where("id", accountID).
+			Take(&account).Error
+	})
+	if err == nil && constant.AccountChecksumVerify && account.Checksum != "" && !VerifyChecksum(account) {
+		repo.logger.Error("ACCOUNT CHECKSUM MISMATCH", "account_id", accountID)
+		metrics.ChecksumMismatch()
+	}
 	return
 }
 
+// TakeAccountByEmail ignores the case of the email, accounts_lower_email_idx serves the lookup
 func (repo *Repository) TakeAccountByEmail(email string) (account model.Account, err error) {
+	err = repo.read("take_account_by_email", func() error {
+		account = model.Account{}
+		return repo.dbMaster.Model(&model.Account{}).
+			Where("LOWER(email) = ?", strings.ToLower(email)).
+			Take(&account).Error
+	})
+	return
+}
+
+func (repo *Repository) TakeAccountByCanonicalEmail(canonicalEmail string) (account model.Account, err error) {
 	query := repo.dbMaster.Model(&model.Account{}).
-		Where("email", email).
+		Where("canonical_email", canonicalEmail).
 		Take(&account)
 	err = query.Error
 	return
@@ -69,72 +231,585 @@ func (repo *Repository) TakeAccountByPhoneNumber(phoneNumber string) (account mo
 }
 
 func (repo *Repository) TakeAccountByUsername(username string) (account model.Account, err error) {
+	err = repo.read("take_account_by_username", func() error {
+		account = model.Account{}
+		return repo.dbMaster.Model(&model.Account{}).
+			Where("username", username).
+			Take(&account).Error
+	})
+	return
+}
+
+// TakeAccountByDisplayName compares trimmed and case-folded display names
+func (repo *Repository) TakeAccountByDisplayName(displayName string) (account model.Account, err error) {
 	query := repo.dbMaster.Model(&model.Account{}).
-		Where("username", username).
+		Where("LOWER(TRIM(display_name)) = ?", strings.ToLower(strings.TrimSpace(displayName))).
 		Take(&account)
 	err = query.Error
 	return
 }
 
+func (repo *Repository) TakeAccountByHandle(handle string) (account model.Account, err error) {
+	query := repo.dbMaster.Model(&model.Account{}).
+		Where("handle", handle).
+		Take(&account)
+	err = query.Error
+	return
+}
+
+// FindHandlesWithPrefix includes deleted accounts, their handles stay reserved by the unique index
+func (repo *Repository) FindHandlesWithPrefix(prefix string) (handles []string, err error) {
+	query := repo.dbMaster.Model(&model.Account{}).Unscoped().
+		Where("handle LIKE ?", prefix+"%").
+		Pluck("handle", &handles)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) TakeHandleRedirect(handle string, now time.Time) (redirect model.HandleRedirect, err error) {
+	query := repo.dbMaster.Model(&model.HandleRedirect{}).
+		Where("handle", handle).
+		Where("expires_at > ?", now).
+		Take(&redirect)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) FindRedirectHandlesWithPrefix(prefix string, now time.Time) (handles []string, err error) {
+	query := repo.dbMaster.Model(&model.HandleRedirect{}).
+		Where("handle LIKE ?", prefix+"%").
+		Where("expires_at > ?", now).
+		Pluck("handle", &handles)
+	err = query.Error
+	return
+}
+
+// UpdateHandle keeps the old handle redirecting to the account until redirectExpiresAt,
+// a redirect already stored for the new handle is expired or the account's own and is removed
+func (repo *Repository) UpdateHandle(accountID int, oldHandle, newHandle string, redirectExpiresAt time.Time) (err error) {
+	query := repo.begin()
+	err = query.Where("handle", newHandle).
+		Delete(&model.HandleRedirect{}).Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	err = query.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "handle"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"account_id": accountID,
+			"expires_at": redirectExpiresAt,
+		})}).
+		Create(&model.HandleRedirect{
+			Handle:    oldHandle,
+			AccountID: accountID,
+			ExpiresAt: redirectExpiresAt,
+			CreatedAt: time.Now().UTC(),
+		}).Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	err = query.Model(&model.Account{}).
+		Where("id", accountID).
+		Update("handle", newHandle).Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	err = repo.commit(query)
+	return
+}
+
 func (repo *Repository) Find(accountIDs []int) (accounts []model.Account, err error) {
+	err = repo.read("find_accounts", func() error {
+		accounts = nil
+		return repo.dbMaster.Model(&model.Account{}).
+			Find(&accounts, accountIDs).Error
+	})
+	return
+}
+
+// FindUnverified pages unverified accounts with an email by id, zero times disable their bound
+func (repo *Repository) FindUnverified(createdAfter, createdBefore time.Time, afterID, limit int) (accounts []model.Account, err error) {
+	query := repo.dbMaster.Model(&model.Account{}).
+		Where("is_verified", false).
+		Where("email IS NOT NULL").
+		Where("id > ?", afterID)
+	if !createdAfter.IsZero() {
+		query = query.Where("created_at >= ?", createdAfter)
+	}
+	if !createdBefore.IsZero() {
+		query = query.Where("created_at < ?", createdBefore)
+	}
+	query = query.Order("id").
+		Limit(limit).
+		Find(&accounts)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) FindAfterID(afterID, limit int) (accounts []model.Account, err error) {
+	query := repo.dbMaster.Model(&model.Account{}).
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&accounts)
+	err = query.Error
+	return
+}
+
+// FindInactive pages through the accounts without a login since the time, accounts that never logged in
+// count from their creation
+func (repo *Repository) FindInactive(since time.Time, afterID, limit int) (accounts []model.Account, err error) {
 	query := repo.dbMaster.Model(&model.Account{}).
-		Find(&accounts, accountIDs)
+		Where("id > ?", afterID).
+		Where("COALESCE(last_login_at, created_at) < ?", since).
+		Order("id").
+		Limit(limit).
+		Find(&accounts)
 	err = query.Error
 	return
 }
 
-func (repo *Repository) Create(account model.Account) (err error) {
-	query := repo.dbMaster.Model(&account ).Begin().
+// FindPage orders by the column then id so pages stay stable, the column must not come from the caller as is
+func (repo *Repository) FindPage(sortColumn string, desc bool, pgn pagination.Pagination) (accounts []model.Account, total int64, err error) {
+	err = repo.read("find_accounts_page", func() error {
+		accounts, total = nil, 0
+		err := repo.dbMaster.Model(&model.Account{}).
+			Count(&total).Error
+		if err != nil {
+			return err
+		}
+
+		return repo.dbMaster.Model(&model.Account{}).
+			Order(clause.OrderByColumn{Column: clause.Column{Name: sortColumn}, Desc: desc}).
+			Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: desc}).
+			Limit(pgn.Limit).
+			Offset(pgn.Offset).
+			Find(&accounts).Error
+	})
+	return
+}
+
+// EachSorted calls fn for every account in the order of FindPage, rows are read one at a time from a single
+// query so the result set is never held in memory. The column must not come from the caller as is
+func (repo *Repository) EachSorted(sortColumn string, desc bool, fn func(account model.Account) error) (err error) {
+	query := repo.dbMaster.Model(&model.Account{}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: sortColumn}, Desc: desc}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: desc})
+	rows, err := query.Rows()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		account := model.Account{}
+		err = query.ScanRows(rows, &account)
+		if err != nil {
+			return
+		}
+		err = fn(account)
+		if err != nil {
+			return
+		}
+	}
+	return rows.Err()
+}
+
+func (repo *Repository) Create(account model.Account) (accountID int, err error) {
+	query := repo.begin()
+	err = query.Model(&account).
 		Clauses(clause.OnConflict{
 			Columns:   []clause.Column{{Name: "username"}},
 			DoUpdates: clause.Assignments(map[string]interface{}{
 				"username": account.Username,
 				"full_name": account.FullName,
 				"password": account.Password,
+				"password_changed_at": account.PasswordChangedAt,
+				"weak_password_rules": account.WeakPasswordRules,
+				"email": account.Email,
+				"canonical_email": account.CanonicalEmail,
+				"phone_number": account.PhoneNumber,
 				"deleted_at": nil,
 			})}).
-		Create(&account)
-	err = query.Error
+		Create(&account).Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	accountID = int(account.ID)
+	err = seal(query, accountID)
 	if err != nil {
-		query.Rollback()
+		repo.rollback(query)
 		return
 	}
 
-	err = query.Commit().Error
+	err = repo.commit(query)
 	return
 }
 
 func (repo *Repository) Update(accountID int, request model.Account) (err error) {
-	account := &model.Account{}
-	query := repo.dbMaster.Model(&account ).Begin().
+	query := repo.begin()
+	err = query.Model(&model.Account{}).
 		Where("id", accountID).
-		Updates(request)
-	err = query.Error
+		Updates(request).Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	err = seal(query, accountID)
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	err = repo.commit(query)
+	return
+}
+
+// UpdateFields writes the given columns as is, including zero values
+func (repo *Repository) UpdateFields(accountID int, fields map[string]interface{}) (err error) {
+	query := repo.begin()
+	err = query.Model(&model.Account{}).
+		Where("id", accountID).
+		Updates(fields).Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	err = seal(query, accountID)
 	if err != nil {
-		query.Rollback()
+		repo.rollback(query)
 		return
 	}
 
-	err = query.Commit().Error
+	err = repo.commit(query)
+	return
+}
+
+// Replace overwrites the given columns only when the row still has the expected updated_at
+func (repo *Repository) Replace(accountID int, updatedAt time.Time, fields map[string]interface{}) (err error) {
+	query := repo.begin()
+	replacement := query.Model(&model.Account{}).
+		Where("id", accountID).
+		Where("updated_at", updatedAt).
+		Updates(fields)
+	err = replacement.Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+	if replacement.RowsAffected != 1 {
+		repo.rollback(query)
+		err = constant.ErrPreconditionFailed
+		return
+	}
+
+	err = seal(query, accountID)
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	err = repo.commit(query)
 	return
 }
 
 func (repo *Repository) Delete(accountID int) (err error) {
 	account := &model.Account{}
-	query := repo.dbMaster.Model(account).Begin().
+	query := repo.begin().Model(account).
 		Where("id", accountID).
 		Delete(account )
 	err = query.Error
 	if err != nil {
-		query.Rollback()
+		repo.rollback(query)
 		return
 	}
 	if query.RowsAffected != 1 {
-		query.Rollback()
+		repo.rollback(query)
+		err = constant.ErrInvalidID
+		return
+	}
+
+	err = repo.commit(query)
+	return
+}
+
+// TakeDeletedAccountByID only finds a soft deleted account
+func (repo *Repository) TakeDeletedAccountByID(accountID int) (account model.Account, err error) {
+	query := repo.dbMaster.Model(&model.Account{}).Unscoped().
+		Where("id", accountID).
+		Where("deleted_at IS NOT NULL").
+		Take(&account)
+	err = query.Error
+	return
+}
+
+// Restore clears deleted_at of a soft deleted account
+func (repo *Repository) Restore(accountID int) (err error) {
+	query := repo.begin()
+	restore := query.Model(&model.Account{}).Unscoped().
+		Where("id", accountID).
+		Where("deleted_at IS NOT NULL").
+		UpdateColumn("deleted_at", nil)
+	err = restore.Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+	if restore.RowsAffected != 1 {
+		repo.rollback(query)
+		err = constant.ErrInvalidID
+		return
+	}
+
+	err = seal(query, accountID)
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	err = repo.commit(query)
+	return
+}
+
+// PurgeDeleted permanently removes accounts soft deleted before the time and pending deletions requested
+// before requestedBefore, with the rows referencing them that the database does not cascade
+func (repo *Repository) PurgeDeleted(before, requestedBefore time.Time) (purged int64, err error) {
+	query := repo.begin()
+	accountIDs := []int{}
+	err = query.Model(&model.Account{}).Unscoped().
+		Where("deleted_at < ?", before).
+		Or("status = ? AND delete_requested_at < ?", constant.AccountStatusPendingDeletion, requestedBefore).
+		Pluck("id", &accountIDs).Error
+	if err != nil || len(accountIDs) == 0 {
+		repo.rollback(query)
+		return
+	}
+
+	for _, dependent := range []interface{}{
+		&model.HandleRedirect{}, &model.StorageUsage{}, &model.Webhook{}, &model.Session{},
+	} {
+		err = query.Where("account_id IN ?", accountIDs).Delete(dependent).Error
+		if err != nil {
+			repo.rollback(query)
+			return
+		}
+	}
+
+	deletion := query.Unscoped().
+		Where("id IN ?", accountIDs).
+		Delete(&model.Account{})
+	err = deletion.Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+	purged = deletion.RowsAffected
+
+	err = repo.commit(query)
+	return
+}
+
+// Merge writes the resolved fields on the target, moves the source attendances to it and deletes the source.
+// The unique columns of the source are cleared so its values can move to the target.
+func (repo *Repository) Merge(sourceID, targetID int, fields map[string]interface{}) (err error) {
+	query := repo.begin()
+	err = query.Model(&model.Account{}).
+		Where("id", sourceID).
+		Updates(map[string]interface{}{
+			"email":           nil,
+			"canonical_email": nil,
+			"phone_number":    nil,
+			"ktp_number":      nil,
+		}).Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	deletion := query.Where("id", sourceID).Delete(&model.Account{})
+	err = deletion.Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+	if deletion.RowsAffected != 1 {
+		repo.rollback(query)
 		err = constant.ErrInvalidID
 		return
 	}
 
-	err = query.Commit().Error
+	if len(fields) > 0 {
+		err = query.Model(&model.Account{}).
+			Where("id", targetID).
+			Updates(fields).Error
+		if err != nil {
+			repo.rollback(query)
+			return
+		}
+		err = seal(query, targetID)
+		if err != nil {
+			repo.rollback(query)
+			return
+		}
+	}
+
+	err = query.Model(&model.Attendance{}).
+		Where("account_id", sourceID).
+		Update("account_id", targetID).Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	err = repo.commit(query)
+	return
+}
+
+// Checksum covers the fields whose silent change would grant access or impersonate the account
+func Checksum(account model.Account) string {
+	return checksum.Sum(constant.AccountChecksumSecret,
+		account.ID,
+		account.Username,
+		account.Email,
+		account.Password,
+		account.KTPNumber,
+		account.PhoneNumber,
+		account.Role,
+		account.IsVerified,
+		account.Permissions,
+	)
+}
+
+func VerifyChecksum(account model.Account) bool {
+	return checksum.Equal(account.Checksum, Checksum(account))
+}
+
+// seal recomputes the checksum from the written row inside the write transaction,
+// UpdateColumn leaves updated_at alone so the etag of the write is kept
+func seal(query *gorm.DB, accountID int) (err error) {
+	account := model.Account{}
+	err = query.Model(&model.Account{}).
+		Where("id", accountID).
+		Take(&account).Error
+	if err != nil {
+		return
+	}
+
+	err = query.Model(&model.Account{}).
+		Where("id", accountID).
+		UpdateColumn("checksum", Checksum(account)).Error
+	return
+}
+
+// UpdateLoginState leaves updated_at and the checksum alone, a failed login is not a change of the account
+func (repo *Repository) UpdateLoginState(accountID int, failedLoginCount int, lockedUntil *time.Time) (err error) {
+	query := repo.dbMaster.Model(&model.Account{}).
+		Where("id", accountID).
+		UpdateColumns(map[string]interface{}{
+			"failed_login_count": failedLoginCount,
+			"locked_until":       lockedUntil,
+		})
+	err = query.Error
+	return
+}
+
+// UpdateTOTPStep moves the last accepted step forward, accepted is false when the step was already used
+// so two requests racing with the same code cannot both log in
+func (repo *Repository) UpdateTOTPStep(accountID int, step int64) (accepted bool, err error) {
+	query := repo.dbMaster.Model(&model.Account{}).
+		Where("id", accountID).
+		Where("totp_last_step < ?", step).
+		UpdateColumn("totp_last_step", step)
+	err = query.Error
+	accepted = query.RowsAffected > 0
+	return
+}
+
+// UpdateLastLogin leaves updated_at and the checksum alone like UpdateLoginState,
+// a write finishing after a later login's does not move the time back
+func (repo *Repository) UpdateLastLogin(accountID int, loggedInAt time.Time) (err error) {
+	query := repo.dbMaster.Model(&model.Account{}).
+		Where("id", accountID).
+		Where("last_login_at IS NULL OR last_login_at < ?", loggedInAt).
+		UpdateColumn("last_login_at", loggedInAt)
+	err = query.Error
+	return
+}
+
+// SetStorageUsage replaces the counters of the account's artifact type
+func (repo *Repository) SetStorageUsage(usage model.StorageUsage) (err error) {
+	query := repo.dbMaster.Model(&model.StorageUsage{}).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "account_id"}, {Name: "artifact"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"bytes":      usage.Bytes,
+				"objects":    usage.Objects,
+				"updated_at": usage.UpdatedAt,
+			})}).
+		Create(&usage)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) FindStorageUsage(accountID int) (usages []model.StorageUsage, err error) {
+	query := repo.dbMaster.Model(&model.StorageUsage{}).
+		Where("account_id", accountID).
+		Order("artifact").
+		Find(&usages)
+	err = query.Error
+	return
+}
+
+// ReserveUsername frees an expired reservation of the username and stores the new one,
+// reserved is false when an unexpired reservation still holds the username
+func (repo *Repository) ReserveUsername(reservation model.UsernameReservation) (reserved bool, err error) {
+	query := repo.begin()
+	err = query.Where("username", reservation.Username).
+		Where("expires_at <= ?", reservation.CreatedAt).
+		Delete(&model.UsernameReservation{}).Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	result := query.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "username"}},
+		DoNothing: true,
+	}).Create(&reservation)
+	err = result.Error
+	if err != nil {
+		repo.rollback(query)
+		return
+	}
+
+	err = repo.commit(query)
+	reserved = err == nil && result.RowsAffected > 0
+	return
+}
+
+func (repo *Repository) TakeUsernameReservation(username string, now time.Time) (reservation model.UsernameReservation, err error) {
+	query := repo.dbMaster.Model(&model.UsernameReservation{}).
+		Where("username", username).
+		Where("expires_at > ?", now).
+		Take(&reservation)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) DeleteUsernameReservation(username string) (err error) {
+	query := repo.dbMaster.
+		Where("username", username).
+		Delete(&model.UsernameReservation{})
+	err = query.Error
 	return
 }
@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"time"
+
+	"go-rest-api/src/connection"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/pagination"
+
+	"gorm.io/gorm"
+)
+
+type DB struct {
+	Master *gorm.DB
+}
+
+type Repository struct {
+	dbMaster *gorm.DB
+}
+
+func NewRepository(
+	db connection.DB,
+) *Repository {
+	return &Repository{
+		dbMaster: db.Master,
+	}
+}
+
+type Repositorier interface {
+	Append(entry model.AuditLog, seal func(entry *model.AuditLog, prevHash string)) (err error)
+	FindAfterID(afterID, limit int) (entries []model.AuditLog, err error)
+	FindByTargetID(targetID int, action string, from, to time.Time, pgn pagination.Pagination) (entries []model.AuditLog, err error)
+}
+
+// Append inserts the entry after the last one, writers are serialized with a transaction scoped
+// advisory lock so every entry is sealed with the hash of its actual predecessor
+func (repo *Repository) Append(entry model.AuditLog, seal func(entry *model.AuditLog, prevHash string)) (err error) {
+	query := repo.dbMaster.Begin()
+	err = query.Exec("SELECT pg_advisory_xact_lock(?)", constant.AuditChainLockKey).Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	last := model.AuditLog{}
+	err = query.Model(&model.AuditLog{}).
+		Order("id DESC").
+		Limit(1).
+		Find(&last).Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	seal(&entry, last.Hash)
+	err = query.Create(&entry).Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
+
+func (repo *Repository) FindAfterID(afterID, limit int) (entries []model.AuditLog, err error) {
+	query := repo.dbMaster.Model(&model.AuditLog{}).
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&entries)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) FindByTargetID(targetID int, action string, from, to time.Time, pgn pagination.Pagination) (entries []model.AuditLog, err error) {
+	query := repo.dbMaster.Model(&model.AuditLog{}).
+		Where("target_id", targetID)
+	if action != "" {
+		query = query.Where("action", action)
+	}
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at <= ?", to)
+	}
+	query = query.Order("id desc").
+		Limit(pgn.Limit).
+		Offset(pgn.Offset).
+		Find(&entries)
+	err = query.Error
+	return
+}
@@ -0,0 +1,34 @@
+package health
+
+import (
+	"context"
+
+	"go-rest-api/src/connection"
+
+	"gorm.io/gorm"
+)
+
+type Repository struct {
+	dbMaster *gorm.DB
+}
+
+func NewRepository(
+	db connection.DB,
+) *Repository {
+	return &Repository{
+		dbMaster: db.Master,
+	}
+}
+
+type Repositorier interface {
+	Ping(ctx context.Context) (err error)
+}
+
+// Ping gives up when ctx is done, a hung database cannot block the caller past its deadline
+func (repo *Repository) Ping(ctx context.Context) (err error) {
+	sqlDB, err := repo.dbMaster.DB()
+	if err != nil {
+		return
+	}
+	return sqlDB.PingContext(ctx)
+}
@@ -0,0 +1,83 @@
+package importjob
+
+import (
+	"go-rest-api/src/connection"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/model"
+
+	"gorm.io/gorm"
+)
+
+type DB struct {
+	Master *gorm.DB
+}
+
+type Repository struct {
+	dbMaster *gorm.DB
+}
+
+func NewRepository(
+	db connection.DB,
+) *Repository {
+	return &Repository{
+		dbMaster: db.Master,
+	}
+}
+
+type Repositorier interface {
+	Create(job model.ImportJob) (jobID int, err error)
+	TakeByID(jobID int) (job model.ImportJob, err error)
+	Update(jobID int, request map[string]interface{}) (err error)
+	InterruptUnfinished() (err error)
+}
+
+func (repo *Repository) Create(job model.ImportJob) (jobID int, err error) {
+	query := repo.dbMaster.Model(&job).Begin().
+		Create(&job)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	jobID = int(job.ID)
+	return
+}
+
+func (repo *Repository) TakeByID(jobID int) (job model.ImportJob, err error) {
+	query := repo.dbMaster.Model(&model.ImportJob{}).
+		Where("id", jobID).
+		Take(&job)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) Update(jobID int, request map[string]interface{}) (err error) {
+	query := repo.dbMaster.Model(&model.ImportJob{}).Begin().
+		Where("id", jobID).
+		Updates(request)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
+
+// InterruptUnfinished marks jobs left pending or running by a previous process as interrupted
+func (repo *Repository) InterruptUnfinished() (err error) {
+	query := repo.dbMaster.Model(&model.ImportJob{}).Begin().
+		Where("status IN ?", []string{constant.ImportJobStatusPending, constant.ImportJobStatusRunning}).
+		Update("status", constant.ImportJobStatusInterrupted)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
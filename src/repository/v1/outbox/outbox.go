@@ -0,0 +1,69 @@
+package outbox
+
+import (
+	"go-rest-api/src/connection"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/model"
+
+	"gorm.io/gorm"
+)
+
+type DB struct {
+	Master *gorm.DB
+}
+
+type Repository struct {
+	dbMaster *gorm.DB
+}
+
+func NewRepository(
+	db connection.DB,
+) *Repository {
+	return &Repository{
+		dbMaster: db.Master,
+	}
+}
+
+type Repositorier interface {
+	Create(message model.Outbox) (err error)
+	FindPending(maxAttempts, limit int) (messages []model.Outbox, err error)
+	Update(messageID int, request map[string]interface{}) (err error)
+}
+
+func (repo *Repository) Create(message model.Outbox) (err error) {
+	query := repo.dbMaster.Model(&message).Begin().
+		Create(&message)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
+
+func (repo *Repository) FindPending(maxAttempts, limit int) (messages []model.Outbox, err error) {
+	query := repo.dbMaster.Model(&model.Outbox{}).
+		Where("status", constant.OutboxStatusPending).
+		Where("attempts < ?", maxAttempts).
+		Order("id").
+		Limit(limit).
+		Find(&messages)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) Update(messageID int, request map[string]interface{}) (err error) {
+	query := repo.dbMaster.Model(&model.Outbox{}).Begin().
+		Where("id", messageID).
+		Updates(request)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
@@ -0,0 +1,211 @@
+package security
+
+import (
+	"time"
+
+	"go-rest-api/src/connection"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/pagination"
+
+	"gorm.io/gorm"
+)
+
+type DB struct {
+	Master *gorm.DB
+}
+
+type Repository struct {
+	dbMaster *gorm.DB
+}
+
+func NewRepository(
+	db connection.DB,
+) *Repository {
+	return &Repository{
+		dbMaster: db.Master,
+	}
+}
+
+type Repositorier interface {
+	CreateFailedLogin(failedLogin model.FailedLogin) (err error)
+	FindFailedLogins(identifier, ipAddress string, from, to time.Time, pgn pagination.Pagination) (failedLogins []model.FailedLogin, err error)
+	CreateFailedRegistration(failedRegistration model.FailedRegistration) (err error)
+	FindFailedRegistrations(fingerprint, reason string, from, to time.Time, pgn pagination.Pagination) (failedRegistrations []model.FailedRegistration, err error)
+	DeleteFailedRegistrationsBefore(before time.Time) (deleted int64, err error)
+	CreateSession(session model.Session) (err error)
+	FindActiveSessions(accountID int, now time.Time) (sessions []model.Session, err error)
+	TakeActiveSession(accountID, sessionID int, now time.Time) (session model.Session, err error)
+	RevokeSession(sessionID int, now time.Time) (err error)
+	RevokeSessionByToken(tokenID string, now time.Time) (err error)
+	RotateSession(oldTokenID, newTokenID string, expiresAt time.Time) (err error)
+}
+
+func (repo *Repository) CreateFailedLogin(failedLogin model.FailedLogin) (err error) {
+	query := repo.dbMaster.Model(&failedLogin).Begin().
+		Create(&failedLogin)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
+
+func (repo *Repository) FindFailedLogins(identifier, ipAddress string, from, to time.Time, pgn pagination.Pagination) (failedLogins []model.FailedLogin, err error) {
+	query := repo.dbMaster.Model(&model.FailedLogin{})
+	if identifier != "" {
+		query = query.Where("identifier", identifier)
+	}
+	if ipAddress != "" {
+		query = query.Where("ip_address", ipAddress)
+	}
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at <= ?", to)
+	}
+	query = query.Order("created_at desc").
+		Limit(pgn.Limit).
+		Offset(pgn.Offset).
+		Find(&failedLogins)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) CreateFailedRegistration(failedRegistration model.FailedRegistration) (err error) {
+	query := repo.dbMaster.Model(&failedRegistration).Begin().
+		Create(&failedRegistration)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
+
+func (repo *Repository) FindFailedRegistrations(fingerprint, reason string, from, to time.Time, pgn pagination.Pagination) (failedRegistrations []model.FailedRegistration, err error) {
+	query := repo.dbMaster.Model(&model.FailedRegistration{})
+	if fingerprint != "" {
+		query = query.Where("fingerprint", fingerprint)
+	}
+	if reason != "" {
+		query = query.Where("reason", reason)
+	}
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at <= ?", to)
+	}
+	query = query.Order("created_at desc").
+		Limit(pgn.Limit).
+		Offset(pgn.Offset).
+		Find(&failedRegistrations)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) DeleteFailedRegistrationsBefore(before time.Time) (deleted int64, err error) {
+	query := repo.dbMaster.Model(&model.FailedRegistration{}).Begin().
+		Where("created_at < ?", before).
+		Delete(&model.FailedRegistration{})
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	deleted = query.RowsAffected
+	err = query.Commit().Error
+	return
+}
+
+func (repo *Repository) CreateSession(session model.Session) (err error) {
+	query := repo.dbMaster.Model(&session).Begin().
+		Create(&session)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
+
+func (repo *Repository) FindActiveSessions(accountID int, now time.Time) (sessions []model.Session, err error) {
+	query := repo.dbMaster.Model(&model.Session{}).
+		Where("account_id", accountID).
+		Where("expires_at > ?", now).
+		Where("revoked_at IS NULL").
+		Order("created_at DESC").
+		Find(&sessions)
+	err = query.Error
+	return
+}
+
+// TakeActiveSession only finds a session of the account, another account's session is gorm.ErrRecordNotFound
+func (repo *Repository) TakeActiveSession(accountID, sessionID int, now time.Time) (session model.Session, err error) {
+	query := repo.dbMaster.Model(&model.Session{}).
+		Where("id", sessionID).
+		Where("account_id", accountID).
+		Where("expires_at > ?", now).
+		Where("revoked_at IS NULL").
+		Take(&session)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) RevokeSession(sessionID int, now time.Time) (err error) {
+	query := repo.dbMaster.Model(&model.Session{}).Begin().
+		Where("id", sessionID).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", now)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
+
+func (repo *Repository) RevokeSessionByToken(tokenID string, now time.Time) (err error) {
+	query := repo.dbMaster.Model(&model.Session{}).Begin().
+		Where("token_id", tokenID).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", now)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
+
+// RotateSession moves the unrevoked session of the old token to the new one, a session revoked meanwhile stays revoked
+func (repo *Repository) RotateSession(oldTokenID, newTokenID string, expiresAt time.Time) (err error) {
+	query := repo.dbMaster.Model(&model.Session{}).Begin().
+		Where("token_id", oldTokenID).
+		Where("revoked_at IS NULL").
+		Updates(map[string]interface{}{
+			"token_id":   newTokenID,
+			"expires_at": expiresAt,
+		})
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
@@ -0,0 +1,84 @@
+package verification
+
+import (
+	"time"
+
+	"go-rest-api/src/connection"
+	"go-rest-api/src/model"
+
+	"gorm.io/gorm"
+)
+
+type DB struct {
+	Master *gorm.DB
+}
+
+type Repository struct {
+	dbMaster *gorm.DB
+}
+
+func NewRepository(
+	db connection.DB,
+) *Repository {
+	return &Repository{
+		dbMaster: db.Master,
+	}
+}
+
+type Repositorier interface {
+	Create(verificationToken model.VerificationToken) (err error)
+	TakeByTokenHash(purpose, tokenHash string) (verificationToken model.VerificationToken, err error)
+	MarkUsed(tokenID int, usedAt time.Time) (err error)
+	TakeReusable(accountID int, purpose string, createdAfter, now time.Time) (verificationToken model.VerificationToken, err error)
+}
+
+func (repo *Repository) Create(verificationToken model.VerificationToken) (err error) {
+	query := repo.dbMaster.Model(&verificationToken).Begin().
+		Create(&verificationToken)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
+
+func (repo *Repository) TakeByTokenHash(purpose, tokenHash string) (verificationToken model.VerificationToken, err error) {
+	query := repo.dbMaster.Model(&model.VerificationToken{}).
+		Where("purpose", purpose).
+		Where("token_hash", tokenHash).
+		Take(&verificationToken)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) MarkUsed(tokenID int, usedAt time.Time) (err error) {
+	query := repo.dbMaster.Model(&model.VerificationToken{}).Begin().
+		Where("id", tokenID).
+		Update("used_at", usedAt)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
+
+// TakeReusable returns the latest unused and unexpired token created after createdAfter that has a seed
+func (repo *Repository) TakeReusable(accountID int, purpose string, createdAfter, now time.Time) (verificationToken model.VerificationToken, err error) {
+	query := repo.dbMaster.Model(&model.VerificationToken{}).
+		Where("account_id", accountID).
+		Where("purpose", purpose).
+		Where("used_at IS NULL").
+		Where("expires_at > ?", now).
+		Where("created_at > ?", createdAfter).
+		Where("seed <> ''").
+		Order("id DESC").
+		Take(&verificationToken)
+	err = query.Error
+	return
+}
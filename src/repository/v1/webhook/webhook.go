@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"go-rest-api/src/connection"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/model"
+
+	"gorm.io/gorm"
+)
+
+type DB struct {
+	Master *gorm.DB
+}
+
+type Repository struct {
+	dbMaster *gorm.DB
+}
+
+func NewRepository(
+	db connection.DB,
+) *Repository {
+	return &Repository{
+		dbMaster: db.Master,
+	}
+}
+
+type Repositorier interface {
+	Create(webhook model.Webhook) (webhookID int, err error)
+	FindByAccountID(accountID int) (webhooks []model.Webhook, err error)
+	CountByAccountID(accountID int) (count int64, err error)
+	Delete(accountID, webhookID int) (err error)
+}
+
+func (repo *Repository) Create(webhook model.Webhook) (webhookID int, err error) {
+	query := repo.dbMaster.Model(&webhook).Begin().
+		Create(&webhook)
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+
+	err = query.Commit().Error
+	webhookID = int(webhook.ID)
+	return
+}
+
+func (repo *Repository) FindByAccountID(accountID int) (webhooks []model.Webhook, err error) {
+	query := repo.dbMaster.Model(&model.Webhook{}).
+		Where("account_id", accountID).
+		Order("id").
+		Find(&webhooks)
+	err = query.Error
+	return
+}
+
+func (repo *Repository) CountByAccountID(accountID int) (count int64, err error) {
+	query := repo.dbMaster.Model(&model.Webhook{}).
+		Where("account_id", accountID).
+		Count(&count)
+	err = query.Error
+	return
+}
+
+// Delete only deletes the webhook when it belongs to the account
+func (repo *Repository) Delete(accountID, webhookID int) (err error) {
+	query := repo.dbMaster.Model(&model.Webhook{}).Begin().
+		Where("id", webhookID).
+		Where("account_id", accountID).
+		Delete(&model.Webhook{})
+	err = query.Error
+	if err != nil {
+		query.Rollback()
+		return
+	}
+	if query.RowsAffected != 1 {
+		query.Rollback()
+		err = constant.ErrWebhookNotFound
+		return
+	}
+
+	err = query.Commit().Error
+	return
+}
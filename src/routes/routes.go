@@ -1,51 +1,207 @@
 package routes
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/joho/godotenv"
-	"github.com/forkyid/go-utils/v1/middleware"
+	"github.com/forkyid/go-utils/v1/validation"
 	"github.com/gin-gonic/gin"
 	"go-rest-api/docs"
 	"go-rest-api/src/connection"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/pkg/bcrypt"
+	"go-rest-api/src/pkg/blacklist"
+	"go-rest-api/src/pkg/bodylimit"
+	"go-rest-api/src/pkg/email"
+	"go-rest-api/src/pkg/enum"
+	"go-rest-api/src/pkg/fieldcrypt"
+	"go-rest-api/src/pkg/geoip"
+	"go-rest-api/src/pkg/idempotency"
+	"go-rest-api/src/pkg/jwt"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/maintenance"
+	"go-rest-api/src/pkg/nik"
+	authMiddleware "go-rest-api/src/middleware/auth"
+	"go-rest-api/src/middleware/ratelimit"
+	appMiddleware "go-rest-api/src/pkg/middleware"
+	"go-rest-api/src/pkg/notifier"
+	"go-rest-api/src/pkg/passwordhash"
+	"go-rest-api/src/pkg/passwordpolicy"
+	"go-rest-api/src/pkg/phone"
+	"go-rest-api/src/pkg/publicid"
+	"go-rest-api/src/pkg/storage"
+	"go-rest-api/src/pkg/transform"
+	"go-rest-api/src/pkg/webhook"
 	"gorm.io/gorm"
 
 	authController "go-rest-api/src/controller/v1/auth"
 	accountController "go-rest-api/src/controller/v1/account"
 	attendanceController "go-rest-api/src/controller/v1/attendance"
+	auditController "go-rest-api/src/controller/v1/audit"
+	capabilityController "go-rest-api/src/controller/v1/capability"
+	healthController "go-rest-api/src/controller/v1/health"
 	locationController "go-rest-api/src/controller/v1/location"
+	securityController "go-rest-api/src/controller/v1/security"
+	webhookController "go-rest-api/src/controller/v1/webhook"
 
 	accountRepository "go-rest-api/src/repository/v1/account"
 	attendanceRepository "go-rest-api/src/repository/v1/attendance"
+	auditRepository "go-rest-api/src/repository/v1/audit"
+	healthRepository "go-rest-api/src/repository/v1/health"
+	importJobRepository "go-rest-api/src/repository/v1/importjob"
 	locationRepository "go-rest-api/src/repository/v1/location"
+	outboxRepository "go-rest-api/src/repository/v1/outbox"
+	securityRepository "go-rest-api/src/repository/v1/security"
+	verificationRepository "go-rest-api/src/repository/v1/verification"
+	webhookRepository "go-rest-api/src/repository/v1/webhook"
 
 	accountService "go-rest-api/src/service/v1/account"
 	attendanceService "go-rest-api/src/service/v1/attendance"
+	auditService "go-rest-api/src/service/v1/audit"
+	capabilityService "go-rest-api/src/service/v1/capability"
+	healthService "go-rest-api/src/service/v1/health"
+	importJobService "go-rest-api/src/service/v1/importjob"
 	locationService "go-rest-api/src/service/v1/location"
+	outboxService "go-rest-api/src/service/v1/outbox"
+	securityService "go-rest-api/src/service/v1/security"
+	webhookService "go-rest-api/src/service/v1/webhook"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
 var master *gorm.DB
-var router = gin.Default()
+var router = gin.New()
 
 type DB struct {
 	Master *gorm.DB
 }
 
-func Run() {	
+// Run serves until SIGINT or SIGTERM, then stops accepting connections and waits up to
+// constant.ShutdownTimeout for active requests before closing the database
+func Run() {
 	godotenv.Load()
 	RouterSetup()
-	router.Run(fmt.Sprintf(":%s", os.Getenv("SERVER_PORT")))
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%s", os.Getenv("SERVER_PORT")),
+		Handler: router,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalln("listen:", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	received := <-quit
+	log.Println("shutdown: received", received, "draining active requests for up to", constant.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), constant.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("shutdown: drain timed out, remaining requests are cut off:", err)
+	} else {
+		log.Println("shutdown: drain completed")
+	}
+
+	if err := connection.Close(); err != nil {
+		log.Println("shutdown: close database:", err)
+	} else {
+		log.Println("shutdown: database closed")
+	}
+	log.Println("shutdown: done")
 }
 
 func RouterSetup() *gin.Engine {
 	// set up
-	router.SetTrustedProxies(nil)
-	middleware := middleware.Middleware{}
-	router.Use(middleware.CORS)
+	if !passwordhash.Supported(constant.PasswordHashAlgorithm) {
+		log.Fatalln("unsupported PASSWORD_HASH_ALGORITHM:", constant.PasswordHashAlgorithm)
+	}
+	if !bcrypt.ValidCost(constant.BcryptCost) {
+		log.Fatalln("invalid BCRYPT_COST, use 4 to 31:", constant.BcryptCost)
+	}
+	tokenBlacklist, ok := blacklist.New(constant.TokenBlacklistStore)
+	if !ok {
+		log.Fatalln("invalid TOKEN_BLACKLIST_STORE, use memory or redis:", constant.TokenBlacklistStore)
+	}
+	jwt.Blacklist = tokenBlacklist
+	corsConfig := appMiddleware.CORSConfig{
+		AllowedOrigins:   constant.CORSAllowedOrigins,
+		AllowedMethods:   constant.CORSAllowedMethods,
+		AllowedHeaders:   constant.CORSAllowedHeaders,
+		ExposedHeaders:   constant.CORSExposedHeaders,
+		AllowCredentials: constant.CORSAllowCredentials,
+		MaxAge:           constant.CORSMaxAge,
+	}
+	if err := corsConfig.Validate(); err != nil {
+		log.Fatalln("invalid CORS_ALLOWED_ORIGINS:", err)
+	}
+	if !publicid.ValidPrefix(constant.AccountIDPrefix) {
+		log.Fatalln("invalid ACCOUNT_ID_PREFIX, use letters and digits only:", constant.AccountIDPrefix)
+	}
+	if err := enum.Register(validation.Validator); err != nil {
+		log.Fatalln("register enum validation:", err)
+	}
+	if err := nik.Register(validation.Validator); err != nil {
+		log.Fatalln("register ktp validation:", err)
+	}
+	if err := phone.Register(validation.Validator); err != nil {
+		log.Fatalln("register phone validation:", err)
+	}
+	enforcedPolicy := passwordpolicy.Policy{}
+	if constant.PasswordPolicyEnforce {
+		enforcedPolicy = constant.PasswordPolicy
+	}
+	if err := passwordpolicy.Register(validation.Validator, enforcedPolicy); err != nil {
+		log.Fatalln("register password validation:", err)
+	}
+	if err := router.SetTrustedProxies(constant.TrustedProxies); err != nil {
+		log.Fatalln("invalid TRUSTED_PROXIES:", err)
+	}
+	logLevel, ok := logger.ParseLevel(constant.LogLevel)
+	if !ok {
+		log.Fatalln("invalid LOG_LEVEL, use debug, info, warn or error:", constant.LogLevel)
+	}
+	appLogger := logger.New(os.Stdout, logLevel)
+	// the request id is set before anything logs, AccessLog reads it once the request is done
+	router.Use(appMiddleware.AccessLog(), appMiddleware.RequestID(), appMiddleware.Metrics(), appMiddleware.Recovery(appLogger))
+	router.Use(appMiddleware.Logging(appLogger))
+
+	// database connection (type *gorm.DB)
+	master = connection.DBMaster()
+
+	// probes are registered before the https, cors, device binding and maintenance middlewares,
+	// the orchestrator calls them over plain http without a token
+	healthSvc := healthService.NewService(healthRepository.NewRepository(connection.DB{
+		Master: master,
+	}), constant.ReadinessTimeout)
+	healthController := healthController.NewController(healthSvc, appLogger)
+	router.GET("/healthz", healthController.Health)
+	router.GET("/readyz", healthController.Readiness)
+
+	router.Use(appMiddleware.HTTPS(constant.HTTPSEnforcement, constant.MinTLSVersion))
+	router.Use(appMiddleware.CORS(corsConfig))
+	router.Use(appMiddleware.DeviceBinding(constant.DeviceBinding, constant.FingerprintSecret, appLogger))
+	maintenanceMode := maintenance.NewMode(constant.ReadOnlyMode, constant.MaintenanceBypassToken)
+	// logging in and probing only read accounts
+	maintenanceMode.AllowRoute("POST", "/v1/auth")
+	maintenanceMode.AllowRoute("POST", "/v1/auth/refresh")
+	maintenanceMode.AllowRoute("POST", "/v1/accounts/exists")
+	router.Use(maintenanceMode.Middleware)
+	bodyLimit := bodylimit.NewLimit(int64(constant.MaxRequestBodyBytes))
+	bodyLimit.SetRoute("POST", "/v1/accounts/bulk", int64(constant.BulkImportMaxBodyBytes))
+	// the multipart boundaries and headers come on top of the file
+	bodyLimit.SetRoute("POST", "/v1/accounts/avatar", int64(constant.AvatarMaxBytes)+64<<10)
+	router.Use(bodyLimit.Middleware)
 
 	// swagger
 	docs.SwaggerInfo.Title = "Phincon Attendance App Rest API"
@@ -55,54 +211,226 @@ func RouterSetup() *gin.Engine {
 	docs.SwaggerInfo.Schemes = []string{"http", "https"}
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// database connection (type *gorm.DB)
-	master = connection.DBMaster()
+	// metrics
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// repository
 	accountRepo := accountRepository.NewRepository(connection.DB{
 		Master: master,
-	})
+	}, appLogger)
 	attendanceRepo := attendanceRepository.NewRepository(connection.DB{
 		Master: master,
 	})
 	locationRepo := locationRepository.NewRepository(connection.DB{
 		Master: master,
 	})
+	securityRepo := securityRepository.NewRepository(connection.DB{
+		Master: master,
+	})
+	outboxRepo := outboxRepository.NewRepository(connection.DB{
+		Master: master,
+	})
+	verificationRepo := verificationRepository.NewRepository(connection.DB{
+		Master: master,
+	})
+	importJobRepo := importJobRepository.NewRepository(connection.DB{
+		Master: master,
+	})
+	auditRepo := auditRepository.NewRepository(connection.DB{
+		Master: master,
+	})
+	webhookRepo := webhookRepository.NewRepository(connection.DB{
+		Master: master,
+	})
+
+	// notifier, messages are queued in the outbox and delivered in the background
+	emailSender, ok := email.New(constant.EmailSender, email.SMTPConfig{
+		Host:     constant.SMTPHost,
+		Port:     constant.SMTPPort,
+		Username: constant.SMTPUsername,
+		Password: constant.SMTPPassword,
+		From:     constant.SMTPFrom,
+		Timeout:  constant.SMTPTimeout,
+	})
+	if !ok {
+		log.Fatalln("invalid or unset EMAIL_SENDER, use log or smtp:", constant.EmailSender)
+	}
+	outboxSvc := outboxService.NewService(outboxRepo, notifier.NewNotifier(emailSender), appLogger)
+	go outboxSvc.Run(constant.OutboxDispatchInterval)
 
 	// service
-	accountSvc := accountService.NewService(accountRepo)
+	objectStorage, ok := storage.New(constant.StorageDriver, constant.StorageLocalDir, constant.StorageBaseURL, storage.S3Config{
+		Endpoint:        constant.S3Endpoint,
+		Region:          constant.S3Region,
+		Bucket:          constant.S3Bucket,
+		AccessKeyID:     constant.S3AccessKeyID,
+		SecretAccessKey: constant.S3SecretAccessKey,
+		Timeout:         constant.S3Timeout,
+	})
+	if !ok {
+		log.Fatalln("invalid STORAGE_DRIVER, use local or s3:", constant.StorageDriver)
+	}
+	if constant.StorageDriver == storage.DriverLocal {
+		router.Static("/uploads", constant.StorageLocalDir)
+	}
+
+	fieldTransforms, err := transform.Parse(constant.AccountFieldTransforms)
+	if err != nil {
+		log.Fatalln("invalid ACCOUNT_FIELD_TRANSFORMS:", err)
+	}
+	var totpCipher *fieldcrypt.Cipher
+	if constant.TOTPEncryptionKey != "" {
+		key, err := fieldcrypt.ParseKey(constant.TOTPEncryptionKey)
+		if err == nil {
+			totpCipher, err = fieldcrypt.New(key)
+		}
+		if err != nil {
+			log.Fatalln("invalid TOTP_ENCRYPTION_KEY:", err)
+		}
+	}
+	accountSvc := accountService.NewService(accountRepo, verificationRepo, outboxSvc, objectStorage, fieldTransforms, totpCipher, appLogger)
 	locationSvc := locationService.NewService(locationRepo)
 	attendanceSvc := attendanceService.NewService(attendanceRepo, accountSvc, locationSvc)
+	securitySvc := securityService.NewService(securityRepo, geoip.Noop{}, appLogger)
+	go securitySvc.RunFailedRegistrationPurge(constant.FailedRegistrationPurgeInterval)
+	capabilitySvc := capabilityService.NewService()
+	auditSvc := auditService.NewService(auditRepo)
+	webhookSender := webhook.NewSender(constant.WebhookWorkers, constant.WebhookQueueSize, constant.WebhookAttempts, constant.WebhookTimeout, appLogger)
+	for _, url := range constant.DeletionWebhookURLs {
+		if err := webhook.ValidateURL(url); err != nil {
+			log.Fatalln("invalid DELETION_WEBHOOK_URLS:", url, err)
+		}
+	}
+	deletionSender := webhook.NewSender(constant.WebhookWorkers, constant.WebhookQueueSize, constant.DeletionWebhookAttempts, constant.DeletionWebhookTimeout, appLogger)
+	webhookSvc := webhookService.NewService(webhookRepo, webhookSender, deletionSender, appLogger)
+	importJobSvc := importJobService.NewService(importJobRepo, accountSvc, auditSvc, appLogger)
+	if err := importJobSvc.InterruptUnfinished(); err != nil {
+		appLogger.Error("interrupt unfinished import jobs failed", "error", err)
+	}
 	
 	// controller
-	authController := authController.NewController(accountSvc)
-	accountController := accountController.NewController(accountSvc)
-	attendanceController := attendanceController.NewController(attendanceSvc)
-	locationController := locationController.NewController(locationSvc)
+	authController := authController.NewController(accountSvc, securitySvc, appLogger)
+	var fieldCipher *fieldcrypt.Cipher
+	if constant.ResponseEncryptionKey != "" {
+		key, err := fieldcrypt.ParseKey(constant.ResponseEncryptionKey)
+		if err == nil {
+			fieldCipher, err = fieldcrypt.New(key)
+		}
+		if err != nil {
+			log.Fatalln("invalid RESPONSE_ENCRYPTION_KEY:", err)
+		}
+	}
+	accountController := accountController.NewController(accountSvc, importJobSvc, auditSvc, securitySvc, webhookSvc, fieldCipher, appLogger)
+	attendanceController := attendanceController.NewController(attendanceSvc, appLogger)
+	locationController := locationController.NewController(locationSvc, appLogger)
+	securityController := securityController.NewController(securitySvc, accountSvc, appLogger)
+	capabilityController := capabilityController.NewController(capabilitySvc)
+	auditController := auditController.NewController(auditSvc, accountSvc, appLogger)
+	webhookController := webhookController.NewController(webhookSvc, appLogger)
 
 	// endpoint v1
 	v1 := router.Group("v1")
 
+	v1.GET("capabilities", capabilityController.Get)
+
+	// brute force limits of the auth endpoints, the store can be replaced by one shared between instances
+	rateLimitStore := ratelimit.NewMemoryStore()
+	idempotencyStore := idempotency.NewStore(constant.IdempotencyTTL)
+	registerLimit := ratelimit.Limit(rateLimitStore, appLogger,
+		ratelimit.Rule{Name: "register", Limit: constant.RegisterRateLimit, Window: constant.RegisterRateWindow, Key: ratelimit.ClientIP})
+	loginLimit := ratelimit.Limit(rateLimitStore, appLogger,
+		ratelimit.Rule{Name: "login", Limit: constant.LoginRateLimit, Window: constant.LoginRateWindow, Key: ratelimit.ClientIP},
+		ratelimit.Rule{Name: "login:identifier", Limit: constant.LoginIdentifierRateLimit, Window: constant.LoginIdentifierRateWindow, Key: ratelimit.LoginIdentifier})
+	// the lockout stops guessing the codes of one account, this stops spreading guesses over many
+	totpLimit := ratelimit.Limit(rateLimitStore, appLogger,
+		ratelimit.Rule{Name: "login_totp", Limit: constant.LoginRateLimit, Window: constant.LoginRateWindow, Key: ratelimit.ClientIP})
+	passwordResetLimit := ratelimit.Limit(rateLimitStore, appLogger,
+		ratelimit.Rule{Name: "password_reset", Limit: constant.PasswordResetRateLimit, Window: constant.PasswordResetRateWindow, Key: ratelimit.ClientIP})
+
 	auth := v1.Group("auth")
-	auth.POST("", authController.Login)
+	auth.POST("", loginLimit, authController.Login)
 	auth.PATCH("forgot", authController.ForgotPassword)
+	auth.POST("refresh", authController.Refresh)
+	auth.POST("totp", totpLimit, authController.LoginTOTP)
+
+	// protected routes read the account id the middleware stores in the context. After an admin reset
+	// the password the tokens of the account only read it, change the password and log out
+	authRequired := authMiddleware.AuthRequired()
+	authMiddleware.AllowDuringPasswordChange("GET", "/v1/accounts")
+	authMiddleware.AllowDuringPasswordChange("PATCH", "/v1/accounts/password")
+	authMiddleware.AllowDuringPasswordChange("POST", "/v1/auth/logout")
+	auth.POST("logout", authRequired, authController.Logout)
+	// admin only routes: accounts list, :id and its suspend, activate and reset-password, auth/diagnose,
+	// verification/bulk, export, integrity, merge, restore, role, bulk and its jobs, the security reports and audit verify.
+	// The handlers still check the stored role since a demoted admin keeps the claim until the token expires.
+	// :id/audit stays on authRequired, an account can read its own trail
+	requireAdmin := authMiddleware.RequireRole(constant.RoleAdmin)
 
 	accounts := v1.Group("accounts")
-	accounts.GET("", accountController.Get)
-	accounts.POST("register", accountController.Register)
-	accounts.PATCH("", accountController.Update)
-	accounts.DELETE("", accountController.Delete)
+	accounts.GET("", authRequired, accountController.Get)
+	accounts.GET("list", authRequired, requireAdmin, accountController.List)
+	accounts.GET(":id", authRequired, requireAdmin, accountController.GetByID)
+	accounts.POST(":id/suspend", authRequired, requireAdmin, accountController.Suspend)
+	accounts.POST(":id/activate", authRequired, requireAdmin, accountController.Activate)
+	accounts.POST(":id/reset-password", authRequired, requireAdmin, accountController.AdminResetPassword)
+	accounts.POST("register", registerLimit, idempotency.Middleware(idempotencyStore, "register"), accountController.Register)
+	accounts.POST("username/reserve", accountController.ReserveUsername)
+	accounts.POST("exists", accountController.ProbeExistence)
+	accounts.POST("auth/diagnose", authRequired, requireAdmin, accountController.DiagnoseLogin)
+	accounts.PATCH("", authRequired, accountController.Update)
+	accounts.PATCH("password", authRequired, accountController.ChangePassword)
+	accounts.POST("password/reset-request", passwordResetLimit, accountController.RequestPasswordReset)
+	accounts.POST("password/reset", accountController.ResetPassword)
+	accounts.PUT("me", authRequired, accountController.Replace)
+	accounts.GET("me/permissions", authRequired, accountController.GetPermissions)
+	accounts.GET("me/storage", authRequired, accountController.GetStorageUsage)
+	accounts.GET("sessions", authRequired, securityController.GetSessions)
+	accounts.DELETE("sessions/:id", authRequired, securityController.DeleteSession)
+	accounts.GET("me/bundle", authRequired, accountController.GetBundle)
+	accounts.POST("terms", authRequired, accountController.AcceptTerms)
+	accounts.GET("email/confirm", accountController.ConfirmEmailChange)
+	accounts.DELETE("", authRequired, accountController.Delete)
+	accounts.POST("deletion/cancel", authRequired, accountController.CancelDeletion)
+	accounts.POST("totp", authRequired, accountController.EnableTOTP)
+	accounts.POST("totp/confirm", authRequired, accountController.ConfirmTOTP)
+	accounts.GET("card", authRequired, accountController.GetCard)
+	accounts.GET(":id/card", accountController.GetCardByID)
+	accounts.GET(":id/audit", authRequired, auditController.GetAccountTrail)
+	accounts.GET("handle/:slug", accountController.GetCardByHandle)
+	accounts.PATCH("handle", authRequired, accountController.UpdateHandle)
+	accounts.POST("avatar", authRequired, accountController.UploadAvatar)
+	accounts.GET("visibility", authRequired, accountController.GetVisibility)
+	accounts.PATCH("visibility", authRequired, accountController.UpdateVisibility)
+	accounts.GET("security/failed-logins", authRequired, requireAdmin, securityController.GetFailedLogins)
+	accounts.GET("security/failed-registrations", authRequired, requireAdmin, securityController.GetFailedRegistrations)
+	accounts.GET("verify", accountController.VerifyEmail)
+	accounts.POST("verification/resend", authRequired, accountController.ResendVerification)
+	accounts.POST("verification/bulk", authRequired, requireAdmin, accountController.SendVerificationBulk)
+	accounts.GET("export", authRequired, requireAdmin, accountController.Export)
+	accounts.GET("integrity", authRequired, requireAdmin, accountController.ScanIntegrity)
+	accounts.POST("merge", authRequired, requireAdmin, accountController.MergeAccounts)
+	accounts.POST("restore", authRequired, requireAdmin, accountController.Restore)
+	accounts.PATCH("role", authRequired, requireAdmin, accountController.UpdateRole)
+	accounts.POST("bulk", authRequired, requireAdmin, accountController.BulkCreate)
+	accounts.GET("bulk/:jobId", authRequired, requireAdmin, accountController.GetImportJob)
+	accounts.GET("bulk/:jobId/errors", authRequired, requireAdmin, accountController.GetImportJobErrors)
+	accounts.GET("webhooks", authRequired, webhookController.Get)
+	accounts.POST("webhooks", authRequired, webhookController.Create)
+	accounts.DELETE("webhooks/:id", authRequired, webhookController.Delete)
+
+	audit := v1.Group("audit")
+	audit.GET("verify", authRequired, requireAdmin, auditController.VerifyChain)
 
 	attendance := v1.Group("attendance")
-	attendance.GET("history", attendanceController.Get)
-	attendance.GET("locations", attendanceController.GetByLocation)
-	attendance.POST("", attendanceController.Add)
+	attendance.GET("history", authRequired, attendanceController.Get)
+	attendance.GET("locations", authRequired, attendanceController.GetByLocation)
+	attendance.POST("", authRequired, attendanceController.Add)
 
 	location := v1.Group("locations")
-	location.GET("", locationController.Get)
-	location.POST("", locationController.Create)
-	location.PATCH("", locationController.Update)
-	location.DELETE("", locationController.Delete)
+	location.GET("", authRequired, locationController.Get)
+	location.POST("", authRequired, locationController.Create)
+	location.PATCH("", authRequired, locationController.Update)
+	location.DELETE("", authRequired, locationController.Delete)
 
 	// endpoint v2
 
@@ -1,50 +1,202 @@
 package account
 
 import (
-	"log"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/forkyid/go-utils/v1/aes"
+	"github.com/forkyid/go-utils/v1/cache"
+	"github.com/go-redis/redis"
+	"github.com/forkyid/go-utils/v1/validation"
 	"github.com/jinzhu/copier"
 	"github.com/pkg/errors"
 	"go-rest-api/src/constant"
 	"go-rest-api/src/http"
 	"go-rest-api/src/model"
-	"go-rest-api/src/pkg/bcrypt"
+	"go-rest-api/src/pkg/coalesce"
+	"go-rest-api/src/pkg/emailcanon"
+	"go-rest-api/src/pkg/enum"
+	"go-rest-api/src/pkg/etag"
+	"go-rest-api/src/pkg/fieldcrypt"
+	"go-rest-api/src/pkg/nik"
+	"go-rest-api/src/pkg/i18n"
+	"go-rest-api/src/pkg/imageproc"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/metrics"
+	"go-rest-api/src/pkg/permission"
+	"go-rest-api/src/pkg/phone"
+	"go-rest-api/src/pkg/notifier"
+	"go-rest-api/src/pkg/pagination"
+	"go-rest-api/src/pkg/publicid"
+	"go-rest-api/src/pkg/passwordhash"
+	"go-rest-api/src/pkg/slidingwindow"
+	"go-rest-api/src/pkg/slug"
+	"go-rest-api/src/pkg/storage"
+	"go-rest-api/src/pkg/token"
+	"go-rest-api/src/pkg/totp"
+	"go-rest-api/src/pkg/transform"
 	"go-rest-api/src/repository/v1/account"
+	"go-rest-api/src/repository/v1/verification"
 	"gorm.io/gorm"
 )
 
 type Service struct {
-	repo account.Repositorier
+	repo         account.Repositorier
+	verification verification.Repositorier
+	notifier     notifier.Notifier
+	storage      storage.Storage
+	limiter      *slidingwindow.Limiter
+	updates      *coalesce.Group
+	avatarPool   *imageproc.Pool
+	hooks        []Hook
+	transforms   transform.Pipelines
+	// totpCipher seals the two factor secrets, nil when TOTP_ENCRYPTION_KEY is not set
+	totpCipher *fieldcrypt.Cipher
+	logger     *logger.Logger
+}
+
+// totpSecretField is authenticated with the sealed secret so it cannot be moved into another column
+const totpSecretField = "totp_secret"
+
+// Hook lets deployments provision default resources for new accounts.
+// Hooks run after the registration is committed and their errors never fail it.
+type Hook interface {
+	OnAccountCreated(accountID int) (err error)
+}
+
+// NoopHook is the default hook, it does nothing
+type NoopHook struct{}
+
+func (NoopHook) OnAccountCreated(accountID int) (err error) {
+	return
 }
 
 func NewService(
 	repositorier account.Repositorier,
+	verificationRepo verification.Repositorier,
+	notifierer notifier.Notifier,
+	objectStorage storage.Storage,
+	fieldTransforms transform.Pipelines,
+	totpCipher *fieldcrypt.Cipher,
+	appLogger *logger.Logger,
 ) *Service {
 	return &Service{
-		repo: repositorier,
+		repo:         repositorier,
+		verification: verificationRepo,
+		notifier:     notifierer,
+		storage:      objectStorage,
+		limiter:      slidingwindow.NewLimiter(),
+		updates:      coalesce.NewGroup(constant.UpdateCoalesceWindow),
+		avatarPool:   imageproc.NewPool(constant.AvatarWorkers, constant.AvatarQueueSize, appLogger),
+		transforms:   fieldTransforms,
+		totpCipher:   totpCipher,
+		logger:       appLogger,
 	}
 }
 
 type Servicer interface {
-	TakeAccountByID(accountID int) (accounts http.GetUser, err error)
-	TakeAccountByKTPNumber(ktpNumber string) (account model.Account, err error)
-	TakeAccountByUsername(username string) (account model.Account, err error)
-	Find(accountIDs []int) (accounts []http.GetUser, err error)
-	CheckAccountByID(accountID int) (exist bool, err error)
-	CheckAccountByEmail(email string) (exist bool, err error)
-	CheckAccountByKTPNumber(ktpNumber string) (exist bool, err error)
-	CheckAccountByPhoneNumber(phoneNumber string) (exist bool, err error)
-	CheckAccountByUsername(username string) (exist bool, err error)
-	Create(request http.RegisterUser) (err error)
-	Update(accountID int, request http.UpdateUser) (err error)
-	UpdatePassword(request http.ForgotPassword) (err error)
-	Delete(accountID int) (err error)
+	TakeAccountByID(ctx context.Context, accountID int) (accounts http.GetUser, err error)
+	TakeAccountByKTPNumber(ctx context.Context, ktpNumber string) (account model.Account, err error)
+	TakeAccountByUsername(ctx context.Context, username string) (account model.Account, err error)
+	Authenticate(ctx context.Context, request http.LoginUser) (account model.Account, err error)
+	Find(ctx context.Context, accountIDs []int) (accounts []http.GetUser, err error)
+	CheckAccountByID(ctx context.Context, accountID int) (exist bool, err error)
+	TakeRefreshableAccount(ctx context.Context, accountID int) (account model.Account, err error)
+	CheckAccountByEmail(ctx context.Context, email string) (exist bool, err error)
+	CheckAccountByKTPNumber(ctx context.Context, ktpNumber string) (exist bool, err error)
+	CheckAccountByPhoneNumber(ctx context.Context, phoneNumber string) (exist bool, err error)
+	CheckAccountByUsername(ctx context.Context, username string) (exist bool, err error)
+	CheckAdminByID(ctx context.Context, accountID int) (isAdmin bool, err error)
+	Create(ctx context.Context, request http.RegisterUser) (accountID int, err error)
+	ReserveUsername(ctx context.Context, request http.ReserveUsername, ipAddress string) (reservation http.UsernameReservation, err error)
+	Update(ctx context.Context, accountID int, request http.UpdateUser) (coalesced bool, err error)
+	Replace(ctx context.Context, accountID int, ifMatch string, request http.ReplaceUser) (tag string, err error)
+	AccountETag(account http.GetUser) (tag string)
+	UpdatePassword(ctx context.Context, request http.ForgotPassword) (err error)
+	ChangePassword(ctx context.Context, accountID int, oldPassword, newPassword string) (err error)
+	AdminResetPassword(ctx context.Context, adminID, accountID int, password string) (temporary string, err error)
+	CreateResetToken(ctx context.Context, email string) (err error)
+	ResetPassword(ctx context.Context, plainToken, newPassword string) (accountID int, err error)
+	Delete(ctx context.Context, accountID int) (err error)
+	RequestDeletion(ctx context.Context, accountID int) (scheduledAt time.Time, err error)
+	CancelDeletion(ctx context.Context, accountID int) (err error)
+	Restore(ctx context.Context, accountID int) (err error)
+	UpdateRole(ctx context.Context, adminID, accountID int, role string) (previous string, err error)
+	Suspend(ctx context.Context, accountID int, reason string) (err error)
+	Activate(ctx context.Context, accountID int) (err error)
+	PurgeDeleted(ctx context.Context, before time.Time) (purged int64, err error)
+	HasPermission(ctx context.Context, accountID int, permission string) (granted bool, err error)
+	Export(ctx context.Context, afterID int, includePII bool, write func(line http.ExportAccount) error) (err error)
+	ExportSorted(ctx context.Context, sort, order string, includePII bool, write func(line http.ExportAccount) error) (err error)
+	ScanIntegrity(ctx context.Context) (result http.IntegrityScan, err error)
+	ListAccounts(ctx context.Context, params http.ListAccounts) (accounts []http.GetUser, total int64, err error)
+	MergeAccounts(ctx context.Context, sourceID, targetID int, strategy string, overrides map[string]string) (report http.MergeReport, err error)
+	AcceptTerms(ctx context.Context, accountID int, request http.AcceptTerms) (err error)
+	UploadAvatar(ctx context.Context, accountID int, original []byte) (photoURL string, err error)
+	MustChangePassword(account model.Account) bool
+	PasswordUnmetRules(account model.Account) (unmet []string)
+	TOTPEnabled(account model.Account) bool
+	EnableTOTP(ctx context.Context, accountID int) (enrollment http.TOTPEnrollment, err error)
+	ConfirmTOTP(ctx context.Context, accountID int, code string) (err error)
+	VerifyTOTP(ctx context.Context, accountID int, code string) (account model.Account, err error)
+	RecordLogin(accountID int)
+	FindInactive(ctx context.Context, since time.Time, afterID, limit int) (accounts []model.Account, err error)
+	DeletionScheduledAt(account model.Account) *time.Time
+	CheckPasswordStrength(ctx context.Context, account model.Account, password string) (unmet []string, err error)
+	UpgradePasswordHash(ctx context.Context, account model.Account, password string) (err error)
+	TakeCard(ctx context.Context, accountID, viewerID int) (card http.GetCard, err error)
+	TakeCardByHandle(ctx context.Context, handle string, viewerID int) (card http.GetCard, err error)
+	UpdateHandle(ctx context.Context, accountID int, request http.UpdateHandle) (err error)
+	TakePermissions(ctx context.Context, accountID int) (permissions http.GetPermissions, err error)
+	StorageUsage(ctx context.Context, accountID int) (usage http.StorageUsage, err error)
+	ConfirmEmailChange(ctx context.Context, plainToken string) (err error)
+	ProbeExistence(ctx context.Context, request http.ExistenceProbe, ipAddress string, reveal bool) (result http.ExistenceProbeResult, err error)
+	DiagnoseLogin(ctx context.Context, adminID int, request http.DiagnoseLogin) (diagnosis http.LoginDiagnosis, err error)
+	TakeVisibility(ctx context.Context, accountID int) (visibility map[string]string, err error)
+	UpdateVisibility(ctx context.Context, accountID int, request http.UpdateVisibility) (err error)
+	SendVerificationBulk(ctx context.Context, request http.SendVerificationBulk) (count int, err error)
+	ResendVerification(ctx context.Context, accountID int) (err error)
+	VerifyEmail(ctx context.Context, plainToken string) (err error)
+	ValidateAccountFields(ctx context.Context, request http.RegisterUser) (fieldErrors map[string]string, err error)
+	ValidateBulk(ctx context.Context, requests []http.RegisterUser) (report http.BulkValidationReport, err error)
+}
+
+// bind returns ctx bounded by timeout and a copy of the service whose account repository runs its statements
+// under it, a non positive timeout only ends with ctx. Work that outlives the request, like the avatar jobs,
+// keeps using the unbound service
+func (svc *Service) bind(ctx context.Context, timeout time.Duration) (bounded context.Context, bound *Service, cancel context.CancelFunc) {
+	if timeout > 0 {
+		bounded, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		bounded, cancel = context.WithCancel(ctx)
+	}
+	return bounded, svc.withRepo(svc.repo.WithContext(bounded)), cancel
+}
+
+// AddHook registers a hook invoked after every successful registration
+func (svc *Service) AddHook(hook Hook) {
+	svc.hooks = append(svc.hooks, hook)
 }
 
-func (svc *Service) TakeAccountByID(accountID int) (account http.GetUser, err error) {
-	takeUser, err := svc.repo.TakeAccountByID(accountID)
+// TakeAccountByID reads the account through the cache, a miss or an unavailable cache reads the database
+// within AccountReadTimeout and caches the result for AccountCacheTTL
+func (svc *Service) TakeAccountByID(ctx context.Context, accountID int) (account http.GetUser, err error) {
+	if cached, ok := svc.cachedAccount(accountID); ok {
+		return cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	takeUser, err := svc.repo.WithContext(ctx).TakeAccountByID(accountID)
 	if err == gorm.ErrRecordNotFound {
 		err = constant.ErrAccountNotRegistered
 		return
@@ -55,11 +207,177 @@ func (svc *Service) TakeAccountByID(accountID int) (account http.GetUser, err er
 
 	account = http.GetUser{}
 	copier.Copy(&account, &takeUser)
-	account.ID = aes.Encrypt(int(takeUser.ID))
+	account.ID = publicid.Encode(int(takeUser.ID))
+	account.TermsAcceptanceRequired = takeUser.TermsVersion != constant.TermsVersion
+	account.MustChangePassword = svc.MustChangePassword(takeUser)
+	account.PasswordUnmetRules = weakPasswordRules(takeUser)
+	account.WeakPassword = len(account.PasswordUnmetRules) > 0
+	account.AvatarVariants = avatarVariants(takeUser)
+	account.PhotoURL = photoURL(takeUser)
+	account.DeletionScheduledAt = svc.DeletionScheduledAt(takeUser)
+	account.TwoFactorEnabled = svc.TOTPEnabled(takeUser)
+	if !emailChangePending(takeUser) {
+		account.PendingEmail = ""
+	}
+	svc.cacheAccount(accountID, account)
+	return
+}
+
+// accountCacheKey keys the cached account, the service name keeps services sharing a redis apart
+func accountCacheKey(accountID int) string {
+	return fmt.Sprintf("%s:account:%d", constant.ServiceName, accountID)
+}
+
+// accountCacheRetryAt is the unix nano time reads and writes of the cache resume after it failed,
+// until then they go to the database without waiting on an unavailable redis
+var accountCacheRetryAt int64
+
+func accountCacheUsable() bool {
+	return constant.AccountCacheTTL > 0 && time.Now().UnixNano() >= atomic.LoadInt64(&accountCacheRetryAt)
+}
+
+func (svc *Service) accountCacheFailed(action string, accountID int, err error) {
+	atomic.StoreInt64(&accountCacheRetryAt, time.Now().Add(constant.AccountCacheRetryAfter).UnixNano())
+	svc.logger.Error(action+" failed", "account_id", accountID, "error", err)
+}
+
+func (svc *Service) cachedAccount(accountID int) (account http.GetUser, ok bool) {
+	if !accountCacheUsable() {
+		return
+	}
+	err := cache.GetUnmarshal(accountCacheKey(accountID), &account)
+	if err == redis.Nil {
+		return
+	} else if err != nil {
+		svc.accountCacheFailed("get cached account", accountID, err)
+		return
+	}
+	return account, true
+}
+
+func (svc *Service) cacheAccount(accountID int, account http.GetUser) {
+	if !accountCacheUsable() {
+		return
+	}
+	err := cache.SetJSON(accountCacheKey(accountID), account, int(constant.AccountCacheTTL.Seconds()))
+	if err != nil {
+		svc.accountCacheFailed("cache account", accountID, err)
+	}
+}
+
+// invalidateAccount drops the cached account after a write, failed writes included since they may have
+// been applied before failing. It is tried even while the cache is failing, a failed delete leaves
+// the entry until it expires
+func (svc *Service) invalidateAccount(accountID int) {
+	if constant.AccountCacheTTL <= 0 {
+		return
+	}
+	if err := cache.Delete(accountCacheKey(accountID)); err != nil {
+		svc.accountCacheFailed("invalidate cached account", accountID, err)
+	}
+}
+
+// MustChangePassword reports whether an admin reset the password or it exceeded constant.PasswordMaxAge,
+// the account can still authenticate to change it
+func (svc *Service) MustChangePassword(account model.Account) bool {
+	if account.MustChangePassword {
+		return true
+	}
+	if constant.PasswordMaxAge <= 0 {
+		return false
+	}
+
+	changedAt := account.CreatedAt
+	if account.PasswordChangedAt != nil {
+		changedAt = *account.PasswordChangedAt
+	}
+	return time.Since(changedAt) > constant.PasswordMaxAge
+}
+
+// DeletionScheduledAt is when the pending deletion of the account stops being cancellable, nil without one
+func (svc *Service) DeletionScheduledAt(account model.Account) *time.Time {
+	if account.Status != constant.AccountStatusPendingDeletion || account.DeleteRequestedAt == nil {
+		return nil
+	}
+	scheduledAt := account.DeleteRequestedAt.Add(constant.AccountDeletionGrace)
+	return &scheduledAt
+}
+
+// deletionDue reports whether the grace of a pending deletion ended, the account only waits for the purge
+func (svc *Service) deletionDue(account model.Account) bool {
+	scheduledAt := svc.DeletionScheduledAt(account)
+	return scheduledAt != nil && !scheduledAt.After(time.Now())
+}
+
+// CheckPasswordStrength checks the plaintext password against the current policy on login,
+// the result is stored so it is also reported outside of login
+func (svc *Service) CheckPasswordStrength(ctx context.Context, account model.Account, password string) (unmet []string, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	rules := unmetPasswordRules(password)
+	json.Unmarshal([]byte(rules), &unmet)
+	if rules == account.WeakPasswordRules {
+		return
+	}
+
+	err = svc.repo.UpdateFields(int(account.ID), map[string]interface{}{
+		"weak_password_rules": rules,
+	})
+	svc.invalidateAccount(int(account.ID))
+	if err != nil {
+		err = errors.Wrap(err, "update weak password rules")
+		return
+	}
+	return
+}
+
+// UpgradePasswordHash rehashes a verified password stored with another algorithm than PasswordHashAlgorithm,
+// with weaker parameters or in plaintext, the password itself does not change so password_changed_at is kept
+func (svc *Service) UpgradePasswordHash(ctx context.Context, account model.Account, password string) (err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	if !passwordhash.NeedsUpgrade(constant.PasswordHashAlgorithm, account.Password) {
+		return
+	}
+
+	hashedPassword, err := passwordhash.Hash(constant.PasswordHashAlgorithm, password)
+	if err != nil {
+		err = errors.Wrap(err, "hash password")
+		return
+	}
+	err = svc.repo.UpdateFields(int(account.ID), map[string]interface{}{
+		"password": hashedPassword,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "update password hash")
+		return
+	}
+	return
+}
+
+// unmetPasswordRules returns the json array stored in model.Account.WeakPasswordRules
+func unmetPasswordRules(password string) string {
+	rules, _ := json.Marshal(constant.PasswordPolicy.Unmet(password))
+	return string(rules)
+}
+
+// PasswordUnmetRules are the rules the password did not meet when it was last checked on login,
+// the second step of a two factor login reports them without the password
+func (svc *Service) PasswordUnmetRules(account model.Account) (unmet []string) {
+	return weakPasswordRules(account)
+}
+
+func weakPasswordRules(account model.Account) (rules []string) {
+	if account.WeakPasswordRules == "" {
+		return
+	}
+	json.Unmarshal([]byte(account.WeakPasswordRules), &rules)
 	return
 }
 
-func (svc *Service) TakeAccountByKTPNumber(ktpNumber string) (account model.Account, err error) {
+func (svc *Service) TakeAccountByKTPNumber(ctx context.Context, ktpNumber string) (account model.Account, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
 	account, err = svc.repo.TakeAccountByKTPNumber(ktpNumber)
 	if err == gorm.ErrRecordNotFound {
 		err = constant.ErrAccountNotRegistered
@@ -71,7 +389,9 @@ func (svc *Service) TakeAccountByKTPNumber(ktpNumber string) (account model.Acco
 	return
 }
 
-func (svc *Service) TakeAccountByUsername(username string) (account model.Account, err error) {
+func (svc *Service) TakeAccountByUsername(ctx context.Context, username string) (account model.Account, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
 	account, err = svc.repo.TakeAccountByUsername(username)
 	if err == gorm.ErrRecordNotFound {
 		err = constant.ErrAccountNotRegistered
@@ -83,8 +403,115 @@ func (svc *Service) TakeAccountByUsername(username string) (account model.Accoun
 	return
 }
 
-func (svc *Service) Find(accountIDs []int) (accounts []http.GetUser, err error) {
-	users, err := svc.repo.Find(accountIDs)
+// Authenticate verifies the password of the account identified by the username or the email
+// Authenticate locks the account for LoginLockoutCooldown after LoginLockoutThreshold consecutive failures.
+// Failures for unknown usernames and emails are counted in memory the same way, so a lockout does not tell
+// whether the account exists, and their password is checked against a dummy hash so they take as long
+func (svc *Service) Authenticate(ctx context.Context, request http.LoginUser) (account model.Account, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	identifier := request.Username
+	if request.Username != "" {
+		account, err = svc.repo.TakeAccountByUsername(request.Username)
+	} else {
+		identifier = emailcanon.Normalize(request.Email)
+		account, err = svc.repo.TakeAccountByEmail(identifier)
+	}
+	if err == gorm.ErrRecordNotFound {
+		compareDummyHash(request.Password)
+		err = constant.ErrAccountNotRegistered
+		if constant.LoginLockoutThreshold > 0 {
+			allowed, _ := svc.limiter.Reserve(slidingwindow.Rule{
+				Key:    fmt.Sprintf("lockout:%s", strings.ToLower(identifier)),
+				Limit:  constant.LoginLockoutThreshold,
+				Window: constant.LoginLockoutCooldown,
+			})
+			if !allowed {
+				err = constant.ErrAccountLocked
+			}
+		}
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+
+	now := time.Now().UTC()
+	if account.LockedUntil != nil && account.LockedUntil.After(now) {
+		err = constant.ErrAccountLocked
+		return
+	}
+
+	if passwordhash.Compare(account.Password, request.Password) != nil {
+		err = constant.ErrInvalidPassword
+		if updateErr := svc.countFailedLogin(account, now); updateErr != nil {
+			err = updateErr
+		}
+		return
+	}
+
+	// with two factor on the count is reset by VerifyTOTP, the password alone must not clear the failed codes
+	if (account.FailedLoginCount > 0 || account.LockedUntil != nil) && !svc.TOTPEnabled(account) {
+		err = svc.repo.UpdateLoginState(int(account.ID), 0, nil)
+		if err != nil {
+			err = errors.Wrap(err, "reset login state")
+			return
+		}
+	}
+	// checked after the password so an unverified or suspended account is not revealed to a wrong password,
+	// an account past its deletion grace is already gone for its owner
+	if svc.deletionDue(account) {
+		err = constant.ErrAccountNotRegistered
+		return
+	}
+	if account.Status == constant.AccountStatusSuspended {
+		err = constant.ErrAccountSuspended
+		return
+	}
+	if constant.RequireVerifiedLogin && !account.IsVerified {
+		err = constant.ErrAccountNotVerified
+		return
+	}
+	return
+}
+
+// dummyHash is hashed once with the configured algorithm, so comparing with it costs what a stored hash does
+var dummyHash = struct {
+	once sync.Once
+	hash string
+}{}
+
+// compareDummyHash spends the time of a password check on a login without an account
+func compareDummyHash(password string) {
+	dummyHash.once.Do(func() {
+		dummyHash.hash, _ = passwordhash.Hash(constant.PasswordHashAlgorithm, "dummy password of an unknown account")
+	})
+	passwordhash.Compare(dummyHash.hash, password)
+}
+
+// countFailedLogin moves the account towards the lockout, wrong passwords and wrong two factor codes count alike
+func (svc *Service) countFailedLogin(account model.Account, now time.Time) (err error) {
+	if constant.LoginLockoutThreshold <= 0 {
+		return
+	}
+	// concurrent failures may be counted once, the lockout only gets slightly later
+	failedLoginCount := account.FailedLoginCount + 1
+	var lockedUntil *time.Time
+	if failedLoginCount >= constant.LoginLockoutThreshold {
+		until := now.Add(constant.LoginLockoutCooldown)
+		lockedUntil = &until
+		failedLoginCount = 0
+	}
+	if err = svc.repo.UpdateLoginState(int(account.ID), failedLoginCount, lockedUntil); err != nil {
+		err = errors.Wrap(err, "update login state")
+	}
+	return
+}
+
+func (svc *Service) Find(ctx context.Context, accountIDs []int) (accounts []http.GetUser, err error) {
+	ctx, cancel := context.WithTimeout(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	users, err := svc.repo.WithContext(ctx).Find(accountIDs)
 	if err != nil {
 		err = errors.Wrap(err, "find accounts")
 		return
@@ -92,16 +519,95 @@ func (svc *Service) Find(accountIDs []int) (accounts []http.GetUser, err error)
 	for i := range users {
 		account := http.GetUser{}
 		copier.Copy(&account, &users[i])
-		account.ID = aes.Encrypt(int(users[i].ID))
-		log.Print(users[i].PhotoURL)
+		account.ID = publicid.Encode(int(users[i].ID))
+		account.TermsAcceptanceRequired = users[i].TermsVersion != constant.TermsVersion
+		account.MustChangePassword = svc.MustChangePassword(users[i])
+		account.PasswordUnmetRules = weakPasswordRules(users[i])
+		account.WeakPassword = len(account.PasswordUnmetRules) > 0
+		account.AvatarVariants = avatarVariants(users[i])
+		account.PhotoURL = photoURL(users[i])
 		accounts = append(accounts, account)
 	} 
 	return
 }
 
-func (svc *Service) CheckAccountByID(accountID int) (exist bool, err error) {
+// listSortColumns maps the sortable GetUser fields to their column
+var listSortColumns = map[string]string{
+	"id":         "id",
+	"username":   "username",
+	"fullname":   "full_name",
+	"handle":     "handle",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// listSort resolves the sort and order params of the list, an empty sort and order default to id ascending
+func listSort(sort, order string) (column string, desc bool, err error) {
+	if sort == "" {
+		sort = "id"
+	}
+	column, ok := listSortColumns[sort]
+	if !ok {
+		err = constant.ErrInvalidSortField
+		return
+	}
+	if order == "" {
+		order = constant.SortOrderAsc
+	}
+	if order != constant.SortOrderAsc && order != constant.SortOrderDesc {
+		err = constant.ErrInvalidSortOrder
+		return
+	}
+	return column, order == constant.SortOrderDesc, nil
+}
+
+// ListAccounts pages every account, an empty sort and order default to id ascending
+// ListAccounts reads the page and the total within AccountListTimeout
+func (svc *Service) ListAccounts(ctx context.Context, params http.ListAccounts) (accounts []http.GetUser, total int64, err error) {
+	column, desc, err := listSort(params.Sort, params.Order)
+	if err != nil {
+		return
+	}
+
+	pgn := pagination.Pagination{
+		Limit: params.Limit,
+		Page:  params.Page,
+	}
+	pgn.Paginate()
+	ctx, cancel := context.WithTimeout(ctx, constant.AccountListTimeout)
+	defer cancel()
+	users, total, err := svc.repo.WithContext(ctx).FindPage(column, desc, pgn)
+	if err != nil {
+		err = errors.Wrap(err, "find accounts page")
+		return
+	}
+
+	accounts = []http.GetUser{}
+	for i := range users {
+		account := http.GetUser{}
+		copier.Copy(&account, &users[i])
+		account.ID = publicid.Encode(int(users[i].ID))
+		account.TermsAcceptanceRequired = users[i].TermsVersion != constant.TermsVersion
+		account.MustChangePassword = svc.MustChangePassword(users[i])
+		account.PasswordUnmetRules = weakPasswordRules(users[i])
+		account.WeakPassword = len(account.PasswordUnmetRules) > 0
+		account.AvatarVariants = avatarVariants(users[i])
+		account.PhotoURL = photoURL(users[i])
+		account.DeletionScheduledAt = svc.DeletionScheduledAt(users[i])
+		account.TwoFactorEnabled = svc.TOTPEnabled(users[i])
+		if !emailChangePending(users[i]) {
+			account.PendingEmail = ""
+		}
+		accounts = append(accounts, account)
+	}
+	return
+}
+
+func (svc *Service) CheckAccountByID(ctx context.Context, accountID int) (exist bool, err error) {
 	exist = false
-	_, err = svc.repo.TakeAccountByID(accountID)
+	ctx, cancel := context.WithTimeout(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	_, err = svc.repo.WithContext(ctx).TakeAccountByID(accountID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			exist = false
@@ -116,9 +622,44 @@ func (svc *Service) CheckAccountByID(accountID int) (exist bool, err error) {
 	return
 }
 
-func (svc *Service) CheckAccountByEmail(email string) (exist bool, err error) {
+// TakeRefreshableAccount reads the account a token is refreshed for within AccountReadTimeout, it fails with
+// constant.ErrAccountNotRegistered for a missing account or one past its deletion grace and
+// constant.ErrAccountSuspended for a suspended one
+func (svc *Service) TakeRefreshableAccount(ctx context.Context, accountID int) (account model.Account, err error) {
+	ctx, cancel := context.WithTimeout(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	account, err = svc.repo.WithContext(ctx).TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take refreshable account")
+		return
+	}
+
+	if svc.deletionDue(account) {
+		err = constant.ErrAccountNotRegistered
+		return
+	}
+	if account.Status == constant.AccountStatusSuspended {
+		err = constant.ErrAccountSuspended
+		return
+	}
+	return
+}
+
+// CheckAccountByEmail compares canonical emails when constant.EmailCanonicalization is on,
+// otherwise emails differing in case or surrounding whitespace only are the same
+func (svc *Service) CheckAccountByEmail(ctx context.Context, email string) (exist bool, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
 	exist = false
-	_, err = svc.repo.TakeAccountByEmail(email)
+	email = emailcanon.Normalize(email)
+	if constant.EmailCanonicalization {
+		_, err = svc.repo.TakeAccountByCanonicalEmail(emailcanon.Canonicalize(email, constant.EmailCanonicalProviders))
+	} else {
+		_, err = svc.repo.TakeAccountByEmail(email)
+	}
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			exist = false
@@ -133,7 +674,9 @@ func (svc *Service) CheckAccountByEmail(email string) (exist bool, err error) {
 	return
 }
 
-func (svc *Service) CheckAccountByKTPNumber(ktpNumber string) (exist bool, err error) {
+func (svc *Service) CheckAccountByKTPNumber(ctx context.Context, ktpNumber string) (exist bool, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
 	exist = false
 	_, err = svc.repo.TakeAccountByKTPNumber(ktpNumber)
 	if err != nil {
@@ -150,7 +693,9 @@ func (svc *Service) CheckAccountByKTPNumber(ktpNumber string) (exist bool, err e
 	return
 }
 
-func (svc *Service) CheckAccountByPhoneNumber(phoneNumber string) (exist bool, err error) {
+func (svc *Service) CheckAccountByPhoneNumber(ctx context.Context, phoneNumber string) (exist bool, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
 	exist = false
 	_, err = svc.repo.TakeAccountByPhoneNumber(phoneNumber)
 	if err != nil {
@@ -167,7 +712,9 @@ func (svc *Service) CheckAccountByPhoneNumber(phoneNumber string) (exist bool, e
 	return
 }
 
-func (svc *Service) CheckAccountByUsername(username string) (exist bool, err error) {
+func (svc *Service) CheckAccountByUsername(ctx context.Context, username string) (exist bool, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
 	exist = false
 	_, err = svc.repo.TakeAccountByUsername(username)
 	if err != nil {
@@ -184,166 +731,2595 @@ func (svc *Service) CheckAccountByUsername(username string) (exist bool, err err
 	return
 }
 
-func (svc *Service) Create(request http.RegisterUser) (err error) {
-	exist, err := svc.CheckAccountByUsername(request.Username)
-	if err != nil {
+func (svc *Service) CheckAdminByID(ctx context.Context, accountID int) (isAdmin bool, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "check admin by id")
 		return
 	}
 
-	if exist {
-		err = constant.ErrAccountExist
-		return
-	} else {
-		newAccount := model.Account{}
-		copier.Copy(&newAccount, &request)
+	isAdmin = account.Role == constant.RoleAdmin
+	return
+}
 
-		hashedPassword, err := bcrypt.HashPassword(newAccount.Password)
-		if err != nil {
-			err = errors.Wrap(err, "hash password")
-			return err
-		}
-		newAccount.Password = hashedPassword
-		newAccount.PhotoURL = "https://thumbs.dreamstime.com/b/user-profile-avatar-solid-black-line-icon-simple-vector-filled-flat-pictogram-isolated-white-background-134042540.jpg"
-		newAccount.Gender = "none"
-		newAccount.IsVerified = false
+// ConflictError names the registration fields already used by another account,
+// it unwraps to constant.ErrAccountExist
+type ConflictError struct {
+	Fields []string
+	// ReservedUsername is set when the username conflicts with another registration's reservation
+	ReservedUsername bool
+}
 
-		err = svc.repo.Create(newAccount)
-		if err != nil {
-			err = errors.Wrap(err, "create new account")
-			return err
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s", constant.ErrAccountExist.Error(), strings.Join(e.Fields, ", "))
+}
+
+func (e *ConflictError) Unwrap() error {
+	return constant.ErrAccountExist
+}
+
+// Codes maps each conflicting field to its conflict code
+func (e *ConflictError) Codes() map[string]string {
+	codes := map[string]string{}
+	for _, field := range e.Fields {
+		switch field {
+		case "username":
+			codes[field] = constant.ConflictCodeUsername
+			if e.ReservedUsername {
+				codes[field] = constant.ConflictCodeReserved
+			}
+		case "email":
+			codes[field] = constant.ConflictCodeEmail
+		case "phone_number":
+			codes[field] = constant.ConflictCodePhoneNumber
 		}
 	}
-	return
+	return codes
 }
 
-func (svc *Service) Update(accountID int, request http.UpdateUser) (err error) {
-	exist, _ := svc.CheckAccountByID(accountID)
-	if !exist {
-		err = constant.ErrAccountNotRegistered
+// registrationConflict checks every unique field of the registration so all conflicts are reported at once
+func (svc *Service) registrationConflict(ctx context.Context, request http.RegisterUser) (conflict *ConflictError, err error) {
+	conflict = &ConflictError{}
+
+	exist, err := svc.CheckAccountByUsername(ctx, request.Username)
+	if err != nil {
 		return
 	}
-
-	if request.Username != nil {
-		if *request.Username == "" {
-			err = constant.ErrUsernameCannotBeEmpty
+	if exist {
+		conflict.Fields = append(conflict.Fields, "username")
+	} else {
+		conflict.ReservedUsername, err = svc.reservedForOther(request.Username, request.ReservationToken)
+		if err != nil {
 			return
-		} else {
-			usernameExist, _ := svc.CheckAccountByUsername(*request.Username)
-			if usernameExist {
-				err = constant.ErrUsernameAlreadyExist
-				return
-			}
+		}
+		if conflict.ReservedUsername {
+			conflict.Fields = append(conflict.Fields, "username")
 		}
 	}
 
 	if request.Email != nil {
-	    emailExist, _ := svc.CheckAccountByEmail(*request.Email)
-	    if emailExist {
-		    err = constant.ErrEmailAlreadyExist
-		    return
-	    }
-	}
-
-	if request.KTPNumber != nil {
-	    ktpNumberExist, _ := svc.CheckAccountByKTPNumber(aes.Encrypt(*request.KTPNumber))
-	    if ktpNumberExist {
-		    err = constant.ErrKTPNumberAlreadyExist
-		    return
-	    }
+		exist, err = svc.CheckAccountByEmail(ctx, *request.Email)
+		if err != nil {
+			return
+		}
+		if exist {
+			conflict.Fields = append(conflict.Fields, "email")
+		}
 	}
 
-	if request.Password != nil {
-		if *request.Password == "" {
-			err = constant.ErrPasswordCannotBeEmpty
+	if request.PhoneNumber != nil {
+		exist, err = svc.CheckAccountByPhoneNumber(ctx, *request.PhoneNumber)
+		if err != nil {
 			return
-		} else {
-			hashedNewPassword, err := bcrypt.HashPassword(*request.Password)
-			if err != nil {
-				err = errors.Wrap(err, "hash new password")
-				return err
-			}
-			request.Password = &hashedNewPassword
+		}
+		if exist {
+			conflict.Fields = append(conflict.Fields, "phone_number")
 		}
 	}
+	return
+}
 
-	if request.PhoneNumber != nil {
-	    phoneNumberExist, _ := svc.CheckAccountByPhoneNumber(*request.PhoneNumber)
-	    if phoneNumberExist {
-		    err = constant.ErrPhoneNumberAlreadyExist
-		    return
-	    }
+// Create runs the uniqueness checks and the insert in one transaction. A registration racing another for the
+// same username, email or phone number gets the ConflictError of the unique constraint it hits.
+// The verification email and the created hooks run once the account is committed
+func (svc *Service) Create(ctx context.Context, request http.RegisterUser) (accountID int, err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	svc.transforms.Apply(&request)
+	request.Email = normalizeEmail(request.Email)
+	request.PhoneNumber = normalizePhone(request.PhoneNumber)
+	if request.TermsVersion != constant.TermsVersion {
+		err = constant.ErrTermsNotAccepted
+		return
 	}
 
-	account := model.Account{}
-	copier.Copy(&account, &request)
-	if request.KTPNumber != nil {
-	    *account.KTPNumber = aes.Encrypt(*request.KTPNumber)
+	// hashing is slow, it is done before the transaction opens
+	hashedPassword, err := passwordhash.Hash(constant.PasswordHashAlgorithm, request.Password)
+	if err != nil {
+		err = errors.Wrap(err, "hash password")
+		return
 	}
-	if request.DOBString != nil {
-		DOBString, err := time.Parse(constant.DOBFormat, *request.DOBString)
-		if err != nil {
-			err = constant.ErrInvalidDOBFormat
-			return err
+
+	newAccount := model.Account{}
+	err = svc.repo.Transaction(func(repo account.Repositorier) (err error) {
+		newAccount, err = svc.withRepo(repo).create(ctx, request, hashedPassword)
+		return
+	})
+	if column, ok := account.ConflictColumn(err); ok {
+		conflict := &ConflictError{Fields: []string{column}}
+		if _, reported := conflict.Codes()[column]; reported {
+			err = conflict
 		}
-		account.DateOfBirth = DOBString
 	}
-
-	err = svc.repo.Update(accountID, account)
 	if err != nil {
-		err = errors.Wrap(err, "update account")
 		return
 	}
+	accountID = int(newAccount.ID)
+
+	// the username is taken by the account now, a leftover reservation would only expire
+	if err := svc.repo.DeleteUsernameReservation(newAccount.Username); err != nil {
+		svc.logger.Error("delete username reservation failed", "account_id", accountID, "username", newAccount.Username, "error", err)
+	}
+	// the account is created either way, the link can be sent again with ResendVerification
+	if _, err := svc.sendVerification(newAccount); err != nil {
+		svc.logger.Error("send verification failed", "account_id", accountID, "error", err)
+	}
+	svc.runCreatedHooks(accountID)
 	return
 }
 
-func (svc *Service) UpdatePassword(request http.ForgotPassword) (err error) {
-	var accountID int
-	if request.KTPNumber != 0 {
-	    ktpNumberExist, _ := svc.CheckAccountByKTPNumber(aes.Encrypt(request.KTPNumber))
-	    if !ktpNumberExist {
-		    err = constant.ErrAccountNotRegistered
-		    return
-	    }
+func (svc *Service) create(ctx context.Context, request http.RegisterUser, hashedPassword string) (newAccount model.Account, err error) {
+	conflict, err := svc.registrationConflict(ctx, request)
+	if err != nil {
+		return
+	}
+	if len(conflict.Fields) > 0 {
+		err = conflict
+		return
+	}
+
+	copier.Copy(&newAccount, &request)
+	newAccount.WeakPasswordRules = unmetPasswordRules(request.Password)
+	newAccount.Password = hashedPassword
+	newAccount.PhotoURL = constant.DefaultPhotoURL
+	newAccount.Gender = "none"
+	newAccount.IsVerified = false
+	newAccount.Role = constant.RoleUser
+	newAccount.Status = constant.AccountStatusActive
+	if !i18n.IsSupported(newAccount.Locale) {
+		newAccount.Locale = i18n.DefaultLocale
+	}
+	now := time.Now().UTC()
+	newAccount.TermsAcceptedAt = &now
+	newAccount.PasswordChangedAt = &now
+	newAccount.CanonicalEmail = canonicalEmail(newAccount.Email)
+	newAccount.Handle, err = svc.generateHandle(newAccount.FullName)
+	if err != nil {
+		return
+	}
+
+	accountID, err := svc.repo.Create(newAccount)
+	if err != nil {
+		err = errors.Wrap(err, "create new account")
+		return
+	}
+	newAccount.ID = uint(accountID)
+	return
+}
+
+// withRepo returns a copy of the service reading and writing accounts through repo, e.g. a transaction
+func (svc *Service) withRepo(repo account.Repositorier) *Service {
+	scoped := *svc
+	scoped.repo = repo
+	return &scoped
+}
+
+// ReserveUsername holds a free username for UsernameReservationTTL, the plain token is only returned here.
+// It is rate limited per ip so usernames cannot be squatted in bulk.
+func (svc *Service) ReserveUsername(ctx context.Context, request http.ReserveUsername, ipAddress string) (reservation http.UsernameReservation, err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	allowed := svc.limiter.Allow(slidingwindow.Rule{
+		Key:    fmt.Sprintf("reserve:%s", ipAddress),
+		Limit:  constant.UsernameReservationLimit,
+		Window: constant.UsernameReservationWindow,
+	})
+	if !allowed {
+		err = constant.ErrReservationRateExceeded
+		return
+	}
+
+	exist, err := svc.CheckAccountByUsername(ctx, request.Username)
+	if err != nil {
+		return
+	}
+	if exist {
+		err = constant.ErrUsernameAlreadyExist
+		return
+	}
+
+	plain, hashed, err := token.Generate()
+	if err != nil {
+		err = errors.Wrap(err, "generate reservation token")
+		return
+	}
+	now := time.Now().UTC()
+	expiresAt := now.Add(constant.UsernameReservationTTL)
+	reserved, err := svc.repo.ReserveUsername(model.UsernameReservation{
+		Username:  request.Username,
+		TokenHash: hashed,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "reserve username")
+		return
+	}
+	if !reserved {
+		err = constant.ErrUsernameReserved
+		return
+	}
+
+	reservation = http.UsernameReservation{
+		Username:  request.Username,
+		Token:     plain,
+		ExpiresAt: expiresAt,
+	}
+	return
+}
+
+// reservedForOther reports whether an unexpired reservation holds the username for another token
+func (svc *Service) reservedForOther(username, reservationToken string) (reserved bool, err error) {
+	reservation, err := svc.repo.TakeUsernameReservation(username, time.Now().UTC())
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take username reservation")
+		return
+	}
+	reserved = reservationToken == "" ||
+		subtle.ConstantTimeCompare([]byte(token.Hash(reservationToken)), []byte(reservation.TokenHash)) != 1
+	return
+}
+
+// runCreatedHooks runs outside the registration transaction, failures are only logged
+func (svc *Service) runCreatedHooks(accountID int) {
+	for i := range svc.hooks {
+		err := svc.hooks[i].OnAccountCreated(accountID)
+		if err != nil {
+			svc.logger.Error("on account created hook failed", "account_id", accountID, "error", err)
+		}
+	}
+}
+
+// Update folds a double submit of the same payload within UpdateCoalesceWindow into the first update,
+// coalesced reports that the write was skipped and the first result returned
+func (svc *Service) Update(ctx context.Context, accountID int, request http.UpdateUser) (coalesced bool, err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	svc.transforms.Apply(&request)
+	request.Email = normalizeEmail(request.Email)
+	request.PhoneNumber = normalizePhone(request.PhoneNumber)
+	payload, err := json.Marshal(request)
+	if err != nil {
+		err = errors.Wrap(err, "marshal update")
+		return
+	}
+	sum := sha256.Sum256(payload)
+	return svc.updates.Do(strconv.Itoa(accountID), hex.EncodeToString(sum[:]), func() (err error) {
+		var current model.Account
+		var expiresAt time.Time
+		err = svc.repo.Transaction(func(repo account.Repositorier) (err error) {
+			current, expiresAt, err = svc.withRepo(repo).update(ctx, accountID, request)
+			return
+		})
+		if conflict := updateConflict(err); conflict != nil {
+			return conflict
+		} else if err != nil {
+			return
+		}
+
+		if request.Email != nil {
+			err = svc.sendEmailChange(current, *request.Email, expiresAt)
+		}
+		return
+	})
+}
+
+// updateConflicts are the errors of an update racing another write of the same unique value,
+// email is only written when a pending change is confirmed
+var updateConflicts = map[string]error{
+	"username":     constant.ErrUsernameAlreadyExist,
+	"email":        constant.ErrEmailAlreadyExist,
+	"ktp_number":   constant.ErrKTPNumberAlreadyExist,
+	"phone_number": constant.ErrPhoneNumberAlreadyExist,
+}
+
+// updateConflict returns the updateConflicts error of a unique violation, nil for any other error
+func updateConflict(err error) error {
+	column, ok := account.ConflictColumn(err)
+	if !ok {
+		return nil
+	}
+	return updateConflicts[column]
+}
+
+// update checks the uniqueness of the present fields and writes them, it runs in the transaction of Update
+// and returns the current account and expiry an email change is sent with once committed
+func (svc *Service) update(ctx context.Context, accountID int, request http.UpdateUser) (current model.Account, expiresAt time.Time, err error) {
+	exist, _ := svc.CheckAccountByID(ctx, accountID)
+	if !exist {
+		err = constant.ErrAccountNotRegistered
+		return
+	}
+
+	if request.Username != nil {
+		if *request.Username == "" {
+			err = constant.ErrUsernameCannotBeEmpty
+			return
+		} else {
+			usernameExist, _ := svc.CheckAccountByUsername(ctx, *request.Username)
+			if usernameExist {
+				err = constant.ErrUsernameAlreadyExist
+				return
+			}
+		}
+	}
+
+	if request.DisplayName != nil {
+		displayName := strings.TrimSpace(*request.DisplayName)
+		request.DisplayName = &displayName
+		err = svc.checkDisplayName(accountID, displayName)
+		if err != nil {
+			return
+		}
+	}
+
+	if request.Email != nil {
+	    emailExist, _ := svc.CheckAccountByEmail(ctx, *request.Email)
+	    if emailExist {
+		    err = constant.ErrEmailAlreadyExist
+		    return
+	    }
+
+		current, err = svc.repo.TakeAccountByID(accountID)
+		if err != nil {
+			err = errors.Wrap(err, "take account")
+			return
+		}
+		if emailChangePending(current) {
+			err = constant.ErrEmailChangePending
+			return
+		}
+	}
+
+	if request.KTPNumber != nil {
+	    ktpNumberExist, _ := svc.CheckAccountByKTPNumber(ctx, aes.Encrypt(*request.KTPNumber))
+	    if ktpNumberExist {
+		    err = constant.ErrKTPNumberAlreadyExist
+		    return
+	    }
+	}
+
+	weakRules := ""
+	if request.Password != nil {
+		if *request.Password == "" {
+			err = constant.ErrPasswordCannotBeEmpty
+			return
+		} else {
+			weakRules = unmetPasswordRules(*request.Password)
+			hashedNewPassword, hashErr := passwordhash.Hash(constant.PasswordHashAlgorithm, *request.Password)
+			if hashErr != nil {
+				err = errors.Wrap(hashErr, "hash new password")
+				return
+			}
+			request.Password = &hashedNewPassword
+		}
+	}
+
+	if request.Locale != nil && !i18n.IsSupported(*request.Locale) {
+		err = constant.ErrInvalidLocale
+		return
+	}
+
+	if request.PhoneNumber != nil && *request.PhoneNumber != "" {
+	    phoneNumberExist, _ := svc.CheckAccountByPhoneNumber(ctx, *request.PhoneNumber)
+	    if phoneNumberExist {
+		    err = constant.ErrPhoneNumberAlreadyExist
+		    return
+	    }
+	}
+
+	if constant.DOBKTPCheck && (request.KTPNumber != nil || request.DOBString != nil) {
+		err = svc.checkDOBAgainstKTP(accountID, request.KTPNumber, request.DOBString)
+		if err != nil {
+			return
+		}
+	}
+
+	if !svc.allowUpdate(accountID, request.Email != nil, request.Password != nil) {
+		err = constant.ErrUpdateRateExceeded
+		return
+	}
+
+	// only the fields present in the body are written, an empty optional field is cleared to null
+	fields := map[string]interface{}{}
+	if request.Username != nil {
+		fields["username"] = *request.Username
+	}
+	if request.FullName != nil {
+		fields["full_name"] = *request.FullName
+	}
+	if request.DisplayName != nil {
+		fields["display_name"] = nullIfEmpty(request.DisplayName)
+	}
+	if request.Address != nil {
+		fields["address"] = nullIfEmpty(request.Address)
+	}
+	if request.EmployeeNumber != nil {
+		fields["employee_number"] = nullIfEmpty(request.EmployeeNumber)
+	}
+	if request.JobPosition != nil {
+		fields["job_position"] = nullIfEmpty(request.JobPosition)
+	}
+	if request.PhoneNumber != nil {
+		fields["phone_number"] = nullIfEmpty(request.PhoneNumber)
+	}
+	if request.Gender != nil {
+		fields["gender"] = *request.Gender
+	}
+	if request.Locale != nil {
+		fields["locale"] = *request.Locale
+	}
+	if request.KTPNumber != nil {
+		fields["ktp_number"] = aes.Encrypt(*request.KTPNumber)
+	}
+	if request.Password != nil {
+		fields["password"] = *request.Password
+		fields["password_changed_at"] = time.Now().UTC()
+		fields["weak_password_rules"] = weakRules
+	}
+	// the new email is only applied once confirmed
+	expiresAt = time.Now().UTC().Add(constant.EmailChangeTTL)
+	if request.Email != nil {
+		fields["pending_email"] = *request.Email
+		fields["pending_email_expires_at"] = expiresAt
+	}
+	if request.DOBString != nil {
+		var dob time.Time
+		dob, err = parseDOB(*request.DOBString)
+		if err != nil {
+			return
+		}
+		fields["date_of_birth"] = dob
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	err = svc.repo.UpdateFields(accountID, fields)
+	if err != nil {
+		err = errors.Wrap(err, "update account")
+		return
+	}
+	return
+}
+
+// AccountETag hashes the rendered account so the tag changes with every exposed field,
+// including the derived ones and the columns written without touching updated_at
+func (svc *Service) AccountETag(account http.GetUser) (tag string) {
+	content, _ := json.Marshal(account)
+	return etag.FromContent(content)
+}
+
+// Replace overwrites every replaceable field of the account, see http.ReplaceUser for the managed fields.
+// A non empty ifMatch must match the etag of the account as returned by Get.
+func (svc *Service) Replace(ctx context.Context, accountID int, ifMatch string, request http.ReplaceUser) (tag string, err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	request.Email = normalizeEmail(request.Email)
+	request.PhoneNumber = normalizePhone(request.PhoneNumber)
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+
+	if ifMatch != "" {
+		current, err := svc.TakeAccountByID(ctx, accountID)
+		if err != nil {
+			return "", err
+		}
+		if !etag.Match(ifMatch, svc.AccountETag(current)) {
+			return "", constant.ErrPreconditionFailed
+		}
+	}
+
+	if request.DisplayName != nil {
+		displayName := strings.TrimSpace(*request.DisplayName)
+		request.DisplayName = &displayName
+		err = svc.checkDisplayName(accountID, displayName)
+		if err != nil {
+			return
+		}
+	}
+
+	// a change in case only is written right away, the address is the same
+	newEmail := request.Email != nil && (account.Email == nil || !strings.EqualFold(*account.Email, *request.Email))
+	if newEmail {
+		emailExist, _ := svc.CheckAccountByEmail(ctx, *request.Email)
+		if emailExist {
+			err = constant.ErrEmailAlreadyExist
+			return
+		}
+		if emailChangePending(account) {
+			err = constant.ErrEmailChangePending
+			return
+		}
+	}
+
+	if request.PhoneNumber != nil && (account.PhoneNumber == nil || *account.PhoneNumber != *request.PhoneNumber) {
+		phoneNumberExist, _ := svc.CheckAccountByPhoneNumber(ctx, *request.PhoneNumber)
+		if phoneNumberExist {
+			err = constant.ErrPhoneNumberAlreadyExist
+			return
+		}
+	}
+
+	if request.Gender == "" {
+		request.Gender = "none"
+	}
+	if request.Locale == "" {
+		request.Locale = i18n.DefaultLocale
+	} else if !i18n.IsSupported(request.Locale) {
+		err = constant.ErrInvalidLocale
+		return
+	}
+
+	var dateOfBirth interface{}
+	if request.DOBString != nil {
+		dob, err := parseDOB(*request.DOBString)
+		if err != nil {
+			return "", err
+		}
+		dateOfBirth = dob
+		if constant.DOBKTPCheck {
+			err = svc.checkDOBAgainstKTP(accountID, nil, request.DOBString)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	emailChanged := (request.Email == nil) != (account.Email == nil) ||
+		(request.Email != nil && *request.Email != *account.Email)
+	if !svc.allowUpdate(accountID, emailChanged, false) {
+		err = constant.ErrUpdateRateExceeded
+		return
+	}
+
+	updatedAt := time.Now().UTC()
+	fields := map[string]interface{}{
+		"full_name":       request.FullName,
+		"display_name":    request.DisplayName,
+		"email":           request.Email,
+		"canonical_email": canonicalEmail(request.Email),
+		"address":         request.Address,
+		"employee_number": request.EmployeeNumber,
+		"job_position":    request.JobPosition,
+		"phone_number":    request.PhoneNumber,
+		"gender":          request.Gender,
+		"date_of_birth":   dateOfBirth,
+		"locale":          request.Locale,
+		"updated_at":      updatedAt,
+	}
+	// a new email is only applied once confirmed, removing the email is immediate
+	expiresAt := updatedAt.Add(constant.EmailChangeTTL)
+	if newEmail {
+		fields["email"] = account.Email
+		fields["canonical_email"] = canonicalEmail(account.Email)
+		fields["pending_email"] = request.Email
+		fields["pending_email_expires_at"] = expiresAt
+	}
+	err = svc.repo.Replace(accountID, account.UpdatedAt, fields)
+	if errors.Is(err, constant.ErrPreconditionFailed) {
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "replace account")
+		return
+	}
+
+	if newEmail {
+		account.Locale = request.Locale
+		account.FullName = request.FullName
+		err = svc.sendEmailChange(account, *request.Email, expiresAt)
+		if err != nil {
+			return
+		}
+	}
+
+	svc.invalidateAccount(accountID)
+	replaced, err := svc.TakeAccountByID(ctx, accountID)
+	if err != nil {
+		return
+	}
+	tag = svc.AccountETag(replaced)
+	return
+}
+
+// parseDOB reads a YYYY-MM-DD date of birth. Malformed input and days that do not exist like 2021-02-29
+// are constant.ErrInvalidDOBFormat, days after today or more than DOBMaxAgeYears ago constant.ErrDOBOutOfRange
+func parseDOB(value string) (dob time.Time, err error) {
+	dob, err = time.Parse(constant.DOBFormat, value)
+	if err != nil {
+		return time.Time{}, constant.ErrInvalidDOBFormat
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if dob.After(today) || dob.Before(today.AddDate(-constant.DOBMaxAgeYears, 0, 0)) {
+		return time.Time{}, constant.ErrDOBOutOfRange
+	}
+	return
+}
+
+// checkDOBAgainstKTP compares the date of birth with the one the ktp number encodes, a side missing
+// from the request is taken from the account and nothing is checked while either is unknown
+func (svc *Service) checkDOBAgainstKTP(accountID int, ktpNumber *int, dobString *string) (err error) {
+	var current model.Account
+	if ktpNumber == nil || dobString == nil {
+		current, err = svc.repo.TakeAccountByID(accountID)
+		if err != nil {
+			err = errors.Wrap(err, "take account")
+			return
+		}
+	}
+
+	nikNumber := 0
+	if ktpNumber != nil {
+		nikNumber = *ktpNumber
+	} else if current.KTPNumber != nil && *current.KTPNumber != "" {
+		nikNumber = aes.Decrypt(*current.KTPNumber)
+	}
+	dob := current.DateOfBirth
+	if dobString != nil {
+		dob, err = parseDOB(*dobString)
+		if err != nil {
+			return
+		}
+	}
+	if nikNumber <= 0 || dob.IsZero() {
+		return
+	}
+
+	if !nik.MatchesDOB(strconv.Itoa(nikNumber), dob) {
+		err = constant.ErrDOBKTPMismatch
+		return
+	}
+	return
+}
+
+// UpdatePassword sets the password of the account of the ktp number, it is deprecated with PATCH /v1/auth/forgot
+// in favour of CreateResetToken and ResetPassword
+func (svc *Service) UpdatePassword(ctx context.Context, request http.ForgotPassword) (err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	account, err := svc.repo.TakeAccountByKTPNumber(aes.Encrypt(request.KTPNumber))
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account by ktp number")
+		return
+	}
+	accountID := int(account.ID)
+
+	hashedNewPassword, err := passwordhash.Hash(constant.PasswordHashAlgorithm, request.Password)
+	if err != nil {
+		err = errors.Wrap(err, "hash new password")
+		return
+	}
+
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"password":            hashedNewPassword,
+		"weak_password_rules": unmetPasswordRules(request.Password),
+		"password_changed_at": time.Now().UTC(),
+	})
+	svc.invalidateAccount(accountID)
+	if err != nil {
+		err = errors.Wrap(err, "update password")
+		return
+	}
+	return
+}
+
+// ChangePassword sets a new password once the current one is verified, it shares the password update limit with Update
+func (svc *Service) ChangePassword(ctx context.Context, accountID int, oldPassword, newPassword string) (err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	current, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+
+	if passwordhash.Compare(current.Password, oldPassword) != nil {
+		err = constant.ErrPasswordMismatch
+		return
+	}
+	if newPassword == oldPassword {
+		err = constant.ErrPasswordUnchanged
+		return
+	}
+
+	if !svc.allowUpdate(accountID, false, true) {
+		err = constant.ErrUpdateRateExceeded
+		return
+	}
+
+	hashedNewPassword, err := passwordhash.Hash(constant.PasswordHashAlgorithm, newPassword)
+	if err != nil {
+		err = errors.Wrap(err, "hash new password")
+		return
+	}
+
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"password":             hashedNewPassword,
+		"weak_password_rules":  unmetPasswordRules(newPassword),
+		"password_changed_at":  time.Now().UTC(),
+		"must_change_password": false,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "update password")
+		return
+	}
+	return
+}
+
+// AdminResetPassword sets the password of the account for support staff and flags it with must_change_password,
+// the failed logins and the lockout are cleared. An empty password generates one meeting the password policy,
+// temporary is only set then. The admin cannot reset their own password
+func (svc *Service) AdminResetPassword(ctx context.Context, adminID, accountID int, password string) (temporary string, err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	if adminID == accountID {
+		err = constant.ErrSelfPasswordReset
+		return
+	}
+	exist, err := svc.CheckAccountByID(ctx, accountID)
+	if err != nil {
+		return
+	}
+	if !exist {
+		err = constant.ErrAccountNotRegistered
+		return
+	}
+
+	if password == "" {
+		password, err = constant.PasswordPolicy.Generate(constant.TemporaryPasswordLength)
+		if err != nil {
+			err = errors.Wrap(err, "generate temporary password")
+			return
+		}
+		temporary = password
+	}
+	hashedPassword, err := passwordhash.Hash(constant.PasswordHashAlgorithm, password)
+	if err != nil {
+		err = errors.Wrap(err, "hash temporary password")
+		return
+	}
+
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"password":             hashedPassword,
+		"weak_password_rules":  unmetPasswordRules(password),
+		"password_changed_at":  time.Now().UTC(),
+		"must_change_password": true,
+		"failed_login_count":   0,
+		"locked_until":         nil,
+	})
+	if err != nil {
+		temporary = ""
+		err = errors.Wrap(err, "reset password")
+		return
+	}
+	return
+}
+
+// CreateResetToken sends a reset link valid for PasswordResetTTL to the account with the email.
+// An unknown email or a rate limited one returns no error so callers cannot tell accounts apart
+func (svc *Service) CreateResetToken(ctx context.Context, email string) (err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	allowed := svc.limiter.Allow(slidingwindow.Rule{
+		Key:    fmt.Sprintf("reset:%s", strings.ToLower(email)),
+		Limit:  constant.PasswordResetLimit,
+		Window: constant.PasswordResetWindow,
+	})
+	if !allowed {
+		return
+	}
+
+	account, err := svc.repo.TakeAccountByEmail(emailcanon.Normalize(email))
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account by email")
+		return
+	}
+
+	plain, hashed, err := token.Generate()
+	if err != nil {
+		err = errors.Wrap(err, "generate password reset token")
+		return
+	}
+
+	now := time.Now().UTC()
+	err = svc.verification.Create(model.VerificationToken{
+		AccountID: int(account.ID),
+		Purpose:   constant.TokenPurposePasswordReset,
+		TokenHash: hashed,
+		ExpiresAt: now.Add(constant.PasswordResetTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "create password reset token")
+		return
+	}
+
+	err = svc.notify(account, i18n.TemplatePasswordReset, map[string]string{
+		"name": account.FullName,
+		"link": fmt.Sprintf("%s?token=%s", constant.PasswordResetURL, plain),
+	})
+	return
+}
+
+// ResetPassword sets the password of the token's account, the token is single use
+// and an expired or used one fails with constant.ErrInvalidToken
+func (svc *Service) ResetPassword(ctx context.Context, plainToken, newPassword string) (accountID int, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	resetToken, err := svc.verification.TakeByTokenHash(constant.TokenPurposePasswordReset, token.Hash(plainToken))
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrInvalidToken
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take password reset token")
+		return
+	}
+
+	now := time.Now().UTC()
+	if resetToken.UsedAt != nil || resetToken.ExpiresAt.Before(now) {
+		err = constant.ErrInvalidToken
+		return
+	}
+	accountID = resetToken.AccountID
+
+	hashedNewPassword, err := passwordhash.Hash(constant.PasswordHashAlgorithm, newPassword)
+	if err != nil {
+		err = errors.Wrap(err, "hash new password")
+		return
+	}
+
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"password":             hashedNewPassword,
+		"weak_password_rules":  unmetPasswordRules(newPassword),
+		"password_changed_at":  now,
+		"must_change_password": false,
+	})
+	svc.invalidateAccount(accountID)
+	if err != nil {
+		err = errors.Wrap(err, "reset password")
+		return
+	}
+
+	err = svc.verification.MarkUsed(int(resetToken.ID), now)
+	if err != nil {
+		err = errors.Wrap(err, "mark password reset token used")
+		return
+	}
+	return
+}
+
+// checkDisplayName enforces the display name policy, the account may keep its own display name
+func (svc *Service) checkDisplayName(accountID int, displayName string) (err error) {
+	if displayName == "" {
+		err = constant.ErrDisplayNameCannotBeEmpty
+		return
+	}
+	if !constant.DisplayNameUnique {
+		return
+	}
+
+	account, err := svc.repo.TakeAccountByDisplayName(displayName)
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account by display name")
+		return
+	}
+	if int(account.ID) != accountID {
+		err = constant.ErrDisplayNameAlreadyExist
+	}
+	return
+}
+
+// allowUpdate applies the sliding window limit of every field group touched by an update
+func (svc *Service) allowUpdate(accountID int, email, password bool) bool {
+	rules := []slidingwindow.Rule{{
+		Key:    fmt.Sprintf("profile:%d", accountID),
+		Limit:  constant.ProfileUpdateLimit,
+		Window: constant.ProfileUpdateWindow,
+	}}
+	if email {
+		rules = append(rules, slidingwindow.Rule{
+			Key:    fmt.Sprintf("email:%d", accountID),
+			Limit:  constant.EmailUpdateLimit,
+			Window: constant.EmailUpdateWindow,
+		})
+	}
+	if password {
+		rules = append(rules, slidingwindow.Rule{
+			Key:    fmt.Sprintf("password:%d", accountID),
+			Limit:  constant.PasswordUpdateLimit,
+			Window: constant.PasswordUpdateWindow,
+		})
+	}
+	return svc.limiter.Allow(rules...)
+}
+
+// ProbeExistence is rate limited per ip for every caller. Without reveal the database is never
+// queried, so the ambiguous answer takes the same time whether the account exists or not.
+func (svc *Service) ProbeExistence(ctx context.Context, request http.ExistenceProbe, ipAddress string, reveal bool) (result http.ExistenceProbeResult, err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	allowed := svc.limiter.Allow(slidingwindow.Rule{
+		Key:    fmt.Sprintf("probe:%s", ipAddress),
+		Limit:  constant.ExistenceProbeLimit,
+		Window: constant.ExistenceProbeWindow,
+	})
+	if !allowed {
+		err = constant.ErrProbeRateExceeded
+		return
+	}
+
+	if !reveal {
+		result.Ambiguous = true
+		return
+	}
+
+	exists := false
+	if request.Username != "" {
+		exists, err = svc.CheckAccountByUsername(ctx, strings.ToLower(request.Username))
+		if err != nil {
+			return
+		}
+	}
+	if !exists && request.Email != "" {
+		exists, err = svc.CheckAccountByEmail(ctx, request.Email)
+		if err != nil {
+			return
+		}
+	}
+	result.Exists = &exists
+	return
+}
+
+// DiagnoseLogin reports why a login with the username would currently be rejected or restricted,
+// it is rate limited per admin so it cannot be used to enumerate accounts
+func (svc *Service) DiagnoseLogin(ctx context.Context, adminID int, request http.DiagnoseLogin) (diagnosis http.LoginDiagnosis, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	allowed := svc.limiter.Allow(slidingwindow.Rule{
+		Key:    fmt.Sprintf("diagnose:%d", adminID),
+		Limit:  constant.LoginDiagnosisLimit,
+		Window: constant.LoginDiagnosisWindow,
+	})
+	if !allowed {
+		err = constant.ErrDiagnosisRateExceeded
+		return
+	}
+
+	diagnosis = http.LoginDiagnosis{
+		Username: request.Username,
+		Reasons:  []string{},
+	}
+	account, err := svc.repo.TakeAccountByUsername(request.Username)
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+		diagnosis.Reasons = append(diagnosis.Reasons, constant.LoginDiagnosisAccountNotFound)
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account by username")
+		return
+	}
+
+	diagnosis.CanLogin = !constant.RequireVerifiedLogin || account.IsVerified
+	if !account.IsVerified {
+		diagnosis.Reasons = append(diagnosis.Reasons, constant.LoginDiagnosisUnverified)
+	}
+	if account.LockedUntil != nil && account.LockedUntil.After(time.Now()) {
+		diagnosis.CanLogin = false
+		diagnosis.Reasons = append(diagnosis.Reasons, constant.LoginDiagnosisLocked)
+	}
+	if account.Status == constant.AccountStatusSuspended {
+		diagnosis.CanLogin = false
+		diagnosis.Reasons = append(diagnosis.Reasons, constant.LoginDiagnosisSuspended)
+	}
+	if account.MustChangePassword {
+		diagnosis.Reasons = append(diagnosis.Reasons, constant.LoginDiagnosisPasswordChange)
+	} else if svc.MustChangePassword(account) {
+		diagnosis.Reasons = append(diagnosis.Reasons, constant.LoginDiagnosisPasswordExpired)
+	}
+	if account.TermsVersion != constant.TermsVersion {
+		diagnosis.Reasons = append(diagnosis.Reasons, constant.LoginDiagnosisTermsNotAccepted)
+	}
+	return
+}
+
+// ValidateAccountFields returns the per-field errors a registration would fail with, keyed by json field name
+func (svc *Service) ValidateAccountFields(ctx context.Context, request http.RegisterUser) (fieldErrors map[string]string, err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	fieldErrors = map[string]string{}
+	if validationErr := validation.Validator.Struct(request); validationErr != nil {
+		if detail, ok := constant.PasswordPolicy.Detail(validationErr).(map[string]string); ok {
+			for field, tag := range detail {
+				fieldErrors[field] = tag
+			}
+		}
+	}
+
+	if request.Username != "" {
+		exist, err := svc.CheckAccountByUsername(ctx, strings.ToLower(request.Username))
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			fieldErrors["username"] = constant.ErrUsernameAlreadyExist.Error()
+		}
+	}
+
+	if request.Locale != "" && !i18n.IsSupported(request.Locale) {
+		fieldErrors["locale"] = constant.ErrInvalidLocale.Error()
+	}
+
+	if request.TermsVersion != constant.TermsVersion {
+		fieldErrors["terms_version"] = constant.ErrTermsNotAccepted.Error()
+	}
+	return
+}
+
+// ValidateBulk validates every row up front without inserting anything
+func (svc *Service) ValidateBulk(ctx context.Context, requests []http.RegisterUser) (report http.BulkValidationReport, err error) {
+	ctx, svc, cancel := svc.bind(ctx, 0)
+	defer cancel()
+	report.Valid = true
+	usernames := map[string]int{}
+	for i := range requests {
+		fieldErrors, err := svc.ValidateAccountFields(ctx, requests[i])
+		if err != nil {
+			err = errors.Wrap(err, "validate account fields")
+			return report, err
+		}
+
+		username := strings.ToLower(requests[i].Username)
+		if first, ok := usernames[username]; ok && username != "" {
+			fieldErrors["username"] = fmt.Sprintf("%s, see row %d", constant.ErrDuplicateInBatch.Error(), first)
+		} else {
+			usernames[username] = i
+		}
+
+		row := http.BulkRowValidation{
+			Index: i,
+			Valid: len(fieldErrors) == 0,
+		}
+		if !row.Valid {
+			row.Errors = fieldErrors
+			report.Valid = false
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	return
+}
+
+// SendVerificationBulk enqueues a verification email for every unverified account matching the filter,
+// accounts whose email already hit the verification rate limit are skipped
+func (svc *Service) SendVerificationBulk(ctx context.Context, request http.SendVerificationBulk) (count int, err error) {
+	_, svc, cancel := svc.bind(ctx, 0)
+	defer cancel()
+	var createdAfter, createdBefore time.Time
+	if request.CreatedAfter != "" {
+		createdAfter, err = time.Parse(constant.DOBFormat, request.CreatedAfter)
+		if err != nil {
+			err = constant.ErrInvalidDateFormat
+			return
+		}
+	}
+	if request.CreatedBefore != "" {
+		createdBefore, err = time.Parse(constant.DOBFormat, request.CreatedBefore)
+		if err != nil {
+			err = constant.ErrInvalidDateFormat
+			return
+		}
+	}
+
+	lastID := 0
+	for {
+		accounts, err := svc.repo.FindUnverified(createdAfter, createdBefore, lastID, constant.OutboxBatchSize)
+		if err != nil {
+			err = errors.Wrap(err, "find unverified accounts")
+			return count, err
+		}
+		if len(accounts) == 0 {
+			break
+		}
+
+		for i := range accounts {
+			sent, err := svc.sendVerification(accounts[i])
+			if err != nil {
+				return count, err
+			}
+			if sent {
+				count++
+			}
+		}
+		lastID = int(accounts[len(accounts)-1].ID)
+	}
+	return
+}
+
+// ResendVerification sends the verification email again, a token issued within VerificationReuseWindow
+// is sent again instead of a new one so the link the user may be about to open keeps working
+func (svc *Service) ResendVerification(ctx context.Context, accountID int) (err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+	if account.IsVerified {
+		err = constant.ErrAccountAlreadyVerified
+		return
+	}
+	if account.Email == nil || *account.Email == "" {
+		err = constant.ErrEmailNotSet
+		return
+	}
+
+	sent, err := svc.sendVerification(account)
+	if err != nil {
+		return
+	}
+	if !sent {
+		err = constant.ErrVerificationRateExceeded
+		return
+	}
+	return
+}
+
+// sendVerification reuses the token issued within VerificationReuseWindow or issues a new one and notifies the account,
+// it returns false without sending when the email is rate limited
+func (svc *Service) sendVerification(account model.Account) (sent bool, err error) {
+	if account.Email == nil || *account.Email == "" {
+		return
+	}
+
+	allowed := svc.limiter.Allow(slidingwindow.Rule{
+		Key:    fmt.Sprintf("verification:%s", strings.ToLower(*account.Email)),
+		Limit:  constant.VerificationEmailLimit,
+		Window: constant.VerificationEmailWindow,
+	})
+	if !allowed {
+		return
+	}
+
+	plain, err := svc.verificationToken(int(account.ID))
+	if err != nil {
+		return
+	}
+
+	err = svc.notify(account, i18n.TemplateVerification, map[string]string{
+		"name": account.FullName,
+		"link": fmt.Sprintf("%s?token=%s", constant.VerificationURL, plain),
+	})
+	if err != nil {
+		return
+	}
+	sent = true
+	return
+}
+
+// verificationToken returns the plain token of a reusable verification token or of a newly created one
+func (svc *Service) verificationToken(accountID int) (plain string, err error) {
+	now := time.Now().UTC()
+	reusable, err := svc.verification.TakeReusable(accountID, constant.TokenPurposeVerification, now.Add(-constant.VerificationReuseWindow), now)
+	if err == nil {
+		plain, _ = token.Derive(constant.SampleSecretKey, reusable.Seed)
+		return
+	} else if err != gorm.ErrRecordNotFound {
+		err = errors.Wrap(err, "take reusable verification token")
+		return
+	}
+
+	seed, _, err := token.Generate()
+	if err != nil {
+		err = errors.Wrap(err, "generate verification token")
+		return
+	}
+	plain, hashed := token.Derive(constant.SampleSecretKey, seed)
+
+	err = svc.verification.Create(model.VerificationToken{
+		AccountID: accountID,
+		Purpose:   constant.TokenPurposeVerification,
+		TokenHash: hashed,
+		ExpiresAt: now.Add(constant.VerificationTokenTTL),
+		CreatedAt: now,
+		Seed:      seed,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "create verification token")
+		return
+	}
+	return
+}
+
+// VerifyEmail marks the account of an unused and unexpired verification token as verified,
+// the token is single use so a replay fails with constant.ErrInvalidToken
+func (svc *Service) VerifyEmail(ctx context.Context, plainToken string) (err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	verificationToken, err := svc.verification.TakeByTokenHash(constant.TokenPurposeVerification, token.Hash(plainToken))
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrInvalidToken
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take verification token")
+		return
+	}
+
+	now := time.Now().UTC()
+	if verificationToken.UsedAt != nil || verificationToken.ExpiresAt.Before(now) {
+		err = constant.ErrInvalidToken
+		return
+	}
+
+	account, err := svc.repo.TakeAccountByID(verificationToken.AccountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrInvalidToken
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+
+	if !account.IsVerified {
+		err = svc.repo.UpdateFields(int(account.ID), map[string]interface{}{
+			"is_verified": true,
+		})
+		svc.invalidateAccount(int(account.ID))
+		if err != nil {
+			err = errors.Wrap(err, "verify account")
+			return
+		}
+	}
+
+	err = svc.verification.MarkUsed(int(verificationToken.ID), now)
+	if err != nil {
+		err = errors.Wrap(err, "mark verification token used")
+		return
+	}
+	return
+}
+
+// emailChangePending reports whether an unexpired email change is waiting for confirmation,
+// the lock releases by itself once the change expires
+func emailChangePending(account model.Account) bool {
+	return account.PendingEmail != nil && account.PendingEmailExpiresAt != nil &&
+		account.PendingEmailExpiresAt.After(time.Now())
+}
+
+// sendEmailChange sends the confirmation link of a pending email change to the new address
+func (svc *Service) sendEmailChange(account model.Account, email string, expiresAt time.Time) (err error) {
+	plain, hashed, err := token.Generate()
+	if err != nil {
+		err = errors.Wrap(err, "generate email change token")
+		return
+	}
+
+	err = svc.verification.Create(model.VerificationToken{
+		AccountID: int(account.ID),
+		Purpose:   constant.TokenPurposeEmailChange,
+		TokenHash: hashed,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "create email change token")
+		return
+	}
+
+	err = svc.notifier.Notify(email, account.Locale, i18n.TemplateEmailChange, map[string]string{
+		"name": account.FullName,
+		"link": fmt.Sprintf("%s?token=%s", constant.EmailChangeURL, plain),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "notify email change")
+		return
+	}
+	return
+}
+
+// ConfirmEmailChange applies the pending email of the token's account and releases the lock,
+// the email is rejected if another account took it since the change was requested
+func (svc *Service) ConfirmEmailChange(ctx context.Context, plainToken string) (err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	verificationToken, err := svc.verification.TakeByTokenHash(constant.TokenPurposeEmailChange, token.Hash(plainToken))
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrInvalidToken
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take email change token")
+		return
+	}
+
+	now := time.Now().UTC()
+	if verificationToken.UsedAt != nil || verificationToken.ExpiresAt.Before(now) {
+		err = constant.ErrInvalidToken
+		return
+	}
+
+	account, err := svc.repo.TakeAccountByID(verificationToken.AccountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrInvalidToken
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+	if !emailChangePending(account) {
+		err = constant.ErrInvalidToken
+		return
+	}
+
+	emailExist, _ := svc.CheckAccountByEmail(ctx, *account.PendingEmail)
+	if emailExist {
+		err = constant.ErrEmailAlreadyExist
+		return
+	}
+
+	err = svc.repo.UpdateFields(int(account.ID), map[string]interface{}{
+		"email":                    *account.PendingEmail,
+		"canonical_email":          canonicalEmail(account.PendingEmail),
+		"pending_email":            nil,
+		"pending_email_expires_at": nil,
+	})
+	svc.invalidateAccount(int(account.ID))
+	if conflict := updateConflict(err); conflict != nil {
+		err = conflict
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "apply pending email")
+		return
+	}
+
+	err = svc.verification.MarkUsed(int(verificationToken.ID), now)
+	if err != nil {
+		err = errors.Wrap(err, "mark email change token used")
+		return
+	}
+	return
+}
+
+// notify sends a templated message to the account email in the account locale
+func (svc *Service) notify(account model.Account, templateName string, data map[string]string) (err error) {
+	if account.Email == nil || *account.Email == "" {
+		return
+	}
+
+	err = svc.notifier.Notify(*account.Email, account.Locale, templateName, data)
+	if err != nil {
+		err = errors.Wrap(err, "notify account")
+		return
+	}
+	return
+}
+
+// AcceptTerms records the re-acceptance of the current terms version
+func (svc *Service) AcceptTerms(ctx context.Context, accountID int, request http.AcceptTerms) (err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	if request.TermsVersion != constant.TermsVersion {
+		err = constant.ErrTermsNotAccepted
+		return
+	}
+
+	exist, _ := svc.CheckAccountByID(ctx, accountID)
+	if !exist {
+		err = constant.ErrAccountNotRegistered
+		return
+	}
+
+	acceptedAt := time.Now().UTC()
+	err = svc.repo.Update(accountID, model.Account{
+		TermsVersion:    request.TermsVersion,
+		TermsAcceptedAt: &acceptedAt,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "accept terms")
+		return
+	}
+	return
+}
+
+func (svc *Service) TakePermissions(ctx context.Context, accountID int) (permissions http.GetPermissions, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+
+	individual := []string{}
+	if account.Permissions != "" {
+		json.Unmarshal([]byte(account.Permissions), &individual)
+	}
+
+	permissions = http.GetPermissions{
+		Role:        account.Role,
+		Permissions: permission.Resolve(account.Role, individual),
+	}
+	return
+}
+
+func (svc *Service) HasPermission(ctx context.Context, accountID int, permissionName string) (granted bool, err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	permissions, err := svc.TakePermissions(ctx, accountID)
+	if err != nil {
+		return
+	}
+	granted = permission.Has(permissions.Permissions, permissionName)
+	return
+}
+
+// Export writes every account after afterID in id order, the table is read in pages of ExportBatchSize.
+// A write error stops the export, the caller resumes from the id of the last written line.
+func (svc *Service) Export(ctx context.Context, afterID int, includePII bool, write func(line http.ExportAccount) error) (err error) {
+	_, svc, cancel := svc.bind(ctx, 0)
+	defer cancel()
+	for {
+		accounts, err := svc.repo.FindAfterID(afterID, constant.ExportBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "find accounts after id")
+		}
+
+		for i := range accounts {
+			err = write(exportLine(accounts[i], includePII))
+			if err != nil {
+				return errors.Wrap(err, "write export line")
+			}
+			afterID = int(accounts[i].ID)
+		}
+
+		if len(accounts) < constant.ExportBatchSize {
+			return nil
+		}
+	}
+}
+
+// ExportSorted streams every account in the order of the list params, the KTP number is added to the
+// personal fields. Export stays the resumable export, a sorted one restarts from the first account
+func (svc *Service) ExportSorted(ctx context.Context, sort, order string, includePII bool, write func(line http.ExportAccount) error) (err error) {
+	_, svc, cancel := svc.bind(ctx, 0)
+	defer cancel()
+	column, desc, err := listSort(sort, order)
+	if err != nil {
+		return
+	}
+
+	err = svc.repo.EachSorted(column, desc, func(account model.Account) error {
+		line := exportLine(account, includePII)
+		if includePII && account.KTPNumber != nil && *account.KTPNumber != "" {
+			if ktpNumber := aes.Decrypt(*account.KTPNumber); ktpNumber > 0 {
+				line.KTPNumber = strconv.Itoa(ktpNumber)
+			}
+		}
+		err := write(line)
+		if err != nil {
+			return errors.Wrap(err, "write export line")
+		}
+		return nil
+	})
+	if err != nil {
+		err = errors.Wrap(err, "export sorted accounts")
+		return
+	}
+	return
+}
+
+// exportLine never carries the password or its hash, the personal fields are only set with includePII
+func exportLine(account model.Account, includePII bool) (line http.ExportAccount) {
+	line = http.ExportAccount{
+		ID:          publicid.Encode(int(account.ID)),
+		Username:    account.Username,
+		Handle:      account.Handle,
+		FullName:    account.FullName,
+		DisplayName: stringValue(account.DisplayName),
+		JobPosition: stringValue(account.JobPosition),
+		Role:        account.Role,
+		Locale:      account.Locale,
+		IsVerified:  account.IsVerified,
+		CreatedAt:   account.CreatedAt,
+		UpdatedAt:   account.UpdatedAt,
+	}
+	if includePII {
+		line.Email = stringValue(account.Email)
+		line.PhoneNumber = stringValue(account.PhoneNumber)
+		line.EmployeeNumber = stringValue(account.EmployeeNumber)
+		line.Address = stringValue(account.Address)
+		if !account.DateOfBirth.IsZero() {
+			line.DateOfBirth = account.DateOfBirth.Format(constant.DOBFormat)
+		}
+	}
+	return
+}
+
+// TakeCard returns the card of an account as seen by the viewer, viewerID is zero for anonymous viewers.
+// The owner sees every field, others only see public fields until followers are supported.
+func (svc *Service) TakeCard(ctx context.Context, accountID, viewerID int) (card http.GetCard, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+
+	// a pending deletion is hidden from everyone but the owner
+	if viewerID != accountID && account.Status == constant.AccountStatusPendingDeletion {
+		err = constant.ErrAccountNotRegistered
+		return
+	}
+
+	copier.Copy(&card, &account)
+	card.ID = publicid.Encode(int(account.ID))
+	if viewerID == accountID {
+		return
+	}
+
+	for field, visibility := range fieldVisibility(account) {
+		if visibility != constant.VisibilityPublic {
+			hideCardField(&card, field)
+		}
+	}
+	return
+}
+
+// HandleMovedError is returned for a previous handle that still redirects, Handle is the current one.
+// It unwraps to constant.ErrHandleMoved.
+type HandleMovedError struct {
+	Handle string
+}
+
+func (e *HandleMovedError) Error() string {
+	return fmt.Sprintf("%s: %s", constant.ErrHandleMoved.Error(), e.Handle)
+}
+
+func (e *HandleMovedError) Unwrap() error {
+	return constant.ErrHandleMoved
+}
+
+func (svc *Service) TakeCardByHandle(ctx context.Context, handle string, viewerID int) (card http.GetCard, err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	account, err := svc.repo.TakeAccountByHandle(handle)
+	if err == gorm.ErrRecordNotFound {
+		return card, svc.followHandleRedirect(handle)
+	} else if err != nil {
+		err = errors.Wrap(err, "take account by handle")
+		return
+	}
+
+	return svc.TakeCard(ctx, int(account.ID), viewerID)
+}
+
+// followHandleRedirect returns a HandleMovedError for a previous handle within its grace period
+func (svc *Service) followHandleRedirect(handle string) (err error) {
+	redirect, err := svc.repo.TakeHandleRedirect(handle, time.Now().UTC())
+	if err == gorm.ErrRecordNotFound {
+		return constant.ErrAccountNotRegistered
+	} else if err != nil {
+		return errors.Wrap(err, "take handle redirect")
+	}
+
+	account, err := svc.repo.TakeAccountByID(redirect.AccountID)
+	if err == gorm.ErrRecordNotFound {
+		return constant.ErrAccountNotRegistered
+	} else if err != nil {
+		return errors.Wrap(err, "take redirected account")
+	}
+	return &HandleMovedError{Handle: account.Handle}
+}
+
+// UpdateHandle keeps the previous handle redirecting for HandleRedirectTTL,
+// a handle still redirecting to another account is taken
+func (svc *Service) UpdateHandle(ctx context.Context, accountID int, request http.UpdateHandle) (err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	if !slug.Valid(request.Handle, constant.HandleMinLength, constant.HandleMaxLength) {
+		err = constant.ErrInvalidHandle
+		return
+	}
+
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+
+	handles, err := svc.repo.FindHandlesWithPrefix(request.Handle)
+	if err != nil {
+		err = errors.Wrap(err, "find handles")
+		return
+	}
+	for _, handle := range handles {
+		if handle == request.Handle {
+			err = constant.ErrHandleAlreadyExist
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	redirect, err := svc.repo.TakeHandleRedirect(request.Handle, now)
+	if err == nil && redirect.AccountID != accountID {
+		err = constant.ErrHandleAlreadyExist
+		return
+	} else if err != nil && err != gorm.ErrRecordNotFound {
+		err = errors.Wrap(err, "take handle redirect")
+		return
+	}
+
+	err = svc.repo.UpdateHandle(accountID, account.Handle, request.Handle, now.Add(constant.HandleRedirectTTL))
+	if err != nil {
+		err = errors.Wrap(err, "update handle")
+		return
+	}
+	return
+}
+
+// generateHandle slugs the source and suffixes it with the first free number on collision
+func (svc *Service) generateHandle(source string) (handle string, err error) {
+	base := slug.Make(source, constant.HandleMaxLength)
+	// leave room for a suffix so every candidate shares the prefix
+	prefix := base
+	if len(prefix) > constant.HandleMaxLength-4 {
+		prefix = prefix[:constant.HandleMaxLength-4]
+	}
+
+	handles, err := svc.repo.FindHandlesWithPrefix(prefix)
+	if err != nil {
+		err = errors.Wrap(err, "find handles")
+		return
+	}
+	redirectHandles, err := svc.repo.FindRedirectHandlesWithPrefix(prefix, time.Now().UTC())
+	if err != nil {
+		err = errors.Wrap(err, "find redirect handles")
+		return
+	}
+	taken := map[string]bool{}
+	for _, handle := range append(handles, redirectHandles...) {
+		taken[handle] = true
+	}
+
+	handle = slug.Unique(base, constant.HandleMaxLength, taken)
+	return
+}
+
+func (svc *Service) TakeVisibility(ctx context.Context, accountID int) (visibility map[string]string, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+
+	visibility = fieldVisibility(account)
+	return
+}
+
+func (svc *Service) UpdateVisibility(ctx context.Context, accountID int, request http.UpdateVisibility) (err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	for field, visibility := range request.Visibility {
+		if _, ok := constant.DefaultFieldVisibility[field]; !ok {
+			err = constant.ErrInvalidVisibilityField
+			return
+		}
+		if visibility != constant.VisibilityPublic &&
+			visibility != constant.VisibilityFollowers &&
+			visibility != constant.VisibilityPrivate {
+			err = constant.ErrInvalidVisibility
+			return
+		}
+	}
+
+	current, err := svc.TakeVisibility(ctx, accountID)
+	if err != nil {
+		return
+	}
+	for field, visibility := range request.Visibility {
+		current[field] = visibility
+	}
+
+	encoded, err := json.Marshal(current)
+	if err != nil {
+		err = errors.Wrap(err, "marshal visibility")
+		return
+	}
+
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"field_visibility": string(encoded),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "update visibility")
+		return
+	}
+	return
+}
+
+// fieldVisibility merges the stored visibility over the defaults, unknown stored fields are dropped
+func fieldVisibility(account model.Account) map[string]string {
+	stored := map[string]string{}
+	if account.FieldVisibility != "" {
+		json.Unmarshal([]byte(account.FieldVisibility), &stored)
+	}
+
+	visibility := map[string]string{}
+	for field, defaultVisibility := range constant.DefaultFieldVisibility {
+		visibility[field] = defaultVisibility
+		if value, ok := stored[field]; ok {
+			visibility[field] = value
+		}
+	}
+	return visibility
+}
+
+func hideCardField(card *http.GetCard, field string) {
+	switch field {
+	case "username":
+		card.Username = ""
+	case "fullname":
+		card.FullName = ""
+	case "display_name":
+		card.DisplayName = ""
+	case "photo_url":
+		card.PhotoURL = ""
+	case "job_position":
+		card.JobPosition = ""
+	case "employee_number":
+		card.EmployeeNumber = ""
+	case "email":
+		card.Email = ""
+	case "phone_number":
+		card.PhoneNumber = ""
+	}
+}
+
+// UploadAvatar stores the original as the photo url of the account and generates its variants in the background.
+// The job is queued before anything is replaced, so a full queue leaves the current avatar as it was.
+// Uploads reuse the keys of the account, the version in the urls keeps clients from showing a cached older avatar
+func (svc *Service) UploadAvatar(ctx context.Context, accountID int, original []byte) (photoURL string, err error) {
+	defer svc.invalidateAccount(accountID)
+	if len(original) > constant.AvatarMaxBytes {
+		err = constant.ErrAvatarTooLarge
+		return
+	}
+	contentType, ok := imageproc.ContentType(original)
+	if !ok {
+		err = constant.ErrUnsupportedAvatarType
+		return
+	}
+	err = imageproc.CheckPixels(original, constant.AvatarMaxPixels)
+	if err == imageproc.ErrTooManyPixels {
+		err = constant.ErrAvatarTooManyPixels
+		return
+	} else if err != nil {
+		err = constant.ErrUnsupportedAvatarType
+		return
+	}
+
+	// the worker waits until the original is stored, it generates nothing when storing failed
+	key := fmt.Sprintf("avatars/%s", publicid.Encode(accountID))
+	version := time.Now().Unix()
+	stored := make(chan bool, 1)
+	queued := svc.avatarPool.Submit(func() {
+		if <-stored {
+			svc.generateAvatarVariants(accountID, key, version, original)
+		}
+	})
+	if !queued {
+		err = constant.ErrAvatarQueueFull
+		return
+	}
+	defer func() { stored <- err == nil }()
+
+	// the job above keeps the unbound service, it runs after the request is done
+	_, bound, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	photoURL, err = bound.storage.Put(key, contentType, original)
+	if err != nil {
+		err = errors.Wrap(err, "store avatar")
+		return
+	}
+	photoURL = avatarURL(photoURL, version)
+	err = bound.repo.UpdateFields(accountID, map[string]interface{}{
+		"photo_url":         photoURL,
+		"avatar_processing": true,
+		"avatar_variants":   "",
+	})
+	if err != nil {
+		err = errors.Wrap(err, "update photo url")
+	}
+	return
+}
+
+// avatarURL appends the upload version to the url of an avatar or one of its variants
+func avatarURL(url string, version int64) string {
+	return fmt.Sprintf("%s?v=%d", url, version)
+}
+
+// generateAvatarVariants stores every variant or none, a failed width leaves the account without variants
+// rather than with an incomplete set that looks finished
+func (svc *Service) generateAvatarVariants(accountID int, key string, version int64, original []byte) {
+	defer svc.invalidateAccount(accountID)
+	variants := map[string]string{}
+	usage := model.StorageUsage{
+		AccountID: accountID,
+		Artifact:  constant.StorageArtifactAvatar,
+		Bytes:     int64(len(original)),
+		Objects:   1,
+	}
+	for _, width := range constant.AvatarVariantWidths {
+		resized, contentType, err := imageproc.Resize(original, width, constant.AvatarMaxPixels)
+		if err != nil {
+			svc.logger.Error("resize avatar failed", "account_id", accountID, "width", width, "error", err)
+			variants = map[string]string{}
+			break
+		}
+
+		url, err := svc.storage.Put(fmt.Sprintf("%s_%d", key, width), contentType, resized)
+		if err != nil {
+			svc.logger.Error("store avatar variant failed", "account_id", accountID, "width", width, "error", err)
+			variants = map[string]string{}
+			break
+		}
+		variants[fmt.Sprint(width)] = avatarURL(url, version)
+		usage.Bytes += int64(len(resized))
+		usage.Objects++
+	}
+
+	encoded := ""
+	if len(variants) > 0 {
+		data, _ := json.Marshal(variants)
+		encoded = string(data)
+	}
+	err := svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"avatar_processing": false,
+		"avatar_variants":   encoded,
+	})
+	if err != nil {
+		svc.logger.Error("update avatar variants failed", "account_id", accountID, "error", err)
+	}
+
+	// variants are written under the same keys on every upload, so the usage is replaced rather than added to
+	usage.UpdatedAt = time.Now().UTC()
+	err = svc.repo.SetStorageUsage(usage)
+	if err != nil {
+		svc.logger.Error("set avatar storage usage failed", "account_id", accountID, "error", err)
+	}
+}
+
+// StorageUsage reads the stored counters, artifact types the account never stored are left out
+func (svc *Service) StorageUsage(ctx context.Context, accountID int) (usage http.StorageUsage, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountReadTimeout)
+	defer cancel()
+	_, err = svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+
+	usages, err := svc.repo.FindStorageUsage(accountID)
+	if err != nil {
+		err = errors.Wrap(err, "find storage usage")
+		return
+	}
+
+	usage.Artifacts = []http.StorageArtifactUsage{}
+	for _, artifactUsage := range usages {
+		usage.TotalBytes += artifactUsage.Bytes
+		usage.Artifacts = append(usage.Artifacts, http.StorageArtifactUsage{
+			Artifact:  artifactUsage.Artifact,
+			Bytes:     artifactUsage.Bytes,
+			Objects:   artifactUsage.Objects,
+			UpdatedAt: artifactUsage.UpdatedAt,
+		})
+	}
+	return
+}
+
+// photoURL falls back to the placeholder for accounts without a photo, e.g. imported ones
+func photoURL(account model.Account) string {
+	if account.PhotoURL == "" {
+		return constant.DefaultPhotoURL
+	}
+	return account.PhotoURL
+}
+
+func avatarVariants(account model.Account) (variants map[string]string) {
+	if account.AvatarProcessing || account.AvatarVariants == "" {
+		return
+	}
+	json.Unmarshal([]byte(account.AvatarVariants), &variants)
+	return
+}
+
+// Delete is a soft delete, the account is hidden from every lookup and listing
+// and can be restored within AccountRestoreWindow
+func (svc *Service) Delete(ctx context.Context, accountID int) (err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	_, err = svc.TakeAccountByID(ctx, accountID)
+	if err != nil {
+		err = errors.Wrap(err, "account is not exist")
+		return
+	}
+
+	err = svc.repo.Delete(accountID)
+	if err != nil {
+		err = errors.Wrap(err, "delete account")
+		return
+	}
+	return
+}
+
+// RequestDeletion schedules the deletion of the account for the end of AccountDeletionGrace, the owner can
+// cancel it until then and PurgeDeleted removes the account after it. Requesting it again keeps the schedule
+func (svc *Service) RequestDeletion(ctx context.Context, accountID int) (scheduledAt time.Time, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+	if pending := svc.DeletionScheduledAt(account); pending != nil {
+		return *pending, nil
+	}
+
+	requestedAt := time.Now().UTC()
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"status":              constant.AccountStatusPendingDeletion,
+		"delete_requested_at": requestedAt,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "request account deletion")
+		return
+	}
+	return requestedAt.Add(constant.AccountDeletionGrace), nil
+}
+
+// CancelDeletion makes the account active again, it fails with constant.ErrDeletionNotPending without
+// a pending deletion and constant.ErrDeletionGraceExpired once AccountDeletionGrace has passed
+func (svc *Service) CancelDeletion(ctx context.Context, accountID int) (err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+	if svc.DeletionScheduledAt(account) == nil {
+		err = constant.ErrDeletionNotPending
+		return
+	}
+	if svc.deletionDue(account) {
+		err = constant.ErrDeletionGraceExpired
+		return
+	}
+
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"status":              constant.AccountStatusActive,
+		"delete_requested_at": nil,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "cancel account deletion")
+		return
+	}
+	return
+}
 
-		account, err := svc.TakeAccountByKTPNumber(aes.Encrypt(request.KTPNumber))
+// Restore fails with constant.ErrAccountNotDeleted for an active account
+// and constant.ErrRestoreWindowExpired once AccountRestoreWindow has passed
+func (svc *Service) Restore(ctx context.Context, accountID int) (err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	account, err := svc.repo.TakeDeletedAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		exist, err := svc.CheckAccountByID(ctx, accountID)
 		if err != nil {
-			err = errors.Wrap(err, "take account by ktp number")
-			return err
+			return errors.Wrap(err, "check account by id")
 		}
-		accountID = int(account.ID)
+		if exist {
+			return constant.ErrAccountNotDeleted
+		}
+		return constant.ErrAccountNotRegistered
+	} else if err != nil {
+		err = errors.Wrap(err, "take deleted account")
+		return
+	}
+
+	if account.DeletedAt.Time.Before(time.Now().Add(-constant.AccountRestoreWindow)) {
+		err = constant.ErrRestoreWindowExpired
+		return
 	}
 
-	hashedNewPassword, err := bcrypt.HashPassword(request.Password)
+	err = svc.repo.Restore(accountID)
 	if err != nil {
-		err = errors.Wrap(err, "hash new password")
-		return err
+		err = errors.Wrap(err, "restore account")
+		return
+	}
+	return
+}
+
+// UpdateRole promotes or demotes the account, an admin cannot change their own role so the
+// last admin cannot demote themselves. Setting the current role again is a no op
+func (svc *Service) UpdateRole(ctx context.Context, adminID, accountID int, role string) (previous string, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	if !enum.Valid(enum.Role, role) {
+		err = constant.ErrInvalidRole
+		return
+	}
+	if adminID == accountID {
+		err = constant.ErrSelfRoleChange
+		return
 	}
 
-	account := model.Account{}
-	copier.Copy(&account, &request)
-	account.Password = hashedNewPassword
-	if request.KTPNumber != 0 {
-	    *account.KTPNumber = aes.Encrypt(request.KTPNumber)
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account by id")
+		return
 	}
 
-	err = svc.repo.Update(accountID, account)
+	previous = account.Role
+	if previous == role {
+		return
+	}
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"role": role,
+	})
 	if err != nil {
-	    err = errors.Wrap(err, "update password")
+		err = errors.Wrap(err, "update role")
 		return
 	}
 	return
 }
 
-func (svc *Service) Delete(accountID int) (err error) {
-	_, err = svc.TakeAccountByID(accountID)
+// Suspend blocks the login of the account and keeps the reason and time for admins,
+// suspending it again replaces the reason
+func (svc *Service) Suspend(ctx context.Context, accountID int, reason string) (err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	exist, err := svc.CheckAccountByID(ctx, accountID)
 	if err != nil {
-		err = errors.Wrap(err, "account is not exist")
+		return
+	}
+	if !exist {
+		err = constant.ErrAccountNotRegistered
 		return
 	}
 
-	err = svc.repo.Delete(accountID)
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"status":            constant.AccountStatusSuspended,
+		"suspension_reason": reason,
+		"suspended_at":      time.Now().UTC(),
+	})
 	if err != nil {
-		err = errors.Wrap(err, "delete account")
+		err = errors.Wrap(err, "suspend account")
+		return
+	}
+	return
+}
+
+// Activate lifts a suspension, the reason and time of the last one are kept
+func (svc *Service) Activate(ctx context.Context, accountID int) (err error) {
+	ctx, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(accountID)
+	exist, err := svc.CheckAccountByID(ctx, accountID)
+	if err != nil {
+		return
+	}
+	if !exist {
+		err = constant.ErrAccountNotRegistered
+		return
+	}
+
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"status": constant.AccountStatusActive,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "activate account")
+		return
+	}
+	return
+}
+
+// RecordLogin sets last_login_at in the background so a slow write never delays the login,
+// a failed write is only logged
+func (svc *Service) RecordLogin(accountID int) {
+	loggedInAt := time.Now().UTC()
+	go func() {
+		if err := svc.repo.UpdateLastLogin(accountID, loggedInAt); err != nil {
+			svc.logger.Error("record last login failed", "account_id", accountID, "error", err)
+			return
+		}
+		svc.invalidateAccount(accountID)
+	}()
+}
+
+// FindInactive returns up to limit accounts after afterID in id order that have not logged in since the time,
+// an account that never logged in is inactive once it was created before. Cleanup jobs page with the last id
+func (svc *Service) FindInactive(ctx context.Context, since time.Time, afterID, limit int) (accounts []model.Account, err error) {
+	_, svc, cancel := svc.bind(ctx, 0)
+	defer cancel()
+	accounts, err = svc.repo.FindInactive(since, afterID, limit)
+	if err != nil {
+		err = errors.Wrap(err, "find inactive accounts")
+		return
+	}
+	return
+}
+
+// TOTPEnabled reports whether logins of the account ask for a two factor code
+func (svc *Service) TOTPEnabled(account model.Account) bool {
+	return account.TOTPEnabledAt != nil && account.TOTPSecret != nil
+}
+
+// EnableTOTP stores a new encrypted secret and returns it with its otpauth uri for the authenticator app,
+// logins ask for a code once ConfirmTOTP accepted one. Enrolling again before confirming replaces the secret
+func (svc *Service) EnableTOTP(ctx context.Context, accountID int) (enrollment http.TOTPEnrollment, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	if svc.totpCipher == nil {
+		err = constant.ErrTwoFactorUnavailable
+		return
+	}
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+	if svc.TOTPEnabled(account) {
+		err = constant.ErrTOTPAlreadyEnabled
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		err = errors.Wrap(err, "generate totp secret")
+		return
+	}
+	sealed, err := svc.totpCipher.Encrypt(totpSecretField, secret)
+	if err != nil {
+		err = errors.Wrap(err, "encrypt totp secret")
+		return
+	}
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"totp_secret":     sealed,
+		"totp_enabled_at": nil,
+		"totp_last_step":  0,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "store totp secret")
+		return
+	}
+
+	enrollment = http.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(constant.TOTPIssuer, account.Username, secret),
+	}
+	return
+}
+
+// ConfirmTOTP turns two factor login on with the first code of the enrolled secret, it fails with
+// constant.ErrTOTPNotEnrolled before EnableTOTP and constant.ErrInvalidTOTPCode for a wrong code
+func (svc *Service) ConfirmTOTP(ctx context.Context, accountID int, code string) (err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	if svc.totpCipher == nil {
+		err = constant.ErrTwoFactorUnavailable
+		return
+	}
+	defer svc.invalidateAccount(accountID)
+	account, err := svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+	if svc.TOTPEnabled(account) {
+		err = constant.ErrTOTPAlreadyEnabled
+		return
+	}
+	if account.TOTPSecret == nil {
+		err = constant.ErrTOTPNotEnrolled
+		return
+	}
+
+	step, err := svc.checkTOTP(account, code)
+	if err != nil {
+		return
+	}
+	err = svc.repo.UpdateFields(accountID, map[string]interface{}{
+		"totp_enabled_at": time.Now().UTC(),
+		"totp_last_step":  step,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "enable totp")
+		return
+	}
+	return
+}
+
+// VerifyTOTP is the second step of a two factor login, a wrong code counts as a failed login towards the lockout
+// and every code is accepted once. The account is checked again, it may have been locked or suspended meanwhile
+func (svc *Service) VerifyTOTP(ctx context.Context, accountID int, code string) (account model.Account, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	if svc.totpCipher == nil {
+		err = constant.ErrTwoFactorUnavailable
+		return
+	}
+	account, err = svc.repo.TakeAccountByID(accountID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take account")
+		return
+	}
+
+	now := time.Now().UTC()
+	if account.LockedUntil != nil && account.LockedUntil.After(now) {
+		err = constant.ErrAccountLocked
+		return
+	}
+	if svc.deletionDue(account) {
+		err = constant.ErrAccountNotRegistered
+		return
+	}
+	if account.Status == constant.AccountStatusSuspended {
+		err = constant.ErrAccountSuspended
+		return
+	}
+	if !svc.TOTPEnabled(account) {
+		err = constant.ErrTOTPNotEnrolled
+		return
+	}
+
+	step, err := svc.checkTOTP(account, code)
+	if err == constant.ErrInvalidTOTPCode {
+		if updateErr := svc.countFailedLogin(account, now); updateErr != nil {
+			err = updateErr
+		}
+		return
+	} else if err != nil {
+		return
+	}
+	accepted, err := svc.repo.UpdateTOTPStep(accountID, step)
+	if err != nil {
+		err = errors.Wrap(err, "update totp step")
+		return
+	}
+	if !accepted {
+		err = constant.ErrInvalidTOTPCode
+		return
+	}
+
+	if account.FailedLoginCount > 0 || account.LockedUntil != nil {
+		err = svc.repo.UpdateLoginState(accountID, 0, nil)
+		if err != nil {
+			err = errors.Wrap(err, "reset login state")
+			return
+		}
+	}
+	return
+}
+
+// checkTOTP returns the step of a code within TOTPSkewSteps of now, a code of a step
+// already used fails like a wrong one
+func (svc *Service) checkTOTP(account model.Account, code string) (step int64, err error) {
+	secret, err := svc.totpCipher.Decrypt(totpSecretField, *account.TOTPSecret)
+	if err != nil {
+		err = errors.Wrap(err, "decrypt totp secret")
+		return
+	}
+	step, ok := totp.Verify(secret, code, time.Now(), constant.TOTPSkewSteps)
+	if !ok || step <= account.TOTPLastStep {
+		err = constant.ErrInvalidTOTPCode
+		return
+	}
+	return
+}
+
+// PurgeDeleted permanently removes the accounts soft deleted before the time and the pending deletions
+// whose AccountDeletionGrace ended, callers pass now minus AccountRestoreWindow
+func (svc *Service) PurgeDeleted(ctx context.Context, before time.Time) (purged int64, err error) {
+	_, svc, cancel := svc.bind(ctx, 0)
+	defer cancel()
+	purged, err = svc.repo.PurgeDeleted(before, time.Now().UTC().Add(-constant.AccountDeletionGrace))
+	if err != nil {
+		err = errors.Wrap(err, "purge deleted accounts")
+		return
+	}
+	return
+}
+
+// mergeFields are the fields a merge resolves, in report order
+var mergeFields = []struct {
+	name   string
+	column string
+	value  func(account model.Account) string
+}{
+	{"fullname", "full_name", func(account model.Account) string { return account.FullName }},
+	{"display_name", "display_name", func(account model.Account) string { return stringValue(account.DisplayName) }},
+	{"email", "email", func(account model.Account) string { return stringValue(account.Email) }},
+	{"phone_number", "phone_number", func(account model.Account) string { return stringValue(account.PhoneNumber) }},
+	{"ktp_number", "ktp_number", func(account model.Account) string { return stringValue(account.KTPNumber) }},
+	{"employee_number", "employee_number", func(account model.Account) string { return stringValue(account.EmployeeNumber) }},
+	{"job_position", "job_position", func(account model.Account) string { return stringValue(account.JobPosition) }},
+	{"address", "address", func(account model.Account) string { return stringValue(account.Address) }},
+	{"photo_url", "photo_url", func(account model.Account) string { return account.PhotoURL }},
+}
+
+// canonicalEmail is stored whether or not constant.EmailCanonicalization is on,
+// so turning it on also covers accounts created before
+func canonicalEmail(email *string) *string {
+	if email == nil {
+		return nil
+	}
+	canonical := emailcanon.Canonicalize(*email, constant.EmailCanonicalProviders)
+	return &canonical
+}
+
+// ScanIntegrity verifies the checksum of every account regardless of AccountChecksumVerify
+func (svc *Service) ScanIntegrity(ctx context.Context) (result http.IntegrityScan, err error) {
+	_, svc, cancel := svc.bind(ctx, 0)
+	defer cancel()
+	result.Mismatched = []string{}
+	afterID := 0
+	for {
+		accounts, err := svc.repo.FindAfterID(afterID, constant.AccountIntegrityBatchSize)
+		if err != nil {
+			return result, errors.Wrap(err, "find accounts after id")
+		}
+
+		for i := range accounts {
+			afterID = int(accounts[i].ID)
+			result.Checked++
+			if accounts[i].Checksum == "" {
+				result.Unsealed++
+				continue
+			}
+			if !account.VerifyChecksum(accounts[i]) {
+				svc.logger.Error("ACCOUNT CHECKSUM MISMATCH", "account_id", afterID)
+				metrics.ChecksumMismatch()
+				result.Mismatched = append(result.Mismatched, publicid.Encode(afterID))
+			}
+		}
+
+		if len(accounts) < constant.AccountIntegrityBatchSize {
+			return result, nil
+		}
+	}
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// nullIfEmpty writes an empty optional field as null so it is cleared rather than stored as ""
+func nullIfEmpty(value *string) interface{} {
+	if *value == "" {
+		return nil
+	}
+	return *value
+}
+
+// normalizeEmail is applied before the uniqueness checks and before the email is stored
+func normalizeEmail(email *string) *string {
+	if email == nil {
+		return nil
+	}
+	normalized := emailcanon.Normalize(*email)
+	return &normalized
+}
+
+// normalizePhone stores every phone number in its +62 form so the uniqueness check sees one spelling,
+// numbers the phone tag would reject are left as they are
+func normalizePhone(number *string) *string {
+	if number == nil {
+		return nil
+	}
+	if canonical, ok := phone.Normalize(*number); ok {
+		return &canonical
+	}
+	return number
+}
+
+// MergeAccounts folds the source account into the target and deletes the source.
+// Empty target fields are filled from the source, fields set differently on both are resolved by the strategy:
+// prefer_newest picks the account updated last and the target on a tie,
+// per_field applies the overrides and keeps the target for fields without one.
+func (svc *Service) MergeAccounts(ctx context.Context, sourceID, targetID int, strategy string, overrides map[string]string) (report http.MergeReport, err error) {
+	_, svc, cancel := svc.bind(ctx, constant.AccountWriteTimeout)
+	defer cancel()
+	defer svc.invalidateAccount(sourceID)
+	defer svc.invalidateAccount(targetID)
+	if sourceID == targetID {
+		err = constant.ErrMergeSameAccount
+		return
+	}
+
+	switch strategy {
+	case constant.MergeStrategyPreferTarget, constant.MergeStrategyPreferSource, constant.MergeStrategyPreferNewest:
+	case constant.MergeStrategyPerField:
+		for field, side := range overrides {
+			known := false
+			for _, mergeField := range mergeFields {
+				known = known || mergeField.name == field
+			}
+			if !known || (side != constant.MergeSideSource && side != constant.MergeSideTarget) {
+				err = errors.Wrap(constant.ErrInvalidMergeOverride, field)
+				return
+			}
+		}
+	default:
+		err = constant.ErrInvalidMergeStrategy
+		return
+	}
+
+	source, err := svc.repo.TakeAccountByID(sourceID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take source account")
+		return
+	}
+	target, err := svc.repo.TakeAccountByID(targetID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrAccountNotRegistered
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take target account")
+		return
+	}
+
+	report = http.MergeReport{
+		TargetID:  publicid.Encode(targetID),
+		Conflicts: []http.MergeResolution{},
+		Filled:    []string{},
+	}
+	fields := map[string]interface{}{}
+	for _, mergeField := range mergeFields {
+		sourceValue, targetValue := mergeField.value(source), mergeField.value(target)
+		if sourceValue == "" || sourceValue == targetValue {
+			continue
+		}
+		if targetValue == "" {
+			fields[mergeField.column] = sourceValue
+			report.Filled = append(report.Filled, mergeField.name)
+			continue
+		}
+
+		resolution := http.MergeResolution{
+			Field:  mergeField.name,
+			Winner: constant.MergeSideTarget,
+			Rule:   strategy,
+		}
+		switch strategy {
+		case constant.MergeStrategyPreferSource:
+			resolution.Winner = constant.MergeSideSource
+		case constant.MergeStrategyPreferNewest:
+			if source.UpdatedAt.After(target.UpdatedAt) {
+				resolution.Winner = constant.MergeSideSource
+			}
+		case constant.MergeStrategyPerField:
+			if side, ok := overrides[mergeField.name]; ok {
+				resolution.Winner = side
+			} else {
+				resolution.Rule = constant.MergeStrategyPreferTarget
+			}
+		}
+		if resolution.Winner == constant.MergeSideSource {
+			fields[mergeField.column] = sourceValue
+		}
+		report.Conflicts = append(report.Conflicts, resolution)
+	}
+	if email, ok := fields["email"].(string); ok {
+		fields["canonical_email"] = canonicalEmail(&email)
+	}
+
+	err = svc.repo.Merge(sourceID, targetID, fields)
+	if err != nil {
+		err = errors.Wrap(err, "merge accounts")
 		return
 	}
 	return
@@ -0,0 +1,1371 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forkyid/go-utils/v1/validation"
+	"github.com/jackc/pgconn"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/i18n"
+	"go-rest-api/src/pkg/imageproc"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/passwordhash"
+	"go-rest-api/src/pkg/passwordpolicy"
+	"go-rest-api/src/pkg/permission"
+	"go-rest-api/src/pkg/phone"
+	"go-rest-api/src/pkg/publicid"
+	"go-rest-api/src/pkg/transform"
+	"go-rest-api/src/repository/v1/account"
+)
+
+func TestMain(m *testing.M) {
+	// the tests run without redis
+	constant.AccountCacheTTL = 0
+	if err := phone.Register(validation.Validator); err != nil {
+		panic(err)
+	}
+	if err := passwordpolicy.Register(validation.Validator, constant.PasswordPolicy); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// notification is a message the outbox kept instead of sending it
+type notification struct {
+	to, templateName string
+	data             map[string]string
+}
+
+type outbox struct {
+	sent []notification
+}
+
+func (o *outbox) Notify(to, locale, templateName string, data map[string]string) (err error) {
+	o.sent = append(o.sent, notification{to: to, templateName: templateName, data: data})
+	return
+}
+
+// memoryStorage keeps the objects put by key
+type memoryStorage struct {
+	objects map[string][]byte
+}
+
+func (s *memoryStorage) Put(key, contentType string, data []byte) (url string, err error) {
+	if s.objects == nil {
+		s.objects = map[string][]byte{}
+	}
+	s.objects[key] = data
+	return "https://cdn.example.com/" + key, nil
+}
+
+// failingStorage fails to store the keys ending in failSuffix
+type failingStorage struct {
+	memoryStorage
+	failSuffix string
+}
+
+func (s *failingStorage) Put(key, contentType string, data []byte) (url string, err error) {
+	if strings.HasSuffix(key, s.failSuffix) {
+		return "", errors.New("bucket unavailable")
+	}
+	return s.memoryStorage.Put(key, contentType, data)
+}
+
+func newTestService() (*Service, *memoryRepo) {
+	repo := &memoryRepo{}
+	svc := NewService(repo, &memoryTokens{}, &outbox{}, &memoryStorage{}, transform.Pipelines{}, nil,
+		logger.New(io.Discard, logger.LevelError))
+	return svc, repo
+}
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+// register creates an account accepting the current terms
+func register(t *testing.T, svc *Service, username string) (accountID int) {
+	t.Helper()
+	accountID, err := svc.Create(context.Background(), http.RegisterUser{
+		Username:     username,
+		FullName:     "Budi Santoso",
+		Password:     "Str0ng!Passw0rd",
+		TermsVersion: constant.TermsVersion,
+	})
+	if err != nil {
+		t.Fatalf("Create(%q) error = %v", username, err)
+	}
+	return
+}
+
+func TestUpdateWritesOnlyThePresentFieldsAndReplaceEveryField(t *testing.T) {
+	svc, repo := newTestService()
+	accountID := register(t, svc, "budi")
+	_, err := svc.Update(context.Background(), accountID, http.UpdateUser{
+		Address:     stringPointer("Jl. Sudirman 1"),
+		JobPosition: stringPointer("Engineer"),
+		Gender:      stringPointer("male"),
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// PATCH leaves the fields absent from the body alone
+	_, err = svc.Update(context.Background(), accountID, http.UpdateUser{FullName: stringPointer("Budi S.")})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	patched, _ := repo.TakeAccountByID(accountID)
+	if patched.FullName != "Budi S." {
+		t.Errorf("full name after PATCH = %q, want %q", patched.FullName, "Budi S.")
+	}
+	if stringValue(patched.Address) != "Jl. Sudirman 1" || stringValue(patched.JobPosition) != "Engineer" || patched.Gender != "male" {
+		t.Errorf("PATCH of the full name changed address %v, job position %v, gender %q",
+			patched.Address, patched.JobPosition, patched.Gender)
+	}
+
+	// PUT resets every replaceable field absent from the body
+	_, err = svc.Replace(context.Background(), accountID, "", http.ReplaceUser{FullName: "Budi Santoso"})
+	if err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	replaced, _ := repo.TakeAccountByID(accountID)
+	if replaced.FullName != "Budi Santoso" {
+		t.Errorf("full name after PUT = %q, want %q", replaced.FullName, "Budi Santoso")
+	}
+	if replaced.Address != nil || replaced.JobPosition != nil {
+		t.Errorf("PUT without address and job position kept %v and %v", replaced.Address, replaced.JobPosition)
+	}
+	if replaced.Gender != "none" {
+		t.Errorf("gender after PUT = %q, want the default none", replaced.Gender)
+	}
+	if replaced.Username != "budi" {
+		t.Errorf("PUT changed the username to %q, it is not replaceable", replaced.Username)
+	}
+}
+
+func TestUpdateRateExceeded(t *testing.T) {
+	defaults := []int{constant.ProfileUpdateLimit, constant.PasswordUpdateLimit}
+	constant.ProfileUpdateLimit, constant.PasswordUpdateLimit = 3, 1
+	defer func() {
+		constant.ProfileUpdateLimit, constant.PasswordUpdateLimit = defaults[0], defaults[1]
+	}()
+
+	svc, _ := newTestService()
+	accountID := register(t, svc, "budi")
+	if _, err := svc.Update(context.Background(), accountID, http.UpdateUser{Password: stringPointer("N3w!Passw0rd")}); err != nil {
+		t.Fatalf("first password update error = %v", err)
+	}
+
+	// the stricter password group is exhausted first, a plain profile update still fits the profile group
+	_, err := svc.Update(context.Background(), accountID, http.UpdateUser{Password: stringPointer("Oth3r!Passw0rd")})
+	if err != constant.ErrUpdateRateExceeded {
+		t.Errorf("second password update error = %v, want %v", err, constant.ErrUpdateRateExceeded)
+	}
+	if _, err = svc.Update(context.Background(), accountID, http.UpdateUser{FullName: stringPointer("Budi S.")}); err != nil {
+		t.Errorf("profile update within the limit error = %v", err)
+	}
+
+	// a rejected update is not counted, the third accepted one fills the profile group
+	if _, err = svc.Update(context.Background(), accountID, http.UpdateUser{FullName: stringPointer("Budi")}); err != nil {
+		t.Errorf("profile update within the limit error = %v", err)
+	}
+	_, err = svc.Update(context.Background(), accountID, http.UpdateUser{FullName: stringPointer("Budi Santoso")})
+	if err != constant.ErrUpdateRateExceeded {
+		t.Errorf("profile update past the limit error = %v, want %v", err, constant.ErrUpdateRateExceeded)
+	}
+}
+
+func TestDisplayNamePolicy(t *testing.T) {
+	defaultUnique := constant.DisplayNameUnique
+	defer func() { constant.DisplayNameUnique = defaultUnique }()
+
+	tests := []struct {
+		name        string
+		unique      bool
+		displayName string
+		want        error
+	}{
+		{"unique taken by another account", true, "Budi", constant.ErrDisplayNameAlreadyExist},
+		{"unique compares trimmed and case folded", true, "  bUDI ", constant.ErrDisplayNameAlreadyExist},
+		{"unique free name", true, "Siti", nil},
+		{"non unique allows a taken name", false, "Budi", nil},
+		{"empty is rejected in both modes", false, "   ", constant.ErrDisplayNameCannotBeEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constant.DisplayNameUnique = tt.unique
+			svc, _ := newTestService()
+			budiID := register(t, svc, "budi")
+			if _, err := svc.Update(context.Background(), budiID, http.UpdateUser{DisplayName: stringPointer("Budi")}); err != nil {
+				t.Fatalf("Update() of the first display name error = %v", err)
+			}
+			sitiID := register(t, svc, "siti")
+
+			if _, err := svc.Update(context.Background(), sitiID, http.UpdateUser{DisplayName: stringPointer(tt.displayName)}); err != tt.want {
+				t.Errorf("Update() of display name %q error = %v, want %v", tt.displayName, err, tt.want)
+			}
+		})
+	}
+
+	// an account keeps its own display name under the unique policy
+	constant.DisplayNameUnique = true
+	svc, _ := newTestService()
+	budiID := register(t, svc, "budi")
+	if _, err := svc.Update(context.Background(), budiID, http.UpdateUser{DisplayName: stringPointer("Budi")}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, err := svc.Update(context.Background(), budiID, http.UpdateUser{DisplayName: stringPointer("budi")}); err != nil {
+		t.Errorf("Update() of the own display name in another case error = %v", err)
+	}
+}
+
+func TestSendVerificationBulkEnqueuesTheFilteredSubset(t *testing.T) {
+	defaultLimit := constant.VerificationEmailLimit
+	constant.VerificationEmailLimit = 1
+	defer func() { constant.VerificationEmailLimit = defaultLimit }()
+
+	svc, repo := newTestService()
+	old := time.Now().UTC().AddDate(0, -1, 0)
+	accounts := []struct {
+		username, email string
+		verified, old   bool
+	}{
+		{"old_unverified", "old@example.com", false, true},
+		{"new_unverified", "new@example.com", false, false},
+		{"old_verified", "verified@example.com", true, true},
+		{"old_without_email", "", false, true},
+	}
+	for _, account := range accounts {
+		i := register(t, svc, account.username) - 1
+		if account.email != "" {
+			repo.accounts[i].Email = stringPointer(account.email)
+		}
+		repo.accounts[i].IsVerified = account.verified
+		if account.old {
+			repo.accounts[i].CreatedAt = old
+		}
+	}
+
+	request := http.SendVerificationBulk{CreatedBefore: time.Now().UTC().AddDate(0, 0, -1).Format(constant.DOBFormat)}
+	count, err := svc.SendVerificationBulk(context.Background(), request)
+	if err != nil {
+		t.Fatalf("SendVerificationBulk() error = %v", err)
+	}
+	sent := svc.notifier.(*outbox).sent
+	if count != 1 || len(sent) != 1 || sent[0].to != "old@example.com" || sent[0].templateName != i18n.TemplateVerification {
+		t.Fatalf("SendVerificationBulk() enqueued %d: %+v, want only the verification of old@example.com", count, sent)
+	}
+
+	// the email hit its verification limit, running the bulk again skips it
+	count, err = svc.SendVerificationBulk(context.Background(), request)
+	if err != nil {
+		t.Fatalf("SendVerificationBulk() error = %v", err)
+	}
+	if count != 0 || len(svc.notifier.(*outbox).sent) != 1 {
+		t.Errorf("SendVerificationBulk() past the rate limit enqueued %d", count)
+	}
+}
+
+// preferenceHook creates the default preference of every new account, it checks the account was committed first
+type preferenceHook struct {
+	repo        *memoryRepo
+	preferences map[int]string
+}
+
+func (hook *preferenceHook) OnAccountCreated(accountID int) (err error) {
+	if _, err = hook.repo.TakeAccountByID(accountID); err != nil {
+		return
+	}
+	hook.preferences[accountID] = "newsletter:weekly"
+	return
+}
+
+type failingHook struct{}
+
+func (failingHook) OnAccountCreated(accountID int) (err error) {
+	return errors.New("preferences unavailable")
+}
+
+func TestCreatedHookCreatesDefaultPreference(t *testing.T) {
+	svc, repo := newTestService()
+	hook := &preferenceHook{repo: repo, preferences: map[int]string{}}
+	svc.AddHook(failingHook{})
+	svc.AddHook(hook)
+
+	// the failing hook neither fails the registration nor stops the hooks after it
+	accountID := register(t, svc, "budi")
+	if hook.preferences[accountID] != "newsletter:weekly" {
+		t.Errorf("preferences = %v, want the default preference of account %d", hook.preferences, accountID)
+	}
+}
+
+func TestValidateBulkReportsEveryRow(t *testing.T) {
+	svc, _ := newTestService()
+	register(t, svc, "budi")
+
+	rows := []http.RegisterUser{
+		{Username: "siti", FullName: "Siti", Password: "Str0ng!Passw0rd", TermsVersion: constant.TermsVersion},
+		{Username: "Budi", FullName: "Budi", Password: "Str0ng!Passw0rd", TermsVersion: constant.TermsVersion},
+		{Username: "andi", FullName: "", Password: "weak", TermsVersion: "0"},
+		{Username: "SITI", FullName: "Siti Aminah", Password: "Str0ng!Passw0rd", TermsVersion: constant.TermsVersion},
+	}
+	report, err := svc.ValidateBulk(context.Background(), rows)
+	if err != nil {
+		t.Fatalf("ValidateBulk() error = %v", err)
+	}
+	if report.Valid || len(report.Rows) != len(rows) {
+		t.Fatalf("ValidateBulk() valid %v with %d rows, want invalid with %d", report.Valid, len(report.Rows), len(rows))
+	}
+
+	want := []struct {
+		valid  bool
+		fields []string
+	}{
+		{true, nil},
+		{false, []string{"username"}},
+		{false, []string{"fullname", "password", "terms_version"}},
+		{false, []string{"username"}},
+	}
+	for i, row := range report.Rows {
+		if row.Index != i || row.Valid != want[i].valid || len(row.Errors) != len(want[i].fields) {
+			t.Errorf("row %d = %+v, want index %d valid %v with errors on %v", i, row, i, want[i].valid, want[i].fields)
+			continue
+		}
+		for _, field := range want[i].fields {
+			if row.Errors[field] == "" {
+				t.Errorf("row %d errors = %v, want an error on %s", i, row.Errors, field)
+			}
+		}
+	}
+	if !strings.Contains(report.Rows[3].Errors["username"], "row 0") {
+		t.Errorf("duplicate username error = %q, want it to point to row 0", report.Rows[3].Errors["username"])
+	}
+}
+
+func TestTermsAcceptance(t *testing.T) {
+	defaultVersion := constant.TermsVersion
+	defer func() { constant.TermsVersion = defaultVersion }()
+	constant.TermsVersion = "1"
+
+	svc, repo := newTestService()
+	_, err := svc.Create(context.Background(), http.RegisterUser{Username: "budi", FullName: "Budi", Password: "Str0ng!Passw0rd"})
+	if err != constant.ErrTermsNotAccepted {
+		t.Errorf("Create() without accepting the terms error = %v, want %v", err, constant.ErrTermsNotAccepted)
+	}
+	if len(repo.accounts) != 0 {
+		t.Fatal("Create() without accepting the terms stored the account")
+	}
+
+	accountID := register(t, svc, "budi")
+	account, _ := svc.TakeAccountByID(context.Background(), accountID)
+	if account.TermsAcceptanceRequired {
+		t.Error("terms acceptance is required right after accepting the current version")
+	}
+
+	constant.TermsVersion = "2"
+	account, _ = svc.TakeAccountByID(context.Background(), accountID)
+	if !account.TermsAcceptanceRequired {
+		t.Error("terms acceptance is not required after the version bump")
+	}
+	if err = svc.AcceptTerms(context.Background(), accountID, http.AcceptTerms{TermsVersion: "1"}); err != constant.ErrTermsNotAccepted {
+		t.Errorf("AcceptTerms() of the old version error = %v, want %v", err, constant.ErrTermsNotAccepted)
+	}
+	if err = svc.AcceptTerms(context.Background(), accountID, http.AcceptTerms{TermsVersion: "2"}); err != nil {
+		t.Fatalf("AcceptTerms() error = %v", err)
+	}
+	account, _ = svc.TakeAccountByID(context.Background(), accountID)
+	stored, _ := repo.TakeAccountByID(accountID)
+	if account.TermsAcceptanceRequired || stored.TermsVersion != "2" || stored.TermsAcceptedAt == nil {
+		t.Errorf("after re-acceptance required %v, stored version %q accepted at %v",
+			account.TermsAcceptanceRequired, stored.TermsVersion, stored.TermsAcceptedAt)
+	}
+}
+
+func avatarPNG(t *testing.T, width int) []byte {
+	t.Helper()
+	buffer := bytes.Buffer{}
+	if err := png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, width, width))); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// holdAvatars gives the service a single avatar worker and keeps it busy until the returned func is called,
+// which waits for every queued job to finish
+func holdAvatars(svc *Service) (finish func()) {
+	svc.avatarPool = imageproc.NewPool(1, 10, svc.logger)
+	release := make(chan struct{})
+	svc.avatarPool.Submit(func() { <-release })
+	return func() {
+		done := make(chan struct{})
+		svc.avatarPool.Submit(func() { close(done) })
+		close(release)
+		<-done
+	}
+}
+
+func TestUploadAvatarEnqueuesAndCompletesVariants(t *testing.T) {
+	svc, _ := newTestService()
+	accountID := register(t, svc, "budi")
+	finish := holdAvatars(svc)
+
+	photoURL, err := svc.UploadAvatar(context.Background(), accountID, avatarPNG(t, 300))
+	if err != nil {
+		t.Fatalf("UploadAvatar() error = %v", err)
+	}
+	queued, _ := svc.TakeAccountByID(context.Background(), accountID)
+	if !queued.AvatarProcessing || len(queued.AvatarVariants) != 0 || queued.PhotoURL != photoURL {
+		t.Errorf("queued avatar processing %v variants %v photo %q, want processing without variants and photo %q",
+			queued.AvatarProcessing, queued.AvatarVariants, queued.PhotoURL, photoURL)
+	}
+
+	finish()
+	processed, _ := svc.TakeAccountByID(context.Background(), accountID)
+	if processed.AvatarProcessing {
+		t.Error("avatar is still processing after the job finished")
+	}
+	if len(processed.AvatarVariants) != len(constant.AvatarVariantWidths) {
+		t.Fatalf("variants = %v, want one per width of %v", processed.AvatarVariants, constant.AvatarVariantWidths)
+	}
+	objects := svc.storage.(*memoryStorage).objects
+	version := photoURL[strings.Index(photoURL, "?v="):]
+	for _, width := range constant.AvatarVariantWidths {
+		key := fmt.Sprintf("avatars/%s_%d", publicid.Encode(accountID), width)
+		if objects[key] == nil {
+			t.Errorf("variant %d is not stored under %s", width, key)
+		}
+		// the variants reuse their keys, they carry the version of the upload like the photo url
+		if url := processed.AvatarVariants[fmt.Sprint(width)]; !strings.HasSuffix(url, version) {
+			t.Errorf("variant %d url = %q, want the version %s of the upload", width, url, version)
+		}
+	}
+}
+
+func TestUploadAvatarLeavesNoPartialVariants(t *testing.T) {
+	svc, _ := newTestService()
+	accountID := register(t, svc, "budi")
+	// the first width is stored, the last one fails
+	widths := constant.AvatarVariantWidths
+	svc.storage = &failingStorage{failSuffix: fmt.Sprintf("_%d", widths[len(widths)-1])}
+	finish := holdAvatars(svc)
+
+	if _, err := svc.UploadAvatar(context.Background(), accountID, avatarPNG(t, 300)); err != nil {
+		t.Fatalf("UploadAvatar() error = %v", err)
+	}
+	finish()
+	processed, _ := svc.TakeAccountByID(context.Background(), accountID)
+	if processed.AvatarProcessing || len(processed.AvatarVariants) != 0 {
+		t.Errorf("avatar after a failed variant processing %v variants %v, want finished without variants",
+			processed.AvatarProcessing, processed.AvatarVariants)
+	}
+}
+
+func TestUploadAvatarRejectsTooManyPixels(t *testing.T) {
+	defaultMaxPixels := constant.AvatarMaxPixels
+	constant.AvatarMaxPixels = 32 * 32
+	defer func() { constant.AvatarMaxPixels = defaultMaxPixels }()
+	svc, repo := newTestService()
+	accountID := register(t, svc, "budi")
+	before, _ := repo.TakeAccountByID(accountID)
+
+	if _, err := svc.UploadAvatar(context.Background(), accountID, avatarPNG(t, 64)); err != constant.ErrAvatarTooManyPixels {
+		t.Errorf("UploadAvatar() of 64x64 pixels error = %v, want %v", err, constant.ErrAvatarTooManyPixels)
+	}
+	if stored, _ := repo.TakeAccountByID(accountID); stored.PhotoURL != before.PhotoURL || stored.AvatarProcessing {
+		t.Errorf("rejected avatar changed the account to photo %q processing %v", stored.PhotoURL, stored.AvatarProcessing)
+	}
+	if _, err := svc.UploadAvatar(context.Background(), accountID, avatarPNG(t, 32)); err != nil {
+		t.Errorf("UploadAvatar() of 32x32 pixels error = %v", err)
+	}
+}
+
+func TestUploadAvatarQueueFull(t *testing.T) {
+	svc, repo := newTestService()
+	accountID := register(t, svc, "budi")
+	before, _ := repo.TakeAccountByID(accountID)
+	svc.avatarPool = imageproc.NewPool(0, 0, svc.logger)
+
+	if _, err := svc.UploadAvatar(context.Background(), accountID, avatarPNG(t, 64)); err != constant.ErrAvatarQueueFull {
+		t.Errorf("UploadAvatar() with a full queue error = %v, want %v", err, constant.ErrAvatarQueueFull)
+	}
+	// nothing is replaced when the job could not be queued
+	stored, _ := repo.TakeAccountByID(accountID)
+	if stored.AvatarProcessing || stored.PhotoURL != before.PhotoURL || stored.AvatarVariants != before.AvatarVariants {
+		t.Errorf("rejected upload changed the account to photo %q processing %v variants %q",
+			stored.PhotoURL, stored.AvatarProcessing, stored.AvatarVariants)
+	}
+	if objects := svc.storage.(*memoryStorage).objects; len(objects) != 0 {
+		t.Errorf("rejected upload stored %d objects", len(objects))
+	}
+}
+
+func TestPasswordChangedAtAdvancesOnPasswordChangeOnly(t *testing.T) {
+	svc, repo := newTestService()
+	accountID := register(t, svc, "budi")
+	if repo.accounts[0].PasswordChangedAt == nil {
+		t.Fatal("password_changed_at is not set on registration")
+	}
+	anHourAgo := time.Now().UTC().Add(-time.Hour)
+	repo.accounts[0].PasswordChangedAt = &anHourAgo
+
+	if _, err := svc.Update(context.Background(), accountID, http.UpdateUser{FullName: stringPointer("Budi S.")}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	account, _ := svc.TakeAccountByID(context.Background(), accountID)
+	if account.PasswordChangedAt == nil || !account.PasswordChangedAt.Equal(anHourAgo) {
+		t.Errorf("password_changed_at after a profile update = %v, want it kept at %v", account.PasswordChangedAt, anHourAgo)
+	}
+
+	if err := svc.ChangePassword(context.Background(), accountID, "Str0ng!Passw0rd", "N3w!Passw0rd"); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	account, _ = svc.TakeAccountByID(context.Background(), accountID)
+	if account.PasswordChangedAt == nil || !account.PasswordChangedAt.After(anHourAgo) {
+		t.Errorf("password_changed_at after a password change = %v, want it after %v", account.PasswordChangedAt, anHourAgo)
+	}
+}
+
+func TestOldPasswordMustBeChanged(t *testing.T) {
+	defaultMaxAge, defaultVerified := constant.PasswordMaxAge, constant.RequireVerifiedLogin
+	defer func() { constant.PasswordMaxAge, constant.RequireVerifiedLogin = defaultMaxAge, defaultVerified }()
+	constant.RequireVerifiedLogin = false
+
+	tests := []struct {
+		name      string
+		maxAge    time.Duration
+		changedAt time.Duration
+		want      bool
+	}{
+		{"older than the max age", 90 * 24 * time.Hour, 91 * 24 * time.Hour, true},
+		{"within the max age", 90 * 24 * time.Hour, 89 * 24 * time.Hour, false},
+		{"policy disabled", 0, 365 * 24 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constant.PasswordMaxAge = tt.maxAge
+			svc, repo := newTestService()
+			accountID := register(t, svc, "budi")
+			changedAt := time.Now().UTC().Add(-tt.changedAt)
+			repo.accounts[0].PasswordChangedAt = &changedAt
+
+			// the owner still authenticates to change the password
+			account, err := svc.Authenticate(context.Background(), http.LoginUser{Username: "budi", Password: "Str0ng!Passw0rd"})
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if got := svc.MustChangePassword(account); got != tt.want {
+				t.Errorf("MustChangePassword() = %v, want %v", got, tt.want)
+			}
+			me, _ := svc.TakeAccountByID(context.Background(), accountID)
+			if me.MustChangePassword != tt.want {
+				t.Errorf("must_change_password = %v, want %v", me.MustChangePassword, tt.want)
+			}
+		})
+	}
+}
+
+func TestCardVisibility(t *testing.T) {
+	svc, repo := newTestService()
+	ownerID := register(t, svc, "budi")
+	viewerID := register(t, svc, "siti")
+	repo.accounts[0].Email = stringPointer("budi@example.com")
+	repo.accounts[0].JobPosition = stringPointer("Engineer")
+
+	card, err := svc.TakeCard(context.Background(), ownerID, viewerID)
+	if err != nil {
+		t.Fatalf("TakeCard() error = %v", err)
+	}
+	if card.Email != "" || card.JobPosition != "Engineer" || card.Username != "budi" {
+		t.Errorf("default card for another account = %+v, want the email hidden and the job position shown", card)
+	}
+
+	err = svc.UpdateVisibility(context.Background(), ownerID, http.UpdateVisibility{Visibility: map[string]string{"job_position": constant.VisibilityPrivate}})
+	if err != nil {
+		t.Fatalf("UpdateVisibility() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		viewerID int
+		visible  bool
+	}{
+		{"another account", viewerID, false},
+		{"anonymous", 0, false},
+		{"owner", ownerID, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, err := svc.TakeCard(context.Background(), ownerID, tt.viewerID)
+			if err != nil {
+				t.Fatalf("TakeCard() error = %v", err)
+			}
+			if (card.JobPosition != "") != tt.visible || (card.Email != "") != tt.visible {
+				t.Errorf("card = %+v, want the private job position and email visible %v", card, tt.visible)
+			}
+			if card.Username != "budi" {
+				t.Errorf("public username = %q, want it shown", card.Username)
+			}
+		})
+	}
+
+	err = svc.UpdateVisibility(context.Background(), ownerID, http.UpdateVisibility{Visibility: map[string]string{"password": constant.VisibilityPublic}})
+	if err != constant.ErrInvalidVisibilityField {
+		t.Errorf("UpdateVisibility() of a field without a setting error = %v, want %v", err, constant.ErrInvalidVisibilityField)
+	}
+}
+
+func TestAdminAndUserGetDifferentPermissions(t *testing.T) {
+	svc, repo := newTestService()
+	userID := register(t, svc, "budi")
+	adminID := register(t, svc, "admin")
+	repo.accounts[1].Role = constant.RoleAdmin
+	repo.accounts[0].Permissions = `["accounts.pii.read"]`
+
+	user, err := svc.TakePermissions(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("TakePermissions() of the user error = %v", err)
+	}
+	admin, err := svc.TakePermissions(context.Background(), adminID)
+	if err != nil {
+		t.Fatalf("TakePermissions() of the admin error = %v", err)
+	}
+	if user.Role != constant.RoleUser || admin.Role != constant.RoleAdmin {
+		t.Errorf("roles = %q and %q, want %q and %q", user.Role, admin.Role, constant.RoleUser, constant.RoleAdmin)
+	}
+
+	tests := []struct {
+		permission  string
+		user, admin bool
+	}{
+		{permission.ReadAccount, true, true},
+		{permission.ExportAccounts, false, true},
+		{permission.ReadAuditTrail, false, true},
+		{permission.ReadAccountPII, true, false},
+	}
+	for _, tt := range tests {
+		if got := permission.Has(user.Permissions, tt.permission); got != tt.user {
+			t.Errorf("user has %s = %v, want %v", tt.permission, got, tt.user)
+		}
+		if got := permission.Has(admin.Permissions, tt.permission); got != tt.admin {
+			t.Errorf("admin has %s = %v, want %v", tt.permission, got, tt.admin)
+		}
+	}
+}
+
+func TestPendingEmailChangeLocksUntilExpiry(t *testing.T) {
+	svc, repo := newTestService()
+	accountID := register(t, svc, "budi")
+	repo.accounts[0].Email = stringPointer("budi@example.com")
+
+	if _, err := svc.Update(context.Background(), accountID, http.UpdateUser{Email: stringPointer("budi@new.example.com")}); err != nil {
+		t.Fatalf("Update() of the email error = %v", err)
+	}
+	if stored, _ := repo.TakeAccountByID(accountID); stringValue(stored.Email) != "budi@example.com" ||
+		stringValue(stored.PendingEmail) != "budi@new.example.com" {
+		t.Fatalf("email %v pending %v, want the change pending until confirmed", stored.Email, stored.PendingEmail)
+	}
+
+	_, err := svc.Update(context.Background(), accountID, http.UpdateUser{Email: stringPointer("budi@other.example.com")})
+	if err != constant.ErrEmailChangePending {
+		t.Errorf("second email change error = %v, want %v", err, constant.ErrEmailChangePending)
+	}
+
+	// the lock releases by itself once the pending change expired
+	expired := time.Now().UTC().Add(-time.Minute)
+	repo.accounts[0].PendingEmailExpiresAt = &expired
+	if _, err = svc.Update(context.Background(), accountID, http.UpdateUser{Email: stringPointer("budi@other.example.com")}); err != nil {
+		t.Errorf("email change after the pending one expired error = %v", err)
+	}
+	if stored, _ := repo.TakeAccountByID(accountID); stringValue(stored.PendingEmail) != "budi@other.example.com" {
+		t.Errorf("pending email = %v, want the new change", stored.PendingEmail)
+	}
+}
+
+func TestProbeExistence(t *testing.T) {
+	defaultLimit := constant.ExistenceProbeLimit
+	constant.ExistenceProbeLimit = 100
+	defer func() { constant.ExistenceProbeLimit = defaultLimit }()
+
+	svc, repo := newTestService()
+	register(t, svc, "budi")
+	repo.accounts[0].Email = stringPointer("budi@example.com")
+
+	tests := []struct {
+		name    string
+		request http.ExistenceProbe
+		exists  bool
+	}{
+		{"registered username", http.ExistenceProbe{Username: "Budi"}, true},
+		{"registered email", http.ExistenceProbe{Email: "budi@example.com"}, true},
+		{"unknown username", http.ExistenceProbe{Username: "siti"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// an admin gets the answer
+			result, err := svc.ProbeExistence(context.Background(), tt.request, "10.0.0.1", true)
+			if err != nil {
+				t.Fatalf("ProbeExistence() as admin error = %v", err)
+			}
+			if result.Ambiguous || result.Exists == nil || *result.Exists != tt.exists {
+				t.Errorf("ProbeExistence() as admin = %+v, want exists %v", result, tt.exists)
+			}
+
+			// a public caller gets the same ambiguous answer for every account
+			result, err = svc.ProbeExistence(context.Background(), tt.request, "10.0.0.2", false)
+			if err != nil {
+				t.Fatalf("ProbeExistence() as public error = %v", err)
+			}
+			if !result.Ambiguous || result.Exists != nil {
+				t.Errorf("ProbeExistence() as public = %+v, want an ambiguous result", result)
+			}
+		})
+	}
+}
+
+func TestProbeExistenceRateLimited(t *testing.T) {
+	defaultLimit := constant.ExistenceProbeLimit
+	constant.ExistenceProbeLimit = 1
+	defer func() { constant.ExistenceProbeLimit = defaultLimit }()
+
+	svc, _ := newTestService()
+	request := http.ExistenceProbe{Username: "budi"}
+	if _, err := svc.ProbeExistence(context.Background(), request, "10.0.0.1", false); err != nil {
+		t.Fatalf("ProbeExistence() error = %v", err)
+	}
+	if _, err := svc.ProbeExistence(context.Background(), request, "10.0.0.1", true); err != constant.ErrProbeRateExceeded {
+		t.Errorf("ProbeExistence() past the limit error = %v, want %v", err, constant.ErrProbeRateExceeded)
+	}
+}
+
+func TestRegistrationHandleCollision(t *testing.T) {
+	svc, repo := newTestService()
+	for _, username := range []string{"budi", "budi2", "budi3"} {
+		register(t, svc, username)
+	}
+	// a deleted account keeps its handle reserved
+	if err := repo.Delete(3); err != nil {
+		t.Fatal(err)
+	}
+	register(t, svc, "budi4")
+
+	want := []string{"budi-santoso", "budi-santoso-2", "budi-santoso-3", "budi-santoso-4"}
+	for i, account := range repo.accounts {
+		if account.Handle != want[i] {
+			t.Errorf("handle of %s = %q, want %q", account.Username, account.Handle, want[i])
+		}
+	}
+
+	if err := svc.UpdateHandle(context.Background(), 1, http.UpdateHandle{Handle: "budi-santoso-2"}); err != constant.ErrHandleAlreadyExist {
+		t.Errorf("UpdateHandle() to a taken handle error = %v, want %v", err, constant.ErrHandleAlreadyExist)
+	}
+	if err := svc.UpdateHandle(context.Background(), 1, http.UpdateHandle{Handle: "Budi Santoso"}); err != constant.ErrInvalidHandle {
+		t.Errorf("UpdateHandle() to a handle that is not a slug error = %v, want %v", err, constant.ErrInvalidHandle)
+	}
+}
+
+// racingRepo fails the insert like a registration that lost the race for the email to another one
+type racingRepo struct {
+	*memoryRepo
+}
+
+func (repo racingRepo) WithContext(ctx context.Context) account.Repositorier {
+	return repo
+}
+
+func (repo racingRepo) Transaction(fn func(repo account.Repositorier) error) (err error) {
+	return fn(repo)
+}
+
+func (repo racingRepo) Create(newAccount model.Account) (accountID int, err error) {
+	return 0, &pgconn.PgError{Code: "23505", ConstraintName: "accounts_email_key"}
+}
+
+func TestRegistrationConflictCodes(t *testing.T) {
+	svc, repo := newTestService()
+	registered := http.RegisterUser{
+		Username:     "budi",
+		FullName:     "Budi Santoso",
+		Password:     "Str0ng!Passw0rd",
+		TermsVersion: constant.TermsVersion,
+		Email:        stringPointer("budi@example.com"),
+		PhoneNumber:  stringPointer("+6281234567890"),
+	}
+	if _, err := svc.Create(context.Background(), registered); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := svc.ReserveUsername(context.Background(), http.ReserveUsername{Username: "siti"}, "10.0.0.1"); err != nil {
+		t.Fatalf("ReserveUsername() error = %v", err)
+	}
+
+	tests := []struct {
+		name                         string
+		username, email, phoneNumber string
+		want                         map[string]string
+	}{
+		{"username", "budi", "other@example.com", "+6281200000000",
+			map[string]string{"username": constant.ConflictCodeUsername}},
+		{"email", "andi", "budi@example.com", "+6281200000000",
+			map[string]string{"email": constant.ConflictCodeEmail}},
+		{"phone number", "andi", "other@example.com", "+6281234567890",
+			map[string]string{"phone_number": constant.ConflictCodePhoneNumber}},
+		{"reserved username", "siti", "other@example.com", "+6281200000000",
+			map[string]string{"username": constant.ConflictCodeReserved}},
+		{"every field", "budi", "budi@example.com", "+6281234567890", map[string]string{
+			"username":     constant.ConflictCodeUsername,
+			"email":        constant.ConflictCodeEmail,
+			"phone_number": constant.ConflictCodePhoneNumber,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := registered
+			request.Username, request.Email, request.PhoneNumber = tt.username, &tt.email, &tt.phoneNumber
+			_, err := svc.Create(context.Background(), request)
+			conflict := &ConflictError{}
+			if !errors.As(err, &conflict) || !errors.Is(err, constant.ErrAccountExist) {
+				t.Fatalf("Create() error = %v, want a ConflictError", err)
+			}
+			if codes := conflict.Codes(); !reflect.DeepEqual(codes, tt.want) {
+				t.Errorf("Codes() = %v, want %v", codes, tt.want)
+			}
+		})
+	}
+
+	// the unique constraint names the field when the checks passed but another registration won the race
+	racing := svc.withRepo(racingRepo{repo})
+	request := registered
+	request.Username, request.Email, request.PhoneNumber = "andi", stringPointer("andi@example.com"), nil
+	_, err := racing.Create(context.Background(), request)
+	conflict := &ConflictError{}
+	if !errors.As(err, &conflict) || conflict.Codes()["email"] != constant.ConflictCodeEmail {
+		t.Errorf("Create() losing the race error = %v, want the email conflict", err)
+	}
+}
+
+func TestMergeAccountsStrategies(t *testing.T) {
+	tests := []struct {
+		name            string
+		strategy        string
+		overrides       map[string]string
+		wantWinners     map[string]string
+		wantRules       map[string]string
+		wantFullName    string
+		wantJobPosition string
+	}{
+		{"prefer target", constant.MergeStrategyPreferTarget, nil,
+			map[string]string{"fullname": constant.MergeSideTarget, "job_position": constant.MergeSideTarget},
+			map[string]string{"fullname": constant.MergeStrategyPreferTarget, "job_position": constant.MergeStrategyPreferTarget},
+			"Budi Santoso", "Manager"},
+		{"prefer source", constant.MergeStrategyPreferSource, nil,
+			map[string]string{"fullname": constant.MergeSideSource, "job_position": constant.MergeSideSource},
+			map[string]string{"fullname": constant.MergeStrategyPreferSource, "job_position": constant.MergeStrategyPreferSource},
+			"Siti Aminah", "Engineer"},
+		{"prefer newest", constant.MergeStrategyPreferNewest, nil,
+			map[string]string{"fullname": constant.MergeSideSource, "job_position": constant.MergeSideSource},
+			map[string]string{"fullname": constant.MergeStrategyPreferNewest, "job_position": constant.MergeStrategyPreferNewest},
+			"Siti Aminah", "Engineer"},
+		{"per field keeps the target without an override", constant.MergeStrategyPerField,
+			map[string]string{"job_position": constant.MergeSideSource},
+			map[string]string{"fullname": constant.MergeSideTarget, "job_position": constant.MergeSideSource},
+			map[string]string{"fullname": constant.MergeStrategyPreferTarget, "job_position": constant.MergeStrategyPerField},
+			"Budi Santoso", "Engineer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, repo := newTestService()
+			targetID, sourceID := register(t, svc, "budi"), register(t, svc, "siti")
+			// the source was updated last, and only it has an address
+			repo.accounts[0].JobPosition, repo.accounts[0].UpdatedAt = stringPointer("Manager"), time.Now().Add(-time.Hour)
+			repo.accounts[1].FullName, repo.accounts[1].JobPosition = "Siti Aminah", stringPointer("Engineer")
+			repo.accounts[1].Address, repo.accounts[1].UpdatedAt = stringPointer("Jakarta"), time.Now()
+
+			report, err := svc.MergeAccounts(context.Background(), sourceID, targetID, tt.strategy, tt.overrides)
+			if err != nil {
+				t.Fatalf("MergeAccounts() error = %v", err)
+			}
+			if !reflect.DeepEqual(report.Filled, []string{"address"}) {
+				t.Errorf("Filled = %v, want the address", report.Filled)
+			}
+			if len(report.Conflicts) != len(tt.wantWinners) {
+				t.Fatalf("Conflicts = %+v, want %d", report.Conflicts, len(tt.wantWinners))
+			}
+			for _, resolution := range report.Conflicts {
+				if resolution.Winner != tt.wantWinners[resolution.Field] || resolution.Rule != tt.wantRules[resolution.Field] {
+					t.Errorf("resolution of %s = %+v, want %s by %s", resolution.Field, resolution,
+						tt.wantWinners[resolution.Field], tt.wantRules[resolution.Field])
+				}
+			}
+
+			target, _ := repo.TakeAccountByID(targetID)
+			if target.FullName != tt.wantFullName || stringValue(target.JobPosition) != tt.wantJobPosition ||
+				stringValue(target.Address) != "Jakarta" {
+				t.Errorf("merged target = %q, %v, %v, want %q, %q and the filled address",
+					target.FullName, target.JobPosition, target.Address, tt.wantFullName, tt.wantJobPosition)
+			}
+			if _, err := repo.TakeAccountByID(sourceID); err == nil {
+				t.Error("the source account was not deleted")
+			}
+		})
+	}
+}
+
+func TestMergeAccountsRejectsInvalidRequests(t *testing.T) {
+	svc, _ := newTestService()
+	targetID, sourceID := register(t, svc, "budi"), register(t, svc, "siti")
+
+	if _, err := svc.MergeAccounts(context.Background(), targetID, targetID, constant.MergeStrategyPreferTarget, nil); err != constant.ErrMergeSameAccount {
+		t.Errorf("MergeAccounts() into itself error = %v, want %v", err, constant.ErrMergeSameAccount)
+	}
+	if _, err := svc.MergeAccounts(context.Background(), sourceID, targetID, "prefer_oldest", nil); err != constant.ErrInvalidMergeStrategy {
+		t.Errorf("MergeAccounts() with an unknown strategy error = %v, want %v", err, constant.ErrInvalidMergeStrategy)
+	}
+	for _, overrides := range []map[string]string{{"password": constant.MergeSideSource}, {"fullname": "both"}} {
+		_, err := svc.MergeAccounts(context.Background(), sourceID, targetID, constant.MergeStrategyPerField, overrides)
+		if !errors.Is(err, constant.ErrInvalidMergeOverride) {
+			t.Errorf("MergeAccounts() with overrides %v error = %v, want %v", overrides, err, constant.ErrInvalidMergeOverride)
+		}
+	}
+}
+
+func TestWeakPasswordWarning(t *testing.T) {
+	defaultPolicy := constant.PasswordPolicy
+	constant.PasswordPolicy = passwordpolicy.Policy{MinLength: 10, RequireUppercase: true, RequireLowercase: true, RequireDigit: true, RequireSymbol: true}
+	defer func() { constant.PasswordPolicy = defaultPolicy }()
+
+	svc, repo := newTestService()
+	accountID := register(t, svc, "budi")
+	stored, _ := repo.TakeAccountByID(accountID)
+
+	// a password set before the policy was tightened still logs in, the login only records what it misses
+	want := []string{passwordpolicy.RuleMinLength, passwordpolicy.RuleUppercase, passwordpolicy.RuleDigit, passwordpolicy.RuleSymbol}
+	unmet, err := svc.CheckPasswordStrength(context.Background(), stored, "weakpass")
+	if err != nil {
+		t.Fatalf("CheckPasswordStrength() error = %v", err)
+	}
+	if !reflect.DeepEqual(unmet, want) {
+		t.Errorf("CheckPasswordStrength() = %v, want %v", unmet, want)
+	}
+	account, err := svc.TakeAccountByID(context.Background(), accountID)
+	if err != nil {
+		t.Fatalf("TakeAccountByID() error = %v", err)
+	}
+	if !account.WeakPassword || !reflect.DeepEqual(account.PasswordUnmetRules, want) {
+		t.Errorf("account warns %v with %v, want a warning with %v", account.WeakPassword, account.PasswordUnmetRules, want)
+	}
+
+	// the warning clears once a login checked a password meeting every rule
+	stored, _ = repo.TakeAccountByID(accountID)
+	if _, err = svc.CheckPasswordStrength(context.Background(), stored, "Str0ng!Passw0rd"); err != nil {
+		t.Fatalf("CheckPasswordStrength() error = %v", err)
+	}
+	account, _ = svc.TakeAccountByID(context.Background(), accountID)
+	if account.WeakPassword || len(account.PasswordUnmetRules) != 0 {
+		t.Errorf("account warns %v with %v, want no warning", account.WeakPassword, account.PasswordUnmetRules)
+	}
+}
+
+func TestExportWritesEveryPage(t *testing.T) {
+	svc, repo := newTestService()
+	total := 2*constant.ExportBatchSize + 1
+	for id := 1; id <= total; id++ {
+		username := fmt.Sprintf("user%d", id)
+		row := model.Account{Username: username, Handle: username, Email: stringPointer(username + "@example.com")}
+		row.ID = uint(id)
+		repo.accounts = append(repo.accounts, row)
+	}
+
+	// export collects the ids of the written lines, failing on a line carrying the email without pii
+	export := func(afterID int, includePII bool) (ids []string) {
+		t.Helper()
+		err := svc.Export(context.Background(), afterID, includePII, func(line http.ExportAccount) error {
+			if (line.Email != "") != includePII {
+				return fmt.Errorf("line %s has email %q with pii %v", line.ID, line.Email, includePII)
+			}
+			ids = append(ids, line.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		return
+	}
+
+	for _, includePII := range []bool{false, true} {
+		ids := export(0, includePII)
+		if len(ids) != total {
+			t.Fatalf("Export() with pii %v wrote %d lines, want %d", includePII, len(ids), total)
+		}
+		for i, id := range ids {
+			if id != publicid.Encode(i+1) {
+				t.Fatalf("line %d has id %s, want %s", i, id, publicid.Encode(i+1))
+			}
+		}
+	}
+
+	// a resumed export starts after the last line written before
+	resumed := export(constant.ExportBatchSize+3, false)
+	if len(resumed) != total-constant.ExportBatchSize-3 || resumed[0] != publicid.Encode(constant.ExportBatchSize+4) {
+		t.Errorf("resumed Export() wrote %d lines from %v, want %d from %s", len(resumed), resumed[:1],
+			total-constant.ExportBatchSize-3, publicid.Encode(constant.ExportBatchSize+4))
+	}
+}
+
+func TestHandleRedirectsDuringGraceOnly(t *testing.T) {
+	svc, repo := newTestService()
+	budiID, sitiID := register(t, svc, "budi"), register(t, svc, "siti")
+	if err := svc.UpdateHandle(context.Background(), budiID, http.UpdateHandle{Handle: "budi"}); err != nil {
+		t.Fatalf("UpdateHandle() error = %v", err)
+	}
+
+	// the previous handle moved to the new one and stays taken
+	_, err := svc.TakeCardByHandle(context.Background(), "budi-santoso", 0)
+	moved := &HandleMovedError{}
+	if !errors.As(err, &moved) || moved.Handle != "budi" {
+		t.Errorf("TakeCardByHandle() of the previous handle error = %v, want a move to budi", err)
+	}
+	if _, err = svc.TakeCardByHandle(context.Background(), "budi", 0); err != nil {
+		t.Errorf("TakeCardByHandle() of the new handle error = %v", err)
+	}
+	if err = svc.UpdateHandle(context.Background(), sitiID, http.UpdateHandle{Handle: "budi-santoso"}); err != constant.ErrHandleAlreadyExist {
+		t.Errorf("UpdateHandle() to a redirecting handle error = %v, want %v", err, constant.ErrHandleAlreadyExist)
+	}
+
+	// after the grace the previous handle is unknown and can be reclaimed
+	repo.redirects[0].ExpiresAt = time.Now().UTC().Add(-time.Minute)
+	if _, err = svc.TakeCardByHandle(context.Background(), "budi-santoso", 0); err != constant.ErrAccountNotRegistered {
+		t.Errorf("TakeCardByHandle() of an expired handle error = %v, want %v", err, constant.ErrAccountNotRegistered)
+	}
+	if err = svc.UpdateHandle(context.Background(), sitiID, http.UpdateHandle{Handle: "budi-santoso"}); err != nil {
+		t.Errorf("UpdateHandle() to an expired handle error = %v", err)
+	}
+}
+
+func TestLoginUpgradesThePasswordHash(t *testing.T) {
+	defaultAlgorithm := constant.PasswordHashAlgorithm
+	defer func() { constant.PasswordHashAlgorithm = defaultAlgorithm }()
+
+	// the account registered with bcrypt, argon2id is preferred since
+	constant.PasswordHashAlgorithm = passwordhash.AlgorithmBcrypt
+	svc, repo := newTestService()
+	accountID := register(t, svc, "budi")
+	repo.accounts[0].IsVerified = true
+	constant.PasswordHashAlgorithm = passwordhash.AlgorithmArgon2id
+
+	// the first login verifies the bcrypt hash and upgrades it, the second verifies the argon2id hash
+	login := http.LoginUser{Username: "budi", Password: "Str0ng!Passw0rd"}
+	for i := 0; i < 2; i++ {
+		stored, err := svc.Authenticate(context.Background(), login)
+		if err != nil {
+			t.Fatalf("Authenticate() on login %d error = %v", i+1, err)
+		}
+		if err = svc.UpgradePasswordHash(context.Background(), stored, login.Password); err != nil {
+			t.Fatalf("UpgradePasswordHash() error = %v", err)
+		}
+		upgraded, _ := repo.TakeAccountByID(accountID)
+		if !strings.HasPrefix(upgraded.Password, "$argon2id$") {
+			t.Errorf("password hash after login %d = %q, want an argon2id hash", i+1, upgraded.Password)
+		}
+		if !reflect.DeepEqual(upgraded.PasswordChangedAt, stored.PasswordChangedAt) {
+			t.Errorf("password_changed_at moved to %v on an upgrade", upgraded.PasswordChangedAt)
+		}
+	}
+
+	login.Password = "wr0ng!Passw0rd"
+	if _, err := svc.Authenticate(context.Background(), login); err != constant.ErrInvalidPassword {
+		t.Errorf("Authenticate() with another password error = %v, want %v", err, constant.ErrInvalidPassword)
+	}
+}
+
+func TestLoginOfAnUnknownAccountChecksADummyHash(t *testing.T) {
+	svc, _ := newTestService()
+
+	_, err := svc.Authenticate(context.Background(), http.LoginUser{Username: "nobody", Password: "Str0ng!Passw0rd"})
+	if err != constant.ErrAccountNotRegistered {
+		t.Fatalf("Authenticate() error = %v, want %v", err, constant.ErrAccountNotRegistered)
+	}
+	if passwordhash.Compare(dummyHash.hash, "dummy password of an unknown account") != nil {
+		t.Errorf("dummy hash = %q, want the hash compared on the login", dummyHash.hash)
+	}
+}
+
+func TestResendVerificationReusesTheToken(t *testing.T) {
+	defaultLimit := constant.VerificationEmailLimit
+	constant.VerificationEmailLimit = 3
+	defer func() { constant.VerificationEmailLimit = defaultLimit }()
+
+	svc, repo := newTestService()
+	accountID := register(t, svc, "budi")
+	repo.accounts[0].Email = stringPointer("budi@example.com")
+	tokens := svc.verification.(*memoryTokens)
+
+	for i := 0; i < 2; i++ {
+		if err := svc.ResendVerification(context.Background(), accountID); err != nil {
+			t.Fatalf("ResendVerification() %d error = %v", i+1, err)
+		}
+	}
+	sent := svc.notifier.(*outbox).sent
+	if len(sent) != 2 || sent[0].data["link"] != sent[1].data["link"] || len(tokens.tokens) != 1 {
+		t.Fatalf("two rapid resends sent %+v with %d tokens, want the same link twice", sent, len(tokens.tokens))
+	}
+
+	// past the reuse window a new token is issued
+	tokens.tokens[0].CreatedAt = time.Now().UTC().Add(-constant.VerificationReuseWindow - time.Minute)
+	if err := svc.ResendVerification(context.Background(), accountID); err != nil {
+		t.Fatalf("ResendVerification() error = %v", err)
+	}
+	sent = svc.notifier.(*outbox).sent
+	if len(sent) != 3 || sent[2].data["link"] == sent[0].data["link"] || len(tokens.tokens) != 2 {
+		t.Errorf("resend past the reuse window sent %+v with %d tokens, want a new link", sent[2:], len(tokens.tokens))
+	}
+
+	if err := svc.ResendVerification(context.Background(), accountID); err != constant.ErrVerificationRateExceeded {
+		t.Errorf("ResendVerification() past the limit error = %v, want %v", err, constant.ErrVerificationRateExceeded)
+	}
+}
+
+func TestDiagnoseLoginReasons(t *testing.T) {
+	defaultRequireVerified, defaultMaxAge, defaultLimit := constant.RequireVerifiedLogin, constant.PasswordMaxAge, constant.LoginDiagnosisLimit
+	defer func() {
+		constant.RequireVerifiedLogin, constant.PasswordMaxAge, constant.LoginDiagnosisLimit = defaultRequireVerified, defaultMaxAge, defaultLimit
+	}()
+	constant.RequireVerifiedLogin, constant.PasswordMaxAge = true, 90*24*time.Hour
+
+	svc, repo := newTestService()
+	register(t, svc, "budi")
+	repo.accounts[0].IsVerified = true
+	registered := repo.accounts[0]
+
+	lockedUntil := time.Now().Add(time.Hour)
+	passwordChangedAt := time.Now().AddDate(-1, 0, 0)
+	tests := []struct {
+		name         string
+		username     string
+		change       func(account *model.Account)
+		wantCanLogin bool
+		wantReasons  []string
+	}{
+		{"can login", "budi", func(account *model.Account) {}, true, []string{}},
+		{"not found", "siti", func(account *model.Account) {}, false, []string{constant.LoginDiagnosisAccountNotFound}},
+		{"unverified", "budi", func(account *model.Account) { account.IsVerified = false },
+			false, []string{constant.LoginDiagnosisUnverified}},
+		{"locked", "budi", func(account *model.Account) { account.LockedUntil = &lockedUntil },
+			false, []string{constant.LoginDiagnosisLocked}},
+		{"suspended", "budi", func(account *model.Account) { account.Status = constant.AccountStatusSuspended },
+			false, []string{constant.LoginDiagnosisSuspended}},
+		{"password expired", "budi", func(account *model.Account) { account.PasswordChangedAt = &passwordChangedAt },
+			true, []string{constant.LoginDiagnosisPasswordExpired}},
+		{"password reset by an admin", "budi", func(account *model.Account) { account.MustChangePassword = true },
+			true, []string{constant.LoginDiagnosisPasswordChange}},
+		{"terms not accepted", "budi", func(account *model.Account) { account.TermsVersion = "" },
+			true, []string{constant.LoginDiagnosisTermsNotAccepted}},
+	}
+	constant.LoginDiagnosisLimit = len(tests)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo.accounts[0] = registered
+			tt.change(&repo.accounts[0])
+
+			diagnosis, err := svc.DiagnoseLogin(context.Background(), 1, http.DiagnoseLogin{Username: tt.username})
+			if err != nil {
+				t.Fatalf("DiagnoseLogin() error = %v", err)
+			}
+			if diagnosis.CanLogin != tt.wantCanLogin || !reflect.DeepEqual(diagnosis.Reasons, tt.wantReasons) {
+				t.Errorf("DiagnoseLogin() = %+v, want can login %v for %v", diagnosis, tt.wantCanLogin, tt.wantReasons)
+			}
+		})
+	}
+
+	if _, err := svc.DiagnoseLogin(context.Background(), 1, http.DiagnoseLogin{Username: "budi"}); err != constant.ErrDiagnosisRateExceeded {
+		t.Errorf("DiagnoseLogin() past the limit error = %v, want %v", err, constant.ErrDiagnosisRateExceeded)
+	}
+}
+
+func TestCanonicalEmailCollision(t *testing.T) {
+	defaultCanonicalization := constant.EmailCanonicalization
+	defer func() { constant.EmailCanonicalization = defaultCanonicalization }()
+
+	svc, repo := newTestService()
+	request := http.RegisterUser{
+		Username:     "budi",
+		FullName:     "Budi Santoso",
+		Password:     "Str0ng!Passw0rd",
+		TermsVersion: constant.TermsVersion,
+		Email:        stringPointer("a.b+x@gmail.com"),
+	}
+	if _, err := svc.Create(context.Background(), request); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	// the email is sent to as typed, only the uniqueness check is canonical
+	if stored := repo.accounts[0]; stringValue(stored.Email) != "a.b+x@gmail.com" {
+		t.Errorf("stored email = %v, want the original", stored.Email)
+	}
+	sitiID := register(t, svc, "siti")
+
+	constant.EmailCanonicalization = true
+	request.Username, request.Email = "andi", stringPointer("ab@gmail.com")
+	if _, err := svc.Create(context.Background(), request); !errors.Is(err, constant.ErrAccountExist) {
+		t.Errorf("Create() with a colliding email error = %v, want %v", err, constant.ErrAccountExist)
+	}
+	if _, err := svc.Update(context.Background(), sitiID, http.UpdateUser{Email: stringPointer("ab@gmail.com")}); err != constant.ErrEmailAlreadyExist {
+		t.Errorf("Update() to a colliding email error = %v, want %v", err, constant.ErrEmailAlreadyExist)
+	}
+
+	constant.EmailCanonicalization = false
+	if _, err := svc.Update(context.Background(), sitiID, http.UpdateUser{Email: stringPointer("ab@gmail.com")}); err != nil {
+		t.Errorf("Update() without canonicalization error = %v", err)
+	}
+}
+
+func TestStorageUsageReflectsTheAvatar(t *testing.T) {
+	svc, _ := newTestService()
+	accountID := register(t, svc, "budi")
+	usage, err := svc.StorageUsage(context.Background(), accountID)
+	if err != nil {
+		t.Fatalf("StorageUsage() error = %v", err)
+	}
+	if usage.TotalBytes != 0 || len(usage.Artifacts) != 0 {
+		t.Errorf("StorageUsage() before an upload = %+v, want nothing stored", usage)
+	}
+
+	// a second upload replaces the first under the same keys, the usage follows it
+	for _, width := range []int{300, 200} {
+		finish := holdAvatars(svc)
+		if _, err = svc.UploadAvatar(context.Background(), accountID, avatarPNG(t, width)); err != nil {
+			t.Fatalf("UploadAvatar() error = %v", err)
+		}
+		finish()
+
+		stored := int64(0)
+		objects := svc.storage.(*memoryStorage).objects
+		for _, object := range objects {
+			stored += int64(len(object))
+		}
+		usage, err = svc.StorageUsage(context.Background(), accountID)
+		if err != nil {
+			t.Fatalf("StorageUsage() error = %v", err)
+		}
+		if len(usage.Artifacts) != 1 || usage.Artifacts[0].Artifact != constant.StorageArtifactAvatar {
+			t.Fatalf("StorageUsage() artifacts = %+v, want the avatar only", usage.Artifacts)
+		}
+		if usage.TotalBytes != stored || usage.Artifacts[0].Bytes != stored || usage.Artifacts[0].Objects != len(objects) {
+			t.Errorf("StorageUsage() of a %dpx avatar = %+v, want %d bytes in %d objects", width, usage, stored, len(objects))
+		}
+	}
+}
+
+func TestUsernameReservation(t *testing.T) {
+	defaultLimit := constant.UsernameReservationLimit
+	constant.UsernameReservationLimit = 100
+	defer func() { constant.UsernameReservationLimit = defaultLimit }()
+
+	svc, repo := newTestService()
+	reservation, err := svc.ReserveUsername(context.Background(), http.ReserveUsername{Username: "siti"}, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("ReserveUsername() error = %v", err)
+	}
+	if _, err = svc.ReserveUsername(context.Background(), http.ReserveUsername{Username: "siti"}, "10.0.0.2"); err != constant.ErrUsernameReserved {
+		t.Errorf("ReserveUsername() of a reserved username error = %v, want %v", err, constant.ErrUsernameReserved)
+	}
+
+	// only the holder of the token registers the reserved username
+	request := http.RegisterUser{
+		Username:     "siti",
+		FullName:     "Siti Aminah",
+		Password:     "Str0ng!Passw0rd",
+		TermsVersion: constant.TermsVersion,
+	}
+	for _, reservationToken := range []string{"", "another token"} {
+		request.ReservationToken = reservationToken
+		_, err = svc.Create(context.Background(), request)
+		conflict := &ConflictError{}
+		if !errors.As(err, &conflict) || !conflict.ReservedUsername {
+			t.Errorf("Create() with token %q error = %v, want the reserved username conflict", reservationToken, err)
+		}
+	}
+	request.ReservationToken = reservation.Token
+	if _, err = svc.Create(context.Background(), request); err != nil {
+		t.Fatalf("Create() with the reservation token error = %v", err)
+	}
+	if len(repo.reservations) != 0 {
+		t.Errorf("reservations after the registration = %+v, want it consumed", repo.reservations)
+	}
+	if _, err = svc.ReserveUsername(context.Background(), http.ReserveUsername{Username: "siti"}, "10.0.0.1"); err != constant.ErrUsernameAlreadyExist {
+		t.Errorf("ReserveUsername() of a registered username error = %v, want %v", err, constant.ErrUsernameAlreadyExist)
+	}
+
+	// an expired reservation frees the username for anyone
+	if _, err = svc.ReserveUsername(context.Background(), http.ReserveUsername{Username: "andi"}, "10.0.0.1"); err != nil {
+		t.Fatalf("ReserveUsername() error = %v", err)
+	}
+	repo.reservations[0].ExpiresAt = time.Now().UTC().Add(-time.Minute)
+	if _, err = svc.ReserveUsername(context.Background(), http.ReserveUsername{Username: "andi"}, "10.0.0.2"); err != nil {
+		t.Errorf("ReserveUsername() of an expired reservation error = %v", err)
+	}
+	repo.reservations[0].ExpiresAt = time.Now().UTC().Add(-time.Minute)
+	request.Username, request.ReservationToken = "andi", ""
+	if _, err = svc.Create(context.Background(), request); err != nil {
+		t.Errorf("Create() of a username whose reservation expired error = %v", err)
+	}
+}
+
+func TestScanIntegrityFindsATamperedRow(t *testing.T) {
+	svc, repo := newTestService()
+	for _, username := range []string{"budi", "siti", "andi"} {
+		register(t, svc, username)
+	}
+	result, err := svc.ScanIntegrity(context.Background())
+	if err != nil {
+		t.Fatalf("ScanIntegrity() error = %v", err)
+	}
+	if result.Checked != 3 || len(result.Mismatched) != 0 || result.Unsealed != 0 {
+		t.Fatalf("ScanIntegrity() of untouched rows = %+v, want 3 checked and none mismatched", result)
+	}
+
+	// a direct edit of the database leaves the checksum of the previous row
+	repo.accounts[1].Role = constant.RoleAdmin
+	if account.VerifyChecksum(repo.accounts[1]) {
+		t.Error("VerifyChecksum() of the tampered row = true")
+	}
+	repo.accounts[2].Checksum = ""
+	result, err = svc.ScanIntegrity(context.Background())
+	if err != nil {
+		t.Fatalf("ScanIntegrity() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.Mismatched, []string{publicid.Encode(2)}) || result.Unsealed != 1 {
+		t.Errorf("ScanIntegrity() = %+v, want the tampered row mismatched and one unsealed", result)
+	}
+}
+
+func TestCreateRunsTheFieldPipelines(t *testing.T) {
+	pipelines, err := transform.Parse([]string{"username=trim|lowercase", "fullname=trim"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	repo := &memoryRepo{}
+	svc := NewService(repo, &memoryTokens{}, &outbox{}, &memoryStorage{}, pipelines, nil,
+		logger.New(io.Discard, logger.LevelError))
+	_, err = svc.Create(context.Background(), http.RegisterUser{
+		Username:     "  BudiSantoso ",
+		FullName:     " Budi Santoso ",
+		Password:     "Str0ng!Passw0rd",
+		TermsVersion: constant.TermsVersion,
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if stored := repo.accounts[0]; stored.Username != "budisantoso" || stored.FullName != "Budi Santoso" {
+		t.Errorf("stored account = %q, %q, want the trimmed and lowercased username", stored.Username, stored.FullName)
+	}
+}
@@ -0,0 +1,554 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"go-rest-api/src/constant"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/pagination"
+	"go-rest-api/src/repository/v1/account"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// accountSchema maps the columns of the field maps to the fields of model.Account
+var accountSchema = func() *schema.Schema {
+	parsed, err := schema.Parse(&model.Account{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// memoryRepo keeps the accounts like the accounts table, deleted ones included. Transaction runs fn
+// without rolling anything back, the tests only look at the result of a transaction that committed
+type memoryRepo struct {
+	accounts     []model.Account
+	redirects    []model.HandleRedirect
+	reservations []model.UsernameReservation
+	usages       []model.StorageUsage
+}
+
+func (repo *memoryRepo) WithContext(ctx context.Context) account.Repositorier {
+	return repo
+}
+
+func (repo *memoryRepo) Transaction(fn func(repo account.Repositorier) error) (err error) {
+	return fn(repo)
+}
+
+// index returns the position of the first account matching, -1 when there is none
+func (repo *memoryRepo) index(unscoped bool, match func(account model.Account) bool) int {
+	for i, account := range repo.accounts {
+		if (unscoped || !account.DeletedAt.Valid) && match(account) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (repo *memoryRepo) take(match func(account model.Account) bool) (account model.Account, err error) {
+	i := repo.index(false, match)
+	if i < 0 {
+		return account, gorm.ErrRecordNotFound
+	}
+	return repo.accounts[i], nil
+}
+
+func (repo *memoryRepo) byID(accountID int) func(account model.Account) bool {
+	return func(account model.Account) bool { return int(account.ID) == accountID }
+}
+
+func equalString(value *string, expected string) bool {
+	return value != nil && *value == expected
+}
+
+// set writes the columns as gorm does, a pointer field gets a new value so copies handed out keep theirs
+func (repo *memoryRepo) set(i int, fields map[string]interface{}) (err error) {
+	row := reflect.ValueOf(&repo.accounts[i]).Elem()
+	for column, value := range fields {
+		field := accountSchema.LookUpField(column)
+		if field == nil {
+			return fmt.Errorf("unknown column %s", column)
+		}
+		if err = field.Set(row, nil); err != nil {
+			return
+		}
+		if err = field.Set(row, value); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// write sets the columns and updated_at when they do not, then reseals the checksum
+func (repo *memoryRepo) write(accountID int, fields map[string]interface{}) (err error) {
+	i := repo.index(false, repo.byID(accountID))
+	if i < 0 {
+		return
+	}
+	if _, ok := fields["updated_at"]; !ok {
+		repo.accounts[i].UpdatedAt = time.Now().UTC()
+	}
+	if err = repo.set(i, fields); err != nil {
+		return
+	}
+	if err = repo.checkUnique(i); err != nil {
+		return
+	}
+	repo.accounts[i].Checksum = account.Checksum(repo.accounts[i])
+	return
+}
+
+// checkUnique fails like the unique constraints of accounts when another row holds a value of row i
+func (repo *memoryRepo) checkUnique(i int) (err error) {
+	row := repo.accounts[i]
+	for j, other := range repo.accounts {
+		if j == i {
+			continue
+		}
+		constraint := ""
+		switch {
+		case other.Username == row.Username:
+			constraint = "accounts_username_key"
+		case row.Email != nil && equalString(other.Email, *row.Email):
+			constraint = "accounts_email_key"
+		case row.KTPNumber != nil && equalString(other.KTPNumber, *row.KTPNumber):
+			constraint = "accounts_ktp_number_key"
+		case row.PhoneNumber != nil && equalString(other.PhoneNumber, *row.PhoneNumber):
+			constraint = "accounts_phone_number_key"
+		case row.Handle != "" && other.Handle == row.Handle:
+			constraint = "accounts_handle_idx"
+		}
+		if constraint != "" {
+			return &pgconn.PgError{Code: "23505", ConstraintName: constraint}
+		}
+	}
+	return
+}
+
+func (repo *memoryRepo) TakeAccountByID(accountID int) (account model.Account, err error) {
+	return repo.take(repo.byID(accountID))
+}
+
+func (repo *memoryRepo) TakeAccountByEmail(email string) (account model.Account, err error) {
+	return repo.take(func(account model.Account) bool {
+		return account.Email != nil && strings.EqualFold(*account.Email, email)
+	})
+}
+
+func (repo *memoryRepo) TakeAccountByCanonicalEmail(canonicalEmail string) (account model.Account, err error) {
+	return repo.take(func(account model.Account) bool { return equalString(account.CanonicalEmail, canonicalEmail) })
+}
+
+func (repo *memoryRepo) TakeAccountByKTPNumber(ktpNumber string) (account model.Account, err error) {
+	return repo.take(func(account model.Account) bool { return equalString(account.KTPNumber, ktpNumber) })
+}
+
+func (repo *memoryRepo) TakeAccountByPhoneNumber(phoneNumber string) (account model.Account, err error) {
+	return repo.take(func(account model.Account) bool { return equalString(account.PhoneNumber, phoneNumber) })
+}
+
+func (repo *memoryRepo) TakeAccountByUsername(username string) (account model.Account, err error) {
+	return repo.take(func(account model.Account) bool { return account.Username == username })
+}
+
+func (repo *memoryRepo) TakeAccountByDisplayName(displayName string) (account model.Account, err error) {
+	displayName = strings.ToLower(strings.TrimSpace(displayName))
+	return repo.take(func(account model.Account) bool {
+		return account.DisplayName != nil && strings.ToLower(strings.TrimSpace(*account.DisplayName)) == displayName
+	})
+}
+
+func (repo *memoryRepo) TakeAccountByHandle(handle string) (account model.Account, err error) {
+	return repo.take(func(account model.Account) bool { return account.Handle == handle })
+}
+
+func (repo *memoryRepo) FindHandlesWithPrefix(prefix string) (handles []string, err error) {
+	for _, account := range repo.accounts {
+		if strings.HasPrefix(account.Handle, prefix) {
+			handles = append(handles, account.Handle)
+		}
+	}
+	return
+}
+
+func (repo *memoryRepo) TakeHandleRedirect(handle string, now time.Time) (redirect model.HandleRedirect, err error) {
+	for _, redirect := range repo.redirects {
+		if redirect.Handle == handle && redirect.ExpiresAt.After(now) {
+			return redirect, nil
+		}
+	}
+	return redirect, gorm.ErrRecordNotFound
+}
+
+func (repo *memoryRepo) FindRedirectHandlesWithPrefix(prefix string, now time.Time) (handles []string, err error) {
+	for _, redirect := range repo.redirects {
+		if strings.HasPrefix(redirect.Handle, prefix) && redirect.ExpiresAt.After(now) {
+			handles = append(handles, redirect.Handle)
+		}
+	}
+	return
+}
+
+func (repo *memoryRepo) UpdateHandle(accountID int, oldHandle, newHandle string, redirectExpiresAt time.Time) (err error) {
+	kept := []model.HandleRedirect{}
+	for _, redirect := range repo.redirects {
+		if redirect.Handle != newHandle && redirect.Handle != oldHandle {
+			kept = append(kept, redirect)
+		}
+	}
+	repo.redirects = append(kept, model.HandleRedirect{
+		ID:        uint(len(kept) + 1),
+		Handle:    oldHandle,
+		AccountID: accountID,
+		ExpiresAt: redirectExpiresAt,
+		CreatedAt: time.Now().UTC(),
+	})
+	return repo.write(accountID, map[string]interface{}{"handle": newHandle})
+}
+
+func (repo *memoryRepo) filter(match func(account model.Account) bool) (accounts []model.Account) {
+	for _, account := range repo.accounts {
+		if !account.DeletedAt.Valid && match(account) {
+			accounts = append(accounts, account)
+		}
+	}
+	return
+}
+
+func limited(accounts []model.Account, limit int) []model.Account {
+	if limit > 0 && len(accounts) > limit {
+		return accounts[:limit]
+	}
+	return accounts
+}
+
+func (repo *memoryRepo) Find(accountIDs []int) (accounts []model.Account, err error) {
+	return repo.filter(func(account model.Account) bool {
+		for _, accountID := range accountIDs {
+			if int(account.ID) == accountID {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (repo *memoryRepo) FindUnverified(createdAfter, createdBefore time.Time, afterID, limit int) (accounts []model.Account, err error) {
+	return limited(repo.filter(func(account model.Account) bool {
+		return !account.IsVerified && account.Email != nil && int(account.ID) > afterID &&
+			(createdAfter.IsZero() || !account.CreatedAt.Before(createdAfter)) &&
+			(createdBefore.IsZero() || account.CreatedAt.Before(createdBefore))
+	}), limit), nil
+}
+
+func (repo *memoryRepo) FindAfterID(afterID, limit int) (accounts []model.Account, err error) {
+	return limited(repo.filter(func(account model.Account) bool { return int(account.ID) > afterID }), limit), nil
+}
+
+func (repo *memoryRepo) FindInactive(since time.Time, afterID, limit int) (accounts []model.Account, err error) {
+	return limited(repo.filter(func(account model.Account) bool {
+		activeAt := account.CreatedAt
+		if account.LastLoginAt != nil {
+			activeAt = *account.LastLoginAt
+		}
+		return int(account.ID) > afterID && activeAt.Before(since)
+	}), limit), nil
+}
+
+// sorted orders by the column then id like FindPage, the columns sorted by are strings, times and ids
+func (repo *memoryRepo) sorted(sortColumn string, desc bool) (accounts []model.Account) {
+	accounts = repo.filter(func(account model.Account) bool { return true })
+	field := accountSchema.LookUpField(sortColumn)
+	key := func(account model.Account) string {
+		value, _ := field.ValueOf(reflect.ValueOf(account))
+		switch value := value.(type) {
+		case time.Time:
+			return value.UTC().Format(time.RFC3339Nano)
+		case uint:
+			return fmt.Sprintf("%020d", value)
+		}
+		return fmt.Sprint(value)
+	}
+	sort.SliceStable(accounts, func(i, j int) bool {
+		first, second := key(accounts[i]), key(accounts[j])
+		if first == second {
+			first, second = fmt.Sprintf("%020d", accounts[i].ID), fmt.Sprintf("%020d", accounts[j].ID)
+		}
+		if desc {
+			return first > second
+		}
+		return first < second
+	})
+	return
+}
+
+func (repo *memoryRepo) FindPage(sortColumn string, desc bool, pgn pagination.Pagination) (accounts []model.Account, total int64, err error) {
+	accounts = repo.sorted(sortColumn, desc)
+	total = int64(len(accounts))
+	start := pgn.Offset
+	if start > len(accounts) {
+		start = len(accounts)
+	}
+	return limited(accounts[start:], pgn.Limit), total, nil
+}
+
+func (repo *memoryRepo) EachSorted(sortColumn string, desc bool, fn func(account model.Account) error) (err error) {
+	for _, account := range repo.sorted(sortColumn, desc) {
+		if err = fn(account); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Create updates the row of a taken username like the upsert of the repository
+func (repo *memoryRepo) Create(newAccount model.Account) (accountID int, err error) {
+	now := time.Now().UTC()
+	i := repo.index(true, func(account model.Account) bool { return account.Username == newAccount.Username })
+	if i < 0 {
+		newAccount.ID = uint(len(repo.accounts) + 1)
+		newAccount.CreatedAt, newAccount.UpdatedAt = now, now
+		if newAccount.Status == "" {
+			newAccount.Status = constant.AccountStatusActive
+		}
+		repo.accounts = append(repo.accounts, newAccount)
+		i = len(repo.accounts) - 1
+		if err = repo.checkUnique(i); err != nil {
+			repo.accounts = repo.accounts[:i]
+			return
+		}
+	} else {
+		err = repo.set(i, map[string]interface{}{
+			"username":            newAccount.Username,
+			"full_name":           newAccount.FullName,
+			"password":            newAccount.Password,
+			"password_changed_at": newAccount.PasswordChangedAt,
+			"weak_password_rules": newAccount.WeakPasswordRules,
+			"email":               newAccount.Email,
+			"canonical_email":     newAccount.CanonicalEmail,
+			"phone_number":        newAccount.PhoneNumber,
+			"deleted_at":          nil,
+			"updated_at":          now,
+		})
+		if err != nil {
+			return
+		}
+	}
+	repo.accounts[i].Checksum = account.Checksum(repo.accounts[i])
+	return int(repo.accounts[i].ID), nil
+}
+
+// Update writes the non zero fields of request like gorm's Updates of a struct
+func (repo *memoryRepo) Update(accountID int, request model.Account) (err error) {
+	fields := map[string]interface{}{}
+	for _, field := range accountSchema.Fields {
+		if field.DBName == "" || field.PrimaryKey {
+			continue
+		}
+		if value, zero := field.ValueOf(reflect.ValueOf(request)); !zero {
+			fields[field.DBName] = value
+		}
+	}
+	return repo.write(accountID, fields)
+}
+
+func (repo *memoryRepo) UpdateFields(accountID int, fields map[string]interface{}) (err error) {
+	return repo.write(accountID, fields)
+}
+
+func (repo *memoryRepo) UpdateLoginState(accountID int, failedLoginCount int, lockedUntil *time.Time) (err error) {
+	if i := repo.index(false, repo.byID(accountID)); i >= 0 {
+		repo.accounts[i].FailedLoginCount = failedLoginCount
+		repo.accounts[i].LockedUntil = lockedUntil
+	}
+	return
+}
+
+func (repo *memoryRepo) UpdateTOTPStep(accountID int, step int64) (accepted bool, err error) {
+	if i := repo.index(false, repo.byID(accountID)); i >= 0 && repo.accounts[i].TOTPLastStep < step {
+		repo.accounts[i].TOTPLastStep = step
+		accepted = true
+	}
+	return
+}
+
+func (repo *memoryRepo) UpdateLastLogin(accountID int, loggedInAt time.Time) (err error) {
+	i := repo.index(false, repo.byID(accountID))
+	if i >= 0 && (repo.accounts[i].LastLoginAt == nil || repo.accounts[i].LastLoginAt.Before(loggedInAt)) {
+		repo.accounts[i].LastLoginAt = &loggedInAt
+	}
+	return
+}
+
+func (repo *memoryRepo) Replace(accountID int, updatedAt time.Time, fields map[string]interface{}) (err error) {
+	i := repo.index(false, repo.byID(accountID))
+	if i < 0 || !repo.accounts[i].UpdatedAt.Equal(updatedAt) {
+		return constant.ErrPreconditionFailed
+	}
+	return repo.write(accountID, fields)
+}
+
+func (repo *memoryRepo) Delete(accountID int) (err error) {
+	i := repo.index(false, repo.byID(accountID))
+	if i < 0 {
+		return constant.ErrInvalidID
+	}
+	repo.accounts[i].DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return
+}
+
+func (repo *memoryRepo) TakeDeletedAccountByID(accountID int) (account model.Account, err error) {
+	i := repo.index(true, func(account model.Account) bool { return int(account.ID) == accountID && account.DeletedAt.Valid })
+	if i < 0 {
+		return account, gorm.ErrRecordNotFound
+	}
+	return repo.accounts[i], nil
+}
+
+func (repo *memoryRepo) Restore(accountID int) (err error) {
+	i := repo.index(true, func(account model.Account) bool { return int(account.ID) == accountID && account.DeletedAt.Valid })
+	if i < 0 {
+		return constant.ErrInvalidID
+	}
+	repo.accounts[i].DeletedAt = gorm.DeletedAt{}
+	repo.accounts[i].Checksum = account.Checksum(repo.accounts[i])
+	return
+}
+
+func (repo *memoryRepo) PurgeDeleted(before, requestedBefore time.Time) (purged int64, err error) {
+	kept := []model.Account{}
+	for _, account := range repo.accounts {
+		if (account.DeletedAt.Valid && account.DeletedAt.Time.Before(before)) ||
+			(account.Status == constant.AccountStatusPendingDeletion && account.DeleteRequestedAt != nil &&
+				account.DeleteRequestedAt.Before(requestedBefore)) {
+			purged++
+			continue
+		}
+		kept = append(kept, account)
+	}
+	repo.accounts = kept
+	return
+}
+
+func (repo *memoryRepo) Merge(sourceID, targetID int, fields map[string]interface{}) (err error) {
+	i := repo.index(false, repo.byID(sourceID))
+	if i < 0 {
+		return constant.ErrInvalidID
+	}
+	err = repo.set(i, map[string]interface{}{"email": nil, "canonical_email": nil, "phone_number": nil, "ktp_number": nil})
+	if err != nil {
+		return
+	}
+	repo.accounts[i].DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	if len(fields) == 0 {
+		return
+	}
+	return repo.write(targetID, fields)
+}
+
+func (repo *memoryRepo) SetStorageUsage(usage model.StorageUsage) (err error) {
+	for i := range repo.usages {
+		if repo.usages[i].AccountID == usage.AccountID && repo.usages[i].Artifact == usage.Artifact {
+			repo.usages[i].Bytes, repo.usages[i].Objects, repo.usages[i].UpdatedAt = usage.Bytes, usage.Objects, usage.UpdatedAt
+			return
+		}
+	}
+	usage.ID = uint(len(repo.usages) + 1)
+	repo.usages = append(repo.usages, usage)
+	return
+}
+
+func (repo *memoryRepo) FindStorageUsage(accountID int) (usages []model.StorageUsage, err error) {
+	for _, usage := range repo.usages {
+		if usage.AccountID == accountID {
+			usages = append(usages, usage)
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Artifact < usages[j].Artifact })
+	return
+}
+
+func (repo *memoryRepo) ReserveUsername(reservation model.UsernameReservation) (reserved bool, err error) {
+	kept := []model.UsernameReservation{}
+	for _, held := range repo.reservations {
+		if held.Username == reservation.Username {
+			if held.ExpiresAt.After(reservation.CreatedAt) {
+				return false, nil
+			}
+			continue
+		}
+		kept = append(kept, held)
+	}
+	reservation.ID = uint(len(kept) + 1)
+	repo.reservations = append(kept, reservation)
+	return true, nil
+}
+
+func (repo *memoryRepo) TakeUsernameReservation(username string, now time.Time) (reservation model.UsernameReservation, err error) {
+	for _, reservation := range repo.reservations {
+		if reservation.Username == username && reservation.ExpiresAt.After(now) {
+			return reservation, nil
+		}
+	}
+	return reservation, gorm.ErrRecordNotFound
+}
+
+func (repo *memoryRepo) DeleteUsernameReservation(username string) (err error) {
+	kept := []model.UsernameReservation{}
+	for _, reservation := range repo.reservations {
+		if reservation.Username != username {
+			kept = append(kept, reservation)
+		}
+	}
+	repo.reservations = kept
+	return
+}
+
+// memoryTokens keeps the verification tokens like the verification_tokens table
+type memoryTokens struct {
+	tokens []model.VerificationToken
+}
+
+func (repo *memoryTokens) Create(verificationToken model.VerificationToken) (err error) {
+	verificationToken.ID = uint(len(repo.tokens) + 1)
+	repo.tokens = append(repo.tokens, verificationToken)
+	return
+}
+
+func (repo *memoryTokens) TakeByTokenHash(purpose, tokenHash string) (verificationToken model.VerificationToken, err error) {
+	for _, verificationToken := range repo.tokens {
+		if verificationToken.Purpose == purpose && verificationToken.TokenHash == tokenHash {
+			return verificationToken, nil
+		}
+	}
+	return verificationToken, gorm.ErrRecordNotFound
+}
+
+func (repo *memoryTokens) MarkUsed(tokenID int, usedAt time.Time) (err error) {
+	for i := range repo.tokens {
+		if int(repo.tokens[i].ID) == tokenID {
+			repo.tokens[i].UsedAt = &usedAt
+		}
+	}
+	return
+}
+
+func (repo *memoryTokens) TakeReusable(accountID int, purpose string, createdAfter, now time.Time) (verificationToken model.VerificationToken, err error) {
+	for i := len(repo.tokens) - 1; i >= 0; i-- {
+		candidate := repo.tokens[i]
+		if candidate.AccountID == accountID && candidate.Purpose == purpose && candidate.UsedAt == nil &&
+			candidate.ExpiresAt.After(now) && candidate.CreatedAt.After(createdAfter) && candidate.Seed != "" {
+			return candidate, nil
+		}
+	}
+	return verificationToken, gorm.ErrRecordNotFound
+}
@@ -1,12 +1,14 @@
 package attendance
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"go-rest-api/src/constant"
 	"go-rest-api/src/http"
 	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/enum"
 	"go-rest-api/src/pkg/pagination"
 	"go-rest-api/src/repository/v1/attendance"
 	"go-rest-api/src/service/v1/account"
@@ -35,13 +37,13 @@ func NewService(
 }
 
 type Servicer interface {
-	FindAttendanceHistory(accountID int, pgn pagination.Pagination, filter string) (responses []http.GetAttendance, err error)
-	FindByLocation(accountID int, pgn pagination.Pagination) (responses []http.GetAttendanceByLocation, err error)
-	Add(accountID int, request http.AddAttendance) (err error)
+	FindAttendanceHistory(ctx context.Context, accountID int, pgn pagination.Pagination, filter string) (responses []http.GetAttendance, err error)
+	FindByLocation(ctx context.Context, accountID int, pgn pagination.Pagination) (responses []http.GetAttendanceByLocation, err error)
+	Add(ctx context.Context, accountID int, request http.AddAttendance) (err error)
 }
 
-func (svc *Service) FindAttendanceHistory(accountID int, pgn pagination.Pagination, filter string) (responses []http.GetAttendance, err error) {
-	accountExist, err := svc.account.CheckAccountByID(accountID)
+func (svc *Service) FindAttendanceHistory(ctx context.Context, accountID int, pgn pagination.Pagination, filter string) (responses []http.GetAttendance, err error) {
+	accountExist, err := svc.account.CheckAccountByID(ctx, accountID)
 	if err != nil {
 		err = errors.Wrap(err, "check account by id")
 		return
@@ -104,8 +106,8 @@ func (svc *Service) FindAttendanceHistory(accountID int, pgn pagination.Paginati
 	return
 }
 
-func (svc *Service) FindByLocation(accountID int, pgn pagination.Pagination) (responses []http.GetAttendanceByLocation, err error) {
-	accountExist, err := svc.account.CheckAccountByID(accountID)
+func (svc *Service) FindByLocation(ctx context.Context, accountID int, pgn pagination.Pagination) (responses []http.GetAttendanceByLocation, err error) {
+	accountExist, err := svc.account.CheckAccountByID(ctx, accountID)
 	if err != nil {
 		err = errors.Wrap(err, "check account by id")
 		return
@@ -146,8 +148,8 @@ func (svc *Service) FindByLocation(accountID int, pgn pagination.Pagination) (re
 	return
 }
 
-func (svc *Service) Add(accountID int, request http.AddAttendance) (err error) {
-	accountExist, err := svc.account.CheckAccountByID(accountID)
+func (svc *Service) Add(ctx context.Context, accountID int, request http.AddAttendance) (err error) {
+	accountExist, err := svc.account.CheckAccountByID(ctx, accountID)
 	if err != nil {
 		err = errors.Wrap(err, "check account by id")
 		return
@@ -168,7 +170,7 @@ func (svc *Service) Add(accountID int, request http.AddAttendance) (err error) {
 	}
 
 	status := request.Status
-	if status == constant.StatusCheckIn || status == constant.StatusCheckOut {
+	if enum.Valid(enum.Status, status) {
 		newAttendance := model.Attendance{}
 		copier.Copy(&newAttendance, &request)
 		newAttendance.AccountID = accountID
@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/metrics"
+	"go-rest-api/src/pkg/pagination"
+	"go-rest-api/src/pkg/publicid"
+	"go-rest-api/src/repository/v1/audit"
+
+	"github.com/pkg/errors"
+)
+
+type Service struct {
+	repo audit.Repositorier
+}
+
+func NewService(
+	repositorier audit.Repositorier,
+) *Service {
+	return &Service{
+		repo: repositorier,
+	}
+}
+
+type Servicer interface {
+	Record(actorID int, action string, targetID int, ipAddress string, metadata map[string]string) (err error)
+	VerifyAuditChain() (result http.AuditChainVerification, err error)
+	FindAccountTrail(accountID int, filter http.AuditFilter, pgn pagination.Pagination) (responses []http.GetAuditEntry, err error)
+}
+
+// Record appends an entry to the audit chain. The operation it records already happened so callers only log
+// a failure, every failure is counted in audit_write_failures_total to alert on the gap in the trail
+func (svc *Service) Record(actorID int, action string, targetID int, ipAddress string, metadata map[string]string) (err error) {
+	defer func() {
+		if err != nil {
+			metrics.AuditWriteFailure(action)
+		}
+	}()
+
+	encoded := []byte{}
+	if len(metadata) > 0 {
+		encoded, err = json.Marshal(metadata)
+		if err != nil {
+			err = errors.Wrap(err, "marshal audit metadata")
+			return
+		}
+	}
+
+	// postgres keeps microseconds, truncate so the hash matches the stored row
+	entry := model.AuditLog{
+		ActorID:   actorID,
+		Action:    action,
+		TargetID:  targetID,
+		IPAddress: ipAddress,
+		Metadata:  string(encoded),
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	err = svc.repo.Append(entry, func(entry *model.AuditLog, prevHash string) {
+		entry.PrevHash = prevHash
+		entry.Hash = hashEntry(*entry)
+	})
+	if err != nil {
+		err = errors.Wrap(err, "append audit log")
+		return
+	}
+	return
+}
+
+// VerifyAuditChain walks the whole chain and reports the first entry that was altered,
+// removed entries are reported at their successor
+func (svc *Service) VerifyAuditChain() (result http.AuditChainVerification, err error) {
+	result.Valid = true
+	prevHash := ""
+	lastID := 0
+	for {
+		entries, err := svc.repo.FindAfterID(lastID, constant.AuditVerifyBatchSize)
+		if err != nil {
+			err = errors.Wrap(err, "find audit logs")
+			return result, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		for i := range entries {
+			if entries[i].PrevHash != prevHash || hashEntry(entries[i]) != entries[i].Hash {
+				brokenAtID := int(entries[i].ID)
+				result.Valid = false
+				result.BrokenAtID = &brokenAtID
+				return result, nil
+			}
+			prevHash = entries[i].Hash
+			result.Checked++
+		}
+		lastID = int(entries[len(entries)-1].ID)
+	}
+	return
+}
+
+// FindAccountTrail returns the newest entries targeting the account first, its own actions and the ones taken on it by admins
+func (svc *Service) FindAccountTrail(accountID int, filter http.AuditFilter, pgn pagination.Pagination) (responses []http.GetAuditEntry, err error) {
+	entries, err := svc.repo.FindByTargetID(accountID, filter.Action, filter.From, filter.To, pgn)
+	if err != nil {
+		err = errors.Wrap(err, "find audit logs")
+		return
+	}
+
+	responses = []http.GetAuditEntry{}
+	for i := range entries {
+		metadata := map[string]string{}
+		if entries[i].Metadata != "" {
+			json.Unmarshal([]byte(entries[i].Metadata), &metadata)
+		}
+		responses = append(responses, http.GetAuditEntry{
+			ID:        int(entries[i].ID),
+			ActorID:   publicid.Encode(entries[i].ActorID),
+			Action:    entries[i].Action,
+			TargetID:  publicid.Encode(entries[i].TargetID),
+			IPAddress: entries[i].IPAddress,
+			Metadata:  metadata,
+			CreatedAt: entries[i].CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return
+}
+
+// hashEntry hashes the canonical json of every sealed field, the id is left out as it is assigned on insert
+func hashEntry(entry model.AuditLog) string {
+	content, _ := json.Marshal([]interface{}{
+		entry.PrevHash,
+		entry.ActorID,
+		entry.Action,
+		entry.TargetID,
+		entry.IPAddress,
+		entry.Metadata,
+		entry.CreatedAt.UnixNano(),
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
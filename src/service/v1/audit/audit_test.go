@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/pagination"
+	"go-rest-api/src/pkg/publicid"
+)
+
+// memoryRepo keeps the chain in insertion order, ids start at 1 like the serial column
+type memoryRepo struct {
+	entries []model.AuditLog
+}
+
+func (repo *memoryRepo) Append(entry model.AuditLog, seal func(entry *model.AuditLog, prevHash string)) (err error) {
+	prevHash := ""
+	if len(repo.entries) > 0 {
+		prevHash = repo.entries[len(repo.entries)-1].Hash
+	}
+	seal(&entry, prevHash)
+	entry.ID = uint(len(repo.entries) + 1)
+	repo.entries = append(repo.entries, entry)
+	return
+}
+
+func (repo *memoryRepo) FindAfterID(afterID, limit int) (entries []model.AuditLog, err error) {
+	for i := range repo.entries {
+		if int(repo.entries[i].ID) > afterID && len(entries) < limit {
+			entries = append(entries, repo.entries[i])
+		}
+	}
+	return
+}
+
+func (repo *memoryRepo) FindByTargetID(targetID int, action string, from, to time.Time, pgn pagination.Pagination) (entries []model.AuditLog, err error) {
+	for i := len(repo.entries) - 1; i >= 0; i-- {
+		entry := repo.entries[i]
+		if entry.TargetID != targetID || action != "" && entry.Action != action ||
+			!from.IsZero() && entry.CreatedAt.Before(from) || !to.IsZero() && entry.CreatedAt.After(to) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if pgn.Offset >= len(entries) {
+		return nil, nil
+	}
+	entries = entries[pgn.Offset:]
+	if pgn.Limit > 0 && pgn.Limit < len(entries) {
+		entries = entries[:pgn.Limit]
+	}
+	return
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	repo := &memoryRepo{}
+	svc := NewService(repo)
+	for targetID := 1; targetID <= 3; targetID++ {
+		if err := svc.Record(1, "suspend", targetID, "10.0.0.1", map[string]string{"reason": "spam"}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	result, err := svc.VerifyAuditChain()
+	if err != nil {
+		t.Fatalf("VerifyAuditChain() error = %v", err)
+	}
+	if !result.Valid || result.Checked != 3 || result.BrokenAtID != nil {
+		t.Fatalf("VerifyAuditChain() of an untouched chain = %+v, want valid with 3 checked", result)
+	}
+
+	// a resealed entry matches its own hash, the link of its successor breaks
+	tests := []struct {
+		name       string
+		tamper     func(entry *model.AuditLog)
+		brokenAtID int
+	}{
+		{"altered target", func(entry *model.AuditLog) { entry.TargetID = 9 }, 2},
+		{"altered metadata", func(entry *model.AuditLog) { entry.Metadata = `{"reason":"none"}` }, 2},
+		{"resealed entry", func(entry *model.AuditLog) {
+			entry.Action = "activate"
+			entry.Hash = hashEntry(*entry)
+		}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := &memoryRepo{entries: append([]model.AuditLog{}, repo.entries...)}
+			tt.tamper(&tampered.entries[1])
+
+			result, err := NewService(tampered).VerifyAuditChain()
+			if err != nil {
+				t.Fatalf("VerifyAuditChain() error = %v", err)
+			}
+			if result.Valid {
+				t.Fatal("VerifyAuditChain() did not detect the altered middle entry")
+			}
+			if result.BrokenAtID == nil || *result.BrokenAtID != tt.brokenAtID {
+				t.Errorf("VerifyAuditChain() broken at %v, want %d", result.BrokenAtID, tt.brokenAtID)
+			}
+		})
+	}
+}
+
+func TestAccountTrailHasAdminAndUserActions(t *testing.T) {
+	svc := NewService(&memoryRepo{})
+	const adminID, accountID = 1, 7
+	recorded := []struct {
+		actorID  int
+		action   string
+		targetID int
+		metadata map[string]string
+	}{
+		{accountID, constant.AuditActionRegister, accountID, nil},
+		{accountID, constant.AuditActionUpdate, accountID, nil},
+		{adminID, constant.AuditActionSuspend, accountID, map[string]string{"reason": "spam"}},
+		{adminID, constant.AuditActionSuspend, 8, map[string]string{"reason": "spam"}},
+		{adminID, constant.AuditActionActivate, accountID, nil},
+	}
+	for _, entry := range recorded {
+		if err := svc.Record(entry.actorID, entry.action, entry.targetID, "10.0.0.1", entry.metadata); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	trail, err := svc.FindAccountTrail(accountID, http.AuditFilter{}, pagination.Pagination{Limit: 10})
+	if err != nil {
+		t.Fatalf("FindAccountTrail() error = %v", err)
+	}
+	// newest first, the action on another account is left out
+	want := []struct{ actorID, action string }{
+		{publicid.Encode(adminID), constant.AuditActionActivate},
+		{publicid.Encode(adminID), constant.AuditActionSuspend},
+		{publicid.Encode(accountID), constant.AuditActionUpdate},
+		{publicid.Encode(accountID), constant.AuditActionRegister},
+	}
+	if len(trail) != len(want) {
+		t.Fatalf("FindAccountTrail() = %+v, want %d entries", trail, len(want))
+	}
+	for i := range want {
+		if trail[i].ActorID != want[i].actorID || trail[i].Action != want[i].action || trail[i].TargetID != publicid.Encode(accountID) {
+			t.Errorf("entry %d = %+v, want %s by %s", i, trail[i], want[i].action, want[i].actorID)
+		}
+	}
+	if trail[1].Metadata["reason"] != "spam" {
+		t.Errorf("suspension metadata = %v, want the reason", trail[1].Metadata)
+	}
+
+	filtered, err := svc.FindAccountTrail(accountID, http.AuditFilter{Action: constant.AuditActionSuspend}, pagination.Pagination{Limit: 10})
+	if err != nil {
+		t.Fatalf("FindAccountTrail() error = %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ActorID != publicid.Encode(adminID) {
+		t.Errorf("FindAccountTrail() of suspensions = %+v, want the one by the admin", filtered)
+	}
+	page, _ := svc.FindAccountTrail(accountID, http.AuditFilter{}, pagination.Pagination{Limit: 2, Offset: 2})
+	if len(page) != 2 || page[0].Action != constant.AuditActionUpdate {
+		t.Errorf("second page = %+v, want the user's actions", page)
+	}
+}
@@ -0,0 +1,45 @@
+package capability
+
+import (
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/pkg/i18n"
+)
+
+type Service struct{}
+
+func NewService() *Service {
+	return &Service{}
+}
+
+type Servicer interface {
+	Take() (capabilities http.Capabilities)
+}
+
+// Take builds the capability document from the effective config on every call
+func (svc *Service) Take() (capabilities http.Capabilities) {
+	capabilities = http.Capabilities{
+		Features: map[string]bool{
+			constant.FeatureTwoFactor:         constant.TOTPEncryptionKey != "",
+			constant.FeatureOAuth:             len(constant.OAuthProviders) != 0,
+			constant.FeatureInviteOnly:        false,
+			constant.FeatureProfileReplace:    true,
+			constant.FeatureUpdateRateLimit:   constant.ProfileUpdateLimit > 0,
+			constant.FeatureLocalizedNotices:  len(i18n.SupportedLocales) > 1,
+			constant.FeatureUniqueDisplayName: constant.DisplayNameUnique,
+		},
+		Parameters: http.CapabilityParameters{
+			PasswordPolicyURL:   constant.PasswordPolicyURL,
+			OAuthProviders:      constant.OAuthProviders,
+			SupportedLocales:    i18n.SupportedLocales,
+			DefaultLocale:       i18n.DefaultLocale,
+			TermsVersion:        constant.TermsVersion,
+			ProfileUpdateLimit:  constant.ProfileUpdateLimit,
+			ProfileUpdateWindow: constant.ProfileUpdateWindow.String(),
+		},
+	}
+	if capabilities.Parameters.OAuthProviders == nil {
+		capabilities.Parameters.OAuthProviders = []string{}
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package capability
+
+import (
+	"testing"
+
+	"go-rest-api/src/constant"
+)
+
+func TestTakeReflectsToggledFeatures(t *testing.T) {
+	defaultKey, defaultUnique := constant.TOTPEncryptionKey, constant.DisplayNameUnique
+	defer func() {
+		constant.TOTPEncryptionKey, constant.DisplayNameUnique = defaultKey, defaultUnique
+	}()
+
+	svc := NewService()
+	constant.TOTPEncryptionKey, constant.DisplayNameUnique = "", false
+	off := svc.Take()
+	constant.TOTPEncryptionKey, constant.DisplayNameUnique = "0123456789abcdef0123456789abcdef", true
+	on := svc.Take()
+
+	for _, feature := range []string{constant.FeatureTwoFactor, constant.FeatureUniqueDisplayName} {
+		if off.Features[feature] {
+			t.Errorf("feature %s is listed as enabled while it is off", feature)
+		}
+		if !on.Features[feature] {
+			t.Errorf("feature %s is not listed as enabled after turning it on", feature)
+		}
+	}
+	if on.Parameters.OAuthProviders == nil {
+		t.Error("oauth providers are nil, the document must list them as an empty array")
+	}
+}
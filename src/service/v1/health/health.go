@@ -0,0 +1,82 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/repository/v1/health"
+)
+
+// Check reports whether a dependency is usable, it must return once ctx is done
+type Check func(ctx context.Context) (err error)
+
+type Service struct {
+	checks  map[string]Check
+	timeout time.Duration
+}
+
+func NewService(
+	repositorier health.Repositorier,
+	timeout time.Duration,
+) *Service {
+	return &Service{
+		checks: map[string]Check{
+			constant.HealthCheckDatabase: repositorier.Ping,
+		},
+		timeout: timeout,
+	}
+}
+
+type Servicer interface {
+	Ready() (ready bool, readiness http.Readiness)
+}
+
+// Ready runs every check concurrently within the timeout, a check still running at the deadline is
+// reported as timeout so a hung dependency cannot hold the probe
+func (svc *Service) Ready() (ready bool, readiness http.Readiness) {
+	ctx, cancel := context.WithTimeout(context.Background(), svc.timeout)
+	defer cancel()
+
+	type result struct {
+		name   string
+		status string
+	}
+	results := make(chan result, len(svc.checks))
+	for name, check := range svc.checks {
+		go func(name string, check Check) {
+			status := constant.HealthStatusUp
+			if err := check(ctx); err != nil {
+				status = constant.HealthStatusDown
+			}
+			results <- result{name: name, status: status}
+		}(name, check)
+	}
+
+	readiness = http.Readiness{
+		Status: constant.HealthStatusUp,
+		Checks: map[string]string{},
+	}
+	for name := range svc.checks {
+		readiness.Checks[name] = constant.HealthStatusTimeout
+	}
+collect:
+	for pending := len(svc.checks); pending > 0; pending-- {
+		select {
+		case r := <-results:
+			readiness.Checks[r.name] = r.status
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	ready = true
+	for _, status := range readiness.Checks {
+		if status != constant.HealthStatusUp {
+			ready = false
+			readiness.Status = constant.HealthStatusDown
+		}
+	}
+	return
+}
@@ -0,0 +1,250 @@
+package importjob
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/publicid"
+	"go-rest-api/src/repository/v1/importjob"
+	"go-rest-api/src/service/v1/account"
+	"go-rest-api/src/service/v1/audit"
+
+	"github.com/forkyid/go-utils/v1/aes"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Service runs bulk account imports in the background so the import outlives the request,
+// progress and failed rows are stored on the job
+type Service struct {
+	repo     importjob.Repositorier
+	accounts account.Servicer
+	audit    audit.Servicer
+	logger   *logger.Logger
+}
+
+func NewService(
+	repositorier importjob.Repositorier,
+	accountSvc account.Servicer,
+	auditSvc audit.Servicer,
+	appLogger *logger.Logger,
+) *Service {
+	return &Service{
+		repo:     repositorier,
+		accounts: accountSvc,
+		audit:    auditSvc,
+		logger:   appLogger,
+	}
+}
+
+type Servicer interface {
+	Start(createdBy int, requests []http.RegisterUser) (jobID int, err error)
+	BulkCreate(ctx context.Context, createdBy int, requests []http.RegisterUser) (report http.BulkCreateReport)
+	TakeByID(jobID int) (job http.GetImportJob, err error)
+	TakeErrorReport(jobID int) (rows []http.BulkRowValidation, err error)
+	InterruptUnfinished() (err error)
+}
+
+// Start stores the job and imports the rows in a goroutine, the rows only live in memory
+func (svc *Service) Start(createdBy int, requests []http.RegisterUser) (jobID int, err error) {
+	jobID, err = svc.repo.Create(model.ImportJob{
+		CreatedBy: createdBy,
+		Status:    constant.ImportJobStatusPending,
+		Total:     len(requests),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "create import job")
+		return
+	}
+
+	go svc.run(jobID, createdBy, requests)
+	return
+}
+
+// BulkCreate imports the rows within the request without a job, each row commits on its own
+// so a failed row does not undo the created ones
+func (svc *Service) BulkCreate(ctx context.Context, createdBy int, requests []http.RegisterUser) (report http.BulkCreateReport) {
+	report = http.BulkCreateReport{
+		Total: len(requests),
+		Rows:  make([]http.BulkRowResult, 0, len(requests)),
+	}
+	usernames := map[string]int{}
+	for i := range requests {
+		accountID, fieldErrors := svc.importRow(ctx, 0, createdBy, requests[i], i, usernames)
+		row := http.BulkRowResult{Index: i}
+		if len(fieldErrors) == 0 {
+			row.Created = true
+			row.ID = publicid.Encode(accountID)
+			report.Succeeded++
+		} else {
+			row.Errors = fieldErrors
+			report.Failed++
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	return
+}
+
+func (svc *Service) TakeByID(jobID int) (job http.GetImportJob, err error) {
+	importJob, err := svc.takeByID(jobID)
+	if err != nil {
+		return
+	}
+
+	job = http.GetImportJob{
+		ID:          aes.Encrypt(int(importJob.ID)),
+		Status:      importJob.Status,
+		Total:       importJob.Total,
+		Processed:   importJob.Processed,
+		Succeeded:   importJob.Succeeded,
+		Failed:      importJob.Failed,
+		CreatedAt:   importJob.CreatedAt,
+		CompletedAt: importJob.CompletedAt,
+	}
+	return
+}
+
+func (svc *Service) TakeErrorReport(jobID int) (rows []http.BulkRowValidation, err error) {
+	importJob, err := svc.takeByID(jobID)
+	if err != nil {
+		return
+	}
+
+	rows = []http.BulkRowValidation{}
+	if importJob.Errors == "" {
+		return
+	}
+	err = json.Unmarshal([]byte(importJob.Errors), &rows)
+	if err != nil {
+		err = errors.Wrap(err, "unmarshal import errors")
+		return
+	}
+	return
+}
+
+// InterruptUnfinished is called on start up, jobs of a previous process cannot be resumed
+// because their rows were never stored
+func (svc *Service) InterruptUnfinished() (err error) {
+	err = svc.repo.InterruptUnfinished()
+	if err != nil {
+		err = errors.Wrap(err, "interrupt unfinished import jobs")
+		return
+	}
+	return
+}
+
+func (svc *Service) takeByID(jobID int) (job model.ImportJob, err error) {
+	job, err = svc.repo.TakeByID(jobID)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrImportJobNotFound
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take import job")
+		return
+	}
+	return
+}
+
+// run outlives the request that started the job, so its rows are created without the request context
+func (svc *Service) run(jobID, createdBy int, requests []http.RegisterUser) {
+	ctx := context.Background()
+	svc.update(jobID, map[string]interface{}{"status": constant.ImportJobStatusRunning})
+
+	succeeded := 0
+	failedRows := []http.BulkRowValidation{}
+	usernames := map[string]int{}
+	for i := range requests {
+		_, fieldErrors := svc.importRow(ctx, jobID, createdBy, requests[i], i, usernames)
+		if len(fieldErrors) == 0 {
+			succeeded++
+		} else {
+			failedRows = append(failedRows, http.BulkRowValidation{
+				Index:  i,
+				Errors: fieldErrors,
+			})
+		}
+
+		encoded, _ := json.Marshal(failedRows)
+		svc.update(jobID, map[string]interface{}{
+			"processed": i + 1,
+			"succeeded": succeeded,
+			"failed":    len(failedRows),
+			"errors":    string(encoded),
+		})
+	}
+
+	completedAt := time.Now().UTC()
+	svc.update(jobID, map[string]interface{}{
+		"status":       constant.ImportJobStatusCompleted,
+		"completed_at": &completedAt,
+	})
+}
+
+// importRow creates the account of one row and returns its id or its field errors, usernames tracks the batch.
+// A zero jobID is a sync import, its audit entries carry no job id
+func (svc *Service) importRow(ctx context.Context, jobID, createdBy int, request http.RegisterUser, index int, usernames map[string]int) (accountID int, fieldErrors map[string]string) {
+	fieldErrors, err := svc.accounts.ValidateAccountFields(ctx, request)
+	if err != nil {
+		svc.logger.Error("validate import row failed", "job_id", jobID, "row", index, "error", err)
+		return 0, map[string]string{"row": constant.ErrImportRowFailed.Error()}
+	}
+
+	username := strings.ToLower(request.Username)
+	if first, ok := usernames[username]; ok && username != "" {
+		fieldErrors["username"] = fmt.Sprintf("%s, see row %d", constant.ErrDuplicateInBatch.Error(), first)
+	} else {
+		usernames[username] = index
+	}
+	if len(fieldErrors) > 0 {
+		return
+	}
+
+	request.Username = username
+	accountID, err = svc.accounts.Create(ctx, request)
+	var conflict *account.ConflictError
+	if err == nil {
+		metadata := map[string]string{}
+		if jobID > 0 {
+			metadata["job_id"] = aes.Encrypt(jobID)
+		}
+		err := svc.audit.Record(createdBy, constant.AuditActionBulkImport, accountID, "", metadata)
+		if err != nil {
+			svc.logger.Error("AUDIT WRITE FAILED", "action", constant.AuditActionBulkImport, "actor_id", createdBy, "target_id", accountID, "error", err)
+		}
+	} else if errors.As(err, &conflict) {
+		// another request took the value after the row was validated
+		for _, field := range conflict.Fields {
+			fieldErrors[field] = conflictMessages[field]
+		}
+	} else if errors.Is(err, constant.ErrAccountExist) {
+		fieldErrors["username"] = constant.ErrUsernameAlreadyExist.Error()
+	} else if errors.Is(err, constant.ErrTermsNotAccepted) {
+		fieldErrors["terms_version"] = constant.ErrTermsNotAccepted.Error()
+	} else if err != nil {
+		svc.logger.Error("import row failed", "job_id", jobID, "row", index, "error", err)
+		fieldErrors["row"] = constant.ErrImportRowFailed.Error()
+	}
+	return
+}
+
+// conflictMessages are the row errors of the fields a ConflictError names
+var conflictMessages = map[string]string{
+	"username":     constant.ErrUsernameAlreadyExist.Error(),
+	"email":        constant.ErrEmailAlreadyExist.Error(),
+	"phone_number": constant.ErrPhoneNumberAlreadyExist.Error(),
+}
+
+func (svc *Service) update(jobID int, fields map[string]interface{}) {
+	err := svc.repo.Update(jobID, fields)
+	if err != nil {
+		svc.logger.Error("update import job failed", "job_id", jobID, "error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package importjob
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/service/v1/account"
+	"go-rest-api/src/service/v1/audit"
+
+	"gorm.io/gorm"
+)
+
+// memoryRepo is read by the test while the job goroutine writes it
+type memoryRepo struct {
+	mu   sync.Mutex
+	jobs []model.ImportJob
+}
+
+func (repo *memoryRepo) Create(job model.ImportJob) (jobID int, err error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	job.ID = uint(len(repo.jobs) + 1)
+	repo.jobs = append(repo.jobs, job)
+	return int(job.ID), nil
+}
+
+func (repo *memoryRepo) TakeByID(jobID int) (job model.ImportJob, err error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if jobID < 1 || jobID > len(repo.jobs) {
+		return job, gorm.ErrRecordNotFound
+	}
+	return repo.jobs[jobID-1], nil
+}
+
+func (repo *memoryRepo) Update(jobID int, request map[string]interface{}) (err error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	job := &repo.jobs[jobID-1]
+	for column, value := range request {
+		switch column {
+		case "status":
+			job.Status = value.(string)
+		case "processed":
+			job.Processed = value.(int)
+		case "succeeded":
+			job.Succeeded = value.(int)
+		case "failed":
+			job.Failed = value.(int)
+		case "errors":
+			job.Errors = value.(string)
+		case "completed_at":
+			job.CompletedAt = value.(*time.Time)
+		}
+	}
+	return
+}
+
+func (repo *memoryRepo) InterruptUnfinished() (err error) {
+	return
+}
+
+// gatedAccounts creates an account each time proceed receives, rows without a username are invalid
+type gatedAccounts struct {
+	account.Servicer
+	proceed chan struct{}
+}
+
+func (svc *gatedAccounts) ValidateAccountFields(ctx context.Context, request http.RegisterUser) (fieldErrors map[string]string, err error) {
+	fieldErrors = map[string]string{}
+	if request.Username == "" {
+		fieldErrors["username"] = "required"
+	}
+	return
+}
+
+func (svc *gatedAccounts) Create(ctx context.Context, request http.RegisterUser) (accountID int, err error) {
+	<-svc.proceed
+	return 1, nil
+}
+
+type auditStub struct {
+	audit.Servicer
+}
+
+func (auditStub) Record(actorID int, action string, targetID int, ipAddress string, metadata map[string]string) (err error) {
+	return
+}
+
+// waitFor polls the job like a client until done reports true
+func waitFor(t *testing.T, svc *Service, jobID int, done func(job http.GetImportJob) bool) (job http.GetImportJob) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := svc.TakeByID(jobID)
+		if err != nil {
+			t.Fatalf("TakeByID() error = %v", err)
+		}
+		if done(job) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job stayed at %+v", job)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestImportJobProgressAndCompletion(t *testing.T) {
+	accounts := &gatedAccounts{proceed: make(chan struct{})}
+	svc := NewService(&memoryRepo{}, accounts, auditStub{}, logger.New(io.Discard, logger.LevelError))
+	jobID, err := svc.Start(1, []http.RegisterUser{{Username: "budi"}, {Username: ""}, {Username: "siti"}})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	job := waitFor(t, svc, jobID, func(job http.GetImportJob) bool { return true })
+	if job.Total != 3 || job.Processed != 0 || job.CompletedAt != nil {
+		t.Errorf("new job = %+v, want 3 rows none processed", job)
+	}
+
+	// the first row is created, the invalid second row fails without waiting, the third waits to be created
+	accounts.proceed <- struct{}{}
+	job = waitFor(t, svc, jobID, func(job http.GetImportJob) bool { return job.Processed == 2 })
+	if job.Status != constant.ImportJobStatusRunning || job.Succeeded != 1 || job.Failed != 1 {
+		t.Errorf("job in progress = %+v, want running with 1 succeeded and 1 failed", job)
+	}
+
+	accounts.proceed <- struct{}{}
+	job = waitFor(t, svc, jobID, func(job http.GetImportJob) bool { return job.Status == constant.ImportJobStatusCompleted })
+	if job.Processed != 3 || job.Succeeded != 2 || job.Failed != 1 || job.CompletedAt == nil {
+		t.Errorf("completed job = %+v, want 3 processed, 2 succeeded and 1 failed", job)
+	}
+	rows, err := svc.TakeErrorReport(jobID)
+	if err != nil {
+		t.Fatalf("TakeErrorReport() error = %v", err)
+	}
+	if len(rows) != 1 || rows[0].Index != 1 || rows[0].Errors["username"] == "" {
+		t.Errorf("error report = %+v, want the username error of row 1", rows)
+	}
+}
+
+func TestTakeUnknownImportJob(t *testing.T) {
+	svc := NewService(&memoryRepo{}, &gatedAccounts{}, auditStub{}, logger.New(io.Discard, logger.LevelError))
+	if _, err := svc.TakeByID(7); err != constant.ErrImportJobNotFound {
+		t.Errorf("TakeByID() of an unknown job error = %v, want %v", err, constant.ErrImportJobNotFound)
+	}
+}
@@ -0,0 +1,112 @@
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/email"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/notifier"
+	"go-rest-api/src/repository/v1/outbox"
+
+	"github.com/pkg/errors"
+)
+
+// Service queues notifications in the outbox table and delivers them in the background,
+// it satisfies notifier.Notifier so callers do not wait on delivery
+type Service struct {
+	repo     outbox.Repositorier
+	notifier notifier.Notifier
+	logger   *logger.Logger
+}
+
+func NewService(
+	repositorier outbox.Repositorier,
+	notifierer notifier.Notifier,
+	appLogger *logger.Logger,
+) *Service {
+	return &Service{
+		repo:     repositorier,
+		notifier: notifierer,
+		logger:   appLogger,
+	}
+}
+
+type Servicer interface {
+	Notify(to, locale, templateName string, data map[string]string) (err error)
+	Dispatch(limit int) (sent int, err error)
+	Run(interval time.Duration)
+}
+
+// Notify enqueues the message, it is rendered and sent by Dispatch
+func (svc *Service) Notify(to, locale, templateName string, data map[string]string) (err error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		err = errors.Wrap(err, "marshal outbox data")
+		return
+	}
+
+	err = svc.repo.Create(model.Outbox{
+		Recipient: to,
+		Locale:    locale,
+		Template:  templateName,
+		Data:      string(payload),
+		Status:    constant.OutboxStatusPending,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "create outbox message")
+		return
+	}
+	return
+}
+
+// Dispatch sends up to limit pending messages, failed messages are retried until OutboxMaxAttempts
+// unless the sender reports that sending again cannot succeed
+func (svc *Service) Dispatch(limit int) (sent int, err error) {
+	messages, err := svc.repo.FindPending(constant.OutboxMaxAttempts, limit)
+	if err != nil {
+		err = errors.Wrap(err, "find pending outbox messages")
+		return
+	}
+
+	for i := range messages {
+		data := map[string]string{}
+		json.Unmarshal([]byte(messages[i].Data), &data)
+
+		attempts := messages[i].Attempts + 1
+		update := map[string]interface{}{"attempts": attempts}
+		sendErr := svc.notifier.Notify(messages[i].Recipient, messages[i].Locale, messages[i].Template, data)
+		if sendErr != nil {
+			svc.logger.Error("send outbox message failed", "outbox_id", messages[i].ID, "attempts", attempts, "error", sendErr)
+			if attempts >= constant.OutboxMaxAttempts || !email.Retriable(sendErr) {
+				update["status"] = constant.OutboxStatusFailed
+			}
+		} else {
+			update["status"] = constant.OutboxStatusSent
+			update["sent_at"] = time.Now().UTC()
+			sent++
+		}
+
+		err = svc.repo.Update(int(messages[i].ID), update)
+		if err != nil {
+			err = errors.Wrap(err, "update outbox message")
+			return
+		}
+	}
+	return
+}
+
+// Run dispatches pending messages every interval, it never returns
+func (svc *Service) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		_, err := svc.Dispatch(constant.OutboxBatchSize)
+		if err != nil {
+			svc.logger.Error("dispatch outbox failed", "error", err)
+		}
+	}
+}
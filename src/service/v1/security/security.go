@@ -0,0 +1,303 @@
+package security
+
+import (
+	"encoding/json"
+	"time"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/geoip"
+	"go-rest-api/src/pkg/jwt"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/pagination"
+	"go-rest-api/src/pkg/useragent"
+	"go-rest-api/src/repository/v1/security"
+
+	"github.com/forkyid/go-utils/v1/aes"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type Service struct {
+	repo   security.Repositorier
+	geo    geoip.Provider
+	logger *logger.Logger
+}
+
+func NewService(
+	repositorier security.Repositorier,
+	geoProvider geoip.Provider,
+	appLogger *logger.Logger,
+) *Service {
+	return &Service{
+		repo:   repositorier,
+		geo:    geoProvider,
+		logger: appLogger,
+	}
+}
+
+type Servicer interface {
+	RecordFailedLogin(identifier, ipAddress, reason string) (err error)
+	FindFailedLogins(filter http.FailedLoginFilter, pgn pagination.Pagination) (responses []http.GetFailedLogin, err error)
+	RecordFailedRegistration(fingerprint, reason string, fields []string) (err error)
+	FindFailedRegistrations(filter http.FailedRegistrationFilter, pgn pagination.Pagination) (responses []http.GetFailedRegistration, err error)
+	PurgeFailedRegistrations(now time.Time) (purged int64, err error)
+	RunFailedRegistrationPurge(interval time.Duration)
+	RecordSession(accountID int, tokenID, ipAddress, userAgent string) (err error)
+	FindSessions(accountID int, currentTokenID string) (responses []http.GetSession, err error)
+	RevokeSession(accountID, sessionID int) (err error)
+	RevokeSessions(accountID int) (revoked int, err error)
+	EndSession(tokenID string) (err error)
+	RotateSession(oldTokenID, newTokenID string) (err error)
+}
+
+// RecordFailedLogin stores a failed login attempt, the attempted password is never persisted
+func (svc *Service) RecordFailedLogin(identifier, ipAddress, reason string) (err error) {
+	failedLogin := model.FailedLogin{
+		Identifier: identifier,
+		IPAddress:  ipAddress,
+		Reason:     reason,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	err = svc.repo.CreateFailedLogin(failedLogin)
+	if err != nil {
+		err = errors.Wrap(err, "create failed login")
+		return
+	}
+	return
+}
+
+func (svc *Service) FindFailedLogins(filter http.FailedLoginFilter, pgn pagination.Pagination) (responses []http.GetFailedLogin, err error) {
+	failedLogins, err := svc.repo.FindFailedLogins(filter.Identifier, filter.IPAddress, filter.From, filter.To, pgn)
+	if err != nil {
+		err = errors.Wrap(err, "find failed logins")
+		return
+	}
+
+	for i := range failedLogins {
+		responses = append(responses, http.GetFailedLogin{
+			ID:         int(failedLogins[i].ID),
+			Identifier: failedLogins[i].Identifier,
+			IPAddress:  failedLogins[i].IPAddress,
+			Reason:     failedLogins[i].Reason,
+			CreatedAt:  failedLogins[i].CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return
+}
+
+// RecordFailedRegistration stores the reason and the names of the attempted fields, never their values
+func (svc *Service) RecordFailedRegistration(fingerprint, reason string, fields []string) (err error) {
+	if constant.FailedRegistrationRetention <= 0 {
+		return
+	}
+
+	if fields == nil {
+		fields = []string{}
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		err = errors.Wrap(err, "marshal failed registration fields")
+		return
+	}
+
+	failedRegistration := model.FailedRegistration{
+		Fingerprint: fingerprint,
+		Reason:      reason,
+		Fields:      string(payload),
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	err = svc.repo.CreateFailedRegistration(failedRegistration)
+	if err != nil {
+		err = errors.Wrap(err, "create failed registration")
+		return
+	}
+	return
+}
+
+func (svc *Service) FindFailedRegistrations(filter http.FailedRegistrationFilter, pgn pagination.Pagination) (responses []http.GetFailedRegistration, err error) {
+	failedRegistrations, err := svc.repo.FindFailedRegistrations(filter.Fingerprint, filter.Reason, filter.From, filter.To, pgn)
+	if err != nil {
+		err = errors.Wrap(err, "find failed registrations")
+		return
+	}
+
+	for i := range failedRegistrations {
+		fields := []string{}
+		json.Unmarshal([]byte(failedRegistrations[i].Fields), &fields)
+		responses = append(responses, http.GetFailedRegistration{
+			ID:          int(failedRegistrations[i].ID),
+			Fingerprint: failedRegistrations[i].Fingerprint,
+			Reason:      failedRegistrations[i].Reason,
+			Fields:      fields,
+			CreatedAt:   failedRegistrations[i].CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return
+}
+
+// PurgeFailedRegistrations deletes the attempts older than FailedRegistrationRetention,
+// with recording disabled every attempt left over is deleted
+func (svc *Service) PurgeFailedRegistrations(now time.Time) (purged int64, err error) {
+	before := now
+	if constant.FailedRegistrationRetention > 0 {
+		before = now.Add(-constant.FailedRegistrationRetention)
+	}
+
+	purged, err = svc.repo.DeleteFailedRegistrationsBefore(before)
+	if err != nil {
+		err = errors.Wrap(err, "delete failed registrations")
+		return
+	}
+	return
+}
+
+// RunFailedRegistrationPurge purges expired attempts every interval, it blocks so run it in a goroutine
+func (svc *Service) RunFailedRegistrationPurge(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		_, err := svc.PurgeFailedRegistrations(time.Now().UTC())
+		if err != nil {
+			svc.logger.Error("purge expired registration attempts failed", "error", err)
+		}
+	}
+}
+
+// RecordSession stores the login under the jti of the token issued with it, it is active until the token expires
+func (svc *Service) RecordSession(accountID int, tokenID, ipAddress, userAgent string) (err error) {
+	if len(userAgent) > constant.SessionUserAgentLimit {
+		userAgent = userAgent[:constant.SessionUserAgentLimit]
+	}
+	now := time.Now().UTC()
+	session := model.Session{
+		AccountID: accountID,
+		TokenID:   &tokenID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(constant.TokenTTL),
+	}
+
+	err = svc.repo.CreateSession(session)
+	if err != nil {
+		err = errors.Wrap(err, "create session")
+		return
+	}
+	return
+}
+
+// FindSessions lists the active sessions newest first, the location is looked up on every call
+// and left empty when the provider cannot resolve it. The session of currentTokenID is marked current
+func (svc *Service) FindSessions(accountID int, currentTokenID string) (responses []http.GetSession, err error) {
+	sessions, err := svc.repo.FindActiveSessions(accountID, time.Now().UTC())
+	if err != nil {
+		err = errors.Wrap(err, "find active sessions")
+		return
+	}
+
+	responses = []http.GetSession{}
+	for i := range sessions {
+		location := geoip.Resolve(svc.geo, sessions[i].IPAddress)
+		responses = append(responses, http.GetSession{
+			ID:         aes.Encrypt(int(sessions[i].ID)),
+			IPAddress:  sessions[i].IPAddress,
+			DeviceType: useragent.DeviceType(sessions[i].UserAgent),
+			Country:    location.Country,
+			City:       location.City,
+			Current:    currentTokenID != "" && sessions[i].TokenID != nil && *sessions[i].TokenID == currentTokenID,
+			CreatedAt:  sessions[i].CreatedAt.Format(time.RFC3339),
+			ExpiresAt:  sessions[i].ExpiresAt.Format(time.RFC3339),
+		})
+	}
+	return
+}
+
+// RevokeSession blacklists the token of an active session of the account and ends the session,
+// a session of another account is constant.ErrSessionNotFound
+func (svc *Service) RevokeSession(accountID, sessionID int) (err error) {
+	now := time.Now().UTC()
+	session, err := svc.repo.TakeActiveSession(accountID, sessionID, now)
+	if err == gorm.ErrRecordNotFound {
+		err = constant.ErrSessionNotFound
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "take active session")
+		return
+	}
+	if session.TokenID == nil || *session.TokenID == "" {
+		err = constant.ErrSessionNotRevocable
+		return
+	}
+
+	err = jwt.RevokeID(*session.TokenID, session.ExpiresAt)
+	if err != nil {
+		err = errors.Wrap(err, "revoke token")
+		return
+	}
+	err = svc.repo.RevokeSession(sessionID, now)
+	if err != nil {
+		err = errors.Wrap(err, "revoke session")
+		return
+	}
+	return
+}
+
+// RevokeSessions revokes every active session of the account, sessions recorded before sessions could
+// be revoked are skipped and end when their token expires
+func (svc *Service) RevokeSessions(accountID int) (revoked int, err error) {
+	now := time.Now().UTC()
+	sessions, err := svc.repo.FindActiveSessions(accountID, now)
+	if err != nil {
+		err = errors.Wrap(err, "find active sessions")
+		return
+	}
+
+	for _, session := range sessions {
+		if session.TokenID == nil || *session.TokenID == "" {
+			continue
+		}
+		err = jwt.RevokeID(*session.TokenID, session.ExpiresAt)
+		if err != nil {
+			err = errors.Wrap(err, "revoke token")
+			return
+		}
+		err = svc.repo.RevokeSession(int(session.ID), now)
+		if err != nil {
+			err = errors.Wrap(err, "revoke session")
+			return
+		}
+		revoked++
+	}
+	return
+}
+
+// EndSession ends the session of a token revoked by a logout, the token itself is revoked by the caller
+func (svc *Service) EndSession(tokenID string) (err error) {
+	err = svc.repo.RevokeSessionByToken(tokenID, time.Now().UTC())
+	if err != nil {
+		err = errors.Wrap(err, "revoke session by token")
+		return
+	}
+	return
+}
+
+// RotateSession moves the session of a refreshed token to the new token, it expires with the new token.
+// The old token is revoked so a revoked session cannot live on in a token refreshed before
+func (svc *Service) RotateSession(oldTokenID, newTokenID string) (err error) {
+	expiresAt := time.Now().UTC().Add(constant.TokenTTL)
+	err = jwt.RevokeID(oldTokenID, expiresAt)
+	if err != nil {
+		err = errors.Wrap(err, "revoke refreshed token")
+		return
+	}
+	err = svc.repo.RotateSession(oldTokenID, newTokenID, expiresAt)
+	if err != nil {
+		err = errors.Wrap(err, "rotate session")
+		return
+	}
+	return
+}
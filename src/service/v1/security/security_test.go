@@ -0,0 +1,295 @@
+package security
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/geoip"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/pagination"
+	"go-rest-api/src/pkg/useragent"
+
+	"gorm.io/gorm"
+)
+
+var discard = logger.New(io.Discard, logger.LevelError)
+
+// memoryRepo filters like the queries of the repository, lists are newest first
+type memoryRepo struct {
+	failedLogins        []model.FailedLogin
+	failedRegistrations []model.FailedRegistration
+	sessions            []model.Session
+}
+
+func inRange(createdAt, from, to time.Time) bool {
+	return (from.IsZero() || !createdAt.Before(from)) && (to.IsZero() || !createdAt.After(to))
+}
+
+func page(length int, pgn pagination.Pagination) (start, end int) {
+	start, end = pgn.Offset, length
+	if start > length {
+		start = length
+	}
+	if pgn.Limit > 0 && start+pgn.Limit < end {
+		end = start + pgn.Limit
+	}
+	return
+}
+
+func (repo *memoryRepo) CreateFailedLogin(failedLogin model.FailedLogin) (err error) {
+	failedLogin.ID = uint(len(repo.failedLogins) + 1)
+	repo.failedLogins = append(repo.failedLogins, failedLogin)
+	return
+}
+
+func (repo *memoryRepo) FindFailedLogins(identifier, ipAddress string, from, to time.Time, pgn pagination.Pagination) (failedLogins []model.FailedLogin, err error) {
+	for _, failedLogin := range repo.failedLogins {
+		if (identifier == "" || failedLogin.Identifier == identifier) && (ipAddress == "" || failedLogin.IPAddress == ipAddress) &&
+			inRange(failedLogin.CreatedAt, from, to) {
+			failedLogins = append(failedLogins, failedLogin)
+		}
+	}
+	sort.SliceStable(failedLogins, func(i, j int) bool { return failedLogins[i].CreatedAt.After(failedLogins[j].CreatedAt) })
+	start, end := page(len(failedLogins), pgn)
+	return failedLogins[start:end], nil
+}
+
+func (repo *memoryRepo) CreateFailedRegistration(failedRegistration model.FailedRegistration) (err error) {
+	failedRegistration.ID = uint(len(repo.failedRegistrations) + 1)
+	repo.failedRegistrations = append(repo.failedRegistrations, failedRegistration)
+	return
+}
+
+func (repo *memoryRepo) FindFailedRegistrations(fingerprint, reason string, from, to time.Time, pgn pagination.Pagination) (failedRegistrations []model.FailedRegistration, err error) {
+	for _, failedRegistration := range repo.failedRegistrations {
+		if (fingerprint == "" || failedRegistration.Fingerprint == fingerprint) && (reason == "" || failedRegistration.Reason == reason) &&
+			inRange(failedRegistration.CreatedAt, from, to) {
+			failedRegistrations = append(failedRegistrations, failedRegistration)
+		}
+	}
+	sort.SliceStable(failedRegistrations, func(i, j int) bool {
+		return failedRegistrations[i].CreatedAt.After(failedRegistrations[j].CreatedAt)
+	})
+	start, end := page(len(failedRegistrations), pgn)
+	return failedRegistrations[start:end], nil
+}
+
+func (repo *memoryRepo) DeleteFailedRegistrationsBefore(before time.Time) (deleted int64, err error) {
+	kept := []model.FailedRegistration{}
+	for _, failedRegistration := range repo.failedRegistrations {
+		if failedRegistration.CreatedAt.Before(before) {
+			deleted++
+			continue
+		}
+		kept = append(kept, failedRegistration)
+	}
+	repo.failedRegistrations = kept
+	return
+}
+
+func (repo *memoryRepo) CreateSession(session model.Session) (err error) {
+	session.ID = uint(len(repo.sessions) + 1)
+	repo.sessions = append(repo.sessions, session)
+	return
+}
+
+func (repo *memoryRepo) active(session model.Session, now time.Time) bool {
+	return session.ExpiresAt.After(now) && session.RevokedAt == nil
+}
+
+func (repo *memoryRepo) FindActiveSessions(accountID int, now time.Time) (sessions []model.Session, err error) {
+	for _, session := range repo.sessions {
+		if session.AccountID == accountID && repo.active(session, now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return
+}
+
+func (repo *memoryRepo) TakeActiveSession(accountID, sessionID int, now time.Time) (session model.Session, err error) {
+	for _, session := range repo.sessions {
+		if int(session.ID) == sessionID && session.AccountID == accountID && repo.active(session, now) {
+			return session, nil
+		}
+	}
+	return session, gorm.ErrRecordNotFound
+}
+
+func (repo *memoryRepo) RevokeSession(sessionID int, now time.Time) (err error) {
+	for i := range repo.sessions {
+		if int(repo.sessions[i].ID) == sessionID && repo.sessions[i].RevokedAt == nil {
+			repo.sessions[i].RevokedAt = &now
+		}
+	}
+	return
+}
+
+func (repo *memoryRepo) RevokeSessionByToken(tokenID string, now time.Time) (err error) {
+	for i := range repo.sessions {
+		if repo.sessions[i].TokenID != nil && *repo.sessions[i].TokenID == tokenID && repo.sessions[i].RevokedAt == nil {
+			repo.sessions[i].RevokedAt = &now
+		}
+	}
+	return
+}
+
+func (repo *memoryRepo) RotateSession(oldTokenID, newTokenID string, expiresAt time.Time) (err error) {
+	for i := range repo.sessions {
+		if repo.sessions[i].TokenID != nil && *repo.sessions[i].TokenID == oldTokenID && repo.sessions[i].RevokedAt == nil {
+			tokenID := newTokenID
+			repo.sessions[i].TokenID = &tokenID
+			repo.sessions[i].ExpiresAt = expiresAt
+		}
+	}
+	return
+}
+
+func TestFailedLoginsAreRecordedAndQueryable(t *testing.T) {
+	svc := NewService(&memoryRepo{}, geoip.Noop{}, discard)
+	attempts := []struct {
+		identifier, ipAddress, reason string
+	}{
+		{"budi", "10.0.0.1", constant.LoginFailureInvalidPassword},
+		{"budi", "10.0.0.2", constant.LoginFailureInvalidPassword},
+		{"nobody@example.com", "10.0.0.1", constant.LoginFailureAccountNotRegistered},
+	}
+	for _, attempt := range attempts {
+		if err := svc.RecordFailedLogin(attempt.identifier, attempt.ipAddress, attempt.reason); err != nil {
+			t.Fatalf("RecordFailedLogin() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter http.FailedLoginFilter
+		want   int
+	}{
+		{"all", http.FailedLoginFilter{}, 3},
+		{"by identifier", http.FailedLoginFilter{Identifier: "budi"}, 2},
+		{"by ip", http.FailedLoginFilter{IPAddress: "10.0.0.1"}, 2},
+		{"by identifier and ip", http.FailedLoginFilter{Identifier: "budi", IPAddress: "10.0.0.2"}, 1},
+		{"since an hour ago", http.FailedLoginFilter{From: time.Now().Add(-time.Hour)}, 3},
+		{"until an hour ago", http.FailedLoginFilter{To: time.Now().Add(-time.Hour)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failedLogins, err := svc.FindFailedLogins(tt.filter, pagination.Pagination{Limit: 10})
+			if err != nil {
+				t.Fatalf("FindFailedLogins() error = %v", err)
+			}
+			if len(failedLogins) != tt.want {
+				t.Fatalf("FindFailedLogins() returned %d attempts, want %d", len(failedLogins), tt.want)
+			}
+			for _, failedLogin := range failedLogins {
+				if failedLogin.Reason == "" || failedLogin.CreatedAt == "" {
+					t.Errorf("failed login %+v misses its reason or time", failedLogin)
+				}
+			}
+		})
+	}
+}
+
+func TestFailedRegistrationsAreRecordedAndPurgedAfterTheWindow(t *testing.T) {
+	defaultRetention := constant.FailedRegistrationRetention
+	constant.FailedRegistrationRetention = 24 * time.Hour
+	defer func() { constant.FailedRegistrationRetention = defaultRetention }()
+
+	repo := &memoryRepo{}
+	svc := NewService(repo, geoip.Noop{}, discard)
+	err := svc.RecordFailedRegistration("fp-1", constant.RegistrationFailureConflict, []string{"username", "email"})
+	if err != nil {
+		t.Fatalf("RecordFailedRegistration() error = %v", err)
+	}
+	err = svc.RecordFailedRegistration("fp-2", constant.RegistrationFailureTermsNotAccepted, nil)
+	if err != nil {
+		t.Fatalf("RecordFailedRegistration() error = %v", err)
+	}
+
+	recorded, err := svc.FindFailedRegistrations(http.FailedRegistrationFilter{Fingerprint: "fp-1"}, pagination.Pagination{Limit: 10})
+	if err != nil {
+		t.Fatalf("FindFailedRegistrations() error = %v", err)
+	}
+	if len(recorded) != 1 || recorded[0].Reason != constant.RegistrationFailureConflict ||
+		len(recorded[0].Fields) != 2 || recorded[0].Fields[0] != "username" {
+		t.Fatalf("FindFailedRegistrations() = %+v, want the conflict of fp-1 with its field names", recorded)
+	}
+
+	// within the window nothing is purged, past it every attempt is
+	now := time.Now().UTC()
+	if purged, _ := svc.PurgeFailedRegistrations(now.Add(time.Hour)); purged != 0 {
+		t.Errorf("PurgeFailedRegistrations() within the window purged %d", purged)
+	}
+	purged, err := svc.PurgeFailedRegistrations(now.Add(25 * time.Hour))
+	if err != nil {
+		t.Fatalf("PurgeFailedRegistrations() error = %v", err)
+	}
+	if purged != 2 || len(repo.failedRegistrations) != 0 {
+		t.Errorf("PurgeFailedRegistrations() past the window purged %d, %d left", purged, len(repo.failedRegistrations))
+	}
+}
+
+// failingGeo is a provider whose lookups always fail, like an unreachable lookup service
+type failingGeo struct{}
+
+func (failingGeo) Lookup(ip string) (location geoip.Location, err error) {
+	return location, errors.New("lookup timed out")
+}
+
+func TestSessionsIncludeDeviceAndLocation(t *testing.T) {
+	const (
+		iphone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148"
+		desktop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/118.0"
+	)
+	repo := &memoryRepo{}
+	geo := geoip.Static{"203.0.113.10": {Country: "ID", City: "Jakarta"}}
+	svc := NewService(repo, geo, discard)
+	sessions := []struct {
+		tokenID, ipAddress, userAgent string
+	}{
+		{"token-1", "203.0.113.10", iphone},
+		{"token-2", "198.51.100.7", desktop},
+	}
+	for _, session := range sessions {
+		if err := svc.RecordSession(7, session.tokenID, session.ipAddress, session.userAgent); err != nil {
+			t.Fatalf("RecordSession() error = %v", err)
+		}
+	}
+
+	want := map[string]http.GetSession{
+		"203.0.113.10": {DeviceType: useragent.DeviceMobile, Country: "ID", City: "Jakarta", Current: true},
+		// an address the provider does not know is left without a location
+		"198.51.100.7": {DeviceType: useragent.DeviceDesktop},
+	}
+	responses, err := svc.FindSessions(7, "token-1")
+	if err != nil {
+		t.Fatalf("FindSessions() error = %v", err)
+	}
+	if len(responses) != len(want) {
+		t.Fatalf("FindSessions() = %+v, want %d sessions", responses, len(want))
+	}
+	for _, response := range responses {
+		expected := want[response.IPAddress]
+		if response.DeviceType != expected.DeviceType || response.Country != expected.Country ||
+			response.City != expected.City || response.Current != expected.Current {
+			t.Errorf("session of %s = %+v, want %+v", response.IPAddress, response, expected)
+		}
+	}
+
+	// a failing provider does not fail the list
+	responses, err = NewService(repo, failingGeo{}, discard).FindSessions(7, "")
+	if err != nil {
+		t.Fatalf("FindSessions() with a failing provider error = %v", err)
+	}
+	for _, response := range responses {
+		if response.Country != "" || response.City != "" || response.DeviceType == "" {
+			t.Errorf("session with a failing provider = %+v, want a device without a location", response)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/publicid"
+	"go-rest-api/src/pkg/token"
+	"go-rest-api/src/pkg/webhook"
+	webhookRepository "go-rest-api/src/repository/v1/webhook"
+
+	"github.com/forkyid/go-utils/v1/aes"
+	"github.com/pkg/errors"
+)
+
+// Service manages the webhooks accounts register for their own events and publishes those events to them
+type Service struct {
+	repo   webhookRepository.Repositorier
+	sender webhook.Dispatcher
+	// deletion delivers to the downstream systems of DeletionWebhookURLs
+	deletion webhook.Dispatcher
+	logger   *logger.Logger
+}
+
+func NewService(
+	repositorier webhookRepository.Repositorier,
+	sender webhook.Dispatcher,
+	deletionSender webhook.Dispatcher,
+	appLogger *logger.Logger,
+) *Service {
+	return &Service{
+		repo:     repositorier,
+		sender:   sender,
+		deletion: deletionSender,
+		logger:   appLogger,
+	}
+}
+
+type Servicer interface {
+	Create(accountID int, request http.CreateWebhook) (response http.CreatedWebhook, err error)
+	Find(accountID int) (responses []http.GetWebhook, err error)
+	Delete(accountID, webhookID int) (err error)
+	Publish(accountID int, event string)
+	NotifyDeletion(accountID int, waitForAck bool) (err error)
+}
+
+// Create registers a webhook within the WebhookMaxPerAccount quota, the url must be a public https url
+func (svc *Service) Create(accountID int, request http.CreateWebhook) (response http.CreatedWebhook, err error) {
+	err = webhook.ValidateURL(request.URL)
+	if err != nil {
+		return
+	}
+
+	count, err := svc.repo.CountByAccountID(accountID)
+	if err != nil {
+		err = errors.Wrap(err, "count webhooks")
+		return
+	}
+	if count >= int64(constant.WebhookMaxPerAccount) {
+		err = constant.ErrWebhookQuotaExceeded
+		return
+	}
+
+	secret, _, err := token.Generate()
+	if err != nil {
+		err = errors.Wrap(err, "generate webhook secret")
+		return
+	}
+
+	webhookID, err := svc.repo.Create(model.Webhook{
+		AccountID: accountID,
+		URL:       request.URL,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "create webhook")
+		return
+	}
+
+	response = http.CreatedWebhook{
+		ID:     aes.Encrypt(webhookID),
+		URL:    request.URL,
+		Secret: secret,
+	}
+	return
+}
+
+func (svc *Service) Find(accountID int) (responses []http.GetWebhook, err error) {
+	webhooks, err := svc.repo.FindByAccountID(accountID)
+	if err != nil {
+		err = errors.Wrap(err, "find webhooks")
+		return
+	}
+
+	responses = []http.GetWebhook{}
+	for i := range webhooks {
+		responses = append(responses, http.GetWebhook{
+			ID:        aes.Encrypt(int(webhooks[i].ID)),
+			URL:       webhooks[i].URL,
+			CreatedAt: webhooks[i].CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return
+}
+
+func (svc *Service) Delete(accountID, webhookID int) (err error) {
+	err = svc.repo.Delete(accountID, webhookID)
+	if err != nil && !errors.Is(err, constant.ErrWebhookNotFound) {
+		err = errors.Wrap(err, "delete webhook")
+		return
+	}
+	return
+}
+
+// Publish queues the event for the webhooks of the account it is about, failures are only logged
+func (svc *Service) Publish(accountID int, event string) {
+	webhooks, err := svc.repo.FindByAccountID(accountID)
+	if err != nil {
+		svc.logger.Error("find webhooks failed", "account_id", accountID, "error", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(http.WebhookEvent{
+		Event:      event,
+		AccountID:  publicid.Encode(accountID),
+		OccurredAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		svc.logger.Error("marshal webhook event failed", "event", event, "error", err)
+		return
+	}
+
+	for i := range webhooks {
+		queued := svc.sender.Enqueue(webhook.Delivery{
+			URL:    webhooks[i].URL,
+			Secret: webhooks[i].Secret,
+			Event:  event,
+			Body:   body,
+		})
+		if !queued {
+			svc.logger.Warn("webhook queue full, event dropped", "event", event, "webhook_id", webhooks[i].ID)
+		}
+	}
+}
+
+// NotifyDeletion tells the downstream systems to clean up the account. With waitForAck every endpoint
+// is delivered to in turn and the first one not acknowledging fails with ErrDeletionNotAcknowledged,
+// otherwise the deliveries are queued and failures are only logged.
+func (svc *Service) NotifyDeletion(accountID int, waitForAck bool) (err error) {
+	if len(constant.DeletionWebhookURLs) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(http.WebhookEvent{
+		Event:      constant.WebhookEventAccountDeleted,
+		AccountID:  publicid.Encode(accountID),
+		OccurredAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "marshal deletion event")
+		return
+	}
+
+	for _, url := range constant.DeletionWebhookURLs {
+		delivery := webhook.Delivery{
+			URL:    url,
+			Secret: constant.DeletionWebhookSecret,
+			Event:  constant.WebhookEventAccountDeleted,
+			Body:   body,
+		}
+		if !waitForAck {
+			if !svc.deletion.Enqueue(delivery) {
+				svc.logger.Warn("deletion webhook queue full, event dropped", "account_id", accountID, "url", url)
+			}
+			continue
+		}
+
+		if deliverErr := svc.deletion.Deliver(delivery); deliverErr != nil {
+			svc.logger.Error("deletion webhook not acknowledged", "account_id", accountID, "url", url, "error", deliverErr)
+			err = constant.ErrDeletionNotAcknowledged
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"go-rest-api/src/constant"
+	"go-rest-api/src/http"
+	"go-rest-api/src/model"
+	"go-rest-api/src/pkg/logger"
+	"go-rest-api/src/pkg/publicid"
+	"go-rest-api/src/pkg/webhook"
+)
+
+var discard = logger.New(io.Discard, logger.LevelError)
+
+type memoryRepo struct {
+	webhooks []model.Webhook
+}
+
+func (repo *memoryRepo) Create(hook model.Webhook) (webhookID int, err error) {
+	hook.ID = uint(len(repo.webhooks) + 1)
+	repo.webhooks = append(repo.webhooks, hook)
+	return int(hook.ID), nil
+}
+
+func (repo *memoryRepo) FindByAccountID(accountID int) (webhooks []model.Webhook, err error) {
+	for i := range repo.webhooks {
+		if repo.webhooks[i].AccountID == accountID {
+			webhooks = append(webhooks, repo.webhooks[i])
+		}
+	}
+	return
+}
+
+func (repo *memoryRepo) CountByAccountID(accountID int) (count int64, err error) {
+	webhooks, err := repo.FindByAccountID(accountID)
+	return int64(len(webhooks)), err
+}
+
+func (repo *memoryRepo) Delete(accountID, webhookID int) (err error) {
+	for i := range repo.webhooks {
+		if int(repo.webhooks[i].ID) == webhookID && repo.webhooks[i].AccountID == accountID {
+			repo.webhooks = append(repo.webhooks[:i], repo.webhooks[i+1:]...)
+			return
+		}
+	}
+	return constant.ErrWebhookNotFound
+}
+
+// recorder keeps the deliveries instead of sending them, deliverErr fails every Deliver
+type recorder struct {
+	queued     []webhook.Delivery
+	delivered  []webhook.Delivery
+	deliverErr error
+}
+
+func (r *recorder) Enqueue(delivery webhook.Delivery) bool {
+	r.queued = append(r.queued, delivery)
+	return true
+}
+
+func (r *recorder) Deliver(delivery webhook.Delivery) (err error) {
+	r.delivered = append(r.delivered, delivery)
+	return r.deliverErr
+}
+
+func TestPublishDeliversToOwnWebhooksOnly(t *testing.T) {
+	repo := &memoryRepo{webhooks: []model.Webhook{
+		{AccountID: 1, URL: "https://93.184.216.34/one", Secret: "secret one"},
+		{AccountID: 2, URL: "https://93.184.216.34/two", Secret: "secret two"},
+		{AccountID: 1, URL: "https://93.184.216.34/three", Secret: "secret three"},
+	}}
+	sender := &recorder{}
+	svc := NewService(repo, sender, &recorder{}, discard)
+
+	svc.Publish(1, constant.WebhookEventAccountUpdated)
+
+	if len(sender.queued) != 2 {
+		t.Fatalf("Publish() queued %d deliveries, want 2", len(sender.queued))
+	}
+	for _, delivery := range sender.queued {
+		if delivery.URL == "https://93.184.216.34/two" || delivery.Secret == "secret two" {
+			t.Errorf("Publish() for account 1 delivered to the webhook of account 2")
+		}
+		event := http.WebhookEvent{}
+		if err := json.Unmarshal(delivery.Body, &event); err != nil {
+			t.Fatalf("delivery body is not an event: %v", err)
+		}
+		if event.AccountID != publicid.Encode(1) || event.Event != constant.WebhookEventAccountUpdated {
+			t.Errorf("delivery body = %+v, want the updated event of account 1", event)
+		}
+	}
+}
+
+func TestCreateRejectsInternalURL(t *testing.T) {
+	repo := &memoryRepo{}
+	svc := NewService(repo, &recorder{}, &recorder{}, discard)
+
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{"https://127.0.0.1/hooks", webhook.ErrInternalTarget},
+		{"https://10.0.0.5/hooks", webhook.ErrInternalTarget},
+		{"http://93.184.216.34/hooks", webhook.ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		if _, err := svc.Create(1, http.CreateWebhook{URL: tt.url}); err != tt.wantErr {
+			t.Errorf("Create(%q) error = %v, want %v", tt.url, err, tt.wantErr)
+		}
+	}
+	if len(repo.webhooks) != 0 {
+		t.Errorf("Create() stored %d rejected webhooks", len(repo.webhooks))
+	}
+}
+
+func TestNotifyDeletionRequiresTheAck(t *testing.T) {
+	defaultURLs := constant.DeletionWebhookURLs
+	constant.DeletionWebhookURLs = []string{"https://93.184.216.34/cleanup", "https://93.184.216.35/cleanup"}
+	defer func() { constant.DeletionWebhookURLs = defaultURLs }()
+
+	// the first endpoint never acknowledged within its attempts, the second is not tried
+	deletion := &recorder{deliverErr: errors.New("timed out")}
+	svc := NewService(&memoryRepo{}, &recorder{}, deletion, discard)
+	if err := svc.NotifyDeletion(1, true); err != constant.ErrDeletionNotAcknowledged {
+		t.Errorf("NotifyDeletion() error = %v, want %v", err, constant.ErrDeletionNotAcknowledged)
+	}
+	if len(deletion.delivered) != 1 || len(deletion.queued) != 0 {
+		t.Errorf("NotifyDeletion() delivered %d and queued %d, want to stop at the first endpoint", len(deletion.delivered), len(deletion.queued))
+	}
+
+	deletion = &recorder{}
+	svc = NewService(&memoryRepo{}, &recorder{}, deletion, discard)
+	if err := svc.NotifyDeletion(1, true); err != nil {
+		t.Errorf("NotifyDeletion() of acknowledging endpoints error = %v", err)
+	}
+	if len(deletion.delivered) != 2 {
+		t.Errorf("NotifyDeletion() delivered %d, want every endpoint", len(deletion.delivered))
+	}
+
+	// fire and forget only queues, a failure is not the caller's
+	deletion = &recorder{deliverErr: errors.New("timed out")}
+	svc = NewService(&memoryRepo{}, &recorder{}, deletion, discard)
+	if err := svc.NotifyDeletion(1, false); err != nil {
+		t.Errorf("NotifyDeletion() without ack error = %v", err)
+	}
+	if len(deletion.queued) != 2 || len(deletion.delivered) != 0 {
+		t.Errorf("NotifyDeletion() without ack queued %d and delivered %d, want every endpoint queued", len(deletion.queued), len(deletion.delivered))
+	}
+}